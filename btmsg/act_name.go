@@ -0,0 +1,58 @@
+package btmsg
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var ErrActRegistered = errors.New("act already registered")
+
+var actNames = struct {
+	lock  sync.RWMutex
+	names map[uint16]string
+}{
+	names: map[uint16]string{
+		ActPing:  "ping",
+		ActPong:  "pong",
+		ActError: "error",
+		ActChunk: "chunk",
+		ActRelay: "relay",
+		ActBatch: "batch",
+	},
+}
+
+// RegisterAct 给act起一个日志和统计里显示的名字，重复注册相同的名字没有影响，名字不同返回 ErrActRegistered
+func RegisterAct(act uint16, name string) error {
+	return RegisterActs(map[uint16]string{act: name})
+}
+
+// RegisterActs 一次注册整张act表，有一个冲突时都不注册
+func RegisterActs(acts map[uint16]string) error {
+	actNames.lock.Lock()
+	defer actNames.lock.Unlock()
+
+	for act, name := range acts {
+		if old, ok := actNames.names[act]; ok && old != name {
+			return errors.Wrapf(ErrActRegistered, "act %d is %q, got %q", act, old, name)
+		}
+	}
+
+	for act, name := range acts {
+		actNames.names[act] = name
+	}
+	return nil
+}
+
+// ActName 注册过的名字，没有注册时返回数字
+func ActName(act uint16) string {
+	actNames.lock.RLock()
+	name, ok := actNames.names[act]
+	actNames.lock.RUnlock()
+
+	if !ok {
+		return strconv.Itoa(int(act))
+	}
+	return name
+}
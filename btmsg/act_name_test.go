@@ -0,0 +1,52 @@
+package btmsg
+
+import (
+	"errors"
+	"testing"
+)
+
+// resetActNames 测试结束时恢复注册表，-count大于1时不会和上一次注册的冲突
+func resetActNames(t *testing.T) {
+	actNames.lock.RLock()
+	saved := make(map[uint16]string, len(actNames.names))
+	for act, name := range actNames.names {
+		saved[act] = name
+	}
+	actNames.lock.RUnlock()
+
+	t.Cleanup(func() {
+		actNames.lock.Lock()
+		actNames.names = saved
+		actNames.lock.Unlock()
+	})
+}
+
+func TestActName(t *testing.T) {
+	resetActNames(t)
+
+	if ActName(ActPing) != "ping" || ActName(60001) != "60001" {
+		t.Fatalf("%s %s", ActName(ActPing), ActName(60001))
+	}
+
+	err := RegisterActs(map[uint16]string{60001: "login", 60002: "logout"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ActName(60001) != "login" || ActName(60002) != "logout" {
+		t.Fatalf("%s %s", ActName(60001), ActName(60002))
+	}
+
+	// 相同的名字可以重复注册
+	if err = RegisterAct(60001, "login"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 有冲突时整张表都不注册
+	err = RegisterActs(map[uint16]string{60002: "bye", 60003: "kick"})
+	if !errors.Is(err, ErrActRegistered) {
+		t.Fatalf("expect ErrActRegistered, got %v", err)
+	}
+	if ActName(60002) != "logout" || ActName(60003) != "60003" {
+		t.Fatalf("%s %s", ActName(60002), ActName(60003))
+	}
+}
@@ -0,0 +1,158 @@
+package btmsg
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrBadBatch    = errors.New("bad batch")
+	ErrNestedBatch = errors.New("nested batch")
+)
+
+// Batch 把多个消息放在一个 ActBatch 消息里发送，省掉每个消息单独的写入
+// body是消息数量(4)，然后每个消息是帧长度(4)加上 ToSendByte 的帧，大端
+type Batch struct {
+	head IHead
+	n    uint32
+	body []byte
+}
+
+func NewBatch() *Batch {
+	return &Batch{body: make([]byte, 4)}
+}
+
+// Add 按顺序追加msg，返回msg编码之后的帧，和单独发送时写入的一样，msg是 ActBatch 时返回 ErrNestedBatch
+func (l *Batch) Add(msg IMsg) ([]byte, error) {
+	if msg.GetAct() == ActBatch {
+		return nil, ErrNestedBatch
+	}
+
+	if l.head == nil {
+		if m, ok := msg.(*Msg); ok {
+			l.head = newHeadLike(m.head)
+		}
+	}
+
+	frame := msg.ToSendByte()
+	l.body = binary.BigEndian.AppendUint32(l.body, uint32(len(frame)))
+	l.body = append(l.body, frame...)
+	l.n++
+	return frame, nil
+}
+
+// Len 已经Add的消息数量
+func (l *Batch) Len() int {
+	return int(l.n)
+}
+
+// Msg head和第一个消息同一个类型，没有消息或者不是 *Msg 时用 MsgHeadTcp，seq是0
+func (l *Batch) Msg() *Msg {
+	hd := l.head
+	if hd == nil {
+		hd = NewMsgHeadTcp()
+	} else {
+		hd = newHeadLike(hd)
+	}
+	hd.SetAct(ActBatch)
+
+	binary.BigEndian.PutUint32(l.body, l.n)
+	return NewMsg(hd, append([]byte(nil), l.body...))
+}
+
+// BatchReader 收到 ActBatch 时按顺序一个一个返回里面的消息，其他消息原样返回
+// 里面的消息用r解析，只支持二进制的head，一个连接一个，不能并发使用
+type BatchReader struct {
+	r       IMsgReader
+	pending []IMsg
+}
+
+func NewBatchReader(r IMsgReader) *BatchReader {
+	return &BatchReader{r: r}
+}
+
+// ReadMsg batch的格式不对或者里面还有batch时返回错误，之后的数据没法确定边界，和读错误一样处理
+func (l *BatchReader) ReadMsg(r IReader) IReadResult {
+	for len(l.pending) == 0 {
+		res := l.r.ReadMsg(r)
+		if res.GetErr() != nil {
+			return res
+		}
+
+		msg := res.GetMsg()
+		if msg.GetAct() != ActBatch {
+			return msgResult{msg}
+		}
+
+		msgs, err := l.explode(msg.BodyByte())
+		msg.Release()
+		if err != nil {
+			return NewReaderResult(err, nil, nil)
+		}
+		l.pending = msgs
+	}
+
+	msg := l.pending[0]
+	l.pending[0] = nil
+	l.pending = l.pending[1:]
+	return msgResult{msg}
+}
+
+func (l *BatchReader) explode(body []byte) ([]IMsg, error) {
+	if len(body) < 4 {
+		return nil, errors.Wrapf(ErrBadBatch, "body len %d", len(body))
+	}
+	n := binary.BigEndian.Uint32(body)
+	body = body[4:]
+
+	var msgs []IMsg
+	release := func() {
+		for _, v := range msgs {
+			v.Release()
+		}
+	}
+	for i := uint32(0); i < n; i++ {
+		if len(body) < 4 {
+			release()
+			return nil, errors.Wrapf(ErrBadBatch, "msg %d short length", i)
+		}
+		size := binary.BigEndian.Uint32(body)
+		body = body[4:]
+		if uint32(len(body)) < size {
+			release()
+			return nil, errors.Wrapf(ErrBadBatch, "msg %d want %d bytes, got %d", i, size, len(body))
+		}
+
+		res := l.r.ReadMsg(&bytesReader{bytes.NewReader(body[:size])})
+		body = body[size:]
+		if err := res.GetErr(); err != nil {
+			release()
+			return nil, errors.Wrapf(ErrBadBatch, "msg %d: %v", i, err)
+		}
+		msg := res.GetMsg()
+		msgs = append(msgs, msg)
+		if msg.GetAct() == ActBatch {
+			release()
+			return nil, errors.Wrapf(ErrNestedBatch, "msg %d", i)
+		}
+	}
+
+	if len(body) != 0 {
+		release()
+		return nil, errors.Wrapf(ErrBadBatch, "%d bytes after %d msgs", len(body), n)
+	}
+	return msgs, nil
+}
+
+// msgResult 已经取出来的msg，不用再GetMsg一次
+type msgResult struct {
+	msg IMsg
+}
+
+func (l msgResult) IsClose() bool         { return false }
+func (l msgResult) IsCloseByServer() bool { return false }
+func (l msgResult) IsCloseByClient() bool { return false }
+func (l msgResult) GetMsg() IMsg          { return l.msg }
+func (l msgResult) GetErr() error         { return nil }
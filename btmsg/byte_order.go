@@ -0,0 +1,65 @@
+package btmsg
+
+import (
+	"encoding/binary"
+)
+
+// defaultByteOrder MsgHeadTcp 和 MsgHeadTcpV2 默认使用网络字节序
+var defaultByteOrder binary.ByteOrder = binary.BigEndian
+
+// orderHead 用指定的字节序读写head，只能包装 MsgHeadTcp 这种按binary编码的固定长度head
+type orderHead struct {
+	IHead
+	order binary.ByteOrder
+}
+
+// FactoryWithByteOrder f创建的head按order读写，比如对接小端的设备协议
+// 两端要使用同一个字节序，不一致时body长度会解析错，见 MsgTooLargeError
+func FactoryWithByteOrder(f func() IHead, order binary.ByteOrder) func() IHead {
+	return func() IHead {
+		return &orderHead{IHead: f(), order: order}
+	}
+}
+
+// WithByteOrder reader按order解析head，等同于用 FactoryWithByteOrder 包装head工厂
+func WithByteOrder(order binary.ByteOrder) ReaderOption {
+	return func(l *Reader) {
+		l.order = order
+	}
+}
+
+// orderedHead 不能直接按binary读写的head自己处理字节序，比如 MsgHeadVersioned
+type orderedHead interface {
+	readWithOrder(r IReader, order binary.ByteOrder) (err error)
+	toBytesWithOrder(order binary.ByteOrder) []byte
+}
+
+func (l *orderHead) Read(r IReader) (err error) {
+	if hd, ok := l.IHead.(orderedHead); ok {
+		return hd.readWithOrder(r, l.order)
+	}
+	return readBinaryHead(r, l.HeadSize(), l.IHead, l.order)
+}
+
+func (l *orderHead) ToBytes() []byte {
+	if hd, ok := l.IHead.(orderedHead); ok {
+		return hd.toBytesWithOrder(l.order)
+	}
+	return writeBinaryHead(l.IHead, l.order)
+}
+
+func (l *orderHead) unwrap() IHead {
+	return l.IHead
+}
+
+func (l *orderHead) readBodyInto(r IReader, bt []byte) (err error) {
+	return readBodyVia(l.IHead, r, bt)
+}
+
+func (l *orderHead) newHead() IHead {
+	return &orderHead{IHead: newHeadLike(l.IHead), order: l.order}
+}
+
+func (l *orderHead) cloneHead() IHead {
+	return &orderHead{IHead: cloneHead(l.IHead), order: l.order}
+}
@@ -0,0 +1,75 @@
+package btmsg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestByteOrderGolden(t *testing.T) {
+	for _, c := range []struct {
+		order  binary.ByteOrder
+		expect string
+	}{
+		// act(2) seq(4) size(4) flags(1)
+		{binary.BigEndian, "0102" + "00000003" + "00000004" + "05"},
+		{binary.LittleEndian, "0201" + "03000000" + "04000000" + "05"},
+	} {
+		hd := FactoryWithByteOrder(FactoryMsgHeadTcpV2(), c.order)()
+		hd.SetAct(0x0102)
+		hd.SetSeq(3)
+		hd.SetSize(4)
+		hd.SetFlags(FlagCompressed | FlagAckRequired)
+
+		if got := hex.EncodeToString(hd.ToBytes()); got != c.expect {
+			t.Fatalf("%v %s", c.order, got)
+		}
+	}
+}
+
+func TestByteOrderRoundTrip(t *testing.T) {
+	f := FactoryWithByteOrder(FactoryMsgHeadTcpSeq(), binary.LittleEndian)
+	hd := f()
+	hd.SetAct(7)
+	hd.SetSeq(9)
+	msg := NewMsg(hd, []byte("little"))
+
+	for _, r := range []*Reader{
+		NewReader(FactoryMsgHeadTcpSeq(), WithByteOrder(binary.LittleEndian)),
+		NewReader(FactoryMsgHeadTcpSeq(), WithByteOrder(binary.LittleEndian), WithPooledMsg()),
+	} {
+		res := r.ReadMsg(&streamReader{bytes.NewReader(msg.ToSendByte())})
+		if res.GetErr() != nil {
+			t.Fatal(res.GetErr())
+		}
+		got := res.GetMsg()
+		if got.GetAct() != 7 || got.GetSeq() != 9 || string(got.BodyByte()) != "little" {
+			t.Fatalf("act %d seq %d body %q", got.GetAct(), got.GetSeq(), got.BodyByte())
+		}
+
+		// 回复和请求使用同一个字节序
+		rsp := NewReplyTo(got)
+		if !bytes.Equal(rsp.ToSendByte()[:2], []byte{7, 0}) {
+			t.Fatalf("reply head %x", rsp.ToSendByte())
+		}
+		got.Release()
+	}
+}
+
+func TestByteOrderMismatch(t *testing.T) {
+	hd := NewMsgHeadTcp()
+	hd.SetAct(1)
+	frame := NewMsg(hd, []byte("big endian body")).ToSendByte()
+
+	res := NewReader(FactoryMsgHeadTcp(), WithByteOrder(binary.LittleEndian), WithMaxBodySize(1024)).
+		ReadMsg(&streamReader{bytes.NewReader(frame)})
+	if !errors.Is(res.GetErr(), ErrMsgTooLarge) {
+		t.Fatalf("expect ErrMsgTooLarge, got %v", res.GetErr())
+	}
+	if !strings.Contains(res.GetErr().Error(), "byte order mismatch") {
+		t.Fatalf("err %v", res.GetErr())
+	}
+}
@@ -0,0 +1,230 @@
+package btmsg
+
+import (
+	"encoding/binary"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrBadChunk      = errors.New("bad chunk")
+	ErrChunkOrder    = errors.New("chunk out of order")
+	ErrChunkTooLarge = errors.New("chunked msg too large")
+	ErrChunkTimeout  = errors.New("chunk timeout")
+	ErrChunkStreams  = errors.New("too many chunk streams")
+)
+
+// chunkHeadSize 分片body前面的 streamId(4) index(4) final(1) act(2)，大端
+const chunkHeadSize = 11
+
+// maxChunkStreams 一个连接上同时在传的大消息数量上限
+const maxChunkStreams = 1024
+
+var lastStreamId uint32
+
+func nextStreamId() uint32 {
+	for {
+		id := atomic.AddUint32(&lastStreamId, 1)
+		if id != 0 {
+			return id
+		}
+	}
+}
+
+// SplitChunks 把msg的body按chunkSize拆成多个 ActChunk 消息，head和msg同一个类型，seq和msg一样
+// 按顺序发送，接收方用 ChunkAssembler 还原
+func SplitChunks(msg IMsg, chunkSize int) []*Msg {
+	if chunkSize <= 0 {
+		chunkSize = 1
+	}
+
+	var body = msg.BodyByte()
+	var id = nextStreamId()
+	var n = (len(body) + chunkSize - 1) / chunkSize
+	if n == 0 {
+		n = 1
+	}
+
+	var chunks = make([]*Msg, 0, n)
+	for i := 0; i < n; i++ {
+		end := (i + 1) * chunkSize
+		if end > len(body) {
+			end = len(body)
+		}
+		part := body[i*chunkSize : end]
+
+		bt := make([]byte, chunkHeadSize+len(part))
+		binary.BigEndian.PutUint32(bt, id)
+		binary.BigEndian.PutUint32(bt[4:], uint32(i))
+		if i == n-1 {
+			bt[8] = 1
+		}
+		binary.BigEndian.PutUint16(bt[9:], msg.GetAct())
+		copy(bt[chunkHeadSize:], part)
+
+		chunk := NewReplyTo(msg)
+		chunk.SetAct(ActChunk)
+		chunk.bodyBt = bt
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
+
+type chunkStream struct {
+	act  uint16
+	seq  uint32
+	next uint32
+	size int
+	last time.Time
+	buf  []byte
+	w    *io.PipeWriter
+}
+
+// ChunkAssembler 把 SplitChunks 拆出来的分片还原成一个消息，一个连接一个，不能并发使用
+// 同一个连接上分片是按顺序到达的，不同大消息的分片可以交错
+type ChunkAssembler struct {
+	maxSize  int
+	timeout  time.Duration
+	streams  map[uint32]*chunkStream
+	onStream func(act uint16, seq uint32, r io.Reader)
+}
+
+// NewChunkAssembler maxSize 一个大消息的body上限，timeout 超过这么久没有收到下一个分片就丢弃，0表示不限制
+func NewChunkAssembler(maxSize int, timeout time.Duration) *ChunkAssembler {
+	return &ChunkAssembler{
+		maxSize: maxSize,
+		timeout: timeout,
+		streams: map[uint32]*chunkStream{},
+	}
+}
+
+// OnStream 收到第一个分片时在新的goroutine里调用f，r按顺序读到body，不再拼成完整的消息
+// 读完最后一个分片r返回io.EOF，出错或者超时返回对应的错误
+// f读得慢会挡住Feed，也就挡住了连接的读取
+func (l *ChunkAssembler) OnStream(f func(act uint16, seq uint32, r io.Reader)) {
+	l.onStream = f
+}
+
+// Feed 不是分片的消息原样返回，分片没收齐返回nil，收齐之后返回还原的消息
+// 返回error时这个大消息已经丢弃，连接可以继续使用
+func (l *ChunkAssembler) Feed(msg IMsg, now time.Time) (IMsg, error) {
+	if msg.GetAct() != ActChunk {
+		return msg, nil
+	}
+
+	l.Expire(now)
+
+	body := msg.BodyByte()
+	if len(body) < chunkHeadSize {
+		return nil, errors.Wrapf(ErrBadChunk, "body len %d", len(body))
+	}
+
+	id := binary.BigEndian.Uint32(body)
+	index := binary.BigEndian.Uint32(body[4:])
+	final := body[8] == 1
+	part := body[chunkHeadSize:]
+
+	st, ok := l.streams[id]
+	if !ok {
+		if index != 0 {
+			return nil, errors.Wrapf(ErrChunkOrder, "stream %d starts at chunk %d", id, index)
+		}
+		if len(l.streams) >= maxChunkStreams {
+			return nil, errors.Wrapf(ErrChunkStreams, "stream %d", id)
+		}
+
+		st = &chunkStream{
+			act: binary.BigEndian.Uint16(body[9:]),
+			seq: msg.GetSeq(),
+		}
+		if l.onStream != nil {
+			pr, pw := io.Pipe()
+			st.w = pw
+			go l.onStream(st.act, st.seq, pr)
+		}
+		l.streams[id] = st
+	}
+
+	if index != st.next {
+		err := errors.Wrapf(ErrChunkOrder, "stream %d expect chunk %d, got %d", id, st.next, index)
+		l.abort(id, err)
+		return nil, err
+	}
+
+	st.next++
+	st.last = now
+	st.size += len(part)
+	if l.maxSize > 0 && st.size > l.maxSize {
+		err := errors.Wrapf(ErrChunkTooLarge, "stream %d over %d bytes", id, l.maxSize)
+		l.abort(id, err)
+		return nil, err
+	}
+
+	if st.w != nil {
+		// 读的一方提前关闭时剩下的分片直接丢掉
+		_, _ = st.w.Write(part)
+	} else {
+		st.buf = append(st.buf, part...)
+	}
+
+	if !final {
+		return nil, nil
+	}
+
+	delete(l.streams, id)
+	if st.w != nil {
+		_ = st.w.Close()
+		return nil, nil
+	}
+
+	full := NewReplyTo(msg)
+	full.SetAct(st.act)
+	full.SetSeq(st.seq)
+	full.bodyBt = st.buf
+	return full, nil
+}
+
+// Expire 丢弃超过timeout没有收到下一个分片的大消息，返回丢弃的数量，Feed的时候也会检查
+func (l *ChunkAssembler) Expire(now time.Time) int {
+	if l.timeout <= 0 {
+		return 0
+	}
+
+	var n int
+	for id, st := range l.streams {
+		if now.Sub(st.last) > l.timeout {
+			l.abort(id, errors.Wrapf(ErrChunkTimeout, "stream %d idle %v", id, now.Sub(st.last)))
+			n++
+		}
+	}
+
+	return n
+}
+
+// Pending 还没收齐的大消息数量
+func (l *ChunkAssembler) Pending() int {
+	return len(l.streams)
+}
+
+// Close 连接断开时调用，丢弃所有没收齐的大消息
+func (l *ChunkAssembler) Close() {
+	for id := range l.streams {
+		l.abort(id, io.ErrUnexpectedEOF)
+	}
+}
+
+func (l *ChunkAssembler) abort(id uint32, err error) {
+	st, ok := l.streams[id]
+	if !ok {
+		return
+	}
+
+	delete(l.streams, id)
+	if st.w != nil {
+		_ = st.w.CloseWithError(err)
+	}
+}
@@ -0,0 +1,143 @@
+package btmsg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func chunkMsg(act uint16, body []byte) *Msg {
+	return seqMsg(act, uint32(act)*10, body)
+}
+
+func TestChunkInterleave(t *testing.T) {
+	a := bytes.Repeat([]byte("a"), 100)
+	b := bytes.Repeat([]byte("b"), 35)
+	ca := SplitChunks(chunkMsg(1, a), 30)
+	cb := SplitChunks(chunkMsg(2, b), 30)
+	if len(ca) != 4 || len(cb) != 2 {
+		t.Fatalf("chunks %d %d", len(ca), len(cb))
+	}
+
+	as := NewChunkAssembler(1024, time.Second)
+	now := time.Now()
+
+	// 普通消息原样返回
+	plain := chunkMsg(3, []byte("plain"))
+	if got, err := as.Feed(plain, now); err != nil || got != plain {
+		t.Fatalf("plain %v %v", got, err)
+	}
+
+	var done []IMsg
+	for _, c := range []*Msg{ca[0], cb[0], ca[1], ca[2], cb[1], ca[3]} {
+		// 分片经过一次编解码
+		res := NewReader(FactoryMsgHeadTcpSeq()).ReadMsg(&streamReader{bytes.NewReader(c.ToSendByte())})
+		if res.GetErr() != nil {
+			t.Fatal(res.GetErr())
+		}
+		got, err := as.Feed(res.GetMsg(), now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != nil {
+			done = append(done, got)
+		}
+	}
+
+	if len(done) != 2 || as.Pending() != 0 {
+		t.Fatalf("done %d pending %d", len(done), as.Pending())
+	}
+	if done[0].GetAct() != 2 || done[0].GetSeq() != 20 || !bytes.Equal(done[0].BodyByte(), b) {
+		t.Fatalf("b act %d seq %d len %d", done[0].GetAct(), done[0].GetSeq(), len(done[0].BodyByte()))
+	}
+	if done[1].GetAct() != 1 || !bytes.Equal(done[1].BodyByte(), a) {
+		t.Fatalf("a act %d len %d", done[1].GetAct(), len(done[1].BodyByte()))
+	}
+}
+
+func TestChunkTimeout(t *testing.T) {
+	chunks := SplitChunks(chunkMsg(1, bytes.Repeat([]byte("x"), 50)), 20)
+	as := NewChunkAssembler(0, time.Second)
+	now := time.Now()
+
+	_, _ = as.Feed(chunks[0], now)
+	if n := as.Expire(now.Add(time.Millisecond * 500)); n != 0 {
+		t.Fatalf("expired %d", n)
+	}
+
+	// 最后一个分片一直没来，下一次Feed的时候丢弃，后面的分片找不到开头
+	_, err := as.Feed(chunks[1], now.Add(time.Second*2))
+	if !errors.Is(err, ErrChunkOrder) || as.Pending() != 0 {
+		t.Fatalf("got %v pending %d", err, as.Pending())
+	}
+}
+
+func TestChunkLimits(t *testing.T) {
+	chunks := SplitChunks(chunkMsg(1, bytes.Repeat([]byte("x"), 50)), 20)
+	as := NewChunkAssembler(30, 0)
+	now := time.Now()
+
+	_, _ = as.Feed(chunks[0], now)
+	_, err := as.Feed(chunks[1], now)
+	if !errors.Is(err, ErrChunkTooLarge) || as.Pending() != 0 {
+		t.Fatalf("got %v", err)
+	}
+
+	as = NewChunkAssembler(0, 0)
+	_, _ = as.Feed(chunks[0], now)
+	_, err = as.Feed(chunks[2], now)
+	if !errors.Is(err, ErrChunkOrder) {
+		t.Fatalf("got %v", err)
+	}
+
+	_, err = as.Feed(NewMsg(NewMsgHeadTcp(), []byte{1}), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad := chunkMsg(ActChunk, []byte{1, 2})
+	_, err = as.Feed(bad, now)
+	if !errors.Is(err, ErrBadChunk) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestChunkStream(t *testing.T) {
+	body := bytes.Repeat([]byte("0123456789"), 100)
+	chunks := SplitChunks(chunkMsg(5, body), 64)
+
+	as := NewChunkAssembler(0, time.Second)
+	type result struct {
+		act uint16
+		bt  []byte
+		err error
+	}
+	var got = make(chan result, 2)
+	as.OnStream(func(act uint16, seq uint32, r io.Reader) {
+		bt, err := io.ReadAll(r)
+		got <- result{act, bt, err}
+	})
+
+	now := time.Now()
+	for _, c := range chunks {
+		msg, err := as.Feed(c, now)
+		if err != nil || msg != nil {
+			t.Fatalf("got %v %v", msg, err)
+		}
+	}
+
+	res := <-got
+	if res.err != nil || res.act != 5 || !bytes.Equal(res.bt, body) {
+		t.Fatalf("act %d len %d err %v", res.act, len(res.bt), res.err)
+	}
+
+	// 超时的stream读到错误
+	chunks = SplitChunks(chunkMsg(6, body), 64)
+	_, _ = as.Feed(chunks[0], now)
+	as.Expire(now.Add(time.Second * 2))
+	res = <-got
+	if !errors.Is(res.err, ErrChunkTimeout) {
+		t.Fatalf("got %v", res.err)
+	}
+}
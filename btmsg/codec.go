@@ -0,0 +1,48 @@
+package btmsg
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// Codec body的编码方式，ID用来区分不同的编码
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(bt []byte, v any) error
+	ID() byte
+}
+
+const (
+	CodecIdJson     byte = 1
+	CodecIdProtobuf byte = 2
+	CodecIdMsgpack  byte = 3
+	CodecIdGob      byte = 4
+	CodecIdRaw      byte = 5
+)
+
+// DefaultCodec 没有指定codec时使用
+var DefaultCodec Codec = JsonCodec{}
+
+// JsonCodec 标准库json，字段名和encoding/json一致，方便其他语言对接
+type JsonCodec struct{}
+
+func (JsonCodec) Marshal(v any) ([]byte, error) {
+	bt, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "json marshal")
+	}
+	return bt, nil
+}
+
+func (JsonCodec) Unmarshal(bt []byte, v any) error {
+	err := json.Unmarshal(bt, v)
+	if err != nil {
+		return errors.Wrap(err, "json unmarshal")
+	}
+	return nil
+}
+
+func (JsonCodec) ID() byte {
+	return CodecIdJson
+}
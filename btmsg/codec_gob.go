@@ -0,0 +1,59 @@
+package btmsg
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/pkg/errors"
+)
+
+// GobCodec 只适合两端都是go的情况
+// gob是有状态的流，这里每条消息都用新的encoder/decoder，类型信息会跟着每条消息发送，
+// 消息之间互不依赖，丢消息或者重连都不影响后面的解码，代价是小消息比json慢很多，见 BenchmarkGobCodec
+type GobCodec struct{}
+
+func (GobCodec) Marshal(v any) (bt []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("gob marshal %T: %v", v, r)
+		}
+	}()
+
+	var buf bytes.Buffer
+	err = gob.NewEncoder(&buf).Encode(v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "gob marshal %T", v)
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(bt []byte, v any) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("gob unmarshal %T: %v", v, r)
+		}
+	}()
+
+	err = gob.NewDecoder(bytes.NewReader(bt)).Decode(v)
+	if err != nil {
+		return errors.Wrapf(err, "gob unmarshal %T", v)
+	}
+	return nil
+}
+
+func (GobCodec) ID() byte {
+	return CodecIdGob
+}
+
+// RegisterGob 和gob.Register一样，interface字段里放的具体类型要先注册
+// 名字冲突时gob.Register会panic，这里返回error
+func RegisterGob(v any) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("gob register: %v", r)
+		}
+	}()
+
+	gob.Register(v)
+	return nil
+}
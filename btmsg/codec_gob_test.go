@@ -0,0 +1,90 @@
+package btmsg
+
+import (
+	"testing"
+)
+
+type gobShape interface {
+	Area() int
+}
+
+type gobSquare struct {
+	Side int
+}
+
+func (l gobSquare) Area() int {
+	return l.Side * l.Side
+}
+
+type gobCircle struct {
+	R int
+}
+
+func (l gobCircle) Area() int {
+	return 3 * l.R * l.R
+}
+
+type gobReq struct {
+	Name  string
+	Shape gobShape
+}
+
+func TestGobCodec(t *testing.T) {
+	if err := RegisterGob(gobSquare{}); err != nil {
+		t.Fatal(err)
+	}
+
+	hd := NewMsgHeadTcp()
+	hd.SetAct(1)
+	msg := NewMsgWithCodec(hd, nil, GobCodec{})
+
+	err := msg.FromStruct(&gobReq{Name: "a", Shape: gobSquare{Side: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got gobReq
+	_, err = msg.ToStruct(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "a" || got.Shape.Area() != 9 {
+		t.Fatalf("got %+v", got)
+	}
+
+	// 没注册的类型返回错误，不会panic
+	err = msg.FromStruct(&gobReq{Shape: gobCircle{R: 1}})
+	if err == nil {
+		t.Fatal("expect unregistered type err")
+	}
+
+	err = msg.FromStruct(&struct{ F func() }{F: func() {}})
+	if err == nil {
+		t.Fatal("expect func field err")
+	}
+
+	// 同一个名字注册不同的类型
+	type gobSquare struct{ X int }
+	if err = RegisterGob(gobSquare{}); err == nil {
+		t.Fatal("expect duplicate register err")
+	}
+}
+
+func BenchmarkGobCodec(b *testing.B) {
+	v := &codecUser{Name: "tom", Age: 18}
+
+	b.Run("gob", func(b *testing.B) {
+		var c GobCodec
+		for i := 0; i < b.N; i++ {
+			bt, _ := c.Marshal(v)
+			_ = c.Unmarshal(bt, &codecUser{})
+		}
+	})
+	b.Run("json", func(b *testing.B) {
+		var c JsonCodec
+		for i := 0; i < b.N; i++ {
+			bt, _ := c.Marshal(v)
+			_ = c.Unmarshal(bt, &codecUser{})
+		}
+	})
+}
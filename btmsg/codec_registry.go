@@ -0,0 +1,94 @@
+package btmsg
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// ActCodec 按act选择codec，Msg编解码时会先调用ForAct
+type ActCodec interface {
+	Codec
+	ForAct(act uint16) Codec
+}
+
+var _ ActCodec = (*CodecRegistry)(nil)
+
+// CodecRegistry 不同的act使用不同的codec，没有注册的act用默认codec
+// 查找不加锁，注册时复制一份新的map，最好在Start之前注册完
+type CodecRegistry struct {
+	def  Codec
+	lock sync.Mutex
+	acts atomic.Value
+}
+
+// NewCodecRegistry def为nil时使用 DefaultCodec
+func NewCodecRegistry(def Codec) *CodecRegistry {
+	if def == nil {
+		def = DefaultCodec
+	}
+
+	l := &CodecRegistry{def: def}
+	l.acts.Store(map[uint16]Codec{})
+	return l
+}
+
+func (l *CodecRegistry) RegisterCodec(act uint16, c Codec) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	old := l.acts.Load().(map[uint16]Codec)
+	acts := make(map[uint16]Codec, len(old)+1)
+	for k, v := range old {
+		acts[k] = v
+	}
+	acts[act] = c
+	l.acts.Store(acts)
+}
+
+func (l *CodecRegistry) ForAct(act uint16) Codec {
+	if c, ok := l.acts.Load().(map[uint16]Codec)[act]; ok {
+		return c
+	}
+	return l.def
+}
+
+// Marshal 不知道act时用默认codec
+func (l *CodecRegistry) Marshal(v any) ([]byte, error) {
+	return l.def.Marshal(v)
+}
+
+func (l *CodecRegistry) Unmarshal(bt []byte, v any) error {
+	return l.def.Unmarshal(bt, v)
+}
+
+func (l *CodecRegistry) ID() byte {
+	return l.def.ID()
+}
+
+// RawCodec body就是[]byte本身，不做任何编码，适合文件分片这种二进制数据
+type RawCodec struct{}
+
+func (RawCodec) Marshal(v any) ([]byte, error) {
+	switch bt := v.(type) {
+	case []byte:
+		return bt, nil
+	case *[]byte:
+		return *bt, nil
+	}
+	return nil, errors.Errorf("raw codec marshal %T, expect []byte", v)
+}
+
+func (RawCodec) Unmarshal(bt []byte, v any) error {
+	p, ok := v.(*[]byte)
+	if !ok {
+		return errors.Errorf("raw codec unmarshal %T, expect *[]byte", v)
+	}
+	*p = bt
+	return nil
+}
+
+func (RawCodec) ID() byte {
+	return CodecIdRaw
+}
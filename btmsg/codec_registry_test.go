@@ -0,0 +1,43 @@
+package btmsg
+
+import (
+	"testing"
+)
+
+func TestCodecRegistry(t *testing.T) {
+	r := NewCodecRegistry(nil)
+	r.RegisterCodec(5, RawCodec{})
+
+	hd := NewMsgHeadTcp()
+	hd.SetAct(5)
+	msg := NewMsgWithCodec(hd, nil, r)
+	err := msg.FromStruct([]byte{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg.BodyByte()) != "\x01\x02\x03" {
+		t.Fatalf("raw body %v", msg.BodyByte())
+	}
+
+	var raw []byte
+	_, err = msg.ToStruct(&raw)
+	if err != nil || len(raw) != 3 {
+		t.Fatalf("raw %v err %v", raw, err)
+	}
+
+	// 没注册的act用默认的json
+	msg.SetAct(1)
+	err = msg.FromStruct(&codecUser{Name: "tom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg.BodyByte()) != `{"name":"tom","age":0}` {
+		t.Fatalf("json body %s", msg.BodyByte())
+	}
+
+	var u codecUser
+	_, err = msg.ToStruct(&u)
+	if err != nil || u.Name != "tom" {
+		t.Fatalf("got %+v err %v", u, err)
+	}
+}
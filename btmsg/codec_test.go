@@ -0,0 +1,65 @@
+package btmsg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// streamReader tcp连接那样按字节流读取
+type streamReader struct {
+	*bytes.Reader
+}
+
+func (l *streamReader) ReadMessage() (messageType int, p []byte, err error) {
+	panic("stream reader has no message")
+}
+
+type codecUser struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+// TestJsonCodecWire 其他语言的客户端按这里的字节实现，不能随便改
+func TestJsonCodecWire(t *testing.T) {
+	hd := NewMsgHeadTcp()
+	hd.SetAct(1)
+
+	msg := NewMsgWithCodec(hd, nil, JsonCodec{})
+	err := msg.FromStruct(&codecUser{Name: "tom", Age: 18})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// act(2) size(4) 大端，后面是json body
+	expect := "0001" + "00000017" + hex.EncodeToString([]byte(`{"name":"tom","age":18}`))
+	if got := hex.EncodeToString(msg.ToSendByte()); got != expect {
+		t.Fatalf("wire %s, expect %s", got, expect)
+	}
+
+	// 默认的NewMsg也是json
+	plain := NewMsg(hd, nil)
+	_ = plain.FromStruct(&codecUser{Name: "tom", Age: 18})
+	if !bytes.Equal(plain.BodyByte(), msg.BodyByte()) {
+		t.Fatalf("default body %s", plain.BodyByte())
+	}
+}
+
+func TestReaderWithCodec(t *testing.T) {
+	hd := NewMsgHeadTcp()
+	hd.SetAct(1)
+	msg := NewMsg(hd, nil)
+	_ = msg.FromStruct(&codecUser{Name: "tom"})
+
+	r := NewReaderWithCodec(FactoryMsgHeadTcp(), JsonCodec{})
+	res := r.ReadMsg(&streamReader{bytes.NewReader(msg.ToSendByte())})
+	if res.GetErr() != nil {
+		t.Fatal(res.GetErr())
+	}
+
+	var u codecUser
+	_, err := res.GetMsg().ToStruct(&u)
+	if err != nil || u.Name != "tom" {
+		t.Fatalf("got %+v err %v", u, err)
+	}
+}
@@ -0,0 +1,149 @@
+package btmsg
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+var ErrBadCompressed = errors.New("bad compressed body")
+
+// defaultMaxDecompressed WithDecompressor 和 WithMaxBodySize 都没有限制时解压之后的最大长度
+const defaultMaxDecompressed = 16 << 20
+
+// compressedPrefix 压缩的body前面4个字节放压缩前的长度，大端
+const compressedPrefix = 4
+
+type Compressor interface {
+	Compress(bt []byte) ([]byte, error)
+	// Decompress size是压缩前的长度，可以一次分配
+	Decompress(bt []byte, size uint32) ([]byte, error)
+}
+
+// FlateCompressor 标准库的deflate
+type FlateCompressor struct {
+	Level int
+}
+
+var DefaultCompressor Compressor = FlateCompressor{Level: flate.DefaultCompression}
+
+func (l FlateCompressor) Compress(bt []byte) ([]byte, error) {
+	var bf bytes.Buffer
+	w, err := flate.NewWriter(&bf, l.Level)
+	if err != nil {
+		return nil, errors.Wrap(err, "flate writer")
+	}
+
+	_, err = w.Write(bt)
+	if err != nil {
+		return nil, errors.Wrap(err, "flate write")
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "flate close")
+	}
+
+	return bf.Bytes(), nil
+}
+
+func (l FlateCompressor) Decompress(bt []byte, size uint32) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(bt))
+	defer r.Close()
+
+	var out = make([]byte, size)
+	_, err := io.ReadFull(r, out)
+	if err != nil {
+		return nil, errors.Wrap(ErrBadCompressed, err.Error())
+	}
+
+	// 实际数据比声明的长
+	n, _ := r.Read(make([]byte, 1))
+	if n > 0 {
+		return nil, errors.Wrapf(ErrBadCompressed, "longer than %d", size)
+	}
+
+	return out, nil
+}
+
+// WithDecompressor 收到带 FlagCompressed 的消息时用c解压，解压之后去掉这个flag
+// max 解压之后的最大长度，0表示和 WithMaxBodySize 一样，都是0时为16M
+func WithDecompressor(c Compressor, max uint32) ReaderOption {
+	return func(l *Reader) {
+		l.decompressor = c
+		l.maxDecompressed = max
+	}
+}
+
+// ToSendByteCompress 和ToSendByte一样，body超过threshold并且压缩之后变小时用c压缩，msg本身不变
+// saved是节省的字节数，没有压缩时为0，head不能带flags时不压缩，比如 MsgHeadTcp
+func (l *Msg) ToSendByteCompress(c Compressor, threshold int) (bt []byte, saved int, err error) {
+	l.checkLive()
+	if len(l.bodyBt) <= threshold || l.HasFlag(FlagCompressed) {
+		return l.ToSendByte(), 0, nil
+	}
+
+	flags := l.head.GetFlags()
+	l.head.SetFlags(flags | FlagCompressed)
+	defer func() {
+		l.head.SetFlags(flags)
+		l.head.SetSize(l.wireSize(len(l.bodyBt)))
+	}()
+	if !l.HasFlag(FlagCompressed) {
+		return l.ToSendByte(), 0, nil
+	}
+
+	z, err := c.Compress(l.bodyBt)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "compress body")
+	}
+
+	saved = len(l.bodyBt) - len(z) - compressedPrefix
+	if saved <= 0 {
+		l.head.SetFlags(flags)
+		return l.ToSendByte(), 0, nil
+	}
+
+	l.stamp()
+	l.head.SetSize(l.wireSize(len(z) + compressedPrefix))
+	bt = l.head.ToBytes()
+	bt = l.appendTraceID(bt)
+	bt = binary.BigEndian.AppendUint32(bt, uint32(len(l.bodyBt)))
+	bt = append(bt, z...)
+
+	return bt, saved, nil
+}
+
+// decompress 带 FlagCompressed 并且设置了 WithDecompressor 时解压body
+func (l *Reader) decompress(head IHead, body []byte) ([]byte, error) {
+	if l.decompressor == nil || head.GetFlags()&FlagCompressed == 0 {
+		return body, nil
+	}
+
+	if len(body) < compressedPrefix {
+		return nil, errors.Wrapf(ErrBadCompressed, "body len %d", len(body))
+	}
+
+	size := binary.BigEndian.Uint32(body)
+	max := l.maxDecompressed
+	if max == 0 {
+		max = l.maxBodySize
+	}
+	if max == 0 {
+		max = defaultMaxDecompressed
+	}
+	if size > max {
+		return nil, errors.Wrapf(ErrMsgTooLarge, "decompressed size %d, max %d", size, max)
+	}
+
+	out, err := l.decompressor.Decompress(body[compressedPrefix:], size)
+	if err != nil {
+		return nil, err
+	}
+
+	head.SetFlags(head.GetFlags() &^ FlagCompressed)
+	return out, nil
+}
@@ -0,0 +1,87 @@
+package btmsg
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	body := bytes.Repeat([]byte("compress me "), 100)
+	hd := NewMsgHeadTcpV2()
+	hd.SetAct(1)
+	msg := NewMsg(hd, body)
+
+	frame, saved, err := msg.ToSendByteCompress(DefaultCompressor, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved <= 0 || len(frame) >= len(body) {
+		t.Fatalf("saved %d frame %d", saved, len(frame))
+	}
+	// msg本身不变
+	if msg.HasFlag(FlagCompressed) || msg.BodySize() != uint32(len(body)) {
+		t.Fatalf("msg changed: flags %08b size %d", msg.GetFlags(), msg.BodySize())
+	}
+
+	for _, r := range []*Reader{
+		NewReader(FactoryMsgHeadTcpV2(), WithDecompressor(DefaultCompressor, 0)),
+		NewReader(FactoryMsgHeadTcpV2(), WithDecompressor(DefaultCompressor, 0), WithPooledMsg()),
+	} {
+		res := r.ReadMsg(&streamReader{bytes.NewReader(frame)})
+		if res.GetErr() != nil {
+			t.Fatal(res.GetErr())
+		}
+		got := res.GetMsg()
+		if !bytes.Equal(got.BodyByte(), body) || got.HasFlag(FlagCompressed) {
+			t.Fatalf("flags %08b body %d", got.GetFlags(), len(got.BodyByte()))
+		}
+		got.Release()
+	}
+
+	msgs, err := NewFrameDecoder(FactoryMsgHeadTcpV2(), WithDecompressor(DefaultCompressor, 0)).Feed(frame)
+	if err != nil || len(msgs) != 1 || !bytes.Equal(msgs[0].BodyByte(), body) {
+		t.Fatalf("decoder %d msgs err %v", len(msgs), err)
+	}
+}
+
+func TestCompressSkip(t *testing.T) {
+	// 太短
+	hd := NewMsgHeadTcpV2()
+	msg := NewMsg(hd, []byte("short"))
+	_, saved, _ := msg.ToSendByteCompress(DefaultCompressor, 64)
+	if saved != 0 {
+		t.Fatalf("short saved %d", saved)
+	}
+
+	// 压缩之后没有变小
+	random := make([]byte, 256)
+	for i := range random {
+		random[i] = byte(i*7919 + i*i*31)
+	}
+	msg = NewMsg(NewMsgHeadTcpV2(), random)
+	frame, saved, _ := msg.ToSendByteCompress(DefaultCompressor, 64)
+	if saved != 0 || !bytes.Equal(frame, msg.ToSendByte()) {
+		t.Fatalf("incompressible saved %d", saved)
+	}
+
+	// MsgHeadTcp 不能带flags
+	msg = NewMsg(NewMsgHeadTcp(), bytes.Repeat([]byte("a"), 1024))
+	_, saved, _ = msg.ToSendByteCompress(DefaultCompressor, 64)
+	if saved != 0 {
+		t.Fatalf("v1 head saved %d", saved)
+	}
+}
+
+func TestDecompressTooLarge(t *testing.T) {
+	body := bytes.Repeat([]byte("a"), 4096)
+	frame, _, err := NewMsg(NewMsgHeadTcpV2(), body).ToSendByteCompress(DefaultCompressor, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := NewReader(FactoryMsgHeadTcpV2(), WithDecompressor(DefaultCompressor, 1024)).ReadMsg(&streamReader{bytes.NewReader(frame)})
+	if !errors.Is(res.GetErr(), ErrMsgTooLarge) {
+		t.Fatalf("expect ErrMsgTooLarge, got %v", res.GetErr())
+	}
+}
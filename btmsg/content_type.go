@@ -0,0 +1,79 @@
+package btmsg
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// flags的高4位是content type，值是 Codec.ID，0表示没有指定
+const contentTypeShift = 4
+
+var ErrUnknownContentType = errors.New("unknown content type")
+
+// UnknownContentTypeError flags里的content type没有对应的codec，errors.Is(err, ErrUnknownContentType) 为true
+type UnknownContentTypeError struct {
+	ID byte
+}
+
+func (l *UnknownContentTypeError) Error() string {
+	return fmt.Sprintf("unknown content type %d", l.ID)
+}
+
+func (l *UnknownContentTypeError) Is(target error) bool {
+	return target == ErrUnknownContentType
+}
+
+var contentTypes = struct {
+	lock   sync.RWMutex
+	codecs map[byte]Codec
+}{
+	codecs: map[byte]Codec{
+		CodecIdJson: JsonCodec{},
+		CodecIdGob:  GobCodec{},
+		CodecIdRaw:  RawCodec{},
+	},
+}
+
+// RegisterContentType 收到content type为c.ID()的消息时用c解码，pbcodec和msgpackcodec导入时自动注册
+// ID只能是1到15，放在flags的高4位
+func RegisterContentType(c Codec) {
+	id := c.ID()
+	if id == 0 || id > FlagCodecMask>>contentTypeShift {
+		panic(fmt.Sprintf("btmsg: content type %d out of range", id))
+	}
+
+	contentTypes.lock.Lock()
+	defer contentTypes.lock.Unlock()
+
+	contentTypes.codecs[id] = c
+}
+
+// GetContentType flags里的content type，0表示没有指定，head没有flags时总是0
+func (l *Msg) GetContentType() byte {
+	return l.GetFlags() >> contentTypeShift
+}
+
+func (l *Msg) setContentType(id byte) {
+	l.SetFlags(l.GetFlags()&^FlagCodecMask | id<<contentTypeShift)
+}
+
+// contentCodec 按content type选择codec，没有指定时用消息自己的codec
+// 只有设置了codec的消息使用content type，MsgHeadWs这种自己编码body的head不受影响
+func (l *Msg) contentCodec() (Codec, error) {
+	c := l.actCodec()
+	id := l.GetContentType()
+	if id == 0 || c.ID() == id {
+		return c, nil
+	}
+
+	contentTypes.lock.RLock()
+	c, ok := contentTypes.codecs[id]
+	contentTypes.lock.RUnlock()
+	if !ok {
+		return nil, &UnknownContentTypeError{ID: id}
+	}
+
+	return c, nil
+}
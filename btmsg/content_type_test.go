@@ -0,0 +1,47 @@
+package btmsg
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestContentType(t *testing.T) {
+	// 发送方用gob，接收方默认json，按content type解码
+	hd := NewMsgHeadTcpV2()
+	hd.SetAct(1)
+	req := NewMsgWithCodec(hd, nil, GobCodec{})
+	err := req.FromStruct(&codecUser{Name: "tom", Age: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.GetContentType() != CodecIdGob {
+		t.Fatalf("content type %d", req.GetContentType())
+	}
+
+	r := NewReaderWithCodec(FactoryMsgHeadTcpV2(), JsonCodec{})
+	res := r.ReadMsg(&streamReader{bytes.NewReader(req.ToSendByte())})
+	u, err := ToStructT[codecUser](res.GetMsg())
+	if err != nil || u.Name != "tom" {
+		t.Fatalf("got %+v err %v", u, err)
+	}
+
+	// 回复也用请求的编码
+	rsp, err := ReplyTo(res.GetMsg(), &codecUser{Name: "jerry"})
+	if err != nil || rsp.GetContentType() != CodecIdGob {
+		t.Fatalf("reply content type %d err %v", rsp.GetContentType(), err)
+	}
+	var gu codecUser
+	if err = (GobCodec{}).Unmarshal(rsp.GetBody(), &gu); err != nil || gu.Name != "jerry" {
+		t.Fatalf("got %+v err %v", gu, err)
+	}
+
+	// 不认识的content type不猜
+	bad := NewMsgWithCodec(NewMsgHeadTcpV2(), []byte(`{}`), JsonCodec{})
+	bad.SetFlags(0xE0)
+	_, err = bad.ToStruct(&codecUser{})
+	var ue *UnknownContentTypeError
+	if !errors.Is(err, ErrUnknownContentType) || !errors.As(err, &ue) || ue.ID != 0xE {
+		t.Fatalf("expect ErrUnknownContentType, got %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package btmsg
+
+// 保留的act，业务不要使用
+const (
+	// ActPing 心跳，mytcp的server和client收到后自动回复 ActPong，不会交给OnReceive
+	ActPing uint16 = 0xFFFF
+	// ActPong seq和对应的ping一样
+	ActPong uint16 = 0xFFFE
+	// ActError 错误回复，见 Msg.SetError
+	ActError uint16 = 0xFFFD
+	// ActChunk 大消息拆成的分片，见 SplitChunks
+	ActChunk uint16 = 0xFFFC
+	// ActRelay 集群的实例之间转发的消息，见 mytcp.MeshRelay
+	ActRelay uint16 = 0xFFFB
+	// ActBatch 多个消息合成的一个消息，见 Batch 和 BatchReader
+	ActBatch uint16 = 0xFFFA
+)
+
+// IsControlAct ping和pong由框架自己处理，业务的回调默认看不到
+func IsControlAct(act uint16) bool {
+	return act == ActPing || act == ActPong
+}
+
+// NewPing 使用 MsgHeadTcpSeq，seq由 NextSeq 生成，对端回复的pong带同一个seq
+func NewPing() *Msg {
+	hd := NewMsgHeadTcpSeq()
+	hd.SetAct(ActPing)
+	hd.SetSeq(NextSeq())
+	return NewMsg(hd, nil)
+}
+
+// NewPong 回复seq为pingSeq的ping，使用 MsgHeadTcpSeq，需要和ping相同的head时用 NewReplyTo
+func NewPong(pingSeq uint32) *Msg {
+	hd := NewMsgHeadTcpSeq()
+	hd.SetAct(ActPong)
+	hd.SetSeq(pingSeq)
+	return NewMsg(hd, nil)
+}
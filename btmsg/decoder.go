@@ -0,0 +1,135 @@
+package btmsg
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+)
+
+// FrameDecoder 推模式的解码，每次Feed收到的任意一段数据，返回其中所有完整的消息
+// 不完整的部分留到下次Feed，只支持有固定长度head的格式，比如MsgHeadTcp
+// 出错之后数据已经错乱，不能再继续Feed
+type FrameDecoder struct {
+	reader *Reader
+	buf    []byte
+	// skipping 为了找magic已经跳过的字节数，找到之后一起上报
+	skipping int
+}
+
+// NewFrameDecoder opts和 NewReader 一样
+func NewFrameDecoder(f func() IHead, opts ...ReaderOption) *FrameDecoder {
+	return &FrameDecoder{
+		reader: NewReader(f, opts...),
+	}
+}
+
+// NewFrameDecoderWithCodec 解出来的消息用c解码body
+func NewFrameDecoderWithCodec(f func() IHead, c Codec, opts ...ReaderOption) *FrameDecoder {
+	return &FrameDecoder{
+		reader: NewReaderWithCodec(f, c, opts...),
+	}
+}
+
+// Buffered 还没有组成完整消息的字节数
+func (l *FrameDecoder) Buffered() int {
+	return len(l.buf)
+}
+
+func (l *FrameDecoder) Feed(bt []byte) (msgs []IMsg, err error) {
+	l.buf = append(l.buf, bt...)
+
+	var off uint64
+	for {
+		head := l.reader.f()
+		headSize := uint64(head.HeadSize())
+		if headSize == 0 {
+			return msgs, errors.Errorf("frame decoder not support %T", head)
+		}
+
+		rest := l.buf[off:]
+		var hdStart uint64
+		if mh, ok := head.(*magicHead); ok {
+			if len(rest) < len(mh.magic) {
+				break
+			}
+
+			var skip int
+			skip, err = l.reader.findMagic(rest, mh.magic)
+			if err != nil {
+				return msgs, err
+			}
+			if skip > 0 {
+				l.skipping += skip
+				off += uint64(skip)
+				if l.skipping > l.reader.maxMagicScan() {
+					return msgs, errors.Wrapf(ErrBadMagic, "not found in %d bytes", l.skipping)
+				}
+				continue
+			}
+
+			l.reader.reportCorrupt(l.skipping)
+			l.skipping = 0
+			hdStart = uint64(len(mh.magic))
+		}
+
+		// head的长度由版本号决定
+		if vh := findVersioned(head); vh != nil {
+			if uint64(len(rest)) <= hdStart {
+				break
+			}
+			err = vh.setVersion(rest[hdStart])
+			if err != nil {
+				return msgs, err
+			}
+			headSize = uint64(head.HeadSize())
+		}
+
+		if uint64(len(rest)) < headSize {
+			break
+		}
+
+		err = head.Read(&bytesReader{bytes.NewReader(rest[hdStart:headSize])})
+		if err != nil {
+			return msgs, err
+		}
+
+		err = l.reader.checkHead(head)
+		if err != nil {
+			return msgs, err
+		}
+
+		frameSize := headSize + uint64(head.BodySize())
+		if uint64(len(rest)) < frameSize {
+			break
+		}
+
+		var body []byte
+		var traceID TraceID
+		traceID, body, err = splitTraceID(head, append([]byte(nil), rest[headSize:frameSize]...))
+		if err != nil {
+			return msgs, err
+		}
+		body, err = l.reader.decompress(head, body)
+		if err != nil {
+			return msgs, err
+		}
+		msg := NewMsgWithCodec(head, body, l.reader.codec)
+		msg.traceID = traceID
+		msg.replyAct = l.reader.replyAct
+		msgs = append(msgs, msg)
+		off += frameSize
+	}
+
+	// 把剩下不完整的部分移到开头，buf不会一直变大
+	l.buf = append(l.buf[:0], l.buf[off:]...)
+	return msgs, nil
+}
+
+// bytesReader 把一段内存当成字节流读取
+type bytesReader struct {
+	*bytes.Reader
+}
+
+func (l *bytesReader) ReadMessage() (messageType int, p []byte, err error) {
+	return 0, nil, errors.New("bytes reader has no message")
+}
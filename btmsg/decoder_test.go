@@ -0,0 +1,108 @@
+package btmsg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func decoderFrames(n int) (all []byte) {
+	for i := 0; i < n; i++ {
+		hd := NewMsgHeadTcp()
+		hd.SetAct(uint16(i + 1))
+		msg := NewMsg(hd, nil)
+		_ = msg.FromStruct(&codecUser{Name: fmt.Sprint("user", i), Age: i})
+		all = append(all, msg.ToSendByte()...)
+	}
+	return
+}
+
+func checkDecoded(t *testing.T, msgs []IMsg, n int) {
+	t.Helper()
+
+	if len(msgs) != n {
+		t.Fatalf("got %d msgs, expect %d", len(msgs), n)
+	}
+	for i, msg := range msgs {
+		var u codecUser
+		_, _ = msg.ToStruct(&u)
+		if msg.GetAct() != uint16(i+1) || u.Age != i {
+			t.Fatalf("msg %d act %d body %+v", i, msg.GetAct(), u)
+		}
+	}
+}
+
+func TestFrameDecoderSplit(t *testing.T) {
+	all := decoderFrames(3)
+
+	// 在每一个字节的位置切成两段
+	for i := 0; i <= len(all); i++ {
+		d := NewFrameDecoder(FactoryMsgHeadTcp())
+		first, err := d.Feed(all[:i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := d.Feed(all[i:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkDecoded(t, append(first, second...), 3)
+		if d.Buffered() != 0 {
+			t.Fatalf("split %d buffered %d", i, d.Buffered())
+		}
+	}
+
+	// 一次一个字节
+	d := NewFrameDecoder(FactoryMsgHeadTcp())
+	var msgs []IMsg
+	for i := range all {
+		got, err := d.Feed(all[i : i+1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, got...)
+	}
+	checkDecoded(t, msgs, 3)
+}
+
+func TestFrameDecoderCoalesced(t *testing.T) {
+	all := decoderFrames(3)
+	frameSize := len(all) / 3
+	cut := frameSize*2 + frameSize/2
+
+	d := NewFrameDecoder(FactoryMsgHeadTcp())
+	msgs, err := d.Feed(all[:cut])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || d.Buffered() != cut-frameSize*2 {
+		t.Fatalf("got %d msgs, buffered %d", len(msgs), d.Buffered())
+	}
+
+	rest, err := d.Feed(all[cut:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs = append(msgs, rest...)
+	checkDecoded(t, msgs, 3)
+
+	// 和拉模式的Reader结果一样
+	r := NewReader(FactoryMsgHeadTcp())
+	src := &streamReader{bytes.NewReader(all)}
+	for i := 0; i < 3; i++ {
+		res := r.ReadMsg(src)
+		if res.GetErr() != nil || !bytes.Equal(res.GetMsg().BodyByte(), msgs[i].BodyByte()) {
+			t.Fatalf("reader msg %d err %v", i, res.GetErr())
+		}
+	}
+}
+
+func TestFrameDecoderTooLarge(t *testing.T) {
+	d := NewFrameDecoder(FactoryMsgHeadTcp(), WithMaxBodySize(4))
+	_, err := d.Feed(decoderFrames(1))
+	if !errors.Is(err, ErrMsgTooLarge) {
+		t.Fatalf("expect ErrMsgTooLarge, got %v", err)
+	}
+}
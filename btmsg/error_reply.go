@@ -0,0 +1,41 @@
+package btmsg
+
+// ErrorBody 错误回复的body，Act是出错的请求的act
+type ErrorBody struct {
+	Act  uint16 `json:"act"`
+	Code uint16 `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+// SetError 把消息变成错误回复，act改成 ActError，原来的act放到body里，seq不变
+func (l *Msg) SetError(code uint16, text string) error {
+	act := l.GetAct()
+	l.SetAct(ActError)
+
+	return l.FromStruct(&ErrorBody{
+		Act:  act,
+		Code: code,
+		Msg:  text,
+	})
+}
+
+func (l *Msg) GetError() (code uint16, text string, ok bool) {
+	if l.GetAct() != ActError {
+		return
+	}
+
+	var body ErrorBody
+	_, err := l.ToStruct(&body)
+	if err != nil {
+		return
+	}
+
+	return body.Code, body.Msg, true
+}
+
+// NewErrorReply req的错误回复
+func NewErrorReply(req IMsg, code uint16, text string) (*Msg, error) {
+	rsp := NewReplyTo(req)
+	err := rsp.SetError(code, text)
+	return rsp, err
+}
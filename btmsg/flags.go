@@ -0,0 +1,26 @@
+package btmsg
+
+import "github.com/pkg/errors"
+
+// 消息的flags，只有 MsgHeadTcpV2 和 MsgHeadWs 能带上
+const (
+	FlagCompressed  uint8 = 1 << 0
+	FlagEncrypted   uint8 = 1 << 1
+	FlagAckRequired uint8 = 1 << 2
+	// FlagTraceID body前面有16字节的trace id，见 Msg.SetTraceID
+	FlagTraceID uint8 = 1 << 3
+	// FlagCodecMask 高4位放content type，也就是codec id，0表示默认codec，见 Msg.GetContentType
+	FlagCodecMask uint8 = 0xF0
+
+	// FlagsKnown 之外的位保留，严格模式下收到会断开
+	FlagsKnown = FlagCompressed | FlagEncrypted | FlagAckRequired | FlagTraceID | FlagCodecMask
+)
+
+var ErrUnknownFlags = errors.New("unknown flags")
+
+// WithStrictFlags flags里有 FlagsKnown 之外的位时返回 ErrUnknownFlags
+func WithStrictFlags() ReaderOption {
+	return func(l *Reader) {
+		l.strictFlags = true
+	}
+}
@@ -0,0 +1,143 @@
+package btmsg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// fuzzReader 按kind选择head和reader选项，覆盖所有读的路径
+func fuzzReader(kind uint8) *Reader {
+	var heads = []func() IHead{
+		FactoryMsgHeadTcp(),
+		FactoryMsgHeadTcpV2(),
+		FactoryMsgHeadTcpV3(),
+		FactoryMsgHeadVersioned(VersionLatest),
+	}
+
+	var opts []ReaderOption
+	if kind&0x04 != 0 {
+		opts = append(opts, WithPooledMsg())
+	}
+	if kind&0x08 != 0 {
+		opts = append(opts, WithMagic(testMagic, 256))
+	}
+	if kind&0x10 != 0 {
+		opts = append(opts, WithDecompressor(DefaultCompressor, 1024))
+	}
+	if kind&0x20 != 0 {
+		opts = append(opts, WithStrictFlags())
+	}
+	if kind&0x40 != 0 {
+		opts = append(opts, WithByteOrder(binary.LittleEndian))
+	}
+	if kind&0x80 != 0 {
+		opts = append(opts, WithMaxBodySize(4096))
+	}
+
+	return NewReader(heads[kind&0x03], opts...)
+}
+
+// useMsg 调用读到的消息上所有不需要额外参数的方法
+func useMsg(t *testing.T, msg IMsg, chunks *ChunkAssembler) {
+	_ = msg.ToSendByte()
+	_, _, _ = msg.GetError()
+	_ = msg.NewReply()
+	_ = msg.Clone()
+	_, _ = msg.ToStruct(&codecUser{})
+	if msg.GetAct() == ActChunk {
+		_, _ = chunks.Feed(msg, time.Now())
+	}
+	msg.Release()
+}
+
+func fuzzSeeds(f *testing.F) {
+	frame := func(hd IHead, body []byte) []byte {
+		return NewMsg(hd, body).ToSendByte()
+	}
+
+	hd := NewMsgHeadTcpV2()
+	hd.SetAct(ActChunk)
+	chunks := SplitChunks(NewMsg(hd, bytes.Repeat([]byte("a"), 100)), 30)
+	var chunked []byte
+	for _, v := range chunks {
+		chunked = append(chunked, v.ToSendByte()...)
+	}
+
+	var seeds = []struct {
+		data []byte
+		kind uint8
+	}{
+		{frame(NewMsgHeadTcp(), []byte(`{"name":"tom"}`)), 0},
+		// 截断的head
+		{[]byte{0, 1, 0, 0}, 0},
+		// 长度远大于实际数据
+		{[]byte{0, 1, 0, 0, 0, 0, 0xFF, 0xFF, 0xFF, 0xFF, 1, 2}, 0},
+		{[]byte{0, 1, 0, 0, 0, 0, 0xFF, 0xFF, 0xFF, 0xFF, 1, 2}, 0x04},
+		// body长度为0
+		{[]byte{0, 1, 0, 0, 0, 0, 0, 0, 0, 0}, 0},
+		// 保留的act和不认识的flags
+		{[]byte{0xFF, 0xFD, 0, 0, 0, 1, 0, 0, 0, 2, 0xFF, '{', '}'}, 0x21},
+		// 不认识的版本号
+		{[]byte{9, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0}, 0x03},
+		// 压缩flag但body不是压缩数据
+		{[]byte{0, 1, 0, 0, 0, 0, 0, 0, 0, 6, FlagCompressed, 0, 0, 0, 9, 1, 2}, 0x11},
+		// 压缩之前的长度超过限制
+		{[]byte{0, 1, 0, 0, 0, 0, 0, 0, 0, 4, FlagCompressed, 0xFF, 0xFF, 0xFF, 0xFF}, 0x11},
+		{append([]byte{0xAB, 0x00, 0xAB}, FactoryWithMagic(FactoryMsgHeadTcp(), testMagic)().ToBytes()...), 0x08},
+		{chunked, 0x01},
+	}
+
+	for _, v := range seeds {
+		f.Add(v.data, v.kind, uint8(3))
+	}
+}
+
+// FuzzReadMsg 任意输入都不能panic，只能返回错误
+func FuzzReadMsg(f *testing.F) {
+	fuzzSeeds(f)
+
+	f.Fuzz(func(t *testing.T, data []byte, kind uint8, _ uint8) {
+		r := fuzzReader(kind)
+		chunks := NewChunkAssembler(4096, time.Second)
+		defer chunks.Close()
+
+		in := &streamReader{bytes.NewReader(data)}
+		for i := 0; i < 64; i++ {
+			res := r.ReadMsg(in)
+			if res.GetErr() != nil {
+				return
+			}
+			useMsg(t, res.GetMsg(), chunks)
+		}
+	})
+}
+
+// FuzzFrameDecoder 和 FuzzReadMsg 一样，数据按split切成多段Feed
+func FuzzFrameDecoder(f *testing.F) {
+	fuzzSeeds(f)
+
+	f.Fuzz(func(t *testing.T, data []byte, kind uint8, split uint8) {
+		r := fuzzReader(kind &^ 0x04)
+		d := &FrameDecoder{reader: r}
+		chunks := NewChunkAssembler(4096, time.Second)
+		defer chunks.Close()
+
+		step := int(split) + 1
+		for len(data) > 0 {
+			n := step
+			if n > len(data) {
+				n = len(data)
+			}
+			msgs, err := d.Feed(data[:n])
+			data = data[n:]
+			for _, msg := range msgs {
+				useMsg(t, msg, chunks)
+			}
+			if err != nil {
+				return
+			}
+		}
+	})
+}
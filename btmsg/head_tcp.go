@@ -3,16 +3,16 @@ package btmsg
 import (
 	"bytes"
 	"encoding/binary"
-	"encoding/json"
 	"fmt"
 	"github.com/pkg/errors"
 	"io"
 	"unsafe"
 )
 
-// MsgHeadTcp 作为容器，不可以有多余字段
+// MsgHeadTcp 作为容器，不可以有多余字段，act和size一共6个字节，需要seq用 MsgHeadTcpSeq
 type MsgHeadTcp struct {
-	Act  uint16
+	Act uint16
+	// Size body长度，超过64k时边读边分配，不可信的对端还是要配合 WithMaxBodySize
 	Size uint32
 }
 
@@ -46,7 +46,11 @@ func (l *MsgHeadTcp) BodySize() uint32 {
 }
 
 func (l *MsgHeadTcp) Read(r IReader) (err error) {
-	var headSize = l.HeadSize()
+	return readBinaryHead(r, l.HeadSize(), l, defaultByteOrder)
+}
+
+// readBinaryHead 读取headSize个字节，按order解析到v
+func readBinaryHead(r IReader, headSize uint32, v any, order binary.ByteOrder) (err error) {
 	var n int
 	var hdBt = make([]byte, headSize)
 
@@ -61,7 +65,7 @@ func (l *MsgHeadTcp) Read(r IReader) (err error) {
 	}
 
 	// 将head 字节 解析成结构体
-	err = binary.Read(bytes.NewReader(hdBt), binary.LittleEndian, l)
+	err = binary.Read(bytes.NewReader(hdBt), order, v)
 	if err != nil {
 		err = errors.Wrap(err, "byte to head")
 		return
@@ -70,18 +74,66 @@ func (l *MsgHeadTcp) Read(r IReader) (err error) {
 	return nil
 }
 
+// bodyReadStep body超过这个长度时边读边分配，对端声明了很大的长度却不发数据时不会一次分配
+const bodyReadStep = 64 * 1024
+
 func (l *MsgHeadTcp) ReadBody(r IReader) (err error, bt []byte) {
-	var bodySize = l.BodySize()
-	var n int
+	return readBody(r, l.BodySize())
+}
+
+// readBody body不超过 bodyReadStep 时一次分配
+func readBody(r IReader, size uint32) (err error, bt []byte) {
+	if size <= bodyReadStep {
+		bt = make([]byte, size)
+		err = readBodyFull(r, bt)
+		return
+	}
+
+	bt, err = readBodyGrow(r, size)
+	return
+}
+
+// readBodyGrow 分配的内存跟着实际收到的数据增长，每次扩大4倍
+func readBodyGrow(r IReader, size uint32) (bt []byte, err error) {
+	bt = make([]byte, 0, bodyReadStep)
+	for uint32(len(bt)) < size {
+		if len(bt) == cap(bt) {
+			n := uint64(cap(bt)) * 4
+			if n > uint64(size) {
+				n = uint64(size)
+			}
+			bt = append(make([]byte, 0, n), bt...)
+		}
+
+		var n int
+		n, err = io.ReadFull(r, bt[len(bt):cap(bt)])
+		bt = bt[:len(bt)+n]
+		if err == io.EOF && len(bt) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return bt, nil
+}
+
+// readBodyInto 把body读到bt里，bt的长度必须等于BodySize，见 WithPooledMsg
+func (l *MsgHeadTcp) readBodyInto(r IReader, bt []byte) (err error) {
+	return readBodyFull(r, bt)
+}
 
-	bt = make([]byte, bodySize)
+// readBodyFull 读满bt
+func readBodyFull(r IReader, bt []byte) (err error) {
+	var n int
 	n, err = io.ReadFull(r, bt)
 	if err != nil {
 		return
 	}
 
-	if n != int(bodySize) {
-		err = fmt.Errorf("body len err got %v, expect %v", n, bodySize)
+	if n != len(bt) {
+		err = fmt.Errorf("body len err got %v, expect %v", n, len(bt))
 		return
 	}
 
@@ -89,17 +141,22 @@ func (l *MsgHeadTcp) ReadBody(r IReader) (err error, bt []byte) {
 }
 
 func (l *MsgHeadTcp) ToBytes() []byte {
+	return writeBinaryHead(l, defaultByteOrder)
+}
+
+// writeBinaryHead 按order把v写成字节
+func writeBinaryHead(v any, order binary.ByteOrder) []byte {
 	bt := make([]byte, 0)
 	bf := bytes.NewBuffer(bt)
-	_ = binary.Write(bf, binary.LittleEndian, l)
+	_ = binary.Write(bf, order, v)
 	return bf.Bytes()
 }
 
+// act 已经在head里了，body 只放v，和ToStruct对应，编码方式是 DefaultCodec
+// 和以前的版本不兼容：以前的body是 WsResponse{act, data}，ToStruct却直接解码body，两边对不上
+// 还在发老格式的对端，收到的消息用 ToStruct(&WsResponse[T]{}) 解码，发给它的用 FromStruct(&WsResponse[T]{Act: act, Data: v})
 func (l *MsgHeadTcp) FromStruct(v any) (bt []byte, err error) {
-	bt, err = json.Marshal(&WsResponse[any]{
-		Act: l.GetAct(),
-		Data: v,
-	})
+	bt, err = DefaultCodec.Marshal(v)
 	if err != nil {
 		err = errors.Wrap(err, "struct to msg")
 		return
@@ -109,7 +166,7 @@ func (l *MsgHeadTcp) FromStruct(v any) (bt []byte, err error) {
 }
 
 func (l *MsgHeadTcp) ToStruct(bt []byte, v any) (any, error) {
-	err := json.Unmarshal(bt, v)
+	err := DefaultCodec.Unmarshal(bt, v)
 	if err != nil {
 		return v, errors.Wrap(err, "msg to struct")
 	}
@@ -117,7 +174,33 @@ func (l *MsgHeadTcp) ToStruct(bt []byte, v any) (any, error) {
 	return v, nil
 }
 
-
-func (l *MsgHeadTcp) SetAct(act uint16)  {
+func (l *MsgHeadTcp) SetAct(act uint16) {
 	l.Act = act
 }
+
+// GetSeq 这个格式没有seq，总是0，需要seq用 MsgHeadTcpSeq
+func (l *MsgHeadTcp) GetSeq() uint32 {
+	return 0
+}
+
+// SetSeq 这个格式没有seq，设置无效
+func (l *MsgHeadTcp) SetSeq(seq uint32) {
+}
+
+// GetFlags 这个格式没有flags，总是0，需要flags用 MsgHeadTcpV2
+func (l *MsgHeadTcp) GetFlags() uint8 {
+	return 0
+}
+
+// SetFlags 这个格式没有flags，设置无效
+func (l *MsgHeadTcp) SetFlags(flags uint8) {
+}
+
+// GetTimestamp 这个格式没有时间戳，总是0，需要时间戳用 MsgHeadTcpV3
+func (l *MsgHeadTcp) GetTimestamp() int64 {
+	return 0
+}
+
+// SetTimestamp 这个格式没有时间戳，设置无效
+func (l *MsgHeadTcp) SetTimestamp(ms int64) {
+}
@@ -0,0 +1,96 @@
+package btmsg
+
+import (
+	"unsafe"
+)
+
+// MsgHeadTcpSeq 在 MsgHeadTcp 的act后面多4个字节的seq，请求和回复用seq对应，两端要使用同一个格式
+// Call 和心跳的rtt需要seq，MsgHeadTcp 是和老版本兼容的默认格式，所以seq要自己选择
+type MsgHeadTcpSeq struct {
+	Act  uint16
+	Seq  uint32
+	Size uint32
+}
+
+var _ IHead = (*MsgHeadTcpSeq)(nil)
+
+func FactoryMsgHeadTcpSeq() func() IHead {
+	return func() IHead {
+		return NewMsgHeadTcpSeq()
+	}
+}
+
+func NewMsgHeadTcpSeq() *MsgHeadTcpSeq {
+	return &MsgHeadTcpSeq{}
+}
+
+func (l *MsgHeadTcpSeq) SetSize(size uint32) {
+	l.Size = size
+}
+
+func (l *MsgHeadTcpSeq) GetAct() uint16 {
+	return l.Act
+}
+
+func (l *MsgHeadTcpSeq) SetAct(act uint16) {
+	l.Act = act
+}
+
+func (l *MsgHeadTcpSeq) HeadSize() uint32 {
+	return uint32(unsafe.Sizeof(l.Act) + unsafe.Sizeof(l.Seq) + unsafe.Sizeof(l.Size))
+}
+
+func (l *MsgHeadTcpSeq) BodySize() uint32 {
+	return l.Size
+}
+
+func (l *MsgHeadTcpSeq) Read(r IReader) (err error) {
+	return readBinaryHead(r, l.HeadSize(), l, defaultByteOrder)
+}
+
+func (l *MsgHeadTcpSeq) ReadBody(r IReader) (err error, bt []byte) {
+	return readBody(r, l.BodySize())
+}
+
+func (l *MsgHeadTcpSeq) readBodyInto(r IReader, bt []byte) (err error) {
+	return readBodyFull(r, bt)
+}
+
+func (l *MsgHeadTcpSeq) ToBytes() []byte {
+	return writeBinaryHead(l, defaultByteOrder)
+}
+
+// FromStruct 和 MsgHeadTcp 一样
+func (l *MsgHeadTcpSeq) FromStruct(v any) (bt []byte, err error) {
+	return (&MsgHeadTcp{}).FromStruct(v)
+}
+
+func (l *MsgHeadTcpSeq) ToStruct(bt []byte, v any) (any, error) {
+	return (&MsgHeadTcp{}).ToStruct(bt, v)
+}
+
+func (l *MsgHeadTcpSeq) GetSeq() uint32 {
+	return l.Seq
+}
+
+func (l *MsgHeadTcpSeq) SetSeq(seq uint32) {
+	l.Seq = seq
+}
+
+// GetFlags 这个格式没有flags，总是0，需要flags用 MsgHeadTcpV2
+func (l *MsgHeadTcpSeq) GetFlags() uint8 {
+	return 0
+}
+
+// SetFlags 这个格式没有flags，设置无效
+func (l *MsgHeadTcpSeq) SetFlags(flags uint8) {
+}
+
+// GetTimestamp 这个格式没有时间戳，总是0，需要时间戳用 MsgHeadTcpV3
+func (l *MsgHeadTcpSeq) GetTimestamp() int64 {
+	return 0
+}
+
+// SetTimestamp 这个格式没有时间戳，设置无效
+func (l *MsgHeadTcpSeq) SetTimestamp(ms int64) {
+}
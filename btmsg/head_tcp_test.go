@@ -71,3 +71,45 @@ func TestWriteStructToBinary(t *testing.T) {
 	t.Log(err)
 	t.Log(bf.Bytes())
 }
+
+// TestReadBaselineFrame 老版本的帧：act(2) size(4) 小端，后面是body，没有seq
+// 默认是大端，对接老的对端用 WithByteOrder(binary.LittleEndian)
+func TestReadBaselineFrame(t *testing.T) {
+	body := []byte(`{"act":3,"data":{"name":"tom"}}`)
+	frame := []byte{3, 0}
+	frame = binary.LittleEndian.AppendUint32(frame, uint32(len(body)))
+	frame = append(frame, body...)
+
+	if hd := NewMsgHeadTcp(); hd.HeadSize() != 6 {
+		t.Fatalf("head size %d", hd.HeadSize())
+	}
+
+	res := NewReader(FactoryMsgHeadTcp(), WithByteOrder(binary.LittleEndian)).ReadMsg(&streamReader{bytes.NewReader(frame)})
+	if res.GetErr() != nil {
+		t.Fatal(res.GetErr())
+	}
+	msg := res.GetMsg()
+	if msg.GetAct() != 3 || msg.GetSeq() != 0 || !bytes.Equal(msg.BodyByte(), body) {
+		t.Fatalf("act %d seq %d body %s", msg.GetAct(), msg.GetSeq(), msg.BodyByte())
+	}
+
+	// 老版本的body包了一层 WsResponse
+	type user struct {
+		Name string `json:"name"`
+	}
+	wrapped, err := ToStructT[WsResponse[user]](msg)
+	if err != nil || wrapped.Act != 3 || wrapped.Data.Name != "tom" {
+		t.Fatalf("wrapped %+v err %v", wrapped, err)
+	}
+
+	// 写出去的和老版本一样
+	hd := FactoryWithByteOrder(FactoryMsgHeadTcp(), binary.LittleEndian)()
+	hd.SetAct(3)
+	out := NewMsg(hd, nil)
+	if err = out.FromStruct(&WsResponse[user]{Act: 3, Data: user{Name: "tom"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.ToSendByte(); !bytes.Equal(got, frame) {
+		t.Fatalf("frame %x, expect %x", got, frame)
+	}
+}
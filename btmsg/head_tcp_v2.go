@@ -0,0 +1,43 @@
+package btmsg
+
+import (
+	"unsafe"
+)
+
+// MsgHeadTcpV2 在 MsgHeadTcpSeq 后面多一个字节的flags，两端要使用同一个格式
+type MsgHeadTcpV2 struct {
+	MsgHeadTcpSeq
+	Flags uint8
+}
+
+var _ IHead = (*MsgHeadTcpV2)(nil)
+
+func FactoryMsgHeadTcpV2() func() IHead {
+	return func() IHead {
+		return NewMsgHeadTcpV2()
+	}
+}
+
+func NewMsgHeadTcpV2() *MsgHeadTcpV2 {
+	return &MsgHeadTcpV2{}
+}
+
+func (l *MsgHeadTcpV2) HeadSize() uint32 {
+	return l.MsgHeadTcpSeq.HeadSize() + uint32(unsafe.Sizeof(l.Flags))
+}
+
+func (l *MsgHeadTcpV2) Read(r IReader) (err error) {
+	return readBinaryHead(r, l.HeadSize(), l, defaultByteOrder)
+}
+
+func (l *MsgHeadTcpV2) ToBytes() []byte {
+	return writeBinaryHead(l, defaultByteOrder)
+}
+
+func (l *MsgHeadTcpV2) GetFlags() uint8 {
+	return l.Flags
+}
+
+func (l *MsgHeadTcpV2) SetFlags(flags uint8) {
+	l.Flags = flags
+}
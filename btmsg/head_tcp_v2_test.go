@@ -0,0 +1,183 @@
+package btmsg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHeadLayoutGolden(t *testing.T) {
+	v1 := NewMsgHeadTcp()
+	v1.SetAct(0x0102)
+	v1.SetSeq(3)
+	v1.SetSize(4)
+	v1.SetFlags(FlagCompressed)
+
+	// act(2) size(4)，默认大端，没有seq和flags
+	if got := hex.EncodeToString(v1.ToBytes()); got != "0102"+"00000004" {
+		t.Fatalf("v1 %s", got)
+	}
+
+	seq := NewMsgHeadTcpSeq()
+	seq.SetAct(0x0102)
+	seq.SetSeq(3)
+	seq.SetSize(4)
+
+	// act(2) seq(4) size(4)
+	if got := hex.EncodeToString(seq.ToBytes()); got != "0102"+"00000003"+"00000004" {
+		t.Fatalf("seq %s", got)
+	}
+
+	v2 := NewMsgHeadTcpV2()
+	v2.SetAct(0x0102)
+	v2.SetSeq(3)
+	v2.SetSize(4)
+	v2.SetFlags(FlagCompressed | FlagAckRequired)
+
+	// act(2) seq(4) size(4) flags(1)
+	if got := hex.EncodeToString(v2.ToBytes()); got != "0102"+"00000003"+"00000004"+"05" {
+		t.Fatalf("v2 %s", got)
+	}
+	if v2.HeadSize() != 11 {
+		t.Fatalf("v2 head size %d", v2.HeadSize())
+	}
+}
+
+func TestHeadV2ReadFlags(t *testing.T) {
+	hd := NewMsgHeadTcpV2()
+	hd.SetAct(1)
+	msg := NewMsg(hd, nil)
+	_ = msg.FromStruct(&codecUser{Name: "tom"})
+	msg.SetFlags(FlagAckRequired | FlagTraceID)
+
+	res := NewReader(FactoryMsgHeadTcpV2()).ReadMsg(&streamReader{bytes.NewReader(msg.ToSendByte())})
+	if res.GetErr() != nil {
+		t.Fatal(res.GetErr())
+	}
+	got := res.GetMsg()
+	if !got.HasFlag(FlagAckRequired) || got.HasFlag(FlagCompressed) {
+		t.Fatalf("flags %08b", got.GetFlags())
+	}
+
+	var u codecUser
+	_, _ = got.ToStruct(&u)
+	if u.Name != "tom" {
+		t.Fatalf("got %+v", u)
+	}
+
+	// 0x08 原来是保留位，现在是 FlagTraceID，严格模式也能读
+	res = NewReader(FactoryMsgHeadTcpV2(), WithStrictFlags()).ReadMsg(&streamReader{bytes.NewReader(msg.ToSendByte())})
+	if res.GetErr() != nil {
+		t.Fatal(res.GetErr())
+	}
+	if _, ok := res.GetMsg().GetTraceID(); ok || !res.GetMsg().HasFlag(FlagTraceID) {
+		t.Fatalf("flags %08b", res.GetMsg().GetFlags())
+	}
+}
+
+// chunkReader 每次最多读n个字节，模拟大body分很多次到达
+type chunkReader struct {
+	streamReader
+	n int
+}
+
+func (l *chunkReader) Read(b []byte) (int, error) {
+	if len(b) > l.n {
+		b = b[:l.n]
+	}
+	return l.streamReader.Read(b)
+}
+
+func TestReadLargeBody(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), 5<<20)
+	hd := NewMsgHeadTcp()
+	hd.SetAct(1)
+	frame := NewMsg(hd, body).ToSendByte()
+
+	r := NewReader(FactoryMsgHeadTcp())
+	var res IReadResult
+	allocs := testing.AllocsPerRun(3, func() {
+		res = r.ReadMsg(&chunkReader{streamReader{bytes.NewReader(frame)}, 1500})
+	})
+	if res.GetErr() != nil || !bytes.Equal(res.GetMsg().BodyByte(), body) {
+		t.Fatalf("err %v body len %d", res.GetErr(), len(res.GetMsg().BodyByte()))
+	}
+
+	// body的分配次数和读了多少次无关
+	if allocs > 20 {
+		t.Fatalf("allocs per read %v", allocs)
+	}
+
+	r = NewReader(FactoryMsgHeadTcp(), WithMaxBodySize(4<<20))
+	res = r.ReadMsg(&streamReader{bytes.NewReader(frame)})
+	if !errors.Is(res.GetErr(), ErrMsgTooLarge) {
+		t.Fatalf("expect ErrMsgTooLarge, got %v", res.GetErr())
+	}
+}
+
+func TestReadMaxBodyBoundary(t *testing.T) {
+	r := NewReader(FactoryMsgHeadTcp(), WithMaxBodySize(16))
+
+	hd := NewMsgHeadTcp()
+	hd.SetAct(1)
+	frame := NewMsg(hd, bytes.Repeat([]byte("a"), 16)).ToSendByte()
+	res := r.ReadMsg(&streamReader{bytes.NewReader(frame)})
+	if res.GetErr() != nil || len(res.GetMsg().BodyByte()) != 16 {
+		t.Fatalf("exact limit err %v", res.GetErr())
+	}
+
+	for _, size := range []uint32{17, ^uint32(0)} {
+		hd.SetSize(size)
+		// 只有head，body分配了的话会读到EOF而不是ErrMsgTooLarge
+		res = r.ReadMsg(&streamReader{bytes.NewReader(hd.ToBytes())})
+
+		var tooLarge *MsgTooLargeError
+		if !errors.As(res.GetErr(), &tooLarge) || !errors.Is(res.GetErr(), ErrMsgTooLarge) {
+			t.Fatalf("size %d expect MsgTooLargeError, got %v", size, res.GetErr())
+		}
+		if tooLarge.Size != size || tooLarge.Max != 16 {
+			t.Fatalf("got %+v", tooLarge)
+		}
+		if res.IsCloseByClient() || res.IsCloseByServer() {
+			t.Fatal("too large is not io close")
+		}
+	}
+}
+
+func TestHeadV3Timestamp(t *testing.T) {
+	hd := NewMsgHeadTcpV3()
+	hd.SetAct(0x0102)
+	hd.SetTimestamp(0x0102030405)
+	// act(2) seq(4) size(4) flags(1) timestamp(8)
+	if got := hex.EncodeToString(hd.ToBytes()); got != "0102"+"00000000"+"00000000"+"00"+"0000000102030405" {
+		t.Fatalf("v3 %s", got)
+	}
+	if hd.HeadSize() != 19 {
+		t.Fatalf("v3 head size %d", hd.HeadSize())
+	}
+
+	// 没有设置时发送时自动填上
+	before := time.Now().UnixMilli()
+	msg := NewMsg(NewMsgHeadTcpV3(), []byte("x"))
+	res := NewReader(FactoryMsgHeadTcpV3()).ReadMsg(&streamReader{bytes.NewReader(msg.ToSendByte())})
+	if res.GetErr() != nil {
+		t.Fatal(res.GetErr())
+	}
+	if ts := res.GetMsg().GetTimestamp(); ts < before || ts > time.Now().UnixMilli() {
+		t.Fatalf("timestamp %d", ts)
+	}
+
+	// 已经设置的不覆盖，不支持的head总是0
+	msg.SetTimestamp(42)
+	msg.ToSendByte()
+	if msg.GetTimestamp() != 42 {
+		t.Fatalf("timestamp %d", msg.GetTimestamp())
+	}
+	v1 := NewMsg(NewMsgHeadTcp(), nil)
+	v1.ToSendByte()
+	if v1.GetTimestamp() != 0 {
+		t.Fatalf("v1 timestamp %d", v1.GetTimestamp())
+	}
+}
@@ -0,0 +1,43 @@
+package btmsg
+
+import (
+	"unsafe"
+)
+
+// MsgHeadTcpV3 在 MsgHeadTcpV2 后面多8个字节的发送时间，unix毫秒，用来统计延迟
+type MsgHeadTcpV3 struct {
+	MsgHeadTcpV2
+	Timestamp int64
+}
+
+var _ IHead = (*MsgHeadTcpV3)(nil)
+
+func FactoryMsgHeadTcpV3() func() IHead {
+	return func() IHead {
+		return NewMsgHeadTcpV3()
+	}
+}
+
+func NewMsgHeadTcpV3() *MsgHeadTcpV3 {
+	return &MsgHeadTcpV3{}
+}
+
+func (l *MsgHeadTcpV3) HeadSize() uint32 {
+	return l.MsgHeadTcpV2.HeadSize() + uint32(unsafe.Sizeof(l.Timestamp))
+}
+
+func (l *MsgHeadTcpV3) Read(r IReader) (err error) {
+	return readBinaryHead(r, l.HeadSize(), l, defaultByteOrder)
+}
+
+func (l *MsgHeadTcpV3) ToBytes() []byte {
+	return writeBinaryHead(l, defaultByteOrder)
+}
+
+func (l *MsgHeadTcpV3) GetTimestamp() int64 {
+	return l.Timestamp
+}
+
+func (l *MsgHeadTcpV3) SetTimestamp(ms int64) {
+	l.Timestamp = ms
+}
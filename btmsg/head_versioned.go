@@ -0,0 +1,141 @@
+package btmsg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// 帧第一个字节的版本号，决定后面head的格式
+const (
+	// Version1 MsgHeadTcp
+	Version1 uint8 = 1
+	// Version2 MsgHeadTcpV2
+	Version2 uint8 = 2
+	// Version3 MsgHeadTcpV3
+	Version3      uint8 = 3
+	VersionLatest       = Version3
+)
+
+var versionHeads = map[uint8]func() IHead{
+	Version1: FactoryMsgHeadTcp(),
+	Version2: FactoryMsgHeadTcpV2(),
+	Version3: FactoryMsgHeadTcpV3(),
+}
+
+var ErrUnknownVersion = errors.New("unknown msg version")
+
+// UnknownVersionError 帧的版本号不认识，errors.Is(err, ErrUnknownVersion) 为true
+type UnknownVersionError struct {
+	Version uint8
+}
+
+func (l *UnknownVersionError) Error() string {
+	return fmt.Sprintf("unknown msg version %d", l.Version)
+}
+
+func (l *UnknownVersionError) Is(target error) bool {
+	return target == ErrUnknownVersion
+}
+
+// MsgHeadVersioned 帧的第一个字节是版本号，读的时候按版本号选择head，不同版本的消息可以混在同一个连接里
+// 写的时候使用创建时指定的版本
+type MsgHeadVersioned struct {
+	IHead
+	version uint8
+}
+
+// FactoryMsgHeadVersioned 写出去的消息使用version的格式，一般用 VersionLatest，老的对端用对应的旧版本
+// 读的时候任何认识的版本都可以
+func FactoryMsgHeadVersioned(version uint8) func() IHead {
+	f, ok := versionHeads[version]
+	if !ok {
+		panic(fmt.Sprintf("btmsg: unknown msg version %d", version))
+	}
+
+	return func() IHead {
+		return &MsgHeadVersioned{IHead: f(), version: version}
+	}
+}
+
+func (l *MsgHeadVersioned) Version() uint8 {
+	return l.version
+}
+
+func (l *MsgHeadVersioned) HeadSize() uint32 {
+	return 1 + l.IHead.HeadSize()
+}
+
+// setVersion 换成version对应的head
+func (l *MsgHeadVersioned) setVersion(version uint8) error {
+	if version == l.version {
+		return nil
+	}
+
+	f, ok := versionHeads[version]
+	if !ok {
+		return &UnknownVersionError{Version: version}
+	}
+
+	l.version = version
+	l.IHead = f()
+	return nil
+}
+
+func (l *MsgHeadVersioned) Read(r IReader) (err error) {
+	return l.readWithOrder(r, defaultByteOrder)
+}
+
+func (l *MsgHeadVersioned) readWithOrder(r IReader, order binary.ByteOrder) (err error) {
+	var v [1]byte
+	_, err = io.ReadFull(r, v[:])
+	if err != nil {
+		return err
+	}
+
+	err = l.setVersion(v[0])
+	if err != nil {
+		return err
+	}
+
+	return readBinaryHead(r, l.IHead.HeadSize(), l.IHead, order)
+}
+
+func (l *MsgHeadVersioned) ToBytes() []byte {
+	return l.toBytesWithOrder(defaultByteOrder)
+}
+
+func (l *MsgHeadVersioned) toBytesWithOrder(order binary.ByteOrder) []byte {
+	return append([]byte{l.version}, writeBinaryHead(l.IHead, order)...)
+}
+
+func (l *MsgHeadVersioned) readBodyInto(r IReader, bt []byte) (err error) {
+	return readBodyVia(l.IHead, r, bt)
+}
+
+func (l *MsgHeadVersioned) newHead() IHead {
+	return &MsgHeadVersioned{IHead: versionHeads[l.version](), version: l.version}
+}
+
+// findVersioned 找到被 FactoryWithMagic 等包装的 MsgHeadVersioned
+func findVersioned(hd IHead) *MsgHeadVersioned {
+	for hd != nil {
+		if v, ok := hd.(*MsgHeadVersioned); ok {
+			return v
+		}
+
+		w, ok := hd.(interface{ unwrap() IHead })
+		if !ok {
+			return nil
+		}
+		hd = w.unwrap()
+	}
+
+	return nil
+}
+
+func (l *MsgHeadVersioned) cloneHead() IHead {
+	return &MsgHeadVersioned{IHead: cloneHead(l.IHead), version: l.version}
+}
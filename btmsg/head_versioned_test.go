@@ -0,0 +1,113 @@
+package btmsg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestVersionedGolden(t *testing.T) {
+	for _, c := range []struct {
+		version uint8
+		expect  string
+	}{
+		// version(1) act(2) size(4)
+		{Version1, "01" + "0102" + "00000004"},
+		// version(1) act(2) seq(4) size(4) flags(1)
+		{Version2, "02" + "0102" + "00000003" + "00000004" + "05"},
+		// version(1) act(2) seq(4) size(4) flags(1) timestamp(8)
+		{Version3, "03" + "0102" + "00000003" + "00000004" + "05" + "0000000000000006"},
+	} {
+		hd := FactoryMsgHeadVersioned(c.version)()
+		hd.SetAct(0x0102)
+		hd.SetSeq(3)
+		hd.SetSize(4)
+		hd.SetFlags(FlagCompressed | FlagAckRequired)
+		hd.SetTimestamp(6)
+
+		if got := hex.EncodeToString(hd.ToBytes()); got != c.expect {
+			t.Fatalf("v%d %s", c.version, got)
+		}
+		if hd.HeadSize() != uint32(len(c.expect)/2) {
+			t.Fatalf("v%d head size %d", c.version, hd.HeadSize())
+		}
+	}
+}
+
+func TestVersionedMixed(t *testing.T) {
+	var stream []byte
+	for _, v := range []uint8{Version1, Version3, Version2, Version1} {
+		hd := FactoryMsgHeadVersioned(v)()
+		hd.SetAct(uint16(v))
+		stream = append(stream, NewMsg(hd, []byte{v, v}).ToSendByte()...)
+	}
+
+	r := NewReader(FactoryMsgHeadVersioned(VersionLatest))
+	sr := &streamReader{bytes.NewReader(stream)}
+	var got []IMsg
+	for i := 0; i < 4; i++ {
+		res := r.ReadMsg(sr)
+		if res.GetErr() != nil {
+			t.Fatal(res.GetErr())
+		}
+		got = append(got, res.GetMsg())
+	}
+
+	msgs, err := NewFrameDecoder(FactoryMsgHeadVersioned(VersionLatest)).Feed(stream)
+	if err != nil || len(msgs) != 4 {
+		t.Fatalf("decoder %d msgs err %v", len(msgs), err)
+	}
+
+	for i, v := range []uint8{Version1, Version3, Version2, Version1} {
+		for _, msg := range []IMsg{got[i], msgs[i]} {
+			if msg.GetAct() != uint16(v) || !bytes.Equal(msg.BodyByte(), []byte{v, v}) {
+				t.Fatalf("frame %d act %d body %v", i, msg.GetAct(), msg.BodyByte())
+			}
+		}
+
+		// 回复使用请求的版本
+		rsp := NewReplyTo(got[i])
+		if rsp.ToSendByte()[0] != v {
+			t.Fatalf("reply version %d, expect %d", rsp.ToSendByte()[0], v)
+		}
+	}
+}
+
+func TestVersionedUnknown(t *testing.T) {
+	frame := []byte{9, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0}
+	res := NewReader(FactoryMsgHeadVersioned(VersionLatest)).ReadMsg(&streamReader{bytes.NewReader(frame)})
+
+	var ve *UnknownVersionError
+	if !errors.Is(res.GetErr(), ErrUnknownVersion) || !errors.As(res.GetErr(), &ve) || ve.Version != 9 {
+		t.Fatalf("got %v", res.GetErr())
+	}
+
+	_, err := NewFrameDecoder(FactoryMsgHeadVersioned(VersionLatest)).Feed(frame)
+	if !errors.Is(err, ErrUnknownVersion) {
+		t.Fatalf("decoder got %v", err)
+	}
+}
+
+func TestVersionedByteOrder(t *testing.T) {
+	f := FactoryWithMagic(FactoryWithByteOrder(FactoryMsgHeadVersioned(Version1), binary.LittleEndian), testMagic)
+	hd := f()
+	hd.SetAct(0x0102)
+	frame := NewMsg(hd, []byte("le")).ToSendByte()
+	// magic(2) version(1) act(2) 小端
+	if got := hex.EncodeToString(frame[:5]); got != "abcd"+"01"+"0201" {
+		t.Fatalf("got %s", got)
+	}
+
+	r := NewReader(FactoryMsgHeadVersioned(VersionLatest), WithByteOrder(binary.LittleEndian), WithMagic(testMagic, 0))
+	res := r.ReadMsg(&streamReader{bytes.NewReader(frame)})
+	if res.GetErr() != nil || res.GetMsg().GetAct() != 0x0102 || string(res.GetMsg().BodyByte()) != "le" {
+		t.Fatalf("got %v", res.GetErr())
+	}
+
+	msgs, err := NewFrameDecoder(FactoryMsgHeadVersioned(VersionLatest), WithByteOrder(binary.LittleEndian), WithMagic(testMagic, 0)).Feed(frame)
+	if err != nil || len(msgs) != 1 || msgs[0].GetAct() != 0x0102 {
+		t.Fatalf("decoder %d msgs err %v", len(msgs), err)
+	}
+}
@@ -7,11 +7,15 @@ import (
 
 type WsResponse [T any] struct{
 	Act uint16 `json:"act"`
+	Seq uint32 `json:"seq,omitempty"`
+	Flags uint8 `json:"flags,omitempty"`
 	Data T `json:"data"`
 }
 
 type MsgHeadWs struct {
 	Act  uint16
+	Seq  uint32
+	Flags uint8
 	Size uint32
 	body []byte
 }
@@ -64,6 +68,15 @@ func (l *MsgHeadWs) Read(r IReader) (err error) {
 	}
 
 	l.Act = uint16(i)
+
+	if seq, ok := hdMap["seq"].(float64); ok {
+		l.Seq = uint32(seq)
+	}
+
+	if flags, ok := hdMap["flags"].(float64); ok {
+		l.Flags = uint8(flags)
+	}
+
 	return nil
 }
 
@@ -83,6 +96,8 @@ func (l *MsgHeadWs) SetSize(size uint32) {
 func (l *MsgHeadWs) FromStruct(v any) (bt []byte, err error) {
 	bt, err = json.Marshal(&WsResponse[any]{
 		Act: l.GetAct(),
+		Seq: l.GetSeq(),
+		Flags: l.GetFlags(),
 		Data: v,
 	})
 	if err != nil {
@@ -106,7 +121,31 @@ func (l *MsgHeadWs) ToStruct(bt []byte, v any) (any, error) {
 	return tmp.Data, nil
 }
 
-
-func (l *MsgHeadWs) SetAct(act uint16)  {
+func (l *MsgHeadWs) SetAct(act uint16) {
 	l.Act = act
 }
+
+func (l *MsgHeadWs) GetSeq() uint32 {
+	return l.Seq
+}
+
+func (l *MsgHeadWs) SetSeq(seq uint32) {
+	l.Seq = seq
+}
+
+func (l *MsgHeadWs) GetFlags() uint8 {
+	return l.Flags
+}
+
+func (l *MsgHeadWs) SetFlags(flags uint8) {
+	l.Flags = flags
+}
+
+// GetTimestamp ws没有时间戳，总是0
+func (l *MsgHeadWs) GetTimestamp() int64 {
+	return 0
+}
+
+// SetTimestamp ws没有时间戳，设置无效
+func (l *MsgHeadWs) SetTimestamp(ms int64) {
+}
@@ -11,6 +11,13 @@ type IHead interface {
 	FromStruct(v any) (bt []byte, err error)
 	ToStruct(bt []byte, v any) (any, error)
 	SetAct(act uint16)
+	GetSeq() uint32
+	SetSeq(seq uint32)
+	GetFlags() uint8
+	SetFlags(flags uint8)
+	// GetTimestamp 发送时的unix毫秒，不支持的head总是0
+	GetTimestamp() int64
+	SetTimestamp(ms int64)
 }
 
 type IReader interface {
@@ -23,10 +30,43 @@ type IMsg interface {
 	HeadSize() uint32
 	GetAct() uint16
 	BodyByte() []byte
+	// GetBody 原始body，不复制，见 Msg.GetBody
+	GetBody() []byte
+	// SetBody 原始body，不复制，见 Msg.SetBody
+	SetBody(bt []byte)
+	// CopyBody 原始body的拷贝
+	CopyBody() []byte
 	FromStruct(v any) error
 	ToStruct(v any) (any, error)
 	ToSendByte() []byte
 	SetAct(act uint16)
+	// GetSeq 请求和回复用seq对应，0表示不需要对应
+	GetSeq() uint32
+	SetSeq(seq uint32)
+	GetFlags() uint8
+	SetFlags(flags uint8)
+	// HasFlag f里的位都设置了才返回true
+	HasFlag(f uint8) bool
+	// GetContentType body的编码，codec的ID，0表示没有指定
+	GetContentType() byte
+	// GetTimestamp 发送时的unix毫秒，没有设置时ToSendByte自动填上，head不支持时总是0
+	GetTimestamp() int64
+	SetTimestamp(ms int64)
+	// SetTraceID 带上trace id，head不能带flags时没有效果
+	SetTraceID(id TraceID)
+	// GetTraceID 没有trace id时ok为false
+	GetTraceID() (id TraceID, ok bool)
+	SetError(code uint16, text string) error
+	// GetError 不是错误回复时ok为false
+	GetError() (code uint16, text string, ok bool)
+	// NewReply 创建这个请求的回复，seq相同，act按 WithReplyAct 的规则
+	NewReply() IMsg
+	// Clone 深拷贝，修改拷贝不影响原来的消息
+	Clone() IMsg
+	// Retain 池化的消息在回调返回之后还要用时调用，见 GetMsg
+	Retain()
+	// Release 和Retain成对调用，不是池化的消息没有效果
+	Release()
 }
 
 type IReadResult interface {
@@ -0,0 +1,69 @@
+package btmsg
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// defaultMaxLine LineReader 默认一行最多的字节数
+const defaultMaxLine = 64 * 1024
+
+// LineReader 读换行结尾的文本，每一行是一个act固定的消息，body是去掉\n和\r的这一行
+// 给还在用文本协议的老客户端用，见 mytcp.WithProtocolSniffing
+type LineReader struct {
+	act     uint16
+	maxLine int
+}
+
+var _ IMsgReader = (*LineReader)(nil)
+
+// NewLineReader maxLine<=0 时默认64k，超过时返回 ErrMsgTooLarge
+func NewLineReader(act uint16, maxLine int) *LineReader {
+	if maxLine <= 0 {
+		maxLine = defaultMaxLine
+	}
+	return &LineReader{act: act, maxLine: maxLine}
+}
+
+// ReadMsg r最好带缓冲，没有实现 io.ByteReader 时一次读一个字节
+// 连接在一行的中间断开时这一行丢弃，返回读到的错误
+func (l *LineReader) ReadMsg(r IReader) (res IReadResult) {
+	var line []byte
+	for {
+		c, err := readByte(r)
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return NewReaderResult(err, nil, nil)
+		}
+
+		if c == '\n' {
+			break
+		}
+		if len(line) >= l.maxLine {
+			return NewReaderResult(errors.Wrapf(ErrMsgTooLarge, "line over %d bytes", l.maxLine), nil, nil)
+		}
+		line = append(line, c)
+	}
+
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+
+	head := NewMsgHeadTcp()
+	head.SetAct(l.act)
+	head.SetSize(uint32(len(line)))
+	return NewReaderResult(nil, head, line)
+}
+
+func readByte(r IReader) (byte, error) {
+	if br, ok := r.(io.ByteReader); ok {
+		return br.ReadByte()
+	}
+
+	var b [1]byte
+	_, err := io.ReadFull(r, b[:])
+	return b[0], err
+}
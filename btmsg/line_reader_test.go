@@ -0,0 +1,50 @@
+package btmsg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+type lineStream struct {
+	io.Reader
+}
+
+func (l *lineStream) ReadMessage() (messageType int, p []byte, err error) {
+	panic("stream reader has no message")
+}
+
+func TestLineReader(t *testing.T) {
+	reader := NewLineReader(50, 8)
+	const data = "hello\r\n\nworld\npart"
+	// 一个没有实现 io.ByteReader，一个实现了
+	for _, r := range []IReader{
+		&lineStream{Reader: strings.NewReader(data)},
+		&streamReader{Reader: bytes.NewReader([]byte(data))},
+	} {
+		for _, expect := range []string{"hello", "", "world"} {
+			res := reader.ReadMsg(r)
+			if res.GetErr() != nil {
+				t.Fatal(res.GetErr())
+			}
+			msg := res.GetMsg()
+			if msg.GetAct() != 50 || string(msg.BodyByte()) != expect || int(msg.BodySize()) != len(expect) {
+				t.Fatalf("act %d body %q", msg.GetAct(), msg.BodyByte())
+			}
+		}
+
+		if err := reader.ReadMsg(r).GetErr(); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expect ErrUnexpectedEOF, got %v", err)
+		}
+		if res := reader.ReadMsg(r); !res.IsCloseByClient() {
+			t.Fatalf("expect EOF, got %v", res.GetErr())
+		}
+	}
+
+	err := reader.ReadMsg(&streamReader{Reader: bytes.NewReader([]byte("123456789\n"))}).GetErr()
+	if !errors.Is(err, ErrMsgTooLarge) {
+		t.Fatalf("expect ErrMsgTooLarge, got %v", err)
+	}
+}
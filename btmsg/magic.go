@@ -0,0 +1,145 @@
+package btmsg
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+var ErrBadMagic = errors.New("bad magic")
+
+// defaultMagicScan 找下一个magic最多跳过的字节数
+const defaultMagicScan = 64 * 1024
+
+// magicHead 每个帧前面加两个字节的magic，数据错位之后reader可以找到下一个帧重新开始
+// Read不读magic，magic由 Reader 和 FrameDecoder 处理
+type magicHead struct {
+	IHead
+	magic [2]byte
+}
+
+// FactoryWithMagic f创建的head写出去的时候前面带上magic，读的时候reader会检查magic
+// magic可能碰巧出现在body里，找回的第一个帧不一定正确，最好配合 WithMaxBodySize
+func FactoryWithMagic(f func() IHead, magic [2]byte) func() IHead {
+	return func() IHead {
+		return &magicHead{IHead: f(), magic: magic}
+	}
+}
+
+// WithMagic 帧前面带magic，magic不对时往后找下一个magic，最多跳过maxScan个字节，0表示默认64k
+// 和 WithByteOrder 一起使用时不用关心顺序
+func WithMagic(magic [2]byte, maxScan int) ReaderOption {
+	return func(l *Reader) {
+		l.magic = &magic
+		l.magicScan = maxScan
+	}
+}
+
+// WithStrictMagic magic不对时不往后找，直接返回 ErrBadMagic，调用方会断开连接
+func WithStrictMagic() ReaderOption {
+	return func(l *Reader) {
+		l.strictMagic = true
+	}
+}
+
+// WithCorruptCallback 为了找到magic跳过了数据时调用，skipped是跳过的字节数
+// 同一个reader给多个连接使用时f会被并发调用
+func WithCorruptCallback(f func(skipped int)) ReaderOption {
+	return func(l *Reader) {
+		l.onCorrupt = f
+	}
+}
+
+func (l *magicHead) HeadSize() uint32 {
+	return l.IHead.HeadSize() + uint32(len(l.magic))
+}
+
+func (l *magicHead) ToBytes() []byte {
+	return append(l.magic[:], l.IHead.ToBytes()...)
+}
+
+func (l *magicHead) readBodyInto(r IReader, bt []byte) (err error) {
+	return readBodyVia(l.IHead, r, bt)
+}
+
+func (l *magicHead) unwrap() IHead {
+	return l.IHead
+}
+
+func (l *magicHead) newHead() IHead {
+	return &magicHead{IHead: newHeadLike(l.IHead), magic: l.magic}
+}
+
+// readBodyVia 包装的head读body，里面的head支持就复用bt
+func readBodyVia(hd IHead, r IReader, bt []byte) (err error) {
+	if v, ok := hd.(bodyReaderInto); ok {
+		return v.readBodyInto(r, bt)
+	}
+
+	_, err = io.ReadFull(r, bt)
+	return
+}
+
+func (l *Reader) maxMagicScan() int {
+	if l.magicScan > 0 {
+		return l.magicScan
+	}
+	return defaultMagicScan
+}
+
+func (l *Reader) reportCorrupt(skipped int) {
+	if skipped > 0 && l.onCorrupt != nil {
+		l.onCorrupt(skipped)
+	}
+}
+
+// readMagic 读到magic为止，一次往后移一个字节，返回跳过的字节数
+func (l *Reader) readMagic(r IReader, magic [2]byte) (skipped int, err error) {
+	var win [2]byte
+	_, err = io.ReadFull(r, win[:])
+	if err != nil {
+		return
+	}
+
+	for win != magic {
+		if l.strictMagic {
+			return skipped, errors.Wrapf(ErrBadMagic, "got %x", win)
+		}
+		if skipped >= l.maxMagicScan() {
+			return skipped, errors.Wrapf(ErrBadMagic, "not found in %d bytes", skipped)
+		}
+
+		win[0] = win[1]
+		_, err = io.ReadFull(r, win[1:])
+		if err != nil {
+			return
+		}
+		skipped++
+	}
+
+	return
+}
+
+// findMagic FrameDecoder 用，返回buf开头需要跳过的字节数
+// 没找到时保留最后一个字节，它可能是下一个magic的前半部分
+func (l *Reader) findMagic(buf []byte, magic [2]byte) (skip int, err error) {
+	if bytes.HasPrefix(buf, magic[:]) {
+		return 0, nil
+	}
+
+	if l.strictMagic {
+		return 0, errors.Wrapf(ErrBadMagic, "got %x", buf[:2])
+	}
+
+	skip = bytes.Index(buf, magic[:])
+	if skip < 0 {
+		skip = len(buf) - 1
+	}
+
+	return skip, nil
+}
+
+func (l *magicHead) cloneHead() IHead {
+	return &magicHead{IHead: cloneHead(l.IHead), magic: l.magic}
+}
@@ -0,0 +1,130 @@
+package btmsg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var testMagic = [2]byte{0xAB, 0xCD}
+
+func magicFrame(t testing.TB, i int) []byte {
+	hd := FactoryWithMagic(FactoryMsgHeadTcp(), testMagic)()
+	hd.SetAct(uint16(i))
+	return NewMsg(hd, []byte(fmt.Sprintf("frame-%d", i))).ToSendByte()
+}
+
+// cleanGarbage 去掉garbage里的magic前缀字节，保证不会凑出一个magic
+func cleanGarbage(bt []byte) []byte {
+	bt = append([]byte(nil), bt...)
+	for i := range bt {
+		if bt[i] == testMagic[0] {
+			bt[i] = 0
+		}
+	}
+	return bt
+}
+
+func TestMagicGolden(t *testing.T) {
+	hd := FactoryWithMagic(FactoryMsgHeadTcp(), testMagic)()
+	hd.SetAct(1)
+	hd.SetSize(2)
+	if got := fmt.Sprintf("%x", hd.ToBytes()); got != "abcd"+"0001"+"00000002" {
+		t.Fatalf("got %s", got)
+	}
+	if hd.HeadSize() != 8 {
+		t.Fatalf("head size %d", hd.HeadSize())
+	}
+}
+
+func TestMagicStrict(t *testing.T) {
+	stream := append([]byte{1, 2, 3}, magicFrame(t, 1)...)
+	r := NewReader(FactoryMsgHeadTcp(), WithMagic(testMagic, 0), WithStrictMagic())
+	res := r.ReadMsg(&streamReader{bytes.NewReader(stream)})
+	if !errors.Is(res.GetErr(), ErrBadMagic) {
+		t.Fatalf("expect ErrBadMagic, got %v", res.GetErr())
+	}
+
+	_, err := NewFrameDecoder(FactoryMsgHeadTcp(), WithMagic(testMagic, 0), WithStrictMagic()).Feed(stream)
+	if !errors.Is(err, ErrBadMagic) {
+		t.Fatalf("decoder expect ErrBadMagic, got %v", err)
+	}
+}
+
+func TestMagicScanLimit(t *testing.T) {
+	stream := append(make([]byte, 100), magicFrame(t, 1)...)
+	r := NewReader(FactoryMsgHeadTcp(), WithMagic(testMagic, 10))
+	res := r.ReadMsg(&streamReader{bytes.NewReader(stream)})
+	if !errors.Is(res.GetErr(), ErrBadMagic) {
+		t.Fatalf("expect ErrBadMagic, got %v", res.GetErr())
+	}
+}
+
+func FuzzMagicResync(f *testing.F) {
+	f.Add([]byte{1, 2, 3}, []byte{}, []byte{0xCD, 0, 0, 0, 0}, uint8(3))
+	f.Add([]byte{}, []byte{0xAB}, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, uint8(1))
+
+	f.Fuzz(func(t *testing.T, g1, g2, g3 []byte, chunk uint8) {
+		var garbage = [][]byte{cleanGarbage(g1), cleanGarbage(g2), cleanGarbage(g3)}
+		var stream []byte
+		var expectSkipped int
+		for i, g := range garbage {
+			stream = append(stream, g...)
+			stream = append(stream, magicFrame(t, i)...)
+			expectSkipped += len(g)
+		}
+
+		var skipped int
+		opts := []ReaderOption{
+			WithMagic(testMagic, 0),
+			WithMaxBodySize(64),
+			WithCorruptCallback(func(n int) {
+				skipped += n
+			}),
+		}
+
+		r := NewReader(FactoryMsgHeadTcp(), opts...)
+		sr := &streamReader{bytes.NewReader(stream)}
+		for i := range garbage {
+			res := r.ReadMsg(sr)
+			if res.GetErr() != nil {
+				t.Fatalf("frame %d: %v", i, res.GetErr())
+			}
+			if got := string(res.GetMsg().BodyByte()); got != fmt.Sprintf("frame-%d", i) {
+				t.Fatalf("frame %d got %q", i, got)
+			}
+		}
+		if skipped != expectSkipped {
+			t.Fatalf("reader skipped %d, expect %d", skipped, expectSkipped)
+		}
+
+		// FrameDecoder 任意切分也要得到同样的结果
+		skipped = 0
+		d := NewFrameDecoder(FactoryMsgHeadTcp(), opts...)
+		var got []IMsg
+		step := int(chunk)%7 + 1
+		for off := 0; off < len(stream); off += step {
+			end := off + step
+			if end > len(stream) {
+				end = len(stream)
+			}
+			msgs, err := d.Feed(stream[off:end])
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, msgs...)
+		}
+		if len(got) != len(garbage) {
+			t.Fatalf("decoder got %d frames", len(got))
+		}
+		for i, msg := range got {
+			if string(msg.BodyByte()) != fmt.Sprintf("frame-%d", i) {
+				t.Fatalf("decoder frame %d got %q", i, msg.BodyByte())
+			}
+		}
+		if skipped != expectSkipped {
+			t.Fatalf("decoder skipped %d, expect %d", skipped, expectSkipped)
+		}
+	})
+}
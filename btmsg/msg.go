@@ -1,10 +1,27 @@
 package btmsg
 
+import (
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
 var _ IMsg = (*Msg)(nil)
 
 type Msg struct {
 	head   IHead
 	bodyBt []byte
+	codec  Codec
+	// traceID 带 FlagTraceID 时有效
+	traceID TraceID
+	// replyAct NewReply使用的规则，由reader设置
+	replyAct ReplyAct
+	// 下面几个字段只有 GetMsg 取的消息使用
+	pooled   bool
+	refs     int32
+	buf      *[]byte
+	released bool
 }
 
 func (l *Msg) BodySize() uint32 {
@@ -14,6 +31,42 @@ func (l *Msg) BodySize() uint32 {
 func (l *Msg) SetAct(act uint16) {
 	l.head.SetAct(act)
 }
+
+func (l *Msg) GetSeq() uint32 {
+	return l.head.GetSeq()
+}
+
+func (l *Msg) SetSeq(seq uint32) {
+	l.head.SetSeq(seq)
+}
+
+func (l *Msg) GetFlags() uint8 {
+	return l.head.GetFlags()
+}
+
+func (l *Msg) SetFlags(flags uint8) {
+	l.head.SetFlags(flags)
+}
+
+func (l *Msg) HasFlag(f uint8) bool {
+	return l.head.GetFlags()&f == f
+}
+
+func (l *Msg) GetTimestamp() int64 {
+	return l.head.GetTimestamp()
+}
+
+func (l *Msg) SetTimestamp(ms int64) {
+	l.head.SetTimestamp(ms)
+}
+
+// stamp 没有设置时间戳时用当前时间，head不支持时没有效果
+func (l *Msg) stamp() {
+	if l.head.GetTimestamp() == 0 {
+		l.head.SetTimestamp(time.Now().UnixMilli())
+	}
+}
+
 func (l *Msg) HeadSize() uint32 {
 	return l.head.HeadSize()
 }
@@ -29,26 +82,152 @@ func NewMsg(head IHead, bodyBt []byte) *Msg {
 	}
 }
 
+// NewActMsg 使用 MsgHeadTcp 创建消息，回复的时候用它创建新消息，不要修改收到的消息
+// NewMsg 的参数是head，已经被使用，所以换了名字
+func NewActMsg(act uint16, body []byte) *Msg {
+	hd := NewMsgHeadTcp()
+	hd.SetAct(act)
+	return NewMsg(hd, body)
+}
+
+// NewMsgFromStruct 使用 MsgHeadTcp 创建消息，body由v编码
+func NewMsgFromStruct(act uint16, v any) (*Msg, error) {
+	msg := NewActMsg(act, nil)
+	err := msg.FromStruct(v)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// NewMsgWithCodec FromStruct/ToStruct使用c编解码body
+// 只适合body只放数据的head，比如MsgHeadTcp，MsgHeadWs的body自带json外层
+func NewMsgWithCodec(head IHead, bodyBt []byte, c Codec) *Msg {
+	return &Msg{
+		head:   head,
+		bodyBt: bodyBt,
+		codec:  c,
+	}
+}
+
 func (l *Msg) BodyByte() []byte {
+	l.checkLive()
+	return l.bodyBt
+}
+
+// GetBody 原始body，不经过codec，和消息共用同一块内存，不要修改
+// 池化的消息Release之后内存会被复用，需要保留时用 CopyBody
+func (l *Msg) GetBody() []byte {
+	l.checkLive()
 	return l.bodyBt
 }
 
+// CopyBody 复制一份原始body，可以随意修改和保留
+func (l *Msg) CopyBody() []byte {
+	l.checkLive()
+	return append([]byte(nil), l.bodyBt...)
+}
+
+// SetBody 直接使用bt作为body，不经过codec也不复制，发送完之前调用方不要修改bt
+// 转发收到的body时，池化的消息要先Retain或者用 CopyBody
+func (l *Msg) SetBody(bt []byte) {
+	l.checkLive()
+	l.bodyBt = bt
+}
+
+// actCodec ActCodec 按当前act选择
+func (l *Msg) actCodec() Codec {
+	if c, ok := l.codec.(ActCodec); ok {
+		return c.ForAct(l.GetAct())
+	}
+	return l.codec
+}
+
 // v is a pointer
+// body换成新的slice，之前BodyByte返回的slice不会被修改，head的act和seq不变
+// 设置了codec时按content type编码，没有content type时用codec编码并把content type设置成它的ID
 func (l *Msg) FromStruct(v any) (err error) {
+	if l.codec != nil {
+		c, err := l.contentCodec()
+		if err != nil {
+			return err
+		}
+
+		l.bodyBt, err = c.Marshal(v)
+		if err != nil {
+			return errors.Wrap(err, "struct to msg")
+		}
+
+		if c.ID() <= FlagCodecMask>>contentTypeShift {
+			l.setContentType(c.ID())
+		}
+		return nil
+	}
+
 	l.bodyBt, err = l.head.FromStruct(v)
 	return
 }
 
 // v is a pointer
 func (l *Msg) ToStruct(v any) (any, error) {
+	l.checkLive()
+	if l.codec != nil {
+		c, err := l.contentCodec()
+		if err != nil {
+			return v, err
+		}
+
+		err = c.Unmarshal(l.bodyBt, v)
+		return v, errors.Wrap(err, "msg to struct")
+	}
+
 	return l.head.ToStruct(l.bodyBt, v)
 }
 
+// ToStructT 每次new一个T解码，并发处理消息时不会共用同一个结构体
+func ToStructT[T any](msg IMsg) (*T, error) {
+	var v = new(T)
+	_, err := msg.ToStruct(v)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Clone 深拷贝head和body，拷贝出来的消息不是池化的，可以在回调返回之后继续使用
+func (l *Msg) Clone() IMsg {
+	l.checkLive()
+	return &Msg{
+		head:     cloneHead(l.head),
+		bodyBt:   append([]byte(nil), l.bodyBt...),
+		codec:    l.codec,
+		traceID:  l.traceID,
+		replyAct: l.replyAct,
+	}
+}
+
+// cloneHead 包装类型的head自己实现cloneHead，其他的head按结构体复制
+func cloneHead(hd IHead) IHead {
+	if v, ok := hd.(interface{ cloneHead() IHead }); ok {
+		return v.cloneHead()
+	}
+
+	v := reflect.New(reflect.TypeOf(hd).Elem())
+	v.Elem().Set(reflect.ValueOf(hd).Elem())
+	return v.Interface().(IHead)
+}
+
 // 除非只需要发送head,否则需要在FromStruct之后执行
+// size和时间戳已经设置好时不修改head，多个goroutine可以同时对同一个消息调用，见 tcpServer.Broadcast
 func (l *Msg) ToSendByte() []byte {
-	l.head.SetSize(uint32(len(l.bodyBt)))
+	l.checkLive()
+	l.stamp()
+	if size := l.wireSize(len(l.bodyBt)); l.head.BodySize() != size {
+		l.head.SetSize(size)
+	}
 
 	bt := l.head.ToBytes()
+	bt = l.appendTraceID(bt)
 	bt = append(bt, l.bodyBt...)
 
 	return bt
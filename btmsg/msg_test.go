@@ -0,0 +1,127 @@
+package btmsg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestNewMsgFromStruct(t *testing.T) {
+	msg, err := NewMsgFromStruct(7, &codecUser{Name: "tom", Age: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := NewReader(FactoryMsgHeadTcp()).ReadMsg(&streamReader{bytes.NewReader(msg.ToSendByte())})
+	if res.GetErr() != nil {
+		t.Fatal(res.GetErr())
+	}
+
+	var u codecUser
+	_, err = res.GetMsg().ToStruct(&u)
+	if err != nil || u.Name != "tom" || res.GetMsg().GetAct() != 7 {
+		t.Fatalf("act %d got %+v err %v", res.GetMsg().GetAct(), u, err)
+	}
+
+	if raw := NewActMsg(8, []byte("raw")); raw.GetAct() != 8 || string(raw.BodyByte()) != "raw" {
+		t.Fatalf("act %d body %q", raw.GetAct(), raw.BodyByte())
+	}
+}
+
+// 复用收到的消息回复：act和seq保留，之前拿到的body不受影响
+func TestMsgFromStructReuse(t *testing.T) {
+	req := seqMsg(1, 5, []byte(`{"name":"tom","age":3}`))
+
+	body := req.BodyByte()
+	sent := req.ToSendByte()
+
+	err := req.FromStruct(&codecUser{Name: "jerry"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(body) != `{"name":"tom","age":3}` {
+		t.Fatalf("old body changed: %s", body)
+	}
+	if !bytes.HasSuffix(sent, body) {
+		t.Fatal("old frame changed")
+	}
+	if req.GetAct() != 1 || req.GetSeq() != 5 {
+		t.Fatalf("act %d seq %d", req.GetAct(), req.GetSeq())
+	}
+	if !bytes.Contains(req.ToSendByte(), []byte("jerry")) {
+		t.Fatalf("new body %s", req.BodyByte())
+	}
+}
+
+func TestToStructTParallel(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		msg, err := NewMsgFromStruct(100, &codecUser{Name: fmt.Sprintf("u%d", i), Age: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				u, err := ToStructT[codecUser](msg)
+				if err != nil || u.Age != i {
+					t.Errorf("got %+v err %v", u, err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestMsgClone(t *testing.T) {
+	f := FactoryWithMagic(FactoryWithByteOrder(FactoryMsgHeadVersioned(Version2), binary.LittleEndian), testMagic)
+	hd := f()
+	hd.SetAct(1)
+	hd.SetSeq(2)
+	hd.SetFlags(FlagAckRequired)
+	msg := NewMsg(hd, []byte("body"))
+	frame := msg.ToSendByte()
+
+	cp := msg.Clone()
+	msg.SetAct(9)
+	msg.SetSeq(9)
+	msg.SetFlags(0)
+	msg.BodyByte()[0] = 'X'
+
+	if !bytes.Equal(cp.ToSendByte(), frame) {
+		t.Fatalf("clone changed: %x, expect %x", cp.ToSendByte(), frame)
+	}
+}
+
+func TestNewPingPong(t *testing.T) {
+	ping := NewPing()
+	pong := NewPong(ping.GetSeq())
+	if ping.GetAct() != ActPing || pong.GetAct() != ActPong || ping.GetSeq() == 0 || pong.GetSeq() != ping.GetSeq() {
+		t.Fatalf("ping %d/%d pong %d/%d", ping.GetAct(), ping.GetSeq(), pong.GetAct(), pong.GetSeq())
+	}
+	if !IsControlAct(ActPing) || !IsControlAct(ActPong) || IsControlAct(ActError) {
+		t.Fatal("IsControlAct")
+	}
+}
+
+func TestMsgRawBody(t *testing.T) {
+	raw := []byte{0, 1, 2, 0xFF}
+	msg := NewActMsg(1, nil)
+	msg.SetBody(raw)
+
+	// GetBody和SetBody不复制
+	if &msg.GetBody()[0] != &raw[0] {
+		t.Fatal("GetBody should alias")
+	}
+	cp := msg.CopyBody()
+	cp[0] = 9
+	if raw[0] != 0 || !bytes.Equal(msg.ToSendByte()[msg.HeadSize():], raw) {
+		t.Fatalf("body %v", msg.GetBody())
+	}
+}
@@ -0,0 +1,41 @@
+//go:build msgpack
+
+// Package msgpackcodec btmsg的msgpack编码，依赖 github.com/vmihailenco/msgpack/v5，
+// 需要 -tags msgpack 编译
+package msgpackcodec
+
+import (
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/winkb/tcp1/btmsg"
+)
+
+var _ btmsg.Codec = Codec{}
+
+// 导入这个包之后，其他codec的连接也能解码content type为msgpack的消息
+func init() {
+	btmsg.RegisterContentType(Codec{})
+}
+
+// Codec 字段名和json一样默认用结构体字段名，可以用 msgpack tag 修改
+type Codec struct{}
+
+func (Codec) Marshal(v any) ([]byte, error) {
+	bt, err := msgpack.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "msgpack marshal")
+	}
+	return bt, nil
+}
+
+func (Codec) Unmarshal(bt []byte, v any) error {
+	err := msgpack.Unmarshal(bt, v)
+	if err != nil {
+		return errors.Wrap(err, "msgpack unmarshal")
+	}
+	return nil
+}
+
+func (Codec) ID() byte {
+	return btmsg.CodecIdMsgpack
+}
@@ -0,0 +1,57 @@
+//go:build msgpack
+
+package msgpackcodec
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+)
+
+type inner struct {
+	Tags map[string]int
+}
+
+type outer struct {
+	Name  string
+	At    time.Time
+	Raw   []byte
+	Inner inner
+	Attrs map[string]any
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	v := &outer{
+		Name:  "tom",
+		At:    time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+		Raw:   []byte{0, 1, 2, 255},
+		Inner: inner{Tags: map[string]int{"a": 1, "b": 2}},
+		Attrs: map[string]any{"k": "v"},
+	}
+
+	hd := btmsg.NewMsgHeadTcp()
+	hd.SetAct(1)
+	msg := btmsg.NewMsgWithCodec(hd, nil, Codec{})
+	err := msg.FromStruct(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got outer
+	_, err = msg.ToStruct(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Name != v.Name || !got.At.Equal(v.At) || !bytes.Equal(got.Raw, v.Raw) {
+		t.Fatalf("got %+v", got)
+	}
+	if got.Inner.Tags["b"] != 2 || got.Attrs["k"] != "v" {
+		t.Fatalf("got %+v", got)
+	}
+
+	js, _ := btmsg.JsonCodec{}.Marshal(v)
+	t.Logf("msgpack %d bytes, json %d bytes", len(msg.BodyByte()), len(js))
+}
@@ -0,0 +1,54 @@
+//go:build protobuf
+
+// Package pbcodec btmsg的protobuf编码，依赖 google.golang.org/protobuf，
+// 需要 -tags protobuf 编译，避免没用到protobuf的项目也要下载这个依赖
+package pbcodec
+
+import (
+	"github.com/pkg/errors"
+	"github.com/winkb/tcp1/btmsg"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrNotProto FromStruct/ToStruct传入的不是proto.Message
+var ErrNotProto = errors.New("not proto.Message")
+
+var _ btmsg.Codec = Codec{}
+
+// 导入这个包之后，其他codec的连接也能解码content type为protobuf的消息
+func init() {
+	btmsg.RegisterContentType(Codec{})
+}
+
+// Codec FromStruct/ToStruct只接受proto.Message，ToStruct要传指针
+type Codec struct{}
+
+func (Codec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, errors.Wrapf(ErrNotProto, "marshal %T", v)
+	}
+
+	bt, err := proto.Marshal(m)
+	if err != nil {
+		return nil, errors.Wrap(err, "proto marshal")
+	}
+	return bt, nil
+}
+
+func (Codec) Unmarshal(bt []byte, v any) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return errors.Wrapf(ErrNotProto, "unmarshal %T", v)
+	}
+
+	err := proto.Unmarshal(bt, m)
+	if err != nil {
+		return errors.Wrap(err, "proto unmarshal")
+	}
+	return nil
+}
+
+func (Codec) ID() byte {
+	return btmsg.CodecIdProtobuf
+}
@@ -0,0 +1,114 @@
+//go:build protobuf
+
+package pbcodec
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/btmsg/pbcodec/internal/testpb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type streamReader struct {
+	*bytes.Reader
+}
+
+func (l *streamReader) ReadMessage() (messageType int, p []byte, err error) {
+	panic("stream reader has no message")
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	hd := btmsg.NewMsgHeadTcp()
+	hd.SetAct(1)
+
+	// json会把超过2^53的int64变成float64丢精度
+	msg := btmsg.NewMsgWithCodec(hd, nil, Codec{})
+	err := msg.FromStruct(wrapperspb.Int64(1<<62 + 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got wrapperspb.Int64Value
+	_, err = msg.ToStruct(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Value != 1<<62+1 {
+		t.Fatalf("got %d", got.Value)
+	}
+}
+
+// TestCodecGenerated 用 protoc-gen-go 生成的消息，和业务代码里的用法一样
+func TestCodecGenerated(t *testing.T) {
+	hd := btmsg.NewMsgHeadTcp()
+	hd.SetAct(2)
+
+	user := &testpb.User{Id: 1<<62 + 1, Name: "tom", Tags: []string{"a", "b"}, Role: testpb.Role_ROLE_ADMIN}
+	msg := btmsg.NewMsgWithCodec(hd, nil, Codec{})
+	if err := msg.FromStruct(user); err != nil {
+		t.Fatal(err)
+	}
+
+	// 按收到的字节重新解码一次
+	r := btmsg.NewReaderWithCodec(btmsg.FactoryMsgHeadTcp(), Codec{})
+	res := r.ReadMsg(&streamReader{bytes.NewReader(msg.ToSendByte())})
+	if res.GetErr() != nil {
+		t.Fatal(res.GetErr())
+	}
+	var rsp testpb.User
+	if _, err := res.GetMsg().ToStruct(&rsp); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(user, &rsp) {
+		t.Fatalf("expect %v, got %v", user, &rsp)
+	}
+}
+
+func TestCodecNotProto(t *testing.T) {
+	_, err := Codec{}.Marshal(struct{}{})
+	if !errors.Is(err, ErrNotProto) {
+		t.Fatalf("expect ErrNotProto, got %v", err)
+	}
+
+	err = Codec{}.Unmarshal(nil, &struct{}{})
+	if !errors.Is(err, ErrNotProto) {
+		t.Fatalf("expect ErrNotProto, got %v", err)
+	}
+}
+
+type fieldJson struct {
+	Name     string `json:"name"`
+	Number   int32  `json:"number"`
+	JsonName string `json:"json_name"`
+	TypeName string `json:"type_name"`
+}
+
+func BenchmarkCodec(b *testing.B) {
+	pb := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String("user_id"),
+		Number:   proto.Int32(12),
+		JsonName: proto.String("userId"),
+		TypeName: proto.String(".example.User"),
+	}
+	js := &fieldJson{Name: "user_id", Number: 12, JsonName: "userId", TypeName: ".example.User"}
+
+	b.Run("protobuf", func(b *testing.B) {
+		var c Codec
+		for i := 0; i < b.N; i++ {
+			bt, _ := c.Marshal(pb)
+			_ = c.Unmarshal(bt, &descriptorpb.FieldDescriptorProto{})
+		}
+	})
+	b.Run("json", func(b *testing.B) {
+		var c btmsg.JsonCodec
+		for i := 0; i < b.N; i++ {
+			bt, _ := c.Marshal(js)
+			_ = c.Unmarshal(bt, &fieldJson{})
+		}
+	})
+}
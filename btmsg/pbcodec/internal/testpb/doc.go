@@ -0,0 +1,4 @@
+// Package testpb pbcodec测试用的protobuf消息，test.pb.go 由 test.proto 生成，不要手动修改
+package testpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative test.proto
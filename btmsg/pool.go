@@ -0,0 +1,124 @@
+package btmsg
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// maxPooledBody 超过这个长度的body不放回池子，避免池子长期占着大块内存
+const maxPooledBody = 64 * 1024
+
+// poisonByte debug模式下回收的body会被填满这个值
+const poisonByte = 0xDB
+
+var msgPool = sync.Pool{
+	New: func() any {
+		return &Msg{}
+	},
+}
+
+var bodyPool sync.Pool
+
+// bodyReaderInto 可以把body读到调用方给的buf里，池化的reader用它复用body
+type bodyReaderInto interface {
+	readBodyInto(r IReader, bt []byte) (err error)
+}
+
+// GetMsg 从池子里取一个消息，引用计数为1，用完调用 PutMsg 或者 msg.Release 放回去
+func GetMsg(head IHead) *Msg {
+	msg := msgPool.Get().(*Msg)
+	msg.head = head
+	msg.pooled = true
+	msg.refs = 1
+	return msg
+}
+
+// PutMsg 等同于 msg.Release，引用计数归零才真正放回池子
+func PutMsg(msg *Msg) {
+	msg.Release()
+}
+
+// Retain 需要在回调返回之后继续使用消息时调用，每次Retain都要对应一次Release
+// 不是从池子里取的消息调用没有效果
+func (l *Msg) Retain() {
+	if !l.pooled {
+		return
+	}
+	l.checkLive()
+	atomic.AddInt32(&l.refs, 1)
+}
+
+// Release 引用计数减一，归零时消息和body放回池子，之后不能再使用这个消息
+// 不是从池子里取的消息调用没有效果
+func (l *Msg) Release() {
+	if !l.pooled {
+		return
+	}
+
+	n := atomic.AddInt32(&l.refs, -1)
+	if n > 0 {
+		return
+	}
+	if n < 0 {
+		if poolDebug {
+			panic("btmsg: msg released too many times")
+		}
+		return
+	}
+
+	l.recycle()
+}
+
+func (l *Msg) recycle() {
+	buf := l.buf
+	if poolDebug {
+		// 不放回池子，回收之后的使用读到的都是poisonByte，访问方法直接panic
+		if buf != nil {
+			for i := range *buf {
+				(*buf)[i] = poisonByte
+			}
+		}
+		l.released = true
+		return
+	}
+
+	if buf != nil && cap(*buf) <= maxPooledBody {
+		*buf = (*buf)[:0]
+		bodyPool.Put(buf)
+	}
+
+	*l = Msg{}
+	msgPool.Put(l)
+}
+
+// checkLive debug模式下使用已经回收的消息直接panic
+func (l *Msg) checkLive() {
+	if poolDebug && l.released {
+		panic("btmsg: use of released msg")
+	}
+}
+
+// getBody 从池子里取长度为n的buf，太大的不走池子
+// 返回指针，放回池子的时候不用再分配
+func getBody(n uint32) *[]byte {
+	if n <= maxPooledBody {
+		if v, ok := bodyPool.Get().(*[]byte); ok {
+			if uint32(cap(*v)) >= n {
+				*v = (*v)[:n]
+				return v
+			}
+			bodyPool.Put(v)
+		}
+	}
+
+	bt := make([]byte, n, bodyCap(n))
+	return &bt
+}
+
+// bodyCap 小body也按1k起分配，放回池子之后能给更多的消息复用
+func bodyCap(n uint32) uint32 {
+	if n < 1024 {
+		return 1024
+	}
+	return n
+}
@@ -0,0 +1,6 @@
+//go:build btmsgdebug
+
+package btmsg
+
+// poolDebug 用 -tags btmsgdebug 编译时打开，回收之后再使用消息会panic
+const poolDebug = true
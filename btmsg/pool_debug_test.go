@@ -0,0 +1,33 @@
+//go:build btmsgdebug
+
+package btmsg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPooledMsgUseAfterRelease(t *testing.T) {
+	hd := NewMsgHeadTcp()
+	hd.SetAct(1)
+	frame := NewMsg(hd, []byte("body")).ToSendByte()
+
+	res := NewReader(FactoryMsgHeadTcp(), WithPooledMsg()).ReadMsg(&streamReader{bytes.NewReader(frame)})
+	if res.GetErr() != nil {
+		t.Fatal(res.GetErr())
+	}
+	msg := res.GetMsg()
+	body := msg.BodyByte()
+	msg.Release()
+
+	if !bytes.Equal(body, bytes.Repeat([]byte{poisonByte}, len(body))) {
+		t.Fatalf("body not poisoned: %q", body)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expect panic")
+		}
+	}()
+	msg.BodyByte()
+}
@@ -0,0 +1,5 @@
+//go:build !btmsgdebug
+
+package btmsg
+
+const poolDebug = false
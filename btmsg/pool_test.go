@@ -0,0 +1,68 @@
+package btmsg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReaderPooledMsg(t *testing.T) {
+	frame := seqMsg(3, 9, []byte("pooled body")).ToSendByte()
+
+	r := NewReader(FactoryMsgHeadTcpSeq(), WithPooledMsg())
+	for i := 0; i < 3; i++ {
+		res := r.ReadMsg(&streamReader{bytes.NewReader(frame)})
+		if res.GetErr() != nil {
+			t.Fatal(res.GetErr())
+		}
+
+		msg := res.GetMsg()
+		if msg.GetAct() != 3 || msg.GetSeq() != 9 || string(msg.BodyByte()) != "pooled body" {
+			t.Fatalf("got act %d seq %d body %q", msg.GetAct(), msg.GetSeq(), msg.BodyByte())
+		}
+
+		msg.Retain()
+		msg.Release()
+		if string(msg.BodyByte()) != "pooled body" {
+			t.Fatal("released while retained")
+		}
+		msg.Release()
+	}
+}
+
+func TestMsgReleaseNotPooled(t *testing.T) {
+	msg := NewMsg(NewMsgHeadTcp(), []byte("keep"))
+	msg.Retain()
+	msg.Release()
+	msg.Release()
+	if string(msg.BodyByte()) != "keep" {
+		t.Fatalf("got %q", msg.BodyByte())
+	}
+}
+
+func benchmarkReadMsg(b *testing.B, opts ...ReaderOption) {
+	hd := NewMsgHeadTcp()
+	hd.SetAct(1)
+	frame := NewMsg(hd, bytes.Repeat([]byte("x"), 512)).ToSendByte()
+	stream := bytes.Repeat(frame, b.N)
+
+	r := NewReader(FactoryMsgHeadTcp(), opts...)
+	sr := &streamReader{bytes.NewReader(stream)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res := r.ReadMsg(sr)
+		if res.GetErr() != nil {
+			b.Fatal(res.GetErr())
+		}
+		res.GetMsg().Release()
+	}
+}
+
+func BenchmarkReadMsg(b *testing.B) {
+	benchmarkReadMsg(b)
+}
+
+func BenchmarkReadMsgPooled(b *testing.B) {
+	benchmarkReadMsg(b, WithPooledMsg())
+}
@@ -1,29 +1,187 @@
 package btmsg
 
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+
+	"github.com/pkg/errors"
+)
+
+var ErrMsgTooLarge = errors.New("msg too large")
+
+// MsgTooLargeError head声明的body长度超过限制，errors.Is(err, ErrMsgTooLarge) 为true
+type MsgTooLargeError struct {
+	// Size head里声明的body长度
+	Size uint32
+	Max  uint32
+}
+
+func (l *MsgTooLargeError) Error() string {
+	// 长度按另一种字节序解析就不超限，多半是两端字节序不一致
+	if bits.ReverseBytes32(l.Size) <= l.Max {
+		return fmt.Sprintf("msg too large: body size %d, max %d, byte order mismatch?", l.Size, l.Max)
+	}
+	return fmt.Sprintf("msg too large: body size %d, max %d", l.Size, l.Max)
+}
+
+func (l *MsgTooLargeError) Is(target error) bool {
+	return target == ErrMsgTooLarge
+}
+
+type ReaderOption func(l *Reader)
+
+// WithMaxBodySize head声明的body长度超过n时不再读取body，直接返回 ErrMsgTooLarge，0表示不限制
+func WithMaxBodySize(n uint32) ReaderOption {
+	return func(l *Reader) {
+		l.maxBodySize = n
+	}
+}
+
+// WithPooledMsg 读到的消息从 GetMsg 取，body也复用，使用方处理完要调用Release
+func WithPooledMsg() ReaderOption {
+	return func(l *Reader) {
+		l.pooled = true
+	}
+}
+
 type Reader struct {
-	f func()IHead
+	f           func() IHead
+	maxBodySize uint32
+	codec       Codec
+	strictFlags bool
+	pooled      bool
+	order       binary.ByteOrder
+	magic       *[2]byte
+	magicScan   int
+	strictMagic bool
+	onCorrupt   func(skipped int)
+	replyAct    ReplyAct
+
+	decompressor    Compressor
+	maxDecompressed uint32
 }
 
-func NewReader(f func()IHead) *Reader {
-	return &Reader{
+func NewReader(f func() IHead, opts ...ReaderOption) *Reader {
+	l := &Reader{
 		f: f,
 	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	// magic在最外层，字节序只影响里面的head
+	if l.order != nil {
+		l.f = FactoryWithByteOrder(l.f, l.order)
+	}
+	if l.magic != nil {
+		l.f = FactoryWithMagic(l.f, *l.magic)
+	}
+
+	return l
+}
+
+// NewReaderWithCodec 读到的消息用c解码body，见 NewMsgWithCodec
+func NewReaderWithCodec(f func() IHead, c Codec, opts ...ReaderOption) *Reader {
+	l := NewReader(f, opts...)
+	l.codec = c
+	return l
 }
 
 func (l *Reader) ReadMsg(r IReader) (res IReadResult) {
 	var err error
 	var head = l.f()
 
+	if mh, ok := head.(*magicHead); ok {
+		var skipped int
+		skipped, err = l.readMagic(r, mh.magic)
+		l.reportCorrupt(skipped)
+		if err != nil {
+			return NewReaderResult(err, head, nil)
+		}
+	}
+
 	err = head.Read(r)
 	if err != nil {
 		return NewReaderResult(err, head, nil)
 	}
 
+	err = l.checkHead(head)
+	if err != nil {
+		return NewReaderResult(err, head, nil)
+	}
+
+	if l.pooled {
+		return l.readPooled(r, head)
+	}
+
 	var body []byte
 	err, body = head.ReadBody(r)
 	if err != nil {
 		return NewReaderResult(err, head, nil)
 	}
 
-	return NewReaderResult(err, head, body)
+	var traceID TraceID
+	traceID, body, err = splitTraceID(head, body)
+	if err != nil {
+		return NewReaderResult(err, head, nil)
+	}
+
+	body, err = l.decompress(head, body)
+	if err != nil {
+		return NewReaderResult(err, head, nil)
+	}
+
+	result := NewReaderResult(err, head, body)
+	result.traceID = traceID
+	result.codec = l.codec
+	result.replyAct = l.replyAct
+	return result
+}
+
+func (l *Reader) readPooled(r IReader, head IHead) (res IReadResult) {
+	var err error
+	var msg = GetMsg(head)
+	msg.codec = l.codec
+	msg.replyAct = l.replyAct
+
+	// 大body不走池子，也不按head声明的长度一次分配
+	if hd, ok := head.(bodyReaderInto); ok && head.BodySize() <= maxPooledBody {
+		msg.buf = getBody(head.BodySize())
+		msg.bodyBt = *msg.buf
+		err = hd.readBodyInto(r, msg.bodyBt)
+	} else {
+		err, msg.bodyBt = head.ReadBody(r)
+	}
+
+	if err == nil {
+		msg.traceID, msg.bodyBt, err = splitTraceID(head, msg.bodyBt)
+	}
+	if err == nil {
+		msg.bodyBt, err = l.decompress(head, msg.bodyBt)
+	}
+
+	if err != nil {
+		msg.Release()
+		return NewReaderResult(err, head, nil)
+	}
+
+	result := NewReaderResult(nil, head, msg.bodyBt)
+	result.msg = msg
+	return result
+}
+
+// checkHead 读body之前检查head，ReadMsg和FrameDecoder共用
+func (l *Reader) checkHead(head IHead) error {
+	if l.strictFlags && head.GetFlags()&^FlagsKnown != 0 {
+		return errors.Wrapf(ErrUnknownFlags, "flags %08b", head.GetFlags())
+	}
+
+	if l.maxBodySize > 0 && head.BodySize() > l.maxBodySize {
+		// 不分配body，剩下的数据也没法再读，调用方应该断开连接
+		return &MsgTooLargeError{Size: head.BodySize(), Max: l.maxBodySize}
+	}
+
+	return nil
 }
@@ -6,9 +6,13 @@ import (
 )
 
 type ReaderResult struct {
-	err  error
-	head IHead
-	body []byte
+	err      error
+	head     IHead
+	body     []byte
+	codec    Codec
+	traceID  TraceID
+	replyAct ReplyAct
+	msg      *Msg
 }
 
 func NewReaderResult(err error, head IHead, body []byte) *ReaderResult {
@@ -40,5 +44,11 @@ func (l *ReaderResult) GetErr() error {
 }
 
 func (l *ReaderResult) GetMsg() IMsg {
-	return NewMsg(l.head, l.body)
+	if l.msg != nil {
+		return l.msg
+	}
+	msg := NewMsgWithCodec(l.head, l.body, l.codec)
+	msg.traceID = l.traceID
+	msg.replyAct = l.replyAct
+	return msg
 }
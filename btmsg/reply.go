@@ -0,0 +1,65 @@
+package btmsg
+
+// ReplyAct 请求的act对应的回复act，收发两端要使用相同的规则
+type ReplyAct func(act uint16) uint16
+
+// ReplySameAct 回复和请求的act一样，默认规则
+func ReplySameAct(act uint16) uint16 {
+	return act
+}
+
+// ReplyHighBit 回复的act是请求的act|0x8000，请求的act不能使用最高位
+func ReplyHighBit(act uint16) uint16 {
+	return act | 0x8000
+}
+
+// ReplyTable 按表查回复的act，表里没有的和请求一样
+func ReplyTable(table map[uint16]uint16) ReplyAct {
+	return func(act uint16) uint16 {
+		if v, ok := table[act]; ok {
+			return v
+		}
+		return act
+	}
+}
+
+// replyFlagsKept 回复只保留codec id和trace id，压缩、需要ack这些是请求自己的
+const replyFlagsKept = FlagCodecMask | FlagTraceID
+
+// WithReplyAct 读到的消息NewReply时用m决定回复的act，默认 ReplySameAct
+func WithReplyAct(m ReplyAct) ReaderOption {
+	return func(l *Reader) {
+		l.replyAct = m
+	}
+}
+
+func (l ReplyAct) of(act uint16) uint16 {
+	if l == nil {
+		return act
+	}
+	return l(act)
+}
+
+// IsReply rsp是不是act为reqAct的请求的回复，错误回复总是，seq由调用方比较
+func (l ReplyAct) IsReply(reqAct uint16, rsp IMsg) bool {
+	return rsp.GetAct() == ActError || rsp.GetAct() == l.of(reqAct)
+}
+
+// NewReply 创建回复，seq、codec和trace id不变，act按reader的 WithReplyAct 规则，请求独有的flags去掉
+func (l *Msg) NewReply() IMsg {
+	l.checkLive()
+	rsp := NewReplyTo(l)
+	rsp.SetAct(l.replyAct.of(l.GetAct()))
+	rsp.SetFlags(l.GetFlags() & replyFlagsKept)
+	return rsp
+}
+
+// ReplyTo 用 NewReply 创建回复，body由v编码
+func ReplyTo(req IMsg, v any) (IMsg, error) {
+	rsp := req.NewReply()
+	err := rsp.FromStruct(v)
+	if err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
@@ -0,0 +1,55 @@
+package btmsg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNewReply(t *testing.T) {
+	hd := NewMsgHeadTcpV2()
+	hd.SetAct(3)
+	hd.SetSeq(9)
+	hd.SetFlags(FlagAckRequired | FlagCompressed | 0x20)
+	req := NewMsg(hd, []byte("req"))
+
+	var cases = []struct {
+		name string
+		m    ReplyAct
+		act  uint16
+	}{
+		{"default", nil, 3},
+		{"same", ReplySameAct, 3},
+		{"high bit", ReplyHighBit, 0x8003},
+		{"table", ReplyTable(map[uint16]uint16{3: 4}), 4},
+		{"table miss", ReplyTable(map[uint16]uint16{1: 2}), 3},
+	}
+
+	for _, c := range cases {
+		bt := req.ToSendByte()
+		res := NewReader(FactoryMsgHeadTcpV2(), WithReplyAct(c.m)).ReadMsg(&streamReader{bytes.NewReader(bt)})
+		if res.GetErr() != nil {
+			t.Fatal(res.GetErr())
+		}
+
+		rsp, err := ReplyTo(res.GetMsg(), &codecUser{Name: "tom"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rsp.GetAct() != c.act || rsp.GetSeq() != 9 {
+			t.Fatalf("%s: act %d seq %d", c.name, rsp.GetAct(), rsp.GetSeq())
+		}
+		if rsp.GetFlags() != 0x20 {
+			t.Fatalf("%s: flags %08b", c.name, rsp.GetFlags())
+		}
+		if !c.m.IsReply(3, rsp) {
+			t.Fatalf("%s: not a reply", c.name)
+		}
+	}
+
+	// 错误回复总是算回复，act对不上的不算
+	errRsp, _ := NewErrorReply(req, 1, "bad")
+	other := NewActMsg(5, nil)
+	if !ReplyAct(ReplyHighBit).IsReply(3, errRsp) || ReplyAct(ReplyHighBit).IsReply(3, other) {
+		t.Fatal("IsReply")
+	}
+}
@@ -0,0 +1,48 @@
+package btmsg
+
+import (
+	"reflect"
+	"sync/atomic"
+)
+
+var lastSeq uint32
+
+// NextSeq 全局递增的seq，可以并发调用，跳过0，因为0表示不需要对应回复
+func NextSeq() uint32 {
+	for {
+		seq := atomic.AddUint32(&lastSeq, 1)
+		if seq != 0 {
+			return seq
+		}
+	}
+}
+
+// NewReplyTo 创建req的回复，head和req同一个类型，act、seq和trace id和req一样，body为空
+func NewReplyTo(req IMsg) *Msg {
+	msg, ok := req.(*Msg)
+	if !ok {
+		hd := NewMsgHeadTcp()
+		hd.SetAct(req.GetAct())
+		hd.SetSeq(req.GetSeq())
+		return NewMsg(hd, nil)
+	}
+
+	hd := newHeadLike(msg.head)
+	hd.SetAct(msg.GetAct())
+	hd.SetSeq(msg.GetSeq())
+
+	rsp := NewMsgWithCodec(hd, nil, msg.codec)
+	if id, ok := msg.GetTraceID(); ok {
+		rsp.SetTraceID(id)
+	}
+	return rsp
+}
+
+// newHeadLike 创建和hd同一个类型的空head，包装类型的head自己实现newHead
+func newHeadLike(hd IHead) IHead {
+	if v, ok := hd.(interface{ newHead() IHead }); ok {
+		return v.newHead()
+	}
+
+	return reflect.New(reflect.TypeOf(hd).Elem()).Interface().(IHead)
+}
@@ -0,0 +1,82 @@
+package btmsg
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+// seqMsg 用 MsgHeadTcpSeq 创建消息
+func seqMsg(act uint16, seq uint32, body []byte) *Msg {
+	hd := NewMsgHeadTcpSeq()
+	hd.SetAct(act)
+	hd.SetSeq(seq)
+	return NewMsg(hd, body)
+}
+
+func TestNextSeq(t *testing.T) {
+	var lock sync.Mutex
+	var seen = map[uint32]bool{}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				seq := NextSeq()
+				lock.Lock()
+				if seq == 0 || seen[seq] {
+					t.Errorf("bad seq %d", seq)
+				}
+				seen[seq] = true
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestNewReplyTo(t *testing.T) {
+	hd := NewMsgHeadTcpV2()
+	hd.SetAct(7)
+	hd.SetSeq(NextSeq())
+	hd.SetFlags(FlagAckRequired)
+	req := NewMsg(hd, []byte(`{"name":"req"}`))
+
+	rsp := NewReplyTo(req)
+	_ = rsp.FromStruct(&codecUser{Name: "rsp"})
+
+	if _, ok := rsp.head.(*MsgHeadTcpV2); !ok {
+		t.Fatalf("reply head %T", rsp.head)
+	}
+	if rsp.GetAct() != 7 || rsp.GetSeq() != req.GetSeq() || rsp.GetFlags() != 0 {
+		t.Fatalf("reply act %d seq %d flags %d", rsp.GetAct(), rsp.GetSeq(), rsp.GetFlags())
+	}
+
+	res := NewReader(FactoryMsgHeadTcpV2()).ReadMsg(&streamReader{bytes.NewReader(rsp.ToSendByte())})
+	if res.GetErr() != nil || res.GetMsg().GetSeq() != req.GetSeq() {
+		t.Fatalf("read seq %d err %v", res.GetMsg().GetSeq(), res.GetErr())
+	}
+}
+
+func TestErrorReply(t *testing.T) {
+	hd := NewMsgHeadTcpSeq()
+	hd.SetAct(9)
+	hd.SetSeq(5)
+	req := NewMsg(hd, nil)
+
+	if _, _, ok := req.GetError(); ok {
+		t.Fatal("normal msg is not error")
+	}
+
+	rsp, err := NewErrorReply(req, 404, "not found")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := NewReader(FactoryMsgHeadTcpSeq()).ReadMsg(&streamReader{bytes.NewReader(rsp.ToSendByte())})
+	code, text, ok := res.GetMsg().GetError()
+	if !ok || code != 404 || text != "not found" || res.GetMsg().GetSeq() != 5 {
+		t.Fatalf("code %d text %q ok %v", code, text, ok)
+	}
+}
@@ -0,0 +1,98 @@
+package btmsg
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+)
+
+// traceIDSize 带 FlagTraceID 时body前面的trace id长度
+const traceIDSize = 16
+
+var ErrBadTraceID = errors.New("bad trace id")
+
+// TraceID 跨client、server和下游服务关联同一个请求，全0表示没有
+type TraceID [traceIDSize]byte
+
+// NewTraceID 随机生成
+func NewTraceID() TraceID {
+	var id TraceID
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+func (l TraceID) IsZero() bool {
+	return l == TraceID{}
+}
+
+func (l TraceID) String() string {
+	return hex.EncodeToString(l[:])
+}
+
+// SetTraceID 设置之后带上 FlagTraceID，发送时trace id放在body前面
+// head不能带flags时没有效果，比如 MsgHeadTcp，MsgHeadWs 的body是json，不要设置
+func (l *Msg) SetTraceID(id TraceID) {
+	flags := l.head.GetFlags() &^ FlagTraceID
+	if !id.IsZero() {
+		flags |= FlagTraceID
+	}
+	l.head.SetFlags(flags)
+	if l.HasFlag(FlagTraceID) {
+		l.traceID = id
+	} else {
+		l.traceID = TraceID{}
+	}
+}
+
+// GetTraceID 没有设置或者head不支持时ok为false
+func (l *Msg) GetTraceID() (id TraceID, ok bool) {
+	if !l.HasFlag(FlagTraceID) || l.traceID.IsZero() {
+		return TraceID{}, false
+	}
+	return l.traceID, true
+}
+
+// wireSize 发送时head里的size，带trace id时包括它
+func (l *Msg) wireSize(body int) uint32 {
+	if l.HasFlag(FlagTraceID) {
+		body += traceIDSize
+	}
+	return uint32(body)
+}
+
+// appendTraceID 带 FlagTraceID 时在head后面写入trace id
+func (l *Msg) appendTraceID(bt []byte) []byte {
+	if !l.HasFlag(FlagTraceID) {
+		return bt
+	}
+	return append(bt, l.traceID[:]...)
+}
+
+// splitTraceID 带 FlagTraceID 时从body开头取出trace id，在解压之前调用
+func splitTraceID(head IHead, body []byte) (TraceID, []byte, error) {
+	var id TraceID
+	if head.GetFlags()&FlagTraceID == 0 {
+		return id, body, nil
+	}
+
+	if len(body) < traceIDSize {
+		return id, nil, errors.Wrapf(ErrBadTraceID, "body len %d", len(body))
+	}
+	copy(id[:], body)
+	return id, body[traceIDSize:], nil
+}
+
+type traceIDKey struct{}
+
+// ContextWithTraceID 处理消息时把trace id传给下游，见 TraceIDFromContext
+func ContextWithTraceID(ctx context.Context, id TraceID) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, id)
+}
+
+// TraceIDFromContext 没有trace id时ok为false
+func TraceIDFromContext(ctx context.Context) (id TraceID, ok bool) {
+	id, ok = ctx.Value(traceIDKey{}).(TraceID)
+	return id, ok && !id.IsZero()
+}
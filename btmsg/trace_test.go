@@ -0,0 +1,123 @@
+package btmsg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTraceIDRoundTrip(t *testing.T) {
+	id := NewTraceID()
+	body := bytes.Repeat([]byte("trace me "), 100)
+	hd := NewMsgHeadTcpV2()
+	hd.SetAct(1)
+	msg := NewMsg(hd, body)
+	msg.SetTraceID(id)
+
+	plain := msg.ToSendByte()
+	if msg.BodySize() != uint32(len(body)+traceIDSize) || len(plain) != int(msg.HeadSize())+len(body)+traceIDSize {
+		t.Fatalf("size %d frame %d", msg.BodySize(), len(plain))
+	}
+	compressed, saved, err := msg.ToSendByteCompress(DefaultCompressor, 64)
+	if err != nil || saved <= 0 {
+		t.Fatalf("saved %d err %v", saved, err)
+	}
+
+	check := func(name string, got IMsg) {
+		t.Helper()
+		v, ok := got.GetTraceID()
+		if !ok || v != id || !bytes.Equal(got.BodyByte(), body) {
+			t.Fatalf("%s: trace %s %v body %d", name, v, ok, len(got.BodyByte()))
+		}
+	}
+
+	for _, frame := range [][]byte{plain, compressed} {
+		for _, r := range []*Reader{
+			NewReader(FactoryMsgHeadTcpV2(), WithDecompressor(DefaultCompressor, 0), WithStrictFlags()),
+			NewReader(FactoryMsgHeadTcpV2(), WithDecompressor(DefaultCompressor, 0), WithPooledMsg()),
+		} {
+			res := r.ReadMsg(&streamReader{bytes.NewReader(frame)})
+			if res.GetErr() != nil {
+				t.Fatal(res.GetErr())
+			}
+			check("reader", res.GetMsg())
+			check("clone", res.GetMsg().Clone())
+			res.GetMsg().Release()
+		}
+
+		msgs, err := NewFrameDecoder(FactoryMsgHeadTcpV2(), WithDecompressor(DefaultCompressor, 0)).Feed(frame)
+		if err != nil || len(msgs) != 1 {
+			t.Fatalf("decoder %d msgs err %v", len(msgs), err)
+		}
+		check("decoder", msgs[0])
+	}
+
+	// 清掉之后不再带上
+	msg.SetTraceID(TraceID{})
+	if _, ok := msg.GetTraceID(); ok || len(msg.ToSendByte()) != int(msg.HeadSize())+len(body) {
+		t.Fatalf("flags %08b", msg.GetFlags())
+	}
+}
+
+func TestTraceIDReply(t *testing.T) {
+	id := NewTraceID()
+	hd := NewMsgHeadTcpV3()
+	hd.SetAct(3)
+	hd.SetSeq(9)
+	req := NewMsg(hd, nil)
+	_ = req.FromStruct(&codecUser{Name: "tom"})
+	req.SetTraceID(id)
+	req.SetFlags(req.GetFlags() | FlagAckRequired)
+
+	res := NewReader(FactoryMsgHeadTcpV3()).ReadMsg(&streamReader{bytes.NewReader(req.ToSendByte())})
+	if res.GetErr() != nil {
+		t.Fatal(res.GetErr())
+	}
+
+	rsp, err := ReplyTo(res.GetMsg(), &codecUser{Name: "jerry"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errRsp, err := NewErrorReply(res.GetMsg(), 1, "fail")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []IMsg{rsp, errRsp} {
+		got := NewReader(FactoryMsgHeadTcpV3()).ReadMsg(&streamReader{bytes.NewReader(v.ToSendByte())}).GetMsg()
+		if tid, ok := got.GetTraceID(); !ok || tid != id || got.HasFlag(FlagAckRequired) {
+			t.Fatalf("act %d trace %s flags %08b", got.GetAct(), tid, got.GetFlags())
+		}
+	}
+}
+
+func TestTraceIDUnsupported(t *testing.T) {
+	msg := NewActMsg(1, []byte("body"))
+	msg.SetTraceID(NewTraceID())
+	if _, ok := msg.GetTraceID(); ok {
+		t.Fatal("MsgHeadTcp has no flags")
+	}
+
+	// 带了flag但是body不够16字节
+	hd := NewMsgHeadTcpV2()
+	hd.SetFlags(FlagTraceID)
+	hd.SetSize(4)
+	frame := append(hd.ToBytes(), "body"...)
+	res := NewReader(FactoryMsgHeadTcpV2()).ReadMsg(&streamReader{bytes.NewReader(frame)})
+	if !errors.Is(res.GetErr(), ErrBadTraceID) {
+		t.Fatalf("expect ErrBadTraceID, got %v", res.GetErr())
+	}
+}
+
+func TestTraceIDContext(t *testing.T) {
+	if _, ok := TraceIDFromContext(context.Background()); ok {
+		t.Fatal("expect no trace id")
+	}
+
+	id := NewTraceID()
+	got, ok := TraceIDFromContext(ContextWithTraceID(context.Background(), id))
+	if !ok || got != id || len(got.String()) != 32 {
+		t.Fatalf("got %s %v", got, ok)
+	}
+}
@@ -0,0 +1,53 @@
+package contracts
+
+import "strconv"
+
+// CloseReason 服务端连接关闭的原因，见 ServerCloseReasonCallback
+type CloseReason int32
+
+const (
+	// ClosePeerClosed 对端断开
+	ClosePeerClosed CloseReason = iota + 1
+	// CloseServerClosed 服务端调用 CloseConn，或者超过待写字节数的上限
+	CloseServerClosed
+	// CloseIdleTimeout 读超时，比如 WithFirstMessageTimeout
+	CloseIdleTimeout
+	// CloseKicked 同一个身份在别的连接登录，被踢下线
+	CloseKicked
+	// CloseWriteError 写出错，没写完的帧已经没法接着写
+	CloseWriteError
+	// CloseProtocolError 收到的数据没法解析，或者违规次数太多
+	CloseProtocolError
+	// CloseShutdown server Shutdown 或者 Close
+	CloseShutdown
+)
+
+var closeReasonNames = map[CloseReason]string{
+	ClosePeerClosed:    "peer_closed",
+	CloseServerClosed:  "server_closed",
+	CloseIdleTimeout:   "idle_timeout",
+	CloseKicked:        "kicked",
+	CloseWriteError:    "write_error",
+	CloseProtocolError: "protocol_error",
+	CloseShutdown:      "shutdown",
+}
+
+func (l CloseReason) String() string {
+	if name, ok := closeReasonNames[l]; ok {
+		return name
+	}
+	return "close_reason(" + strconv.Itoa(int(l)) + ")"
+}
+
+// Flags 兼容 ServerCloseCallback 的两个参数
+// 对端断开只有isClient，写出错分不清是哪一边，两个都是true，其他都是服务端关闭
+func (l CloseReason) Flags() (isServer bool, isClient bool) {
+	switch l {
+	case ClosePeerClosed:
+		return false, true
+	case CloseWriteError:
+		return true, true
+	default:
+		return true, false
+	}
+}
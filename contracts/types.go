@@ -1,19 +1,59 @@
 package contracts
 
 import (
+	"context"
+	"errors"
+	"io"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/winkb/tcp1/btmsg"
 )
 
+var (
+	// ErrSendTimeout SendWithTimeout 在限定的时间内没有交给连接的写协程
+	ErrSendTimeout = errors.New("send timeout")
+	// ErrClosed 连接已经关闭，和mytcp的ErrConnClosed是同一个值
+	ErrClosed = errors.New("conn closed")
+	// ErrBackpressure 所有连接待写的字节数到了 PendingBudget 的上限
+	ErrBackpressure = errors.New("backpressure")
+)
+
 type ServerCloseCallback func(s ITcpServer, conn *TcpConn, isServer bool, isClient bool)
+
+// ServerCloseReasonCallback 每个连接只调用一次，包括Shutdown时还没有断开的连接
+type ServerCloseReasonCallback func(s ITcpServer, conn *TcpConn, reason CloseReason)
+
+// Reason 转成 ServerCloseReasonCallback，isServer isClient 由 CloseReason.Flags 得到
+func (f ServerCloseCallback) Reason() ServerCloseReasonCallback {
+	if f == nil {
+		return nil
+	}
+	return func(s ITcpServer, conn *TcpConn, reason CloseReason) {
+		isServer, isClient := reason.Flags()
+		f(s, conn, isServer, isClient)
+	}
+}
+
 type ServerReceiveCallback func(s ITcpServer, conn *TcpConn, msg btmsg.IMsg)
 
+// ServerReceiveCtxCallback ctx带着消息的trace id，见 btmsg.TraceIDFromContext
+type ServerReceiveCtxCallback func(ctx context.Context, s ITcpServer, conn *TcpConn, msg btmsg.IMsg)
+
+type ClientReceiveCallback func(msg btmsg.IMsg)
+type ClientCloseCallback func(isServer bool, isClient bool)
+
+// ITcpServer 业务代码使用的server，每个连接的读写循环不在这里
 type ITcpServer interface {
+	// Close 先等排队的消息写完再Shutdown，可以重复调用
+	// 不兼容的改动：以前的 Close(conn) 关闭一个连接，现在改名为 CloseConn，Close() 关闭整个server
+	io.Closer
 	Shutdown()
 	Send(conn *TcpConn, v btmsg.IMsg)
-	Close(conn *TcpConn)
+	// CloseConn 服务端主动关闭一个连接，就是以前的 Close(conn)
+	CloseConn(conn *TcpConn)
 	SendById(id uint64, v btmsg.IMsg)
 	OnReceive(f ServerReceiveCallback)
 	OnClose(f ServerCloseCallback)
@@ -21,12 +61,43 @@ type ITcpServer interface {
 	Broadcast(bt btmsg.IMsg)
 }
 
+// ITcpClient 业务代码使用的client，只包含收发和生命周期，方便替换成测试用的fake
+type ITcpClient interface {
+	Start() (wg *sync.WaitGroup, err error)
+	Send(v btmsg.IMsg) error
+	SendMsg(msg btmsg.IMsg) error
+	OnReceive(f ClientReceiveCallback)
+	OnClose(f ClientCloseCallback)
+	io.Closer
+	Done() <-chan struct{}
+}
+
 type IConn interface {
+	// GetRemoteIp 对端的ip，不带端口，见 RemoteIp
 	GetRemoteIp() string
 	net.Conn
 	ReadMessage() (messageType int, p []byte, err error)
 }
 
+// ConnProtocol 连接使用的协议，开启协议探测时由第一个消息的开头决定
+type ConnProtocol int
+
+const (
+	// ProtocolFramed btmsg的帧，默认
+	ProtocolFramed ConnProtocol = iota
+	// ProtocolText 换行结尾的文本，每一行是一个消息
+	ProtocolText
+)
+
+// Priority 发送的优先级，写协程先处理高优先级的消息，同一个优先级按发送的顺序
+type Priority int
+
+const (
+	PriorityNormal Priority = iota
+	// PriorityHigh 控制消息用，比如心跳、踢下线的通知，不会排在大量的业务消息后面
+	PriorityHigh
+)
+
 type TcpConn struct {
 	Conn     IConn
 	Id       uint64
@@ -35,6 +106,233 @@ type TcpConn struct {
 	WaitConn chan bool
 	Lock     sync.RWMutex
 	IsClose  bool
+	// Protocol 在Lock里修改，收到第一个消息之后不再变化
+	Protocol ConnProtocol
+	// InputHigh PriorityHigh 的消息，为nil时和普通消息一样走Input
+	InputHigh chan btmsg.IMsg
+	// Budget 由server设置，为nil时不记录待写的字节数
+	Budget *PendingBudget
+	// Pending 已经Reserve还没有写入的字节数，用atomic读
+	Pending int64
+	// Queued 已经Reserve还没有写入的消息数，没有Budget时也记录，用atomic读
+	Queued int64
+	// Received Sent 由server在读到和写入每个消息时记录，见 Stats
+	Received RateCounter
+	Sent     RateCounter
+	// ConnectedAt server接受连接的时间
+	ConnectedAt time.Time
+	// BytesIn BytesOut 收发的总字节数，LastActive 最后一次收发的unix纳秒，都用atomic读
+	BytesIn    uint64
+	BytesOut   uint64
+	LastActive int64
+	// closeReason 见 SetCloseReason
+	closeReason int32
+}
+
+// SetCloseReason 记录连接关闭的原因，只有第一次有效，返回是否记录成功
+func (l *TcpConn) SetCloseReason(reason CloseReason) bool {
+	return atomic.CompareAndSwapInt32(&l.closeReason, 0, int32(reason))
+}
+
+// CloseReason 还没有关闭时返回0
+func (l *TcpConn) CloseReason() CloseReason {
+	return CloseReason(atomic.LoadInt32(&l.closeReason))
+}
+
+// rateBuckets 每秒一个桶，最近60个完整的秒加上当前这一秒
+const rateBuckets = 61
+
+// Rate 每秒的消息数和字节数
+type Rate struct {
+	Msgs  float64
+	Bytes float64
+}
+
+// RateWindows 最近1秒、10秒、60秒的平均速率，都不算还没有结束的当前这一秒
+type RateWindows struct {
+	Last1s  Rate
+	Last10s Rate
+	Last60s Rate
+}
+
+// RateCounter 按秒分桶的滑动窗口，零值可以直接使用
+type RateCounter struct {
+	lock    sync.Mutex
+	buckets [rateBuckets]rateBucket
+}
+
+type rateBucket struct {
+	sec   int64
+	msgs  uint64
+	bytes uint64
+}
+
+// Add 记录now这一秒的一个消息，桶里是60秒以前的数据时先清空
+func (l *RateCounter) Add(now time.Time, bytes int) {
+	sec := now.Unix()
+	l.lock.Lock()
+	b := &l.buckets[sec%rateBuckets]
+	if b.sec != sec {
+		*b = rateBucket{sec: sec}
+	}
+	b.msgs++
+	b.bytes += uint64(bytes)
+	l.lock.Unlock()
+}
+
+// Windows now之前的完整的秒里的平均速率
+func (l *RateCounter) Windows(now time.Time) RateWindows {
+	var windows = [...]int64{1, 10, 60}
+	var msgs, bytes [len(windows)]uint64
+
+	sec := now.Unix()
+	l.lock.Lock()
+	for _, b := range l.buckets {
+		age := sec - b.sec
+		for i, w := range windows {
+			if age >= 1 && age <= w {
+				msgs[i] += b.msgs
+				bytes[i] += b.bytes
+			}
+		}
+	}
+	l.lock.Unlock()
+
+	var res [len(windows)]Rate
+	for i, w := range windows {
+		res[i] = Rate{Msgs: float64(msgs[i]) / float64(w), Bytes: float64(bytes[i]) / float64(w)}
+	}
+	return RateWindows{Last1s: res[0], Last10s: res[1], Last60s: res[2]}
+}
+
+// ConnStats 一个连接的收发速率、总量和待写的字节数
+type ConnStats struct {
+	Received    RateWindows
+	Sent        RateWindows
+	Pending     int64
+	Queued      int64
+	BytesIn     uint64
+	BytesOut    uint64
+	ConnectedAt time.Time
+	// LastActive 还没有收发过消息时是零值
+	LastActive time.Time
+}
+
+func (l *TcpConn) Stats() ConnStats {
+	now := time.Now()
+	var last time.Time
+	if v := atomic.LoadInt64(&l.LastActive); v != 0 {
+		last = time.Unix(0, v)
+	}
+	return ConnStats{
+		Received:    l.Received.Windows(now),
+		Sent:        l.Sent.Windows(now),
+		Pending:     atomic.LoadInt64(&l.Pending),
+		Queued:      atomic.LoadInt64(&l.Queued),
+		BytesIn:     atomic.LoadUint64(&l.BytesIn),
+		BytesOut:    atomic.LoadUint64(&l.BytesOut),
+		ConnectedAt: l.ConnectedAt,
+		LastActive:  last,
+	}
+}
+
+// PendingBudget 所有连接共享的待写字节数上限，见 TcpConn.Reserve
+type PendingBudget struct {
+	Max int64
+	// Reject 超过Max的发送返回 ErrBackpressure，否则照常发送，由Over处理
+	Reject bool
+	// Over 发送之后超过了Max时调用，不能阻塞
+	Over     func()
+	total    int64
+	rejected uint64
+}
+
+// Total 所有连接待写的字节数
+func (l *PendingBudget) Total() int64 {
+	return atomic.LoadInt64(&l.total)
+}
+
+// Rejected 因为Reject拒绝的发送数
+func (l *PendingBudget) Rejected() uint64 {
+	return atomic.LoadUint64(&l.rejected)
+}
+
+// FrameSize 记账用的消息大小，head加body，和实际写入的长度可能不完全一样
+func FrameSize(v btmsg.IMsg) int64 {
+	return int64(v.HeadSize()) + int64(len(v.BodyByte()))
+}
+
+// Reserve 交给写协程之前记下v的大小，写入或者丢弃之后调用Unreserve
+func (l *TcpConn) Reserve(v btmsg.IMsg) error {
+	b := l.Budget
+	if b == nil {
+		atomic.AddInt64(&l.Queued, 1)
+		return nil
+	}
+
+	size := FrameSize(v)
+	atomic.AddInt64(&l.Queued, 1)
+	atomic.AddInt64(&l.Pending, size)
+	if !b.Reject {
+		if atomic.AddInt64(&b.total, size) > b.Max && b.Over != nil {
+			b.Over()
+		}
+		return nil
+	}
+
+	// 并发的发送加起来也不会超过Max
+	for {
+		total := atomic.LoadInt64(&b.total)
+		if total+size > b.Max {
+			atomic.AddInt64(&l.Queued, -1)
+			atomic.AddInt64(&l.Pending, -size)
+			atomic.AddUint64(&b.rejected, 1)
+			return ErrBackpressure
+		}
+		if atomic.CompareAndSwapInt64(&b.total, total, total+size) {
+			return nil
+		}
+	}
+}
+
+func (l *TcpConn) Unreserve(v btmsg.IMsg) {
+	atomic.AddInt64(&l.Queued, -1)
+	if l.Budget == nil {
+		return
+	}
+
+	size := FrameSize(v)
+	atomic.AddInt64(&l.Pending, -size)
+	atomic.AddInt64(&l.Budget.total, -size)
+}
+
+// RemoteIp addr里的ip，ipv6不带方括号，ipv4映射的ipv6地址(::ffff:1.2.3.4)返回ipv4，不是ip的地址原样返回
+func RemoteIp(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+
+	var ip net.IP
+	switch v := addr.(type) {
+	case *net.TCPAddr:
+		ip = v.IP
+	case *net.UDPAddr:
+		ip = v.IP
+	default:
+		host, _, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			return addr.String()
+		}
+		ip = net.ParseIP(host)
+		if ip == nil {
+			return host
+		}
+	}
+
+	if v4 := ip.To4(); v4 != nil {
+		return v4.String()
+	}
+	return ip.String()
 }
 
 func (l *TcpConn) GetRemoteIp() string {
@@ -47,3 +345,106 @@ func (l *TcpConn) GetRemoteIp() string {
 func (l *TcpConn) GetId() uint64 {
 	return l.Id
 }
+
+// Send 连接已经关闭时丢弃
+func (l *TcpConn) Send(v btmsg.IMsg) {
+	l.SendPriority(v, PriorityNormal)
+}
+
+// SendPriority 和Send一样，按prio放进对应的队列
+func (l *TcpConn) SendPriority(v btmsg.IMsg, prio Priority) {
+	l.Lock.RLock()
+	closed := l.IsClose
+	l.Lock.RUnlock()
+	if closed {
+		return
+	}
+	if l.Reserve(v) != nil {
+		return
+	}
+
+	// 和server的Send一样，写完之后Release
+	v.Retain()
+	select {
+	case l.InputFor(prio) <- v:
+	case <-l.WaitConn:
+		l.Unreserve(v)
+		v.Release()
+	}
+}
+
+// InputFor prio对应的发送队列
+func (l *TcpConn) InputFor(prio Priority) chan btmsg.IMsg {
+	if prio == PriorityHigh && l.InputHigh != nil {
+		return l.InputHigh
+	}
+	return l.Input
+}
+
+// SendWithTimeout 和Send一样，d之内没有交给写协程返回 ErrSendTimeout，连接已经关闭返回 ErrClosed
+// d<=0时不等待，写协程正忙就返回 ErrSendTimeout，超过 PendingBudget 的上限返回 ErrBackpressure
+func (l *TcpConn) SendWithTimeout(v btmsg.IMsg, d time.Duration) (err error) {
+	l.Lock.RLock()
+	closed := l.IsClose
+	l.Lock.RUnlock()
+	if closed {
+		return ErrClosed
+	}
+	if err = l.Reserve(v); err != nil {
+		return err
+	}
+
+	v.Retain()
+	defer func() {
+		if err != nil {
+			l.Unreserve(v)
+			v.Release()
+		}
+	}()
+
+	if d <= 0 {
+		select {
+		case l.Input <- v:
+			return nil
+		case <-l.WaitConn:
+			return ErrClosed
+		default:
+			return ErrSendTimeout
+		}
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case l.Input <- v:
+		return nil
+	case <-l.WaitConn:
+		return ErrClosed
+	case <-timer.C:
+		return ErrSendTimeout
+	}
+}
+
+// ReplyError 回复req一个错误，客户端的Call会返回对应的错误
+func (l *TcpConn) ReplyError(req btmsg.IMsg, code uint16, text string) error {
+	rsp, err := btmsg.NewErrorReply(req, code, text)
+	if err != nil {
+		return err
+	}
+
+	l.Send(rsp)
+	return nil
+}
+
+// ReplyMsg 回复req，body由v编码，act按server的reader设置的 btmsg.WithReplyAct 规则
+// 客户端要用相同的规则才能在Call里收到回复
+func (l *TcpConn) ReplyMsg(req btmsg.IMsg, v any) error {
+	rsp, err := btmsg.ReplyTo(req, v)
+	if err != nil {
+		return err
+	}
+
+	l.Send(rsp)
+	return nil
+}
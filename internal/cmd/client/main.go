@@ -7,14 +7,9 @@ import (
 	"github.com/winkb/tcp1/net/mytcp"
 	"github.com/winkb/tcp1/util"
 	"os"
+	"time"
 )
 
-type RouteHandle func(msg btmsg.IMsg)
-
-type RouteInfo struct {
-	Handle RouteHandle
-}
-
 type ShutdownReq struct {
 	Msg string
 }
@@ -34,38 +29,25 @@ func newMsg(act uint16, req any) btmsg.IMsg {
 	return res
 }
 
-var routes = map[uint16]*RouteInfo{}
-
-func init() {
-	routes[100] = &RouteInfo{
-		Handle: func(msg btmsg.IMsg) {
-			handleShutdownReply(msg, parseReq(ShutdownRsp{}, msg))
-		},
-	}
-}
-
-func parseReq[T any](v T, msg btmsg.IMsg) T {
-	_, _ = msg.ToStruct(&v)
-	return v
-}
-
-func handleShutdownReply(msg btmsg.IMsg, req ShutdownRsp) {
+func handleShutdownReply(msg btmsg.IMsg, req *ShutdownRsp) {
 	fmt.Println("shutdown notify ", req.Reason)
 }
 
 func main() {
 
-	cli := mytcp.NewTcpClient(":989")
+	cli := mytcp.NewTcpClient(":989",
+		mytcp.WithDialTimeout(time.Second*5),
+		// 服务端慢的时候丢掉新输入，不卡住读stdin
+		mytcp.WithSendQueue(1024, mytcp.OverflowDropNew),
+	)
 
-	cli.OnReceive(func(v btmsg.IMsg) {
-		act := v.GetAct()
-		r, ok := routes[act]
-		if !ok {
-			fmt.Println("not found handle", act)
-			return
-		}
+	mytcp.HandleClient(cli, 100, handleShutdownReply)
+	cli.HandleNotFound(func(v btmsg.IMsg) {
+		fmt.Println("not found handle", btmsg.ActName(v.GetAct()))
+	})
 
-		r.Handle(v)
+	cli.OnPanic(func(v any, stack []byte) {
+		fmt.Println("receive panic", v)
 	})
 
 	cli.OnClose(func(isServer bool, isClient bool) {
@@ -74,7 +56,6 @@ func main() {
 		}
 
 		if isServer {
-			cli.ReleaseChan()
 			fmt.Println("我自己端口连接")
 		}
 	})
@@ -87,34 +68,52 @@ func main() {
 	scan := bufio.NewScanner(os.Stdin)
 	const exitLimit = "exit;"
 
-	util.MyGoWg(wg, "scan_input", func() {
-		defer func() {
-			cli.Close()
-		}()
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
 		for scan.Scan() {
+			lines <- scan.Text()
+		}
+	}()
 
-			txt := scan.Text()
-			if txt == exitLimit {
-				return
+	util.MyGoWg(wg, "scan_input", func() {
+		defer func() {
+			if err := cli.CloseGraceful(time.Second * 3); err != nil {
+				fmt.Println(err)
 			}
+		}()
+		for {
+			var txt string
+			var ok bool
 
 			select {
-			case <-cli.HasClosed():
+			case <-cli.Done():
 				return
-			default:
-				if txt == "shutdown" {
-					cli.Send(newMsg(100, ShutdownReq{
-						Msg: txt,
-					}))
-					continue
+			case txt, ok = <-lines:
+				if !ok || txt == exitLimit {
+					return
 				}
+			}
 
-				cli.Send(newMsg(200, ShutdownReq{
+			var err error
+			if txt == "shutdown;" {
+				err = cli.SendStruct(100, ShutdownReq{
+					Msg: txt,
+				})
+			} else {
+				err = cli.Send(newMsg(200, ShutdownReq{
 					Msg: txt,
 				}))
 			}
+
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
 		}
 	})
 
 	wg.Wait()
+
+	fmt.Printf("client stats %+v\n", cli.Stats())
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
 	"github.com/winkb/tcp1/net/mytcp"
 	"sync"
 	"testing"
@@ -10,7 +11,7 @@ import (
 )
 
 func TestShutdown(t *testing.T) {
-	var conns []mytcp.ITcpClient
+	var conns []contracts.ITcpClient
 	var lock sync.Mutex
 
 	go func() {
@@ -35,7 +36,7 @@ func TestShutdown(t *testing.T) {
 	time.Sleep(time.Second * 10)
 }
 
-func start() (mytcp.ITcpClient, *sync.WaitGroup) {
+func start() (contracts.ITcpClient, *sync.WaitGroup) {
 	cli := mytcp.NewTcpClient(":989")
 
 	cli.OnReceive(func(v btmsg.IMsg) {
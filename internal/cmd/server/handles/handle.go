@@ -22,7 +22,10 @@ func handleShutdown(s contracts.ITcpServer,conn *contracts.TcpConn, msg btmsg.IM
 
 	fmt.Println("sever will shutdown ", req.Msg)
 
-	err := msg.FromStruct(&types.ShutdownRsp{
+	// 同一个handle同时给tcp和ws用，NewReplyTo保证head类型和收到的一样
+	rsp := btmsg.NewReplyTo(msg)
+	rsp.SetSeq(0)
+	err := rsp.FromStruct(&types.ShutdownRsp{
 		Reason: "server will shutdown! trigger by " + conn.GetRemoteIp(),
 	})
 	if err != nil {
@@ -30,7 +33,7 @@ func handleShutdown(s contracts.ITcpServer,conn *contracts.TcpConn, msg btmsg.IM
 		return
 	}
 
-	s.Broadcast(msg)
+	s.Broadcast(rsp)
 	time.AfterFunc(time.Second, func() {
 		s.Shutdown()
 	})
@@ -39,18 +42,19 @@ func handleShutdown(s contracts.ITcpServer,conn *contracts.TcpConn, msg btmsg.IM
 func handleHello(s contracts.ITcpServer,conn *contracts.TcpConn, msg btmsg.IMsg, req *types.HelloReq) {
 	fmt.Println("hello", req.Content)
 
-	err := msg.FromStruct(req)
+	rsp := btmsg.NewReplyTo(msg)
+	err := rsp.FromStruct(req)
 	if err != nil {
 		log.Err(err)
 		return
 	}
 
-	s.Send(conn, msg)
+	s.Send(conn, rsp)
 }
 
 func logHandle(name string, t time.Time) func() {
 	return func() {
 		fmt.Println("handle", name, "in")
-		fmt.Println("handle", name, "out", numfn.ToStr(time.Now().Sub(t).Nanoseconds())+"ns")
+		fmt.Println("handle", name, "out", numfn.HumanDuration(time.Since(t)))
 	}
 }
@@ -6,9 +6,13 @@ import (
 	"github.com/winkb/tcp1/contracts"
 )
 
-func parseReq[T any](v T, msg btmsg.IMsg) T {
-	x,_ := msg.ToStruct(v)
-	return x.(T)
+// parseReq 每个消息单独解码，解码失败用零值
+func parseReq[T any](msg btmsg.IMsg) *T {
+	v, err := btmsg.ToStructT[T](msg)
+	if err != nil {
+		return new(T)
+	}
+	return v
 }
 
 type RouteHandle func(s contracts.ITcpServer,conn *contracts.TcpConn, msg btmsg.IMsg)
@@ -19,21 +23,26 @@ type RouteInfo struct {
 var Routes = map[uint16]*RouteInfo{}
 
 func init() {
-	Routes[0] = &RouteInfo{
+	err := btmsg.RegisterActs(types.ActNames)
+	if err != nil {
+		panic(err)
+	}
+
+	Routes[types.ActDefault] = &RouteInfo{
 		Handle: func(s contracts.ITcpServer,conn *contracts.TcpConn, msg btmsg.IMsg) {
 			handleDefault(s,conn, msg, nil)
 		},
 	}
 
-	Routes[1] = &RouteInfo{
+	Routes[types.ActHello] = &RouteInfo{
 		Handle: func(s contracts.ITcpServer,conn *contracts.TcpConn, msg btmsg.IMsg) {
-			handleHello(s,conn, msg, parseReq(&types.HelloReq{}, msg))
+			handleHello(s,conn, msg, parseReq[types.HelloReq](msg))
 		},
 	}
 
-	Routes[100] = &RouteInfo{
+	Routes[types.ActShutdown] = &RouteInfo{
 		Handle: func(s contracts.ITcpServer,conn *contracts.TcpConn, msg btmsg.IMsg) {
-			handleShutdown(s,conn, msg, parseReq(&types.ShutdownReq{}, msg))
+			handleShutdown(s,conn, msg, parseReq[types.ShutdownReq](msg))
 		},
 	}
 }
@@ -0,0 +1,48 @@
+package handles
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+	"github.com/winkb/tcp1/internal/cmd/server/types"
+)
+
+type stubServer struct {
+	contracts.ITcpServer
+	lock    sync.Mutex
+	reasons []string
+}
+
+func (l *stubServer) Broadcast(bt btmsg.IMsg) {
+	rsp, _ := btmsg.ToStructT[types.ShutdownRsp](bt)
+	l.lock.Lock()
+	l.reasons = append(l.reasons, rsp.Reason)
+	l.lock.Unlock()
+}
+
+func (l *stubServer) Shutdown() {
+}
+
+func TestRouteShutdownParallel(t *testing.T) {
+	s := &stubServer{}
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		msg, err := btmsg.NewMsgFromStruct(100, &types.ShutdownReq{Msg: "bye"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Routes[100].Handle(s, &contracts.TcpConn{}, msg)
+		}()
+	}
+	wg.Wait()
+
+	if len(s.reasons) != 2 {
+		t.Fatalf("broadcast %d", len(s.reasons))
+	}
+}
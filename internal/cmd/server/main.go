@@ -1,23 +1,25 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/winkb/tcp1/internal/cmd/server/handles"
+	"github.com/winkb/tcp1/net/mytcp"
 	"github.com/winkb/tcp1/net/myws"
 	"html/template"
 	"net/http"
-	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/winkb/tcp1/btmsg"
 	"github.com/winkb/tcp1/contracts"
 )
 
 func main() {
-	//var server = mytcp.NewTcpServer("989", btmsg.NewReader(func() btmsg.IHead {
-	//	return btmsg.NewMsgHeadTcp()
-	//}))
+	// 自己处理信号，ctx结束时ws和tcp一起停止
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	http.HandleFunc("/home", func(w http.ResponseWriter, r *http.Request) {
 		err := homeTemplate.Execute(w, "ws://"+r.Host+"/ws")
@@ -34,7 +36,9 @@ func main() {
 		panic(err)
 	}
 
-	http.HandleFunc("/", server.LoopAccept)
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		server.LoopAccept(w, r, func(conn *contracts.TcpConn) {})
+	})
 
 	go func() {
 		wg.Add(1)
@@ -45,7 +49,7 @@ func main() {
 		http.ListenAndServe("localhost:9899", nil)
 	}()
 
-	server.OnClose(func(s contracts.ITcpServer, conn *contracts.TcpConn, isServer bool, isClient bool) {
+	onClose := func(s contracts.ITcpServer, conn *contracts.TcpConn, isServer bool, isClient bool) {
 		if isClient {
 			fmt.Println("客户端断开连接")
 		}
@@ -53,13 +57,13 @@ func main() {
 		if isServer {
 			fmt.Println("我自己断开连接")
 		}
-	})
+	}
 
-	server.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+	onReceive := func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
 		act := msg.GetAct()
 		hv, ok := handles.Routes[act]
 		if !ok {
-			fmt.Println("not found handle", act)
+			fmt.Println("not found handle", btmsg.ActName(act))
 
 			// 走默认路由
 			act = 0
@@ -67,28 +71,23 @@ func main() {
 		}
 
 		hv.Handle(s, conn, msg)
-	})
-
-	chSingle := make(chan os.Signal)
-
-	signal.Notify(chSingle, syscall.SIGINT, syscall.SIGTERM)
-
-	go func() {
-		v := <-chSingle
-		switch v {
-		case syscall.SIGINT:
-			fmt.Println("ctr+c")
-		case syscall.SIGTERM:
-			fmt.Println("terminated")
-		}
+	}
+	onReceive = mytcp.AccessLog()(onReceive)
 
-		server.Shutdown()
+	server.OnClose(onClose)
+	server.OnReceive(onReceive)
 
-		fmt.Println(v)
-	}()
+	err = mytcp.ListenAndServeContext(ctx, "989", btmsg.NewReader(func() btmsg.IHead {
+		return btmsg.NewMsgHeadTcp()
+	}), onReceive, mytcp.WithFirstMessageTimeout(time.Second*30), mytcp.WithServerOnClose(onClose))
+	if err != nil {
+		fmt.Println(err)
+	}
 
+	// tcp收到shutdown消息停止时ctx还没有结束
+	fmt.Println("shutdown")
+	server.Shutdown()
 	wg.Wait()
-	close(chSingle)
 }
 
 var homeTemplate = template.Must(template.New("").Parse(`<!DOCTYPE html>
@@ -1,5 +1,18 @@
 package types
 
+const (
+	ActDefault  uint16 = 0
+	ActHello    uint16 = 1
+	ActShutdown uint16 = 100
+)
+
+// ActNames 日志里显示的act名字，见 btmsg.RegisterActs
+var ActNames = map[uint16]string{
+	ActDefault:  "default",
+	ActHello:    "hello",
+	ActShutdown: "shutdown",
+}
+
 type ShutdownReq struct {
 	Msg string
 }
@@ -0,0 +1,164 @@
+package mytcp
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+type clientCalls struct {
+	lastSeq uint32
+	lock    sync.Mutex
+	waiters map[uint32]clientWaiter
+	// 超时的请求，回复到达时直接丢弃，值是请求的act
+	abandoned map[uint32]uint16
+	// replyAct 回复的act规则，seq相同但act对不上的消息不是回复
+	replyAct btmsg.ReplyAct
+}
+
+type clientWaiter struct {
+	ch  chan btmsg.IMsg
+	act uint16
+}
+
+func newClientCalls() *clientCalls {
+	return &clientCalls{
+		waiters:   map[uint32]clientWaiter{},
+		abandoned: map[uint32]uint16{},
+	}
+}
+
+func (l *clientCalls) nextSeq() uint32 {
+	for {
+		seq := atomic.AddUint32(&l.lastSeq, 1)
+		if seq != 0 {
+			return seq
+		}
+	}
+}
+
+func (l *clientCalls) add(seq uint32, act uint16) chan btmsg.IMsg {
+	ch := make(chan btmsg.IMsg, 1)
+
+	l.lock.Lock()
+	l.waiters[seq] = clientWaiter{ch: ch, act: act}
+	l.lock.Unlock()
+
+	return ch
+}
+
+func (l *clientCalls) remove(seq uint32, abandon bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	w, ok := l.waiters[seq]
+	if !ok {
+		return
+	}
+
+	delete(l.waiters, seq)
+	if abandon {
+		l.abandoned[seq] = w.act
+	}
+}
+
+// dispatch 回复交给等待的Call，返回true表示msg已经被消费，不需要再走OnReceive
+func (l *clientCalls) dispatch(msg btmsg.IMsg) bool {
+	seq := msg.GetSeq()
+	if seq == 0 {
+		return false
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if w, ok := l.waiters[seq]; ok && l.replyAct.IsReply(w.act, msg) {
+		delete(l.waiters, seq)
+		w.ch <- msg
+		return true
+	}
+
+	if act, ok := l.abandoned[seq]; ok && l.replyAct.IsReply(act, msg) {
+		delete(l.abandoned, seq)
+		return true
+	}
+
+	return false
+}
+
+func (l *clientCalls) reset() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.waiters = map[uint32]clientWaiter{}
+	l.abandoned = map[uint32]uint16{}
+}
+
+// Call 发送请求并等待seq相同、act符合 WithReplyAct 规则的回复，回复解码到rsp，错误回复返回 *ReplyError
+// 两端的head要能带seq，比如 btmsg.MsgHeadTcpSeq，默认的 btmsg.MsgHeadTcp 返回 ErrNoSeq
+// 连接断开时返回 ErrConnClosed，ctx结束时返回ctx.Err()，之后到达的回复会被丢弃
+func (l *tcpClient) Call(ctx context.Context, act uint16, req any, rsp any) (err error) {
+	return l.call(ctx, act, req, rsp, false)
+}
+
+// call early 见 sendPriority
+func (l *tcpClient) call(ctx context.Context, act uint16, req any, rsp any, early bool) (err error) {
+	hd := l.head()
+	hd.SetAct(act)
+	hd.SetSeq(l.calls.nextSeq())
+	if hd.GetSeq() == 0 {
+		return ErrNoSeq
+	}
+
+	msg := l.newMsg(hd)
+	err = msg.FromStruct(req)
+	if err != nil {
+		return err
+	}
+
+	if l.traceHook != nil {
+		var end func(err error)
+		ctx, end = l.startSpan(ctx, SpanCall, msg)
+		defer func() {
+			end(err)
+		}()
+	}
+
+	seq := msg.GetSeq()
+	bt, err := l.encode(msg)
+	if err != nil {
+		return err
+	}
+
+	ch := l.calls.add(seq, act)
+
+	err = l.sendPriority(bt, contracts.PriorityNormal, ctx.Done(), early)
+	if err != nil {
+		l.calls.remove(seq, false)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	// 请求发出去之后连接断开，回复不可能再到达
+	_, wait := l.current()
+
+	select {
+	case reply := <-ch:
+		if code, text, ok := reply.GetError(); ok {
+			return &ReplyError{act: act, code: code, text: text}
+		}
+		_, err = reply.ToStruct(rsp)
+		return err
+	case <-ctx.Done():
+		l.calls.remove(seq, true)
+		return ctx.Err()
+	case <-wait:
+		l.calls.remove(seq, false)
+		return ErrConnClosed
+	}
+}
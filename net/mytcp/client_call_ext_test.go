@@ -0,0 +1,183 @@
+package mytcp_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+	"github.com/winkb/tcp1/net/mytcp"
+	"github.com/winkb/tcp1/net/mytcp/testutil"
+)
+
+type callReq struct {
+	N int
+}
+
+type callRsp struct {
+	N int
+}
+
+func TestClientCall(t *testing.T) {
+	ts := testutil.StartTestServer(t, testutil.WithOnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		var req callReq
+		_, _ = msg.ToStruct(&req)
+		if req.N < 0 {
+			return
+		}
+		_ = msg.FromStruct(&callRsp{N: req.N * 2})
+		s.Send(conn, msg)
+	}))
+	cli := testutil.StartTestClient(t, ts.Addr())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			var rsp callRsp
+			err := cli.SendAndWaitReply(1, &callReq{N: i}, &rsp)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if rsp.N != i*2 {
+				t.Errorf("expect %d, got %d", i*2, rsp.N)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	cli.Timeout = time.Millisecond * 100
+	err := cli.SendAndWaitReply(1, &callReq{N: -1}, &callRsp{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestClientCallConnClosed(t *testing.T) {
+	ts := testutil.StartTestServer(t, testutil.WithOnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		s.CloseConn(conn)
+	}))
+	cli := testutil.StartTestClient(t, ts.Addr())
+
+	err := cli.SendAndWaitReply(1, &callReq{N: 1}, &callRsp{})
+	if !errors.Is(err, mytcp.ErrConnClosed) {
+		t.Fatalf("expect ErrConnClosed, got %v", err)
+	}
+}
+
+func TestClientCallReplyError(t *testing.T) {
+	ts := testutil.StartTestServer(t, testutil.WithOnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		var req callReq
+		_, _ = msg.ToStruct(&req)
+		if req.N%2 == 1 {
+			_ = conn.ReplyError(msg, 400, "odd")
+			return
+		}
+		_ = msg.FromStruct(&callRsp{N: req.N * 2})
+		s.Send(conn, msg)
+	}))
+	cli := testutil.StartTestClient(t, ts.Addr())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			var rsp callRsp
+			err := cli.Call(context.Background(), 3, &callReq{N: i}, &rsp)
+			if i%2 == 0 {
+				if err != nil || rsp.N != i*2 {
+					t.Errorf("call %d rsp %d err %v", i, rsp.N, err)
+				}
+				return
+			}
+
+			var replyErr *mytcp.ReplyError
+			if !errors.As(err, &replyErr) {
+				t.Errorf("call %d expect ReplyError, got %v", i, err)
+				return
+			}
+			if replyErr.Code() != 400 || replyErr.Text() != "odd" || replyErr.Act() != 3 {
+				t.Errorf("call %d reply err %v", i, replyErr)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// 两端用相同的act规则，ReplyMsg的回复被Call收到；规则不一致时回复走OnReceive
+func TestClientCallReplyAct(t *testing.T) {
+	ts := testutil.StartTestServer(t,
+		testutil.WithReader(btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq(), btmsg.WithReplyAct(btmsg.ReplyHighBit))),
+		testutil.WithOnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+			req, _ := btmsg.ToStructT[callReq](msg)
+			_ = conn.ReplyMsg(msg, &callRsp{N: req.N + 1})
+		}),
+	)
+
+	cli := testutil.StartTestClient(t, ts.Addr(), mytcp.WithReplyAct(btmsg.ReplyHighBit))
+	var rsp callRsp
+	err := cli.SendAndWaitReply(2, &callReq{N: 1}, &rsp)
+	if err != nil || rsp.N != 2 {
+		t.Fatalf("rsp %+v err %v", rsp, err)
+	}
+
+	other := testutil.StartTestClient(t, ts.Addr())
+	var received = make(chan uint16, 1)
+	other.OnReceive(func(msg btmsg.IMsg) {
+		received <- msg.GetAct()
+	})
+
+	other.Timeout = time.Millisecond * 200
+	err = other.SendAndWaitReply(2, &callReq{N: 1}, &rsp)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect DeadlineExceeded, got %v", err)
+	}
+
+	select {
+	case act := <-received:
+		if act != 0x8002 {
+			t.Fatalf("act %x", act)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reply not received")
+	}
+}
+
+// TestWaitForConns 多个client连接之后广播，每个client都收到
+func TestWaitForConns(t *testing.T) {
+	ts := testutil.StartTestServer(t, testutil.WithOnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		s.Broadcast(msg)
+	}))
+
+	const n = 3
+	var got = make(chan uint16, n)
+	var clis []*testutil.TestClient
+	for i := 0; i < n; i++ {
+		cli := testutil.StartTestClient(t, ts.Addr())
+		cli.OnReceive(func(msg btmsg.IMsg) {
+			got <- msg.GetAct()
+		})
+		clis = append(clis, cli)
+	}
+	ts.WaitForConns(n, time.Second*3)
+
+	_ = clis[0].SendStruct(7, callReq{N: 1})
+	for i := 0; i < n; i++ {
+		select {
+		case act := <-got:
+			if act != 7 {
+				t.Fatalf("act %d", act)
+			}
+		case <-time.After(time.Second * 3):
+			t.Fatal("timeout")
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package mytcp
+
+import (
+	"testing"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+type callReq struct {
+	N int
+}
+
+type callRsp struct {
+	N int
+}
+
+// newTestClient 测试的server都用 btmsg.MsgHeadTcpSeq，Call 需要seq
+func newTestClient(addr string, opts ...ClientOption) *tcpClient {
+	return NewTcpClient(addr, append([]ClientOption{WithHeadFactory(btmsg.FactoryMsgHeadTcpSeq())}, opts...)...)
+}
+
+// newActMsg 和 btmsg.NewActMsg 一样，head是 btmsg.MsgHeadTcpSeq
+func newActMsg(act uint16, body []byte) *btmsg.Msg {
+	hd := btmsg.NewMsgHeadTcpSeq()
+	hd.SetAct(act)
+	return btmsg.NewMsg(hd, body)
+}
+
+func newMsgFromStruct(act uint16, v any) (*btmsg.Msg, error) {
+	msg := newActMsg(act, nil)
+	err := msg.FromStruct(v)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func startEchoServer(t *testing.T, f contracts.ServerReceiveCallback) (*tcpServer, func()) {
+	verifyNoLeaks(t)
+
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()))
+	ts.OnReceive(f)
+	wg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ts, func() {
+		ts.Shutdown()
+		wg.Wait()
+	}
+}
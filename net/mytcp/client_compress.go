@@ -0,0 +1,45 @@
+package mytcp
+
+import (
+	"sync/atomic"
+
+	"github.com/winkb/tcp1/btmsg"
+)
+
+// WithCompressThreshold body超过n个字节时压缩，压缩之后没有变小就不压缩，head要能带flags，比如 btmsg.MsgHeadTcpV2
+// 收到的压缩消息自动解压，服务端的reader要用 btmsg.WithDecompressor
+func WithCompressThreshold(n int) ClientOption {
+	return func(l *tcpClient) {
+		l.compressThreshold = n
+	}
+}
+
+// WithCompressor 压缩使用的算法，默认 btmsg.DefaultCompressor
+func WithCompressor(c btmsg.Compressor) ClientOption {
+	return func(l *tcpClient) {
+		l.compressor = c
+	}
+}
+
+// encode 开启压缩时按 WithCompressThreshold 压缩body，没有trace id时生成一个
+func (l *tcpClient) encode(msg btmsg.IMsg) ([]byte, error) {
+	ensureTraceID(msg)
+	m, ok := msg.(*btmsg.Msg)
+	if l.compressThreshold <= 0 || !ok {
+		return msg.ToSendByte(), nil
+	}
+
+	bt, saved, err := m.ToSendByteCompress(l.compressor, l.compressThreshold)
+	if err != nil {
+		return nil, err
+	}
+
+	if saved > 0 {
+		atomic.AddUint64(&l.counter.compressed, 1)
+		atomic.AddUint64(&l.counter.compressSaved, uint64(saved))
+	} else {
+		atomic.AddUint64(&l.counter.uncompressed, 1)
+	}
+
+	return bt, nil
+}
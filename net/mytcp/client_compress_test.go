@@ -0,0 +1,59 @@
+package mytcp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+	"github.com/winkb/tcp1/util/numfn"
+)
+
+func TestClientCompress(t *testing.T) {
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpV2(), btmsg.WithDecompressor(btmsg.DefaultCompressor, 0)))
+	var got = make(chan string, 2)
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		var v echoReq
+		_, _ = msg.ToStruct(&v)
+		got <- v.Msg
+	})
+	swg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		swg.Wait()
+	}()
+
+	cli := newTestClient(ts.listener.Addr().String(), WithHeadFactory(btmsg.FactoryMsgHeadTcpV2()), WithCompressThreshold(64))
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	long := strings.Repeat("long message ", 50)
+	_ = cli.SendStruct(1, echoReq{Msg: long})
+	_ = cli.SendStruct(1, echoReq{Msg: "short"})
+
+	for _, expect := range []string{long, "short"} {
+		select {
+		case v := <-got:
+			if v != expect {
+				t.Fatalf("got %q", v)
+			}
+		case <-time.After(time.Second * 3):
+			t.Fatal("timeout")
+		}
+	}
+
+	st := cli.Stats()
+	if st.Compressed != 1 || st.Uncompressed != 1 || st.CompressSaved == 0 {
+		t.Fatalf("compressed %d uncompressed %d saved %d", st.Compressed, st.Uncompressed, st.CompressSaved)
+	}
+	if want := "compressed 1 saved " + numfn.HumanBytes(int64(st.CompressSaved)); !strings.Contains(st.String(), want) {
+		t.Fatalf("stats %s", st)
+	}
+}
@@ -0,0 +1,129 @@
+package mytcp
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/proxy"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// socks5Stub 只支持无认证的CONNECT，够测试用
+func socks5Stub(t *testing.T) (addr string, used *int32, stop func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	used = new(int32)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go socks5Serve(conn, used)
+		}
+	}()
+
+	return ln.Addr().String(), used, func() { _ = ln.Close() }
+}
+
+func socks5Serve(conn net.Conn, used *int32) {
+	defer conn.Close()
+
+	var hd = make([]byte, 2)
+	if _, err := io.ReadFull(conn, hd); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, make([]byte, hd[1])); err != nil {
+		return
+	}
+	_, _ = conn.Write([]byte{5, 0})
+
+	var req = make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return
+	}
+
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, 4)
+		_, _ = io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case 4:
+		ip := make([]byte, 16)
+		_, _ = io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case 3:
+		n := make([]byte, 1)
+		_, _ = io.ReadFull(conn, n)
+		name := make([]byte, n[0])
+		_, _ = io.ReadFull(conn, name)
+		host = string(name)
+	default:
+		return
+	}
+	port := make([]byte, 2)
+	_, _ = io.ReadFull(conn, port)
+
+	target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	if err != nil {
+		_, _ = conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+
+	atomic.AddInt32(used, 1)
+	_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+	go func() {
+		_, _ = io.Copy(target, conn)
+		_ = target.Close()
+	}()
+	_, _ = io.Copy(conn, target)
+}
+
+func TestClientSocks5Dialer(t *testing.T) {
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		_ = msg.FromStruct(&callRsp{N: 7})
+		s.Send(conn, msg)
+	})
+	defer stop()
+
+	proxyAddr, used, stopProxy := socks5Stub(t)
+	defer stopProxy()
+
+	d, err := proxy.SOCKS5("tcp", proxyAddr, nil, proxy.Direct)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cli := newTestClient(ts.listener.Addr().String(), WithDialer(d.(proxy.ContextDialer).DialContext))
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	var rsp callRsp
+	err = cli.Call(ctx, 1, &callReq{}, &rsp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp.N != 7 || atomic.LoadInt32(used) != 1 {
+		t.Fatalf("rsp %d, proxy used %d", rsp.N, atomic.LoadInt32(used))
+	}
+}
@@ -0,0 +1,100 @@
+package mytcp
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+type clientAddrs struct {
+	lock    sync.Mutex
+	list    []string
+	fails   map[string]int
+	last    string
+	shuffle bool
+}
+
+func (l *clientAddrs) add(addrs ...string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.fails == nil {
+		l.fails = map[string]int{}
+	}
+
+	for _, addr := range addrs {
+		if _, ok := l.fails[addr]; ok {
+			continue
+		}
+		l.fails[addr] = 0
+		l.list = append(l.list, addr)
+	}
+}
+
+// candidates 上次连接成功的地址排在最前面，其余按失败次数从少到多
+func (l *clientAddrs) candidates() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	var res = append([]string(nil), l.list...)
+	if l.shuffle {
+		rand.Shuffle(len(res), func(i, j int) {
+			res[i], res[j] = res[j], res[i]
+		})
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i] == l.last || res[j] == l.last {
+			return res[i] == l.last
+		}
+		return l.fails[res[i]] < l.fails[res[j]]
+	})
+
+	return res
+}
+
+func (l *clientAddrs) fail(addr string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.fails[addr]++
+	if l.last == addr {
+		l.last = ""
+	}
+}
+
+// success 失败次数减半而不是清零，反复断开的地址仍然排在后面
+func (l *clientAddrs) success(addr string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.fails[addr] /= 2
+	l.last = addr
+}
+
+func (l *clientAddrs) current() string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.last
+}
+
+// WithAddresses 备用地址，连接和重连时依次尝试，NewTcpClient的addr排在最前面
+// 上次连接成功的地址优先，失败次数多的地址靠后，dial超时是所有地址加起来的时间
+func WithAddresses(addrs ...string) ClientOption {
+	return func(l *tcpClient) {
+		l.addrs.add(addrs...)
+	}
+}
+
+// WithShuffleAddresses 失败次数相同的地址随机排序，而不是按添加的顺序
+func WithShuffleAddresses() ClientOption {
+	return func(l *tcpClient) {
+		l.addrs.shuffle = true
+	}
+}
+
+// CurrentAddr 当前连接的地址，还没连接成功过时为空
+func (l *tcpClient) CurrentAddr() string {
+	return l.addrs.current()
+}
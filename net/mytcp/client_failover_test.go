@@ -0,0 +1,81 @@
+package mytcp
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+func closedAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	return addr
+}
+
+func TestClientFailover(t *testing.T) {
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {})
+	defer stop()
+
+	bad := closedAddr(t)
+	good := ts.listener.Addr().String()
+
+	cli := newTestClient(bad, WithAddresses(good), WithDialTimeout(time.Second))
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	if cli.CurrentAddr() != good {
+		t.Fatalf("current addr %q, expect %q", cli.CurrentAddr(), good)
+	}
+
+	// 连接成功过的地址优先，失败过的排后面
+	if got := cli.addrs.candidates(); got[0] != good || got[1] != bad {
+		t.Fatalf("candidates %v", got)
+	}
+}
+
+func TestClientFailoverAllFail(t *testing.T) {
+	a, b := closedAddr(t), closedAddr(t)
+
+	cli := newTestClient(a, WithAddresses(b, a), WithDialTimeout(time.Second))
+	_, err := cli.Start()
+	if !errors.Is(err, ErrDialRefused) {
+		t.Fatalf("expect ErrDialRefused, got %v", err)
+	}
+
+	var dialErr *DialError
+	if !errors.As(err, &dialErr) {
+		t.Fatalf("expect DialError, got %T", err)
+	}
+
+	if n := len(cli.addrs.list); n != 2 {
+		t.Fatalf("expect 2 addrs after dedupe, got %d", n)
+	}
+}
+
+func TestClientAddrsCandidates(t *testing.T) {
+	var addrs clientAddrs
+	addrs.add("a", "b", "c")
+
+	addrs.fail("a")
+	addrs.fail("a")
+	addrs.fail("b")
+	if got := addrs.candidates(); got[0] != "c" || got[1] != "b" || got[2] != "a" {
+		t.Fatalf("candidates %v", got)
+	}
+
+	addrs.success("a")
+	if got := addrs.candidates(); got[0] != "a" || got[1] != "c" || got[2] != "b" {
+		t.Fatalf("candidates %v", got)
+	}
+}
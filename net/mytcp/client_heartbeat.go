@@ -0,0 +1,115 @@
+package mytcp
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+type clientHeartbeat struct {
+	interval time.Duration
+	timeout  time.Duration
+	lastRead int64
+	pingSeq  uint32
+	pingAt   int64
+	lastRtt  int64
+}
+
+func (l *clientHeartbeat) touch() {
+	atomic.StoreInt64(&l.lastRead, time.Now().UnixNano())
+}
+
+func (l *clientHeartbeat) idle() time.Duration {
+	return time.Duration(time.Now().UnixNano() - atomic.LoadInt64(&l.lastRead))
+}
+
+// WithHeartbeat 每隔interval发送一次ping，超过timeout没有收到任何数据就断开连接
+func WithHeartbeat(interval time.Duration, timeout time.Duration) ClientOption {
+	return func(l *tcpClient) {
+		l.heartbeat.interval = interval
+		l.heartbeat.timeout = timeout
+	}
+}
+
+// LastRTT 最近一次ping到pong的耗时，没开启心跳或者还没收到pong时为0
+func (l *tcpClient) LastRTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&l.heartbeat.lastRtt))
+}
+
+// WithPassThroughControlFrames ping和pong在自动处理之后也交给OnReceive，默认业务看不到
+func WithPassThroughControlFrames() ClientOption {
+	return func(l *tcpClient) {
+		l.passControl = true
+	}
+}
+
+// handleControl 服务端的ping自动回复pong，pong用来计算rtt
+func (l *tcpClient) handleControl(msg btmsg.IMsg) {
+	if msg.GetAct() == btmsg.ActPong {
+		l.handlePong(msg)
+		return
+	}
+
+	// 读协程不能等 OnReconnected 返回，回调里的Call要靠它读回复
+	err := l.sendMsg(l.controlMsg(btmsg.ActPong, msg.GetSeq()), contracts.PriorityHigh, true)
+	if err != nil {
+		l.log("heartbeat pong", err)
+	}
+}
+
+// controlMsg 用客户端的head创建ping或者pong，和业务消息的格式一样
+func (l *tcpClient) controlMsg(act uint16, seq uint32) btmsg.IMsg {
+	hd := l.head()
+	hd.SetAct(act)
+	hd.SetSeq(seq)
+	return l.newMsg(hd)
+}
+
+func (l *tcpClient) handlePong(msg btmsg.IMsg) {
+	hb := &l.heartbeat
+	if msg.GetSeq() != atomic.LoadUint32(&hb.pingSeq) {
+		return
+	}
+
+	atomic.StoreInt64(&hb.lastRtt, time.Now().UnixNano()-atomic.LoadInt64(&hb.pingAt))
+}
+
+func (l *tcpClient) sendPing() error {
+	// head不能带seq时是0，pong也是0
+	ping := l.controlMsg(btmsg.ActPing, l.calls.nextSeq())
+	atomic.StoreUint32(&l.heartbeat.pingSeq, ping.GetSeq())
+	atomic.StoreInt64(&l.heartbeat.pingAt, time.Now().UnixNano())
+
+	// 和 OnReconnected 里的发送一样不用等回调返回
+	return l.sendMsg(ping, contracts.PriorityHigh, true)
+}
+
+func (l *tcpClient) LoopHeartbeat() {
+	conn, wait := l.current()
+	hb := &l.heartbeat
+	ticker := time.NewTicker(hb.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-wait:
+			return
+		case <-ticker.C:
+			if hb.timeout > 0 && hb.idle() > hb.timeout {
+				l.log("heartbeat timeout", hb.idle())
+				l.setConnErr(errors.Wrapf(ErrConnClosed, "heartbeat timeout after %v", hb.idle()))
+				// 读协程会因为连接关闭退出并触发OnClose
+				_ = conn.Close()
+				return
+			}
+
+			err := l.sendPing()
+			if err != nil {
+				l.log("heartbeat ping", err)
+			}
+		}
+	}
+}
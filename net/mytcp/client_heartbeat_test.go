@@ -0,0 +1,174 @@
+package mytcp
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+func TestClientHeartbeatRtt(t *testing.T) {
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		t.Errorf("server receive act %d", msg.GetAct())
+	})
+	defer stop()
+
+	cli := newTestClient(ts.listener.Addr().String(), WithHeartbeat(time.Millisecond*20, time.Second))
+	cli.OnReceive(func(msg btmsg.IMsg) {
+		t.Errorf("client receive act %d", msg.GetAct())
+	})
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	time.Sleep(time.Millisecond * 200)
+
+	if cli.LastRTT() <= 0 {
+		t.Fatal("expect rtt")
+	}
+}
+
+func TestClientHeartbeatTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// 只收不回，模拟已经失效的连接
+		_, _ = conn.Read(make([]byte, 1024))
+		time.Sleep(time.Second * 2)
+	}()
+
+	var closed = make(chan bool, 1)
+	cli := newTestClient(ln.Addr().String(), WithHeartbeat(time.Millisecond*20, time.Millisecond*100))
+	cli.OnClose(func(isServer bool, isClient bool) {
+		closed <- isServer
+	})
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("expect close by heartbeat")
+	}
+}
+
+func TestClientReadIdleTimeout(t *testing.T) {
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {})
+	defer stop()
+
+	var gotErr = make(chan error, 1)
+	cli := newTestClient(ts.listener.Addr().String(), WithReadIdleTimeout(time.Millisecond*100))
+	cli.OnError(func(err error) {
+		gotErr <- err
+	})
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err = <-gotErr:
+		if !errors.Is(err, ErrReadIdleTimeout) {
+			t.Fatalf("expect ErrReadIdleTimeout, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect idle timeout")
+	}
+	<-cli.Done()
+
+	// 心跳的pong算作收到数据，不会触发空闲超时
+	hb := newTestClient(ts.listener.Addr().String(),
+		WithReadIdleTimeout(time.Millisecond*100),
+		WithHeartbeat(time.Millisecond*20, time.Second),
+	)
+	_, err = hb.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hb.Close()
+
+	select {
+	case <-hb.Done():
+		t.Fatal("heartbeat should keep conn alive")
+	case <-time.After(time.Millisecond * 300):
+	}
+}
+
+// 两端互相ping，自动回复pong，默认业务回调看不到，开启透传之后都能看到
+func TestControlFrames(t *testing.T) {
+	for _, pass := range []bool{false, true} {
+		var serverActs = make(chan uint16, 16)
+		var opts []ServerOption
+		if pass {
+			opts = append(opts, WithServerPassThroughControlFrames())
+		}
+		ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), opts...)
+		ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+			serverActs <- msg.GetAct()
+			if msg.GetAct() == 1 {
+				s.Send(conn, btmsg.NewPing())
+			}
+		})
+		swg, err := ts.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var clientActs = make(chan uint16, 16)
+		var copts []ClientOption
+		if pass {
+			copts = append(copts, WithPassThroughControlFrames())
+		}
+		cli := newTestClient(ts.listener.Addr().String(), copts...)
+		cli.OnReceive(func(msg btmsg.IMsg) {
+			clientActs <- msg.GetAct()
+		})
+		cwg, err := cli.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_ = cli.SendMsg(btmsg.NewPing())
+		_ = cli.SendStruct(1, echoReq{Msg: "hi"})
+		time.Sleep(time.Millisecond * 200)
+		cli.Close()
+		// 等读协程退出，OnReceive不会再写clientActs
+		cwg.Wait()
+		ts.Shutdown()
+		swg.Wait()
+		close(serverActs)
+		close(clientActs)
+
+		var seen = map[uint16]bool{}
+		for act := range serverActs {
+			seen[act] = true
+		}
+		if !seen[1] || seen[btmsg.ActPing] != pass || seen[btmsg.ActPong] != pass {
+			t.Fatalf("pass %v server saw %v", pass, seen)
+		}
+
+		seen = map[uint16]bool{}
+		for act := range clientActs {
+			seen[act] = true
+		}
+		if seen[btmsg.ActPing] != pass || seen[btmsg.ActPong] != pass {
+			t.Fatalf("pass %v client saw %v", pass, seen)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package mytcp
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"syscall"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+)
+
+type ClientOption func(l *tcpClient)
+
+// WithDialTimeout 连接服务端的超时时间，默认0不超时
+func WithDialTimeout(d time.Duration) ClientOption {
+	return func(l *tcpClient) {
+		l.dialTimeout = d
+	}
+}
+
+// WithTLS 使用tls连接服务端，握手在Start中完成，同样受dial超时控制
+func WithTLS(cfg *tls.Config) ClientOption {
+	return func(l *tcpClient) {
+		l.tlsConfig = cfg
+	}
+}
+
+// WithHeadFactory 收发消息使用的head，默认 btmsg.MsgHeadTcp
+func WithHeadFactory(f func() btmsg.IHead) ClientOption {
+	return func(l *tcpClient) {
+		l.head = f
+	}
+}
+
+// WithByteOrder head按order读写，默认大端，和 WithHeadFactory 一起使用时包装那个head
+// 设置了 WithReader 时收到的消息由那个reader决定，要用 btmsg.WithByteOrder 设置相同的字节序
+func WithByteOrder(order binary.ByteOrder) ClientOption {
+	return func(l *tcpClient) {
+		l.byteOrder = order
+	}
+}
+
+// WithMagic 每个帧前面带magic，收到的数据错位时跳过垃圾数据找下一个帧，服务端的reader要用 btmsg.WithMagic
+func WithMagic(magic [2]byte) ClientOption {
+	return func(l *tcpClient) {
+		l.magic = &magic
+	}
+}
+
+// WithCodec SendStruct、Call以及收到的消息都用c编解码body，服务端的reader要用相同的codec
+// 设置了 WithReader 时收到的消息由那个reader决定
+func WithCodec(c btmsg.Codec) ClientOption {
+	return func(l *tcpClient) {
+		l.codec = c
+	}
+}
+
+// WithReplyAct 回复的act规则，Call按它匹配回复，收到的消息NewReply也用它，服务端的reader要用相同的 btmsg.WithReplyAct
+// 设置了 WithReader 时收到的消息NewReply由那个reader决定
+func WithReplyAct(m btmsg.ReplyAct) ClientOption {
+	return func(l *tcpClient) {
+		l.calls.replyAct = m
+	}
+}
+
+// WithReader 自定义读取消息的reader，设置后 WithHeadFactory 和 WithMaxMsgSize 对读取不再生效
+func WithReader(r btmsg.IMsgReader) ClientOption {
+	return func(l *tcpClient) {
+		l.reader = r
+	}
+}
+
+// WithMaxMsgSize 收到的body超过n时断开连接，并通过OnError通知
+func WithMaxMsgSize(n uint32) ClientOption {
+	return func(l *tcpClient) {
+		l.maxMsgSize = n
+	}
+}
+
+// WithCopySendBytes SendBytes 先复制一份再发送，调用方可以在返回后继续修改原来的slice
+func WithCopySendBytes() ClientOption {
+	return func(l *tcpClient) {
+		l.copySendBytes = true
+	}
+}
+
+// WithLocalAddr 指定本地地址，比如 "10.0.0.2:0" 表示用这个ip和随机端口连接服务端
+func WithLocalAddr(addr string) ClientOption {
+	return func(l *tcpClient) {
+		l.localAddr = addr
+	}
+}
+
+// WithNetwork 连接服务端用的network，tcp4只用ipv4，tcp6只用ipv6，默认tcp
+// 传给 WithDialer、WithTransport 的拨号函数，自己实现的拨号可以忽略
+func WithNetwork(network string) ClientOption {
+	return func(l *tcpClient) {
+		l.network = network
+	}
+}
+
+func (l *tcpClient) dialNetwork() string {
+	if l.network == "" {
+		return "tcp"
+	}
+	return l.network
+}
+
+// WithDialControl 在connect之前设置socket参数，比如 SO_BINDTODEVICE
+func WithDialControl(f func(network, address string, c syscall.RawConn) error) ClientOption {
+	return func(l *tcpClient) {
+		l.dialControl = f
+	}
+}
+
+// WithDialer 替换默认的拨号方式，WithLocalAddr 和 WithDialControl 只对默认拨号生效
+func WithDialer(d DialFunc) ClientOption {
+	return func(l *tcpClient) {
+		l.dialer = d
+	}
+}
+
+// WithTransport 用t建立连接，要和服务端的 WithServerTransport 一致，WithDialer 优先
+// WithLocalAddr 和 WithDialControl 只对默认的tcp生效
+func WithTransport(t Transport) ClientOption {
+	return func(l *tcpClient) {
+		l.transport = t
+	}
+}
+
+// WithWebSocket 用websocket连接服务端的path，服务端用 WsHandler 接入，帧的格式不变
+// 设置了 WithTLS 时使用wss，WithDialer 的拨号用来建立底层连接
+func WithWebSocket(path string) ClientOption {
+	return func(l *tcpClient) {
+		if path == "" {
+			path = "/"
+		}
+		l.wsPath = path
+	}
+}
+
+// WithReadIdleTimeout 超过d没有收到任何数据就断开连接，OnError会收到 ErrReadIdleTimeout
+// 心跳的pong也算收到数据
+func WithReadIdleTimeout(d time.Duration) ClientOption {
+	return func(l *tcpClient) {
+		l.readIdleTimeout = d
+	}
+}
@@ -0,0 +1,71 @@
+package mytcp
+
+import (
+	"runtime/debug"
+
+	"github.com/pkg/errors"
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/util"
+)
+
+type clientPanicCallback func(v any, stack []byte)
+
+type PanicPolicy int
+
+const (
+	// PanicKeep 只回调OnPanic，连接继续收消息
+	PanicKeep PanicPolicy = iota
+	// PanicClose 回调OnPanic之后关闭当前连接，开启了重连会重新连接
+	PanicClose
+	// PanicRepanic 回调OnPanic之后让进程崩溃
+	PanicRepanic
+)
+
+// WithPanicPolicy 收消息回调panic之后的处理方式，默认 PanicKeep
+func WithPanicPolicy(p PanicPolicy) ClientOption {
+	return func(l *tcpClient) {
+		l.panicPolicy = p
+	}
+}
+
+// OnGoroutinePanic server和client内部的goroutine panic时调用，比如读写连接的协程，panic的goroutine会结束
+// 对所有server和client生效，nil表示只打印日志
+func OnGoroutinePanic(f func(name string, recovered any, stack []byte)) {
+	util.SetPanicHook(f)
+}
+
+// OnPanic 收消息回调(OnReceive、Handle等)panic时调用，没设置时打印到日志
+func (l *tcpClient) OnPanic(f clientPanicCallback) {
+	l.panicCallback = f
+}
+
+func (l *tcpClient) safeReceive(msg btmsg.IMsg) {
+	defer l.recoverReceive(msg)
+
+	l.handelReceive(msg)
+}
+
+// recoverReceive 处理msg时panic按 WithPanicPolicy 处理，要直接defer调用
+func (l *tcpClient) recoverReceive(msg btmsg.IMsg) {
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	stack := debug.Stack()
+	if l.panicCallback != nil {
+		l.panicCallback(v, stack)
+	} else {
+		l.log("receive panic", errors.Errorf("act %s: %v\n%s", btmsg.ActName(msg.GetAct()), v, stack))
+	}
+
+	switch l.panicPolicy {
+	case PanicClose:
+		if conn, _ := l.current(); conn != nil {
+			_ = conn.Close()
+		}
+	case PanicRepanic:
+		// MyGoWg会recover，只能换一个协程抛出去
+		go panic(v)
+	}
+}
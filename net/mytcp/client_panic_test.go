@@ -0,0 +1,86 @@
+package mytcp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+func TestClientReceivePanic(t *testing.T) {
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		s.Send(conn, msg)
+	})
+	defer stop()
+
+	var got = make(chan string, 2)
+	var panics = make(chan any, 2)
+	cli := newTestClient(ts.listener.Addr().String())
+	cli.OnReceive(func(msg btmsg.IMsg) {
+		var v echoReq
+		_, _ = msg.ToStruct(&v)
+		if v.Msg == "panic;" {
+			panic("receive panic;")
+		}
+		got <- v.Msg
+	})
+	cli.OnPanic(func(v any, stack []byte) {
+		if len(stack) == 0 {
+			t.Error("expect stack")
+		}
+		panics <- v
+	})
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	_ = cli.SendStruct(1, echoReq{Msg: "panic;"})
+	_ = cli.SendStruct(1, echoReq{Msg: "after"})
+
+	select {
+	case v := <-panics:
+		if v != "receive panic;" {
+			t.Fatalf("panic value %v", v)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("expect OnPanic")
+	}
+
+	select {
+	case v := <-got:
+		if v != "after" {
+			t.Fatalf("got %q", v)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("expect receive after panic")
+	}
+}
+
+func TestClientReceivePanicClose(t *testing.T) {
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		s.Send(conn, msg)
+	})
+	defer stop()
+
+	cli := newTestClient(ts.listener.Addr().String(), WithPanicPolicy(PanicClose))
+	cli.OnReceive(func(msg btmsg.IMsg) {
+		panic("close")
+	})
+	cli.OnPanic(func(v any, stack []byte) {})
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	_ = cli.SendStruct(1, echoReq{})
+
+	select {
+	case <-cli.Done():
+	case <-time.After(time.Second * 3):
+		t.Fatal("expect conn closed")
+	}
+}
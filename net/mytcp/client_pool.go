@@ -0,0 +1,389 @@
+package mytcp
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/util"
+)
+
+type PoolBalance int
+
+const (
+	PoolRoundRobin PoolBalance = iota
+	PoolLeastPending
+)
+
+var ErrPoolClosed = errors.New("pool closed")
+
+type poolClient struct {
+	cli     *tcpClient
+	pending int64
+}
+
+func (l *poolClient) alive() bool {
+	select {
+	case <-l.cli.Done():
+		return false
+	default:
+		return true
+	}
+}
+
+type PoolStats struct {
+	Size      int
+	Connected int
+	Pending   int64
+	Replaced  int64
+	// Clients 当前所有连接的统计之和，已经被替换掉的连接不算
+	Clients ClientStats
+}
+
+// ClientPool 维护size个连接，断开的连接会自动重新建立
+type ClientPool struct {
+	addr          string
+	size          int
+	opts          []ClientOption
+	balance       PoolBalance
+	retryInterval time.Duration
+	lock          sync.RWMutex
+	clients       []*poolClient
+	next          uint32
+	replaced      int64
+	closed        chan struct{}
+	callLock      sync.Mutex
+	calling       int
+	drained       chan struct{}
+	wg            *sync.WaitGroup
+}
+
+func NewClientPool(addr string, size int, opts ...ClientOption) *ClientPool {
+	if size <= 0 {
+		size = 1
+	}
+
+	return &ClientPool{
+		addr:          addr,
+		size:          size,
+		opts:          opts,
+		balance:       PoolRoundRobin,
+		retryInterval: time.Second,
+		clients:       make([]*poolClient, size),
+		closed:        make(chan struct{}),
+		wg:            &sync.WaitGroup{},
+	}
+}
+
+// SetBalance 在Start之前调用
+func (l *ClientPool) SetBalance(b PoolBalance) {
+	l.balance = b
+}
+
+// SetRetryInterval 连接断开后重新建立连接的间隔，在Start之前调用
+func (l *ClientPool) SetRetryInterval(d time.Duration) {
+	l.retryInterval = d
+}
+
+// Start 所有连接都建立成功才返回nil，否则关闭已经建立的连接
+func (l *ClientPool) Start() (wg *sync.WaitGroup, err error) {
+	for i := 0; i < l.size; i++ {
+		var pc *poolClient
+		pc, err = l.dial()
+		if err != nil {
+			l.closeClients()
+			return nil, errors.Wrapf(err, "pool dial %d", i)
+		}
+
+		l.clients[i] = pc
+		l.watch(i, pc)
+	}
+
+	return l.wg, nil
+}
+
+func (l *ClientPool) dial() (*poolClient, error) {
+	cli := NewTcpClient(l.addr, l.opts...)
+	_, err := cli.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	return &poolClient{cli: cli}, nil
+}
+
+// watch 连接断开后在同一个位置重新建立连接，保证按key分配的连接不变
+func (l *ClientPool) watch(idx int, pc *poolClient) {
+	util.MyGoWg(l.wg, fmt.Sprintf("pool_%d_watch", idx), func() {
+		select {
+		case <-l.closed:
+			return
+		case <-pc.cli.Done():
+		}
+
+		for {
+			newPc, err := l.dial()
+			if err == nil {
+				l.lock.Lock()
+				select {
+				case <-l.closed:
+					l.lock.Unlock()
+					newPc.cli.Close()
+					return
+				default:
+				}
+				l.clients[idx] = newPc
+				l.lock.Unlock()
+
+				atomic.AddInt64(&l.replaced, 1)
+				l.watch(idx, newPc)
+				return
+			}
+
+			select {
+			case <-l.closed:
+				return
+			case <-time.After(l.retryInterval):
+			}
+		}
+	})
+}
+
+func (l *ClientPool) isClosed() bool {
+	select {
+	case <-l.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *ClientPool) pick() (*poolClient, error) {
+	if l.isClosed() {
+		return nil, ErrPoolClosed
+	}
+
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	if l.balance == PoolLeastPending {
+		var best *poolClient
+		for _, pc := range l.clients {
+			if !pc.alive() {
+				continue
+			}
+			if best == nil || atomic.LoadInt64(&pc.pending) < atomic.LoadInt64(&best.pending) {
+				best = pc
+			}
+		}
+		if best == nil {
+			return nil, ErrNotConnected
+		}
+		return best, nil
+	}
+
+	for i := 0; i < len(l.clients); i++ {
+		n := atomic.AddUint32(&l.next, 1)
+		pc := l.clients[int(n)%len(l.clients)]
+		if pc.alive() {
+			return pc, nil
+		}
+	}
+
+	return nil, ErrNotConnected
+}
+
+// pickByKey 相同的key总是分配到同一个位置的连接上，这样消息能保持顺序
+func (l *ClientPool) pickByKey(key string) (*poolClient, error) {
+	if l.isClosed() {
+		return nil, ErrPoolClosed
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return l.clients[jumpHash(h.Sum64(), len(l.clients))], nil
+}
+
+// jumpHash 一致性hash，见 https://arxiv.org/abs/1406.2294
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+func (l *ClientPool) sendMsg(pc *poolClient, msg btmsg.IMsg) error {
+	atomic.AddInt64(&pc.pending, 1)
+	defer atomic.AddInt64(&pc.pending, -1)
+
+	return pc.cli.SendMsg(msg)
+}
+
+func (l *ClientPool) beginCall() error {
+	l.callLock.Lock()
+	defer l.callLock.Unlock()
+
+	if l.isClosed() {
+		return ErrPoolClosed
+	}
+
+	l.calling++
+	return nil
+}
+
+func (l *ClientPool) endCall() {
+	l.callLock.Lock()
+	defer l.callLock.Unlock()
+
+	l.calling--
+	if l.calling == 0 && l.drained != nil {
+		close(l.drained)
+		l.drained = nil
+	}
+}
+
+func (l *ClientPool) call(ctx context.Context, pc *poolClient, act uint16, req any, rsp any) error {
+	err := l.beginCall()
+	if err != nil {
+		return err
+	}
+	defer l.endCall()
+
+	atomic.AddInt64(&pc.pending, 1)
+	defer atomic.AddInt64(&pc.pending, -1)
+
+	return pc.cli.Call(ctx, act, req, rsp)
+}
+
+func (l *ClientPool) Send(msg btmsg.IMsg) error {
+	return l.SendMsg(msg)
+}
+
+func (l *ClientPool) SendMsg(msg btmsg.IMsg) error {
+	pc, err := l.pick()
+	if err != nil {
+		return err
+	}
+	return l.sendMsg(pc, msg)
+}
+
+func (l *ClientPool) SendMsgByKey(key string, msg btmsg.IMsg) error {
+	pc, err := l.pickByKey(key)
+	if err != nil {
+		return err
+	}
+	return l.sendMsg(pc, msg)
+}
+
+func (l *ClientPool) Call(ctx context.Context, act uint16, req any, rsp any) error {
+	pc, err := l.pick()
+	if err != nil {
+		return err
+	}
+	return l.call(ctx, pc, act, req, rsp)
+}
+
+func (l *ClientPool) CallByKey(ctx context.Context, key string, act uint16, req any, rsp any) error {
+	pc, err := l.pickByKey(key)
+	if err != nil {
+		return err
+	}
+	return l.call(ctx, pc, act, req, rsp)
+}
+
+func (l *ClientPool) Stats() PoolStats {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	var st = PoolStats{
+		Size:     len(l.clients),
+		Replaced: atomic.LoadInt64(&l.replaced),
+	}
+
+	for _, pc := range l.clients {
+		if pc == nil {
+			continue
+		}
+		if pc.alive() {
+			st.Connected++
+		}
+		st.Pending += atomic.LoadInt64(&pc.pending)
+
+		cs := pc.cli.Stats()
+		st.Clients.BytesSent += cs.BytesSent
+		st.Clients.BytesReceived += cs.BytesReceived
+		st.Clients.MsgSent += cs.MsgSent
+		st.Clients.MsgReceived += cs.MsgReceived
+		st.Clients.Pending += cs.Pending
+		st.Clients.Dropped += cs.Dropped
+		st.Clients.Reconnects += cs.Reconnects
+		st.Clients.Compressed += cs.Compressed
+		st.Clients.Uncompressed += cs.Uncompressed
+		st.Clients.CompressSaved += cs.CompressSaved
+	}
+
+	return st
+}
+
+func (l *ClientPool) closeClients() {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	for _, pc := range l.clients {
+		if pc != nil {
+			pc.cli.Close()
+		}
+	}
+}
+
+// Close 不再接受新的发送，最多等待timeout让进行中的Call完成，然后关闭所有连接
+func (l *ClientPool) Close(timeout time.Duration) (err error) {
+	l.callLock.Lock()
+	if l.isClosed() {
+		l.callLock.Unlock()
+		return ErrPoolClosed
+	}
+	close(l.closed)
+
+	var done = make(chan struct{})
+	if l.calling == 0 {
+		close(done)
+	} else {
+		l.drained = done
+	}
+	l.callLock.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+		err = errors.Errorf("pool close timeout after %v, calls still in flight", timeout)
+	}
+
+	l.closeClients()
+	l.wg.Wait()
+
+	l.lock.RLock()
+	for _, pc := range l.clients {
+		if pc != nil {
+			<-pc.cli.Done()
+		}
+	}
+	l.lock.RUnlock()
+
+	return
+}
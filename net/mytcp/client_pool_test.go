@@ -0,0 +1,82 @@
+package mytcp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+func TestClientPool(t *testing.T) {
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		var req callReq
+		_, _ = msg.ToStruct(&req)
+		if req.N < 0 {
+			s.CloseConn(conn)
+			return
+		}
+		_ = msg.FromStruct(&callRsp{N: req.N + 1})
+		s.Send(conn, msg)
+	})
+	defer stop()
+
+	pool := NewClientPool(ts.listener.Addr().String(), 3, WithHeadFactory(btmsg.FactoryMsgHeadTcpSeq()))
+	pool.SetRetryInterval(time.Millisecond * 10)
+	_, err := pool.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		var rsp callRsp
+		err = pool.Call(context.Background(), 1, &callReq{N: i}, &rsp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rsp.N != i+1 {
+			t.Fatalf("expect %d, got %d", i+1, rsp.N)
+		}
+	}
+
+	// 让服务端断开key对应的连接，之后同一个key应该用上新建立的连接
+	_ = pool.CallByKey(context.Background(), "k", 1, &callReq{N: -1}, &callRsp{})
+
+	deadline := time.Now().Add(time.Second * 3)
+	for pool.Stats().Replaced == 0 || pool.Stats().Connected != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect replaced, got %+v", pool.Stats())
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	var rsp callRsp
+	err = pool.CallByKey(context.Background(), "k", 1, &callReq{N: 1}, &rsp)
+	if err != nil || rsp.N != 2 {
+		t.Fatalf("call by key after replace: %v %d", err, rsp.N)
+	}
+
+	err = pool.Close(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = pool.Call(context.Background(), 1, &callReq{N: 1}, &rsp)
+	if err != ErrPoolClosed {
+		t.Fatalf("expect ErrPoolClosed, got %v", err)
+	}
+}
+
+func TestJumpHash(t *testing.T) {
+	for k := uint64(0); k < 1000; k++ {
+		b := jumpHash(k, 10)
+		if b < 0 || b >= 10 {
+			t.Fatalf("bucket %d out of range", b)
+		}
+		// 扩容时只有一部分key会移动到新的桶
+		if nb := jumpHash(k, 11); nb != b && nb != 10 {
+			t.Fatalf("key %d moved from %d to %d", k, b, nb)
+		}
+	}
+}
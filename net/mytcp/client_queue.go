@@ -0,0 +1,71 @@
+package mytcp
+
+import (
+	"sync/atomic"
+)
+
+type OverflowPolicy int
+
+const (
+	// OverflowBlock 队列满了Send一直等待，默认
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNew 丢弃这次发送的消息，Send返回nil
+	OverflowDropNew
+	// OverflowDropOld 丢弃队列里最早的消息，再放入这次的消息
+	OverflowDropOld
+	// OverflowError Send返回 ErrSendQueueFull
+	OverflowError
+)
+
+type clientSendQueue struct {
+	size   int
+	policy OverflowPolicy
+}
+
+// WithSendQueue 发送先放入长度为size的队列，由写协程写入socket，队列满了按policy处理
+// 丢弃的数量见 ClientStats.Dropped，CloseGraceful会等队列写完
+func WithSendQueue(size int, policy OverflowPolicy) ClientOption {
+	return func(l *tcpClient) {
+		l.sendQueue = clientSendQueue{
+			size:   size,
+			policy: policy,
+		}
+	}
+}
+
+// tryEnqueue 不阻塞地放入队列，handled为false时按 OverflowBlock 处理
+// 调用方已经把pending加1
+func (l *tcpClient) tryEnqueue(bt []byte) (handled bool, err error) {
+	if l.sendQueue.policy == OverflowBlock {
+		return false, nil
+	}
+
+	for {
+		select {
+		case l.input <- bt:
+			return true, nil
+		default:
+		}
+
+		switch l.sendQueue.policy {
+		case OverflowDropNew:
+			l.drop()
+			return true, nil
+		case OverflowError:
+			atomic.AddInt64(&l.counter.pending, -1)
+			return true, ErrSendQueueFull
+		}
+
+		// OverflowDropOld 腾出一个位置再放
+		select {
+		case <-l.input:
+			l.drop()
+		default:
+		}
+	}
+}
+
+func (l *tcpClient) drop() {
+	atomic.AddInt64(&l.counter.pending, -1)
+	atomic.AddUint64(&l.counter.dropped, 1)
+}
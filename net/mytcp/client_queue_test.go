@@ -0,0 +1,49 @@
+package mytcp
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClientSendQueueOverflow(t *testing.T) {
+	enqueue := func(cli *tcpClient, v byte) error {
+		atomic.AddInt64(&cli.counter.pending, 1)
+		_, err := cli.tryEnqueue([]byte{v})
+		return err
+	}
+
+	cases := []struct {
+		policy  OverflowPolicy
+		queued  []byte
+		dropped uint64
+		err     error
+	}{
+		{OverflowDropNew, []byte{1, 2}, 1, nil},
+		{OverflowDropOld, []byte{2, 3}, 1, nil},
+		{OverflowError, []byte{1, 2}, 0, ErrSendQueueFull},
+	}
+
+	for _, c := range cases {
+		cli := newTestClient("127.0.0.1:1", WithSendQueue(2, c.policy))
+		_ = enqueue(cli, 1)
+		_ = enqueue(cli, 2)
+		err := enqueue(cli, 3)
+		if !errors.Is(err, c.err) {
+			t.Fatalf("policy %d err %v, expect %v", c.policy, err, c.err)
+		}
+
+		var queued []byte
+		for len(cli.input) > 0 {
+			queued = append(queued, (<-cli.input)[0])
+		}
+		if string(queued) != string(c.queued) {
+			t.Fatalf("policy %d queued %v, expect %v", c.policy, queued, c.queued)
+		}
+
+		st := cli.Stats()
+		if st.Dropped != c.dropped || st.Pending != 2 {
+			t.Fatalf("policy %d dropped %d pending %d", c.policy, st.Dropped, st.Pending)
+		}
+	}
+}
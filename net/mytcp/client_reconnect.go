@@ -0,0 +1,195 @@
+package mytcp
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+type clientReconnectedCallback func(s ReconnectSender, attempt int, downtime time.Duration) error
+
+// ReconnectSender OnReconnected 回调里用来发送，回调返回之前只有它发送的消息会写到新的连接上
+// 回调返回之后不要再用
+type ReconnectSender interface {
+	SendMsg(msg btmsg.IMsg) error
+	SendStruct(act uint16, v any) error
+	Call(ctx context.Context, act uint16, req any, rsp any) error
+}
+
+type reconnectSender struct {
+	l *tcpClient
+}
+
+func (l reconnectSender) SendMsg(msg btmsg.IMsg) error {
+	return l.l.sendMsg(msg, contracts.PriorityNormal, true)
+}
+
+func (l reconnectSender) SendStruct(act uint16, v any) error {
+	return l.l.sendStruct(act, v, true)
+}
+
+func (l reconnectSender) Call(ctx context.Context, act uint16, req any, rsp any) error {
+	return l.l.call(ctx, act, req, rsp, true)
+}
+
+type clientReconnect struct {
+	on          bool
+	min         time.Duration
+	max         time.Duration
+	maxAttempts int
+}
+
+func (l *clientReconnect) enabled() bool {
+	return l.on
+}
+
+// WithReconnect 连接断开后自动重连，间隔从min开始每次翻倍，最大max
+// maxAttempts 连续失败多少次之后放弃，0表示一直重试
+func WithReconnect(min time.Duration, max time.Duration, maxAttempts int) ClientOption {
+	return func(l *tcpClient) {
+		if min <= 0 {
+			min = time.Second
+		}
+		if max < min {
+			max = min
+		}
+
+		l.reconnect = clientReconnect{
+			on:          true,
+			min:         min,
+			max:         max,
+			maxAttempts: maxAttempts,
+		}
+	}
+}
+
+// OnReconnected 重连成功之后、断开期间被挡住的发送放行之前调用，用s同步完成鉴权和订阅
+// 返回error表示这次重连失败，连接会被关闭并继续重试
+// 回调执行期间其他地方的发送和队列里的消息都被挡住，回调返回之后才写到新连接上
+func (l *tcpClient) OnReconnected(f clientReconnectedCallback) {
+	l.reconnected = f
+}
+
+// supervise 当前连接断开后，开启了重连就重新建立连接，否则结束客户端
+func (l *tcpClient) supervise(ctx context.Context, wg *sync.WaitGroup) {
+	for {
+		_, wait := l.current()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			l.setErr(ctx.Err())
+			l.Close()
+			return
+		case <-l.stop:
+			return
+		}
+
+		connErr := l.takeConnErr()
+		if !l.reconnect.enabled() {
+			l.setErr(connErr)
+			l.closeStop()
+			return
+		}
+
+		if !l.reconnectLoop(ctx, wg) {
+			l.closeStop()
+			return
+		}
+	}
+}
+
+// reconnectLoop 返回false表示客户端已经关闭或者放弃重连
+func (l *tcpClient) reconnectLoop(ctx context.Context, wg *sync.WaitGroup) bool {
+	var down = time.Now()
+
+	l.stateLock.Lock()
+	if l.state == clientStateClosed {
+		l.stateLock.Unlock()
+		return false
+	}
+	l.state = clientStateReconnecting
+	l.ready = make(chan struct{})
+	ready := l.ready
+	l.stateLock.Unlock()
+
+	var delay = l.reconnect.min
+	for attempt := 1; ; attempt++ {
+		if l.reconnect.maxAttempts > 0 && attempt > l.reconnect.maxAttempts {
+			err := errors.Wrapf(ErrReconnectGaveUp, "after %d attempts", l.reconnect.maxAttempts)
+			l.setErr(err)
+			l.handelError(err)
+			return false
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-l.stop:
+			return false
+		case <-ctx.Done():
+			l.setErr(ctx.Err())
+			l.Close()
+			return false
+		}
+
+		delay *= 2
+		if delay > l.reconnect.max {
+			delay = l.reconnect.max
+		}
+
+		conn, err := l.connServer(ctx)
+		if err != nil {
+			l.handelError(errors.Wrapf(err, "reconnect attempt %d", attempt))
+			continue
+		}
+
+		l.stateLock.Lock()
+		if l.state == clientStateClosed {
+			l.stateLock.Unlock()
+			_ = conn.Close()
+			return false
+		}
+		l.conn = conn
+		l.wait = make(chan bool)
+		l.hookInput = make(chan []byte)
+		l.released = ready
+		l.state = clientStateRestoring
+		wait := l.wait
+		l.stateLock.Unlock()
+
+		l.startConnLoops(wg)
+		atomic.AddUint64(&l.counter.reconnects, 1)
+
+		if l.reconnected != nil {
+			err = l.reconnected(reconnectSender{l: l}, attempt, time.Since(down))
+			if err != nil {
+				l.handelError(errors.Wrapf(err, "reconnected hook attempt %d", attempt))
+
+				l.stateLock.Lock()
+				if l.state != clientStateClosed {
+					l.state = clientStateReconnecting
+				}
+				l.stateLock.Unlock()
+
+				_ = conn.Close()
+				<-wait
+				l.takeConnErr()
+				continue
+			}
+		}
+
+		l.stateLock.Lock()
+		if l.state == clientStateRestoring {
+			l.state = clientStateConnected
+		}
+		l.stateLock.Unlock()
+
+		close(ready)
+		return true
+	}
+}
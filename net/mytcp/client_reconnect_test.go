@@ -0,0 +1,187 @@
+package mytcp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+func TestClientReconnectedHook(t *testing.T) {
+	var acts = make(chan uint16, 10)
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		acts <- msg.GetAct()
+		if msg.GetAct() == 9 {
+			s.CloseConn(conn)
+		}
+	})
+	defer stop()
+
+	var closed = make(chan bool, 2)
+	var hooking = make(chan struct{})
+	var hookCalls int32
+	var lastAttempt int32
+	cli := newTestClient(ts.listener.Addr().String(), WithReconnect(time.Millisecond*10, time.Millisecond*50, 0))
+	cli.OnClose(func(isServer bool, isClient bool) {
+		closed <- true
+	})
+	cli.OnReconnected(func(s ReconnectSender, attempt int, downtime time.Duration) error {
+		atomic.StoreInt32(&lastAttempt, int32(attempt))
+		if atomic.AddInt32(&hookCalls, 1) == 1 {
+			return errors.New("auth failed")
+		}
+		if err := s.SendStruct(2, echoReq{Msg: "auth"}); err != nil {
+			return err
+		}
+		// 回调执行期间的发送要等回调返回
+		close(hooking)
+		time.Sleep(time.Millisecond * 100)
+		return s.SendStruct(4, echoReq{Msg: "subscribe"})
+	})
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	_ = cli.SendStruct(9, echoReq{})
+	<-closed
+
+	var sent = make(chan error, 1)
+	go func() {
+		<-hooking
+		sent <- cli.SendStruct(3, echoReq{Msg: "held"})
+	}()
+
+	if err = <-sent; err != nil {
+		t.Fatal(err)
+	}
+
+	var got []uint16
+	for len(got) < 4 {
+		select {
+		case act := <-acts:
+			got = append(got, act)
+		case <-time.After(time.Second * 3):
+			t.Fatalf("timeout, got %v", got)
+		}
+	}
+
+	if got[0] != 9 || got[1] != 2 || got[2] != 4 || got[3] != 3 {
+		t.Fatalf("expect [9 2 4 3], got %v", got)
+	}
+	if n := atomic.LoadInt32(&lastAttempt); n != 2 {
+		t.Fatalf("expect hook on attempt 2, got %d", n)
+	}
+	if st := cli.Stats(); st.Reconnects != 2 {
+		t.Fatalf("expect 2 reconnects, got %d", st.Reconnects)
+	}
+}
+
+// TestClientReconnectedHookPing 回调里Call的时候服务端发ping，收到pong之后才回复，读协程回复pong不能等回调返回
+func TestClientReconnectedHookPing(t *testing.T) {
+	verifyNoLeaks(t)
+
+	// 同一个连接的消息按顺序处理，先记下请求，收到pong再回复
+	var auth btmsg.IMsg
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), WithServerPassThroughControlFrames())
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		switch msg.GetAct() {
+		case 9:
+			s.CloseConn(conn)
+		case 2:
+			auth = msg
+			s.Send(conn, btmsg.NewPing())
+		case btmsg.ActPong:
+			if auth != nil {
+				_ = conn.ReplyMsg(auth, &echoReq{Msg: "ok"})
+			}
+		}
+	})
+	wg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		wg.Wait()
+	}()
+
+	var hooked = make(chan error, 1)
+	cli := newTestClient(ts.listener.Addr().String(), WithReconnect(time.Millisecond*10, time.Millisecond*50, 0))
+	cli.OnReconnected(func(s ReconnectSender, attempt int, downtime time.Duration) error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+		defer cancel()
+
+		var rsp echoReq
+		err := s.Call(ctx, 2, &echoReq{Msg: "auth"}, &rsp)
+		hooked <- err
+		return err
+	})
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	_ = cli.SendStruct(9, echoReq{})
+	select {
+	case err = <-hooked:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout waiting hook")
+	}
+}
+
+func TestClientReconnectGiveUp(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 只接受一个连接，之后的重连都会被拒绝
+	go func() {
+		conn, err := ln.Accept()
+		_ = ln.Close()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}()
+
+	var errs = make(chan error, 4)
+	cli := newTestClient(ln.Addr().String(), WithReconnect(time.Millisecond*10, time.Millisecond*10, 2))
+	cli.OnError(func(err error) {
+		errs <- err
+	})
+	wg, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-cli.Done():
+	case <-time.After(time.Second * 3):
+		t.Fatal("expect done after give up")
+	}
+	wg.Wait()
+
+	if n := len(errs); n != 3 {
+		t.Fatalf("expect 2 dial errors and give up, got %d errors", n)
+	}
+
+	err = cli.SendStruct(1, echoReq{})
+	if !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("expect ErrNotConnected, got %v", err)
+	}
+
+	if !errors.Is(cli.Err(), ErrReconnectGaveUp) {
+		t.Fatalf("expect ErrReconnectGaveUp, got %v", cli.Err())
+	}
+}
@@ -0,0 +1,61 @@
+package mytcp
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Resolver *net.Resolver 实现了这个接口
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) (addrs []string, err error)
+}
+
+type clientResolver struct {
+	resolver Resolver
+	lock     sync.Mutex
+	next     map[string]int
+}
+
+// WithResolver 每次连接和重连都用r重新解析域名，解析出多个ip时每次尝试换下一个
+// 不设置时域名交给dialer解析，同样不会缓存
+func WithResolver(r Resolver) ClientOption {
+	return func(l *tcpClient) {
+		l.resolver = &clientResolver{
+			resolver: r,
+			next:     map[string]int{},
+		}
+	}
+}
+
+func (l *clientResolver) pick(host string, ips []string) string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	n := l.next[host]
+	l.next[host] = n + 1
+	return ips[n%len(ips)]
+}
+
+// wrap 在dial之前解析域名，ip地址直接交给dial
+func (l *clientResolver) wrap(dial DialFunc) DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || host == "" || net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+
+		ips, err := l.resolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(ips) == 0 {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+
+		conn, err := dial(ctx, network, net.JoinHostPort(l.pick(host, ips), port))
+		return conn, errors.Wrapf(err, "resolved %s", host)
+	}
+}
@@ -0,0 +1,121 @@
+package mytcp
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeResolver struct {
+	lock    sync.Mutex
+	answers []string
+	lookups int
+}
+
+func (l *fakeResolver) set(ips ...string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.answers = ips
+}
+
+func (l *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.lookups++
+	return append([]string(nil), l.answers...), nil
+}
+
+func TestClientResolverReconnect(t *testing.T) {
+	lnA, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(lnA.Addr().String())
+
+	lnB, err := net.Listen("tcp", net.JoinHostPort("127.0.0.2", port))
+	if err != nil {
+		_ = lnA.Close()
+		t.Skip("127.0.0.2 not available: ", err)
+	}
+	defer lnB.Close()
+
+	// A接受连接后马上断开，模拟服务迁移
+	go func() {
+		conn, err := lnA.Accept()
+		_ = lnA.Close()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}()
+
+	var accepted = make(chan net.Conn, 1)
+	go func() {
+		conn, err := lnB.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	r := &fakeResolver{}
+	r.set("127.0.0.1")
+
+	var closed = make(chan bool, 1)
+	cli := newTestClient(net.JoinHostPort("svc.test", port),
+		WithResolver(r),
+		WithReconnect(time.Millisecond*10, time.Millisecond*10, 0),
+	)
+	cli.OnClose(func(isServer bool, isClient bool) {
+		select {
+		case closed <- true:
+		default:
+		}
+	})
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	<-closed
+	r.set("127.0.0.2")
+
+	select {
+	case conn := <-accepted:
+		defer conn.Close()
+	case <-time.After(time.Second * 3):
+		t.Fatal("expect reconnect to new ip")
+	}
+
+	if cli.CurrentAddr() != net.JoinHostPort("svc.test", port) {
+		t.Fatalf("current addr %q", cli.CurrentAddr())
+	}
+}
+
+func TestClientResolverRotate(t *testing.T) {
+	r := &fakeResolver{}
+	r.set("10.0.0.1", "10.0.0.2")
+
+	var got []string
+	cr := &clientResolver{resolver: r, next: map[string]int{}}
+	dial := cr.wrap(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		got = append(got, addr)
+		return nil, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		_, _ = dial(context.Background(), "tcp", "svc.test:80")
+	}
+	_, _ = dial(context.Background(), "tcp", "10.0.0.9:80")
+
+	expect := []string{"10.0.0.1:80", "10.0.0.2:80", "10.0.0.1:80", "10.0.0.9:80"}
+	for i := range expect {
+		if got[i] != expect[i] {
+			t.Fatalf("dial %v, expect %v", got, expect)
+		}
+	}
+	if r.lookups != 3 {
+		t.Fatalf("expect lookup every dial, got %d", r.lookups)
+	}
+}
@@ -0,0 +1,171 @@
+package mytcp
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/winkb/tcp1/btmsg"
+)
+
+type clientRouteHandle func(msg btmsg.IMsg, req any)
+
+// clientRouteHandleE 返回错误时自动回复，见 HandleE
+type clientRouteHandleE func(msg btmsg.IMsg, req any) error
+
+type clientRoute struct {
+	newReq func() any
+	handle clientRouteHandleE
+	// sizes 这个act收到的消息大小，见 RouteStats
+	sizes sizeHistogram
+}
+
+type clientRouter struct {
+	lock     sync.RWMutex
+	routes   map[uint16]*clientRoute
+	notFound clientReceiveCallback
+	// errs 每个act的handler返回错误的次数
+	errs map[uint16]uint64
+}
+
+// RouteStats 一个act的路由统计
+type RouteStats struct {
+	Errors uint64
+	// Sizes 收到的消息大小分布，桶见 SizeBuckets
+	Sizes []uint64
+}
+
+func (l *clientRouter) get(act uint16) (*clientRoute, clientReceiveCallback) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return l.routes[act], l.notFound
+}
+
+// RouteStats 每个注册过路由的act的统计
+func (l *tcpClient) RouteStats() map[uint16]RouteStats {
+	l.router.lock.RLock()
+	defer l.router.lock.RUnlock()
+
+	var res = map[uint16]RouteStats{}
+	for act, route := range l.router.routes {
+		res[act] = RouteStats{Errors: l.router.errs[act], Sizes: route.sizes.snapshot()}
+	}
+	return res
+}
+
+// Handle 收到act消息时用newReq创建请求结构体解码后调用h，newReq为nil时不解码，req为nil
+// 解码失败交给OnError，不调用h。Call等待的回复不会走到这里
+func (l *tcpClient) Handle(act uint16, newReq func() any, h clientRouteHandle) {
+	l.HandleE(act, newReq, func(msg btmsg.IMsg, req any) error {
+		h(msg, req)
+		return nil
+	})
+}
+
+// HandleE 和Handle一样，h返回错误时用相同的seq回复 btmsg.ActError，错误交给OnError并计入 HandleErrors
+// 错误码见 HandleError，返回 ErrNoReply 时什么都不做
+func (l *tcpClient) HandleE(act uint16, newReq func() any, h clientRouteHandleE) {
+	l.router.lock.Lock()
+	defer l.router.lock.Unlock()
+
+	if l.router.routes == nil {
+		l.router.routes = map[uint16]*clientRoute{}
+	}
+	l.router.routes[act] = &clientRoute{newReq: newReq, handle: h}
+}
+
+// HandleNotFound 没有注册路由的act走这里，没设置时走OnReceive
+func (l *tcpClient) HandleNotFound(f clientReceiveCallback) {
+	l.router.lock.Lock()
+	defer l.router.lock.Unlock()
+
+	l.router.notFound = f
+}
+
+// HandleClient Handle的泛型版本，req已经解码成*T
+func HandleClient[T any](cli *tcpClient, act uint16, h func(msg btmsg.IMsg, req *T)) {
+	cli.Handle(act, func() any {
+		return new(T)
+	}, func(msg btmsg.IMsg, req any) {
+		h(msg, req.(*T))
+	})
+}
+
+// HandleClientE HandleE的泛型版本
+func HandleClientE[T any](cli *tcpClient, act uint16, h func(msg btmsg.IMsg, req *T) error) {
+	cli.HandleE(act, func() any {
+		return new(T)
+	}, func(msg btmsg.IMsg, req any) error {
+		return h(msg, req.(*T))
+	})
+}
+
+// HandleErrors 每个act的handler返回错误的次数，不包括 ErrNoReply
+func (l *tcpClient) HandleErrors() map[uint16]uint64 {
+	l.router.lock.RLock()
+	defer l.router.lock.RUnlock()
+
+	var res = make(map[uint16]uint64, len(l.router.errs))
+	for act, n := range l.router.errs {
+		res[act] = n
+	}
+	return res
+}
+
+func (l *tcpClient) handleRouteError(msg btmsg.IMsg, err error) {
+	if errors.Is(err, ErrNoReply) {
+		return
+	}
+
+	act := msg.GetAct()
+	l.router.lock.Lock()
+	if l.router.errs == nil {
+		l.router.errs = map[uint16]uint64{}
+	}
+	l.router.errs[act]++
+	l.router.lock.Unlock()
+
+	l.handelError(errors.Wrapf(err, "handle act %s", btmsg.ActName(act)))
+
+	code, text := handleErrorReply(err)
+	rsp, err := btmsg.NewErrorReply(msg, code, text)
+	if err != nil {
+		l.handelError(errors.Wrapf(err, "error reply act %s", btmsg.ActName(act)))
+		return
+	}
+	err = l.SendMsg(rsp)
+	if err != nil {
+		l.handelError(errors.Wrapf(err, "error reply act %s", btmsg.ActName(act)))
+	}
+}
+
+func (l *tcpClient) handelReceive(msg btmsg.IMsg) {
+	route, notFound := l.router.get(msg.GetAct())
+	if route == nil {
+		if notFound != nil {
+			notFound(msg)
+			return
+		}
+		if l.receiveCallback != nil {
+			l.receiveCallback(msg)
+		}
+		return
+	}
+
+	route.sizes.observe(int(msg.HeadSize() + msg.BodySize()))
+
+	var req any
+	if route.newReq != nil {
+		req = route.newReq()
+		_, err := msg.ToStruct(req)
+		if err != nil {
+			l.handelError(errors.Wrapf(err, "decode act %s", btmsg.ActName(msg.GetAct())))
+			return
+		}
+	}
+
+	err := route.handle(msg, req)
+	if err != nil {
+		l.handleRouteError(msg, err)
+	}
+}
@@ -0,0 +1,223 @@
+package mytcp
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+func TestClientHandle(t *testing.T) {
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		s.Send(conn, msg)
+		if msg.GetAct() == 1 && msg.GetSeq() == 0 {
+			// 额外推一个没注册的act
+			hd := btmsg.NewMsgHeadTcpSeq()
+			hd.SetAct(7)
+			s.Send(conn, btmsg.NewMsg(hd, nil))
+		}
+	})
+	defer stop()
+
+	var got = make(chan string, 4)
+	var missed = make(chan uint16, 4)
+	cli := newTestClient(ts.listener.Addr().String())
+	HandleClient(cli, 1, func(msg btmsg.IMsg, req *echoReq) {
+		got <- req.Msg
+	})
+	cli.HandleNotFound(func(msg btmsg.IMsg) {
+		missed <- msg.GetAct()
+	})
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	// Call的回复只交给Call，不会进路由
+	var rsp echoReq
+	err = cli.Call(context.Background(), 1, echoReq{Msg: "call"}, &rsp)
+	if err != nil || rsp.Msg != "call" {
+		t.Fatalf("call rsp %+v err %v", rsp, err)
+	}
+
+	_ = cli.SendStruct(1, echoReq{Msg: "push"})
+
+	select {
+	case v := <-got:
+		if v != "push" {
+			t.Fatalf("got %q", v)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout")
+	}
+
+	select {
+	case act := <-missed:
+		if act != 7 {
+			t.Fatalf("not found act %d", act)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout")
+	}
+
+	select {
+	case v := <-got:
+		t.Fatalf("unexpected route %q", v)
+	default:
+	}
+}
+
+func TestClientHandleCodecRegistry(t *testing.T) {
+	codecs := btmsg.NewCodecRegistry(nil)
+	codecs.RegisterCodec(5, btmsg.RawCodec{})
+
+	ts := NewTcpServer("0", btmsg.NewReaderWithCodec(btmsg.FactoryMsgHeadTcpSeq(), codecs))
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		s.Send(conn, msg)
+	})
+	swg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		swg.Wait()
+	}()
+
+	var chunks = make(chan []byte, 1)
+	var reqs = make(chan string, 1)
+	cli := newTestClient(ts.listener.Addr().String(), WithCodec(codecs))
+	HandleClient(cli, 5, func(msg btmsg.IMsg, req *[]byte) {
+		chunks <- *req
+	})
+	HandleClient(cli, 1, func(msg btmsg.IMsg, req *echoReq) {
+		reqs <- req.Msg
+	})
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	_ = cli.SendStruct(5, []byte{0xff, 0x00})
+	_ = cli.SendStruct(1, echoReq{Msg: "json"})
+
+	select {
+	case bt := <-chunks:
+		if len(bt) != 2 || bt[0] != 0xff {
+			t.Fatalf("chunk %v", bt)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout")
+	}
+
+	select {
+	case v := <-reqs:
+		if v != "json" {
+			t.Fatalf("got %q", v)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout")
+	}
+}
+
+// TestClientHandleE handler返回错误时自动回复错误，ErrNoReply不回复
+func TestClientHandleE(t *testing.T) {
+	type result struct {
+		seq  uint32
+		code uint16
+		text string
+	}
+	var replies = make(chan result, 4)
+	var connCh = make(chan *contracts.TcpConn, 1)
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		if msg.GetAct() == 9 {
+			connCh <- conn
+			return
+		}
+		code, text, ok := msg.GetError()
+		if !ok {
+			t.Errorf("expect error reply, got act %d", msg.GetAct())
+			return
+		}
+		var body btmsg.ErrorBody
+		_, _ = msg.ToStruct(&body)
+		if body.Act != 10 {
+			t.Errorf("error act %d", body.Act)
+		}
+		replies <- result{seq: msg.GetSeq(), code: code, text: text}
+	})
+	defer stop()
+
+	var errs = make(chan error, 4)
+	cli := newTestClient(ts.listener.Addr().String())
+	cli.OnError(func(err error) {
+		errs <- err
+	})
+	HandleClientE(cli, 10, func(msg btmsg.IMsg, req *callReq) error {
+		switch {
+		case req.N < 0:
+			return errors.Wrap(&HandleError{Code: 404, Text: "missing"}, "lookup")
+		case req.N == 0:
+			return errors.New("boom")
+		case req.N == 1:
+			return ErrNoReply
+		}
+		return nil
+	})
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	_ = cli.SendStruct(9, nil)
+	var conn *contracts.TcpConn
+	select {
+	case conn = <-connCh:
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout")
+	}
+
+	for i, n := range []int{-1, 1, 2, 0} {
+		req := btmsg.NewMsg(btmsg.NewMsgHeadTcpSeq(), nil)
+		req.SetAct(10)
+		req.SetSeq(uint32(100 + i))
+		_ = req.FromStruct(&callReq{N: n})
+		ts.Send(conn, req)
+	}
+
+	for _, want := range []result{{100, 404, "missing"}, {103, DefaultHandleErrorCode, "boom"}} {
+		select {
+		case got := <-replies:
+			if got != want {
+				t.Fatalf("expect %+v, got %+v", want, got)
+			}
+		case <-time.After(time.Second * 3):
+			t.Fatal("timeout")
+		}
+		select {
+		case err := <-errs:
+			if !strings.Contains(err.Error(), "handle act 10") {
+				t.Fatalf("error %v", err)
+			}
+		case <-time.After(time.Second * 3):
+			t.Fatal("OnError not called")
+		}
+	}
+
+	select {
+	case got := <-replies:
+		t.Fatalf("unexpected reply %+v", got)
+	case <-time.After(time.Millisecond * 50):
+	}
+	if n := cli.HandleErrors()[10]; n != 2 {
+		t.Fatalf("expect 2 errors, got %d", n)
+	}
+}
@@ -0,0 +1,115 @@
+package mytcp
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/winkb/tcp1/util/numfn"
+)
+
+type ClientStats struct {
+	BytesSent     uint64
+	BytesReceived uint64
+	MsgSent       uint64
+	MsgReceived   uint64
+	// Pending 正在等待写入socket的发送数量
+	Pending int64
+	// Dropped 发送队列满了被丢弃的消息数量，见 WithSendQueue
+	Dropped    uint64
+	Reconnects uint64
+	// Oversized 收到超过 WithMaxMsgSize 的消息而断开的次数
+	Oversized uint64
+	// Compressed 开启 WithCompressThreshold 后压缩发送的消息数，Uncompressed 是没有压缩的消息数
+	Compressed   uint64
+	Uncompressed uint64
+	// CompressSaved 压缩节省的字节数
+	CompressSaved uint64
+	// ConnectedAt 最近一次连接成功的时间
+	ConnectedAt time.Time
+	// Connected 最近一次连接到现在的时长，断开之后为0
+	Connected time.Duration
+	// ReceivedSizes SentSizes 收发消息的大小分布，桶见 SizeBuckets
+	ReceivedSizes []uint64
+	SentSizes     []uint64
+}
+
+type clientCounter struct {
+	bytesSent     uint64
+	bytesReceived uint64
+	msgSent       uint64
+	msgReceived   uint64
+	pending       int64
+	dropped       uint64
+	reconnects    uint64
+	oversized     uint64
+	compressed    uint64
+	uncompressed  uint64
+	compressSaved uint64
+	connectedAt   int64
+	// writes socket写入次数，用来观察 WithWriteBuffer 的效果
+	writes uint64
+}
+
+// countConn 统计经过连接的字节数
+type countConn struct {
+	net.Conn
+	counter *clientCounter
+}
+
+func (l *countConn) Read(b []byte) (n int, err error) {
+	n, err = l.Conn.Read(b)
+	atomic.AddUint64(&l.counter.bytesReceived, uint64(n))
+	return
+}
+
+func (l *countConn) Write(b []byte) (n int, err error) {
+	n, err = l.Conn.Write(b)
+	atomic.AddUint64(&l.counter.bytesSent, uint64(n))
+	atomic.AddUint64(&l.counter.writes, 1)
+	return
+}
+
+// Stats 计数在重连之后继续累加
+func (l *tcpClient) Stats() ClientStats {
+	c := &l.counter
+	st := ClientStats{
+		BytesSent:     atomic.LoadUint64(&c.bytesSent),
+		BytesReceived: atomic.LoadUint64(&c.bytesReceived),
+		MsgSent:       atomic.LoadUint64(&c.msgSent),
+		MsgReceived:   atomic.LoadUint64(&c.msgReceived),
+		Pending:       atomic.LoadInt64(&c.pending),
+		Dropped:       atomic.LoadUint64(&c.dropped),
+		Reconnects:    atomic.LoadUint64(&c.reconnects),
+		Oversized:     atomic.LoadUint64(&c.oversized),
+		Compressed:    atomic.LoadUint64(&c.compressed),
+		Uncompressed:  atomic.LoadUint64(&c.uncompressed),
+		CompressSaved: atomic.LoadUint64(&c.compressSaved),
+		ReceivedSizes: l.sizes.received.snapshot(),
+		SentSizes:     l.sizes.sent.snapshot(),
+	}
+
+	if at := atomic.LoadInt64(&c.connectedAt); at > 0 {
+		st.ConnectedAt = time.Unix(0, at)
+		_, wait := l.current()
+		select {
+		case <-wait:
+		default:
+			st.Connected = time.Since(st.ConnectedAt)
+		}
+	}
+
+	return st
+}
+
+// String 给日志看的格式，字节数和时长换成可读的单位
+func (l ClientStats) String() string {
+	return fmt.Sprintf("sent %d msgs %s, received %d msgs %s, pending %d, dropped %d, reconnects %d, oversized %d, compressed %d saved %s, connected %s",
+		l.MsgSent, numfn.HumanBytes(int64(l.BytesSent)),
+		l.MsgReceived, numfn.HumanBytes(int64(l.BytesReceived)),
+		l.Pending, l.Dropped, l.Reconnects, l.Oversized,
+		l.Compressed, numfn.HumanBytes(int64(l.CompressSaved)),
+		numfn.HumanDuration(l.Connected),
+	)
+}
@@ -0,0 +1,162 @@
+package mytcp
+
+import (
+	"bufio"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// closeFlushTimeout Close之前flush最多等待的时间，避免对端不读时Close卡住
+	closeFlushTimeout = time.Second
+	// writeQueueSize 开启 WithWriteBuffer 时发送队列的长度
+	writeQueueSize = 256
+)
+
+type clientWriteBuffer struct {
+	size     int
+	maxDelay time.Duration
+	flush    chan chan error
+}
+
+// WithWriteBuffer 发送先写入size大小的缓冲区，缓冲区满、发送队列空闲、
+// 距离第一条没发出去的消息超过maxDelay时写入socket，maxDelay为0时只在前两种情况写入
+// 开启后没有设置 WithSendQueue 时发送队列长度为 writeQueueSize，Send放进队列就返回
+func WithWriteBuffer(size int, maxDelay time.Duration) ClientOption {
+	return func(l *tcpClient) {
+		l.writeBuffer = clientWriteBuffer{
+			size:     size,
+			maxDelay: maxDelay,
+			flush:    make(chan chan error),
+		}
+	}
+}
+
+// Flush 把已经Send成功的消息都写入socket，没有开启 WithWriteBuffer 时直接返回nil
+func (l *tcpClient) Flush() error {
+	if l.writeBuffer.size <= 0 {
+		return nil
+	}
+
+	_, wait := l.current()
+	res := make(chan error, 1)
+
+	select {
+	case l.writeBuffer.flush <- res:
+	case <-wait:
+		return ErrNotConnected
+	}
+
+	select {
+	case err := <-res:
+		return err
+	case <-wait:
+		return ErrNotConnected
+	}
+}
+
+// flushBeforeClose 关闭连接之前尽量把缓冲区写出去
+func (l *tcpClient) flushBeforeClose() {
+	if l.writeBuffer.size <= 0 {
+		return
+	}
+
+	l.stateLock.RLock()
+	state := l.state
+	l.stateLock.RUnlock()
+	if state != clientStateConnected {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = l.Flush()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(closeFlushTimeout):
+	}
+}
+
+func (l *tcpClient) loopWriteBuffered(conn net.Conn, wait chan bool) {
+	cfg := &l.writeBuffer
+	bw := bufio.NewWriterSize(fullWriter{w: conn}, cfg.size)
+
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	if cfg.maxDelay > 0 {
+		ticker = time.NewTicker(cfg.maxDelay)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	// firstAt 缓冲区里最早一条消息写入的时间
+	var firstAt time.Time
+	flush := func() error {
+		firstAt = time.Time{}
+		if bw.Buffered() == 0 {
+			return nil
+		}
+		return bw.Flush()
+	}
+
+	write := func(bt []byte) {
+		if bw.Buffered() == 0 {
+			firstAt = time.Now()
+		}
+		_, err := bw.Write(bt)
+		atomic.AddInt64(&l.counter.pending, -1)
+		if err != nil {
+			l.log("conn write", err)
+			return
+		}
+		atomic.AddUint64(&l.counter.msgSent, 1)
+		l.sizes.observeSent(nil, len(bt))
+	}
+
+	ps := prioritySelector[[]byte]{high: l.inputHigh, normal: l.input}
+	writeBatch := func(bt []byte) {
+		write(bt)
+
+		// 一直有消息就一直写缓冲区，队列空了再写socket
+		for cfg.maxDelay <= 0 || time.Since(firstAt) < cfg.maxDelay {
+			bt, ok := ps.try()
+			if !ok {
+				break
+			}
+			write(bt)
+		}
+
+		if err := flush(); err != nil {
+			l.log("conn flush", err)
+		}
+	}
+
+	for {
+		select {
+		case bt := <-l.inputHigh:
+			ps.took(true)
+			writeBatch(bt)
+		case bt := <-l.input:
+			ps.took(false)
+			writeBatch(bt)
+		case res := <-cfg.flush:
+			// Flush之前已经返回的Send可能还在队列里
+			for bt, ok := ps.try(); ok; bt, ok = ps.try() {
+				write(bt)
+			}
+			res <- flush()
+		case <-tick:
+			if !firstAt.IsZero() && time.Since(firstAt) >= cfg.maxDelay {
+				if err := flush(); err != nil {
+					l.log("conn flush", err)
+				}
+			}
+		case <-wait:
+			return
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package mytcp
+
+import (
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+func TestClientWriteBuffer(t *testing.T) {
+	var lock sync.Mutex
+	var got int
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		lock.Lock()
+		got++
+		lock.Unlock()
+	})
+	defer stop()
+
+	cli := newTestClient(ts.listener.Addr().String(), WithWriteBuffer(4096, time.Millisecond*20))
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 1000
+	for i := 0; i < n; i++ {
+		err = cli.SendStruct(1, echoReq{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = cli.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if writes := atomic.LoadUint64(&cli.counter.writes); writes >= n {
+		t.Fatalf("expect fewer writes than msgs, got %d", writes)
+	}
+
+	// Close之前会flush
+	_ = cli.SendStruct(1, echoReq{})
+	cli.Close()
+
+	deadline := time.Now().Add(time.Second * 3)
+	for {
+		lock.Lock()
+		v := got
+		lock.Unlock()
+		if v == n+1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server got %d, expect %d", v, n+1)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func benchmarkClientSend(b *testing.B, opts ...ClientOption) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	cli := newTestClient(ln.Addr().String(), opts...)
+	_, err = cli.Start()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer cli.Close()
+
+	hd := btmsg.NewMsgHeadTcpSeq()
+	hd.SetAct(1)
+	bt := btmsg.NewMsg(hd, []byte("x")).ToSendByte()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 1000; j++ {
+			_ = cli.SendBytes(bt)
+		}
+		_ = cli.Flush()
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(atomic.LoadUint64(&cli.counter.writes))/float64(b.N), "writes/op")
+}
+
+// BenchmarkClientSend 每次发送1000条很小的消息
+func BenchmarkClientSend(b *testing.B) {
+	b.Run("unbuffered", func(b *testing.B) {
+		benchmarkClientSend(b)
+	})
+	b.Run("buffered", func(b *testing.B) {
+		benchmarkClientSend(b, WithWriteBuffer(32*1024, time.Millisecond))
+	})
+}
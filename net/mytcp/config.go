@@ -0,0 +1,428 @@
+package mytcp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	stderrors "errors"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/winkb/tcp1/btmsg"
+)
+
+// Duration 配置里的时间，json和yaml里写成 time.ParseDuration 的格式，比如 "3s"
+type Duration time.Duration
+
+func (l Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(l).String()), nil
+}
+
+func (l *Duration) UnmarshalText(bt []byte) error {
+	d, err := time.ParseDuration(string(bt))
+	if err != nil {
+		return errors.Wrapf(ErrInvalidConfig, "duration %q", bt)
+	}
+	*l = Duration(d)
+	return nil
+}
+
+// TLSConfig 证书和私钥都是pem文件，server必须设置证书，client设置证书时用于双向认证
+type TLSConfig struct {
+	CertFile string `json:"cert_file,omitempty" yaml:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty" yaml:"key_file,omitempty"`
+	// CAFile server用来验证客户端证书，client用来验证服务端证书，为空时client使用系统的根证书
+	CAFile     string `json:"ca_file,omitempty" yaml:"ca_file,omitempty"`
+	ServerName string `json:"server_name,omitempty" yaml:"server_name,omitempty"`
+	// InsecureSkipVerify 只用于测试
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify,omitempty"`
+}
+
+func (l *TLSConfig) enabled() bool {
+	return l.CertFile != "" || l.KeyFile != "" || l.CAFile != "" || l.ServerName != "" || l.InsecureSkipVerify
+}
+
+func (l *TLSConfig) validate(server bool) []error {
+	var errs []error
+	if (l.CertFile == "") != (l.KeyFile == "") {
+		errs = append(errs, errors.Wrap(ErrInvalidConfig, "tls: cert_file and key_file must be set together"))
+	}
+	if server && l.enabled() && l.CertFile == "" {
+		errs = append(errs, errors.Wrap(ErrInvalidConfig, "tls: server needs cert_file"))
+	}
+	return errs
+}
+
+// load server时CAFile是客户端证书的CA，设置了就要求客户端证书
+func (l *TLSConfig) load(server bool) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: l.ServerName, InsecureSkipVerify: l.InsecureSkipVerify}
+	if l.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(l.CertFile, l.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "tls: load key pair")
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if l.CAFile != "" {
+		pem, err := os.ReadFile(l.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "tls: read ca_file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Wrapf(ErrInvalidConfig, "tls: no certificate in %s", l.CAFile)
+		}
+		if server {
+			cfg.ClientCAs = pool
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			cfg.RootCAs = pool
+		}
+	}
+	return cfg, nil
+}
+
+// BanConfig 见 WithViolationBan，Threshold是0时不封禁
+type BanConfig struct {
+	Threshold int      `json:"threshold,omitempty" yaml:"threshold,omitempty"`
+	Window    Duration `json:"window,omitempty" yaml:"window,omitempty"`
+	Duration  Duration `json:"duration,omitempty" yaml:"duration,omitempty"`
+}
+
+// BindRetryConfig 见 WithBindRetry
+type BindRetryConfig struct {
+	Attempts int      `json:"attempts,omitempty" yaml:"attempts,omitempty"`
+	Interval Duration `json:"interval,omitempty" yaml:"interval,omitempty"`
+}
+
+// ServerConfig 可以从json或者yaml读取的server配置，零值和 NewTcpServer 不带选项一样
+// 函数类型的选项(回调、reader、metrics等)不能写在配置里，见 NewTcpServerFromConfig
+type ServerConfig struct {
+	// Addr 监听的地址，可以只写端口，见 NewTcpServer
+	Addr string `json:"addr" yaml:"addr"`
+	// Network tcp、tcp4或者tcp6，见 WithServerNetwork
+	Network      string   `json:"network,omitempty" yaml:"network,omitempty"`
+	WriteTimeout Duration `json:"write_timeout,omitempty" yaml:"write_timeout,omitempty"`
+	// FirstMessageTimeout 见 WithFirstMessageTimeout
+	FirstMessageTimeout Duration `json:"first_message_timeout,omitempty" yaml:"first_message_timeout,omitempty"`
+	// MaxTotalPendingBytes BackpressurePolicy 见 WithMaxTotalPendingBytes，policy是reject、pause或者close_largest
+	MaxTotalPendingBytes int64  `json:"max_total_pending_bytes,omitempty" yaml:"max_total_pending_bytes,omitempty"`
+	BackpressurePolicy   string `json:"backpressure_policy,omitempty" yaml:"backpressure_policy,omitempty"`
+	BroadcastWorkers     int    `json:"broadcast_workers,omitempty" yaml:"broadcast_workers,omitempty"`
+	// BroadcastTimeout 见 WithBroadcastTimeout
+	BroadcastTimeout Duration `json:"broadcast_timeout,omitempty" yaml:"broadcast_timeout,omitempty"`
+	DispatchWorkers  int      `json:"dispatch_workers,omitempty" yaml:"dispatch_workers,omitempty"`
+	// ChunkMaxSize 大于0时开启 WithChunkAssembly
+	ChunkMaxSize int       `json:"chunk_max_size,omitempty" yaml:"chunk_max_size,omitempty"`
+	ChunkTimeout Duration  `json:"chunk_timeout,omitempty" yaml:"chunk_timeout,omitempty"`
+	Ban          BanConfig `json:"ban,omitempty" yaml:"ban,omitempty"`
+	// HealthAddr 见 WithHealthEndpoint，HealthStats 见 WithHealthStats
+	HealthAddr  string `json:"health_addr,omitempty" yaml:"health_addr,omitempty"`
+	HealthStats bool   `json:"health_stats,omitempty" yaml:"health_stats,omitempty"`
+	// EventLogSize 见 WithEventLog，负数不记录
+	EventLogSize int             `json:"event_log_size,omitempty" yaml:"event_log_size,omitempty"`
+	BindRetry    BindRetryConfig `json:"bind_retry,omitempty" yaml:"bind_retry,omitempty"`
+	TLS          TLSConfig       `json:"tls,omitempty" yaml:"tls,omitempty"`
+}
+
+var backpressurePolicies = map[string]BackpressurePolicy{
+	"reject":        BackpressureReject,
+	"pause":         BackpressurePause,
+	"close_largest": BackpressureCloseLargest,
+}
+
+// ApplyDefaults 没有设置的字段填上 NewTcpServer 的默认值
+func (l *ServerConfig) ApplyDefaults() {
+	if l.WriteTimeout == 0 {
+		l.WriteTimeout = Duration(time.Second * 3)
+	}
+	if l.BackpressurePolicy == "" {
+		l.BackpressurePolicy = "reject"
+	}
+	if l.EventLogSize == 0 {
+		l.EventLogSize = defaultEventLogSize
+	}
+}
+
+// Validate 返回所有的问题，每个都可以用 errors.Is(err, ErrInvalidConfig) 判断
+func (l *ServerConfig) Validate() error {
+	var errs []error
+	durations := map[string]Duration{
+		"write_timeout":         l.WriteTimeout,
+		"first_message_timeout": l.FirstMessageTimeout,
+		"broadcast_timeout":     l.BroadcastTimeout,
+		"chunk_timeout":         l.ChunkTimeout,
+		"ban.window":            l.Ban.Window,
+		"ban.duration":          l.Ban.Duration,
+		"bind_retry.interval":   l.BindRetry.Interval,
+	}
+	errs = append(errs, negativeDurations(durations)...)
+
+	if l.Network != "" && l.Network != "tcp" && l.Network != "tcp4" && l.Network != "tcp6" {
+		errs = append(errs, errors.Wrapf(ErrInvalidConfig, "network %q", l.Network))
+	}
+	if l.MaxTotalPendingBytes < 0 {
+		errs = append(errs, errors.Wrap(ErrInvalidConfig, "max_total_pending_bytes is negative"))
+	}
+	if _, ok := backpressurePolicies[l.BackpressurePolicy]; l.BackpressurePolicy != "" && !ok {
+		errs = append(errs, errors.Wrapf(ErrInvalidConfig, "backpressure_policy %q", l.BackpressurePolicy))
+	}
+	if l.BroadcastWorkers < 0 || l.DispatchWorkers < 0 || l.ChunkMaxSize < 0 || l.Ban.Threshold < 0 || l.BindRetry.Attempts < 0 {
+		errs = append(errs, errors.Wrap(ErrInvalidConfig, "workers, chunk_max_size, ban.threshold and bind_retry.attempts can not be negative"))
+	}
+	if l.Ban.Threshold > 0 && (l.Ban.Window == 0 || l.Ban.Duration == 0) {
+		errs = append(errs, errors.Wrap(ErrInvalidConfig, "ban needs window and duration"))
+	}
+	if l.HealthStats && l.HealthAddr == "" {
+		errs = append(errs, errors.Wrap(ErrInvalidConfig, "health_stats needs health_addr"))
+	}
+	errs = append(errs, l.TLS.validate(true)...)
+	return stderrors.Join(errs...)
+}
+
+// Options 按配置生成的选项，没有设置的字段不生成，会先调用 Validate
+func (l *ServerConfig) Options() ([]ServerOption, error) {
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+
+	var opts []ServerOption
+	if l.Network != "" {
+		opts = append(opts, WithServerNetwork(l.Network))
+	}
+	if l.WriteTimeout > 0 {
+		opts = append(opts, WithServerWriteTimeout(time.Duration(l.WriteTimeout)))
+	}
+	if l.FirstMessageTimeout > 0 {
+		opts = append(opts, WithFirstMessageTimeout(time.Duration(l.FirstMessageTimeout)))
+	}
+	if l.MaxTotalPendingBytes > 0 {
+		opts = append(opts, WithMaxTotalPendingBytes(l.MaxTotalPendingBytes, backpressurePolicies[l.BackpressurePolicy]))
+	}
+	if l.BroadcastWorkers > 0 {
+		opts = append(opts, WithBroadcastWorkers(l.BroadcastWorkers))
+	}
+	if l.BroadcastTimeout > 0 {
+		opts = append(opts, WithBroadcastTimeout(time.Duration(l.BroadcastTimeout)))
+	}
+	if l.DispatchWorkers > 0 {
+		opts = append(opts, WithDispatchWorkers(l.DispatchWorkers))
+	}
+	if l.ChunkMaxSize > 0 {
+		opts = append(opts, WithChunkAssembly(l.ChunkMaxSize, time.Duration(l.ChunkTimeout)))
+	}
+	if l.Ban.Threshold > 0 {
+		opts = append(opts, WithViolationBan(l.Ban.Threshold, time.Duration(l.Ban.Window), time.Duration(l.Ban.Duration)))
+	}
+	if l.HealthAddr != "" {
+		opts = append(opts, WithHealthEndpoint(l.HealthAddr))
+	}
+	if l.HealthStats {
+		opts = append(opts, WithHealthStats())
+	}
+	if l.EventLogSize != 0 {
+		opts = append(opts, WithEventLog(l.EventLogSize))
+	}
+	if l.BindRetry.Attempts > 0 {
+		opts = append(opts, WithBindRetry(l.BindRetry.Attempts, time.Duration(l.BindRetry.Interval)))
+	}
+	if l.TLS.enabled() {
+		cfg, err := l.TLS.load(true)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithServerTLS(cfg))
+	}
+	return opts, nil
+}
+
+// NewTcpServerFromConfig opts在配置生成的选项之后，可以加上回调之类不能写在配置里的选项
+func NewTcpServerFromConfig(cfg ServerConfig, r btmsg.IMsgReader, opts ...ServerOption) (*tcpServer, error) {
+	cfgOpts, err := cfg.Options()
+	if err != nil {
+		return nil, err
+	}
+	return NewTcpServer(cfg.Addr, r, append(cfgOpts, opts...)...), nil
+}
+
+// HeartbeatConfig 见 WithHeartbeat，Interval是0时不发心跳
+type HeartbeatConfig struct {
+	Interval Duration `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Timeout  Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// ReconnectConfig 见 WithReconnect
+type ReconnectConfig struct {
+	Enabled     bool     `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Min         Duration `json:"min,omitempty" yaml:"min,omitempty"`
+	Max         Duration `json:"max,omitempty" yaml:"max,omitempty"`
+	MaxAttempts int      `json:"max_attempts,omitempty" yaml:"max_attempts,omitempty"`
+}
+
+// SendQueueConfig 见 WithSendQueue，Policy是block、drop_new、drop_old或者error
+type SendQueueConfig struct {
+	Size   int    `json:"size,omitempty" yaml:"size,omitempty"`
+	Policy string `json:"policy,omitempty" yaml:"policy,omitempty"`
+}
+
+// WriteBufferConfig 见 WithWriteBuffer
+type WriteBufferConfig struct {
+	Size     int      `json:"size,omitempty" yaml:"size,omitempty"`
+	MaxDelay Duration `json:"max_delay,omitempty" yaml:"max_delay,omitempty"`
+}
+
+// ClientConfig 可以从json或者yaml读取的client配置，零值和 NewTcpClient 不带选项一样
+type ClientConfig struct {
+	Addr string `json:"addr" yaml:"addr"`
+	// Addresses 见 WithAddresses，Addr为空时用第一个
+	Addresses []string `json:"addresses,omitempty" yaml:"addresses,omitempty"`
+	Network   string   `json:"network,omitempty" yaml:"network,omitempty"`
+	// DialTimeout 包括tls握手，见 WithDialTimeout
+	DialTimeout     Duration `json:"dial_timeout,omitempty" yaml:"dial_timeout,omitempty"`
+	ReadIdleTimeout Duration `json:"read_idle_timeout,omitempty" yaml:"read_idle_timeout,omitempty"`
+	// MaxMsgSize 见 WithMaxMsgSize，0不限制
+	MaxMsgSize        uint32            `json:"max_msg_size,omitempty" yaml:"max_msg_size,omitempty"`
+	CompressThreshold int               `json:"compress_threshold,omitempty" yaml:"compress_threshold,omitempty"`
+	Heartbeat         HeartbeatConfig   `json:"heartbeat,omitempty" yaml:"heartbeat,omitempty"`
+	Reconnect         ReconnectConfig   `json:"reconnect,omitempty" yaml:"reconnect,omitempty"`
+	SendQueue         SendQueueConfig   `json:"send_queue,omitempty" yaml:"send_queue,omitempty"`
+	WriteBuffer       WriteBufferConfig `json:"write_buffer,omitempty" yaml:"write_buffer,omitempty"`
+	TLS               TLSConfig         `json:"tls,omitempty" yaml:"tls,omitempty"`
+}
+
+var overflowPolicies = map[string]OverflowPolicy{
+	"block":    OverflowBlock,
+	"drop_new": OverflowDropNew,
+	"drop_old": OverflowDropOld,
+	"error":    OverflowError,
+}
+
+// ApplyDefaults 没有设置的字段填上 NewTcpClient 和对应选项的默认值
+func (l *ClientConfig) ApplyDefaults() {
+	if l.Addr == "" && len(l.Addresses) > 0 {
+		l.Addr = l.Addresses[0]
+	}
+	if l.SendQueue.Policy == "" {
+		l.SendQueue.Policy = "block"
+	}
+	if l.Reconnect.Enabled && l.Reconnect.Min == 0 {
+		l.Reconnect.Min = Duration(time.Second)
+	}
+	if l.Reconnect.Enabled && l.Reconnect.Max == 0 {
+		l.Reconnect.Max = l.Reconnect.Min
+	}
+}
+
+// Validate 返回所有的问题，每个都可以用 errors.Is(err, ErrInvalidConfig) 判断
+func (l *ClientConfig) Validate() error {
+	var errs []error
+	if l.Addr == "" && len(l.Addresses) == 0 {
+		errs = append(errs, errors.Wrap(ErrInvalidConfig, "addr is empty"))
+	}
+	durations := map[string]Duration{
+		"dial_timeout":           l.DialTimeout,
+		"read_idle_timeout":      l.ReadIdleTimeout,
+		"heartbeat.interval":     l.Heartbeat.Interval,
+		"heartbeat.timeout":      l.Heartbeat.Timeout,
+		"reconnect.min":          l.Reconnect.Min,
+		"reconnect.max":          l.Reconnect.Max,
+		"write_buffer.max_delay": l.WriteBuffer.MaxDelay,
+	}
+	errs = append(errs, negativeDurations(durations)...)
+
+	if l.Network != "" && l.Network != "tcp" && l.Network != "tcp4" && l.Network != "tcp6" {
+		errs = append(errs, errors.Wrapf(ErrInvalidConfig, "network %q", l.Network))
+	}
+	if l.Heartbeat.Timeout > 0 && l.Heartbeat.Timeout < l.Heartbeat.Interval {
+		errs = append(errs, errors.Wrap(ErrInvalidConfig, "heartbeat.timeout is shorter than interval"))
+	}
+	if l.Reconnect.Max > 0 && l.Reconnect.Max < l.Reconnect.Min {
+		errs = append(errs, errors.Wrap(ErrInvalidConfig, "reconnect.max is shorter than min"))
+	}
+	if l.Reconnect.MaxAttempts < 0 || l.SendQueue.Size < 0 || l.WriteBuffer.Size < 0 || l.CompressThreshold < 0 {
+		errs = append(errs, errors.Wrap(ErrInvalidConfig, "max_attempts, sizes and compress_threshold can not be negative"))
+	}
+	if _, ok := overflowPolicies[l.SendQueue.Policy]; l.SendQueue.Policy != "" && !ok {
+		errs = append(errs, errors.Wrapf(ErrInvalidConfig, "send_queue.policy %q", l.SendQueue.Policy))
+	}
+	errs = append(errs, l.TLS.validate(false)...)
+	return stderrors.Join(errs...)
+}
+
+// Options 按配置生成的选项，没有设置的字段不生成，会先调用 Validate
+func (l *ClientConfig) Options() ([]ClientOption, error) {
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+
+	var opts []ClientOption
+	if len(l.Addresses) > 0 {
+		opts = append(opts, WithAddresses(l.Addresses...))
+	}
+	if l.Network != "" {
+		opts = append(opts, WithNetwork(l.Network))
+	}
+	if l.DialTimeout > 0 {
+		opts = append(opts, WithDialTimeout(time.Duration(l.DialTimeout)))
+	}
+	if l.ReadIdleTimeout > 0 {
+		opts = append(opts, WithReadIdleTimeout(time.Duration(l.ReadIdleTimeout)))
+	}
+	if l.MaxMsgSize > 0 {
+		opts = append(opts, WithMaxMsgSize(l.MaxMsgSize))
+	}
+	if l.CompressThreshold > 0 {
+		opts = append(opts, WithCompressThreshold(l.CompressThreshold))
+	}
+	if l.Heartbeat.Interval > 0 {
+		opts = append(opts, WithHeartbeat(time.Duration(l.Heartbeat.Interval), time.Duration(l.Heartbeat.Timeout)))
+	}
+	if l.Reconnect.Enabled {
+		opts = append(opts, WithReconnect(time.Duration(l.Reconnect.Min), time.Duration(l.Reconnect.Max), l.Reconnect.MaxAttempts))
+	}
+	if l.SendQueue.Size > 0 {
+		opts = append(opts, WithSendQueue(l.SendQueue.Size, overflowPolicies[l.SendQueue.Policy]))
+	}
+	if l.WriteBuffer.Size > 0 {
+		opts = append(opts, WithWriteBuffer(l.WriteBuffer.Size, time.Duration(l.WriteBuffer.MaxDelay)))
+	}
+	if l.TLS.enabled() {
+		cfg, err := l.TLS.load(false)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithTLS(cfg))
+	}
+	return opts, nil
+}
+
+// NewTcpClientFromConfig opts在配置生成的选项之后
+func NewTcpClientFromConfig(cfg ClientConfig, opts ...ClientOption) (*tcpClient, error) {
+	cfgOpts, err := cfg.Options()
+	if err != nil {
+		return nil, err
+	}
+	addr := cfg.Addr
+	if addr == "" {
+		addr = cfg.Addresses[0]
+	}
+	return NewTcpClient(addr, append(cfgOpts, opts...)...), nil
+}
+
+func negativeDurations(durations map[string]Duration) []error {
+	var names []string
+	for name, d := range durations {
+		if d < 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		errs = append(errs, errors.Wrapf(ErrInvalidConfig, "%s is negative", name))
+	}
+	return errs
+}
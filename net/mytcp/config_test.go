@@ -0,0 +1,200 @@
+package mytcp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// writeTestCert 自签名的localhost证书，同时当作CA
+func writeTestCert(t *testing.T, dir string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]*pem.Block{
+		"server.crt": {Type: "CERTIFICATE", Bytes: der},
+		"server.key": {Type: "EC PRIVATE KEY", Bytes: keyDer},
+	}
+	for name, block := range files {
+		if err = os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func loadTestConfig(t *testing.T, name string, cfg any) {
+	t.Helper()
+
+	bt, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(bt, cfg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestConfigRoundTrip 从json读取的配置启动tls的server和client，收发一次消息
+func TestConfigRoundTrip(t *testing.T) {
+	verifyNoLeaks(t)
+
+	dir := t.TempDir()
+	writeTestCert(t, dir)
+
+	var scfg ServerConfig
+	loadTestConfig(t, "server_config.json", &scfg)
+	scfg.ApplyDefaults()
+	if scfg.WriteTimeout != Duration(time.Second*2) || scfg.Ban.Window != Duration(time.Minute) || scfg.EventLogSize != 50 {
+		t.Fatalf("config %+v", scfg)
+	}
+	scfg.TLS.CertFile = filepath.Join(dir, scfg.TLS.CertFile)
+	scfg.TLS.KeyFile = filepath.Join(dir, scfg.TLS.KeyFile)
+
+	ts, err := NewTcpServerFromConfig(scfg, btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		var req echoReq
+		_, _ = msg.ToStruct(&req)
+		_ = conn.ReplyMsg(msg, &req)
+	})
+	wg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		wg.Wait()
+	}()
+
+	var ccfg ClientConfig
+	loadTestConfig(t, "client_config.json", &ccfg)
+	ccfg.Addr = ts.listener.Addr().String()
+	ccfg.TLS.CAFile = filepath.Join(dir, ccfg.TLS.CAFile)
+	ccfg.ApplyDefaults()
+
+	cli, err := NewTcpClientFromConfig(ccfg, WithHeadFactory(btmsg.FactoryMsgHeadTcpSeq()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cli.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	var rsp echoReq
+	if err = cli.Call(context.Background(), 1, &echoReq{Msg: "hello"}, &rsp); err != nil {
+		t.Fatal(err)
+	}
+	if rsp.Msg != "hello" {
+		t.Fatalf("rsp %+v", rsp)
+	}
+
+	// 配置的时间可以再写回json
+	bt, err := json.Marshal(scfg)
+	if err != nil || !strings.Contains(string(bt), `"write_timeout":"2s"`) {
+		t.Fatalf("marshal %s %v", bt, err)
+	}
+}
+
+// TestConfigDefaults 零值的配置生成的选项和不带选项一样
+func TestConfigDefaults(t *testing.T) {
+	var scfg ServerConfig
+	if opts, err := scfg.Options(); err != nil || len(opts) != 0 {
+		t.Fatalf("opts %d %v", len(opts), err)
+	}
+	scfg.ApplyDefaults()
+	if scfg.WriteTimeout != Duration(time.Second*3) || scfg.BackpressurePolicy != "reject" || scfg.EventLogSize != defaultEventLogSize {
+		t.Fatalf("config %+v", scfg)
+	}
+	ts, err := NewTcpServerFromConfig(scfg, btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()))
+	if err != nil || ts.timeout != time.Second*3 || ts.events.size != defaultEventLogSize {
+		t.Fatalf("server %v", err)
+	}
+
+	ccfg := ClientConfig{Addresses: []string{"a:1", "b:1"}, Reconnect: ReconnectConfig{Enabled: true}}
+	ccfg.ApplyDefaults()
+	if ccfg.Addr != "a:1" || ccfg.SendQueue.Policy != "block" || ccfg.Reconnect.Min != Duration(time.Second) || ccfg.Reconnect.Max != ccfg.Reconnect.Min {
+		t.Fatalf("config %+v", ccfg)
+	}
+}
+
+// TestConfigValidate 一次返回所有的问题
+func TestConfigValidate(t *testing.T) {
+	scfg := ServerConfig{
+		WriteTimeout:       Duration(-time.Second),
+		BackpressurePolicy: "drop",
+		Network:            "udp",
+		TLS:                TLSConfig{CertFile: "a.crt"},
+	}
+	err := scfg.Validate()
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expect invalid config, got %v", err)
+	}
+	for _, v := range []string{"write_timeout", "backpressure_policy", "network", "key_file"} {
+		if !strings.Contains(err.Error(), v) {
+			t.Fatalf("expect %s in %v", v, err)
+		}
+	}
+	if _, err = NewTcpServerFromConfig(scfg, nil); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expect invalid config, got %v", err)
+	}
+
+	ccfg := ClientConfig{
+		Heartbeat: HeartbeatConfig{Interval: Duration(time.Second * 5), Timeout: Duration(time.Second)},
+		Reconnect: ReconnectConfig{Enabled: true, Min: Duration(time.Second * 2), Max: Duration(time.Second)},
+		SendQueue: SendQueueConfig{Size: -1, Policy: "wait"},
+	}
+	err = ccfg.Validate()
+	for _, v := range []string{"addr", "heartbeat.timeout", "reconnect.max", "negative", "send_queue.policy"} {
+		if err == nil || !strings.Contains(err.Error(), v) {
+			t.Fatalf("expect %s in %v", v, err)
+		}
+	}
+
+	var d Duration
+	if err = json.Unmarshal([]byte(`"3 days"`), &d); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expect invalid config, got %v", err)
+	}
+}
@@ -1,7 +1,11 @@
 package mytcp
 
 import (
+	"bufio"
 	"net"
+	"time"
+
+	"github.com/winkb/tcp1/contracts"
 )
 
 type wrapConn struct {
@@ -18,6 +22,51 @@ func (l *wrapConn) ReadMessage() (messageType int, p []byte, err error) {
 }
 
 func (l *wrapConn) GetRemoteIp() string {
-	return l.Conn.RemoteAddr().String()
+	return contracts.RemoteIp(l.Conn.RemoteAddr())
+}
+
+// Peek 底层连接带缓冲时不读走数据，返回前n个字节，见 WithProtocolSniffing
+func (l *wrapConn) Peek(n int) ([]byte, error) {
+	p, ok := l.Conn.(peeker)
+	if !ok {
+		return nil, errPeekNotSupported
+	}
+	return p.Peek(n)
+}
+
+
+// idleConn 每次Read之前延长读超时，超过idle没有收到任何字节Read返回超时错误
+type idleConn struct {
+	net.Conn
+	idle time.Duration
+}
+
+func (l *idleConn) Read(b []byte) (n int, err error) {
+	_ = l.Conn.SetReadDeadline(time.Now().Add(l.idle))
+	return l.Conn.Read(b)
+}
+
+// readBufSize 一次Read尽量多读，批量发送的多个帧从缓冲里依次解析，不用每个帧都系统调用
+const readBufSize = 32 * 1024
+
+// bufConn 读走缓冲，写直接走底层连接
+type bufConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func newBufConn(conn net.Conn) *bufConn {
+	return &bufConn{Conn: conn, r: bufio.NewReaderSize(conn, readBufSize)}
 }
 
+func (l *bufConn) Read(b []byte) (n int, err error) {
+	return l.r.Read(b)
+}
+
+func (l *bufConn) ReadByte() (byte, error) {
+	return l.r.ReadByte()
+}
+
+func (l *bufConn) Peek(n int) ([]byte, error) {
+	return l.r.Peek(n)
+}
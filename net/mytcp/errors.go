@@ -0,0 +1,153 @@
+package mytcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/winkb/tcp1/contracts"
+)
+
+var (
+	ErrDialTimeout = errors.New("dial timeout")
+	ErrDialRefused = errors.New("dial refused")
+	ErrDialDns     = errors.New("dial dns")
+	// ErrConnClosed 连接已经断开，TcpConn.SendWithTimeout 返回的 contracts.ErrClosed 也是它
+	ErrConnClosed = contracts.ErrClosed
+	// ErrNotConnected 还没有连接或者连接已经断开
+	ErrNotConnected = errors.New("not connected")
+	// ErrClientClosed 已经调用过Close
+	ErrClientClosed = errors.New("client closed")
+	// ErrReadIdleTimeout 超过 WithReadIdleTimeout 设置的时间没有收到数据
+	ErrReadIdleTimeout = errors.New("read idle timeout")
+	// ErrReconnectGaveUp 重连次数超过 WithReconnect 的maxAttempts
+	ErrReconnectGaveUp = errors.New("reconnect gave up")
+	// ErrSendQueueFull 发送队列满了，只在 OverflowError 时返回
+	ErrSendQueueFull = errors.New("send queue full")
+	// ErrNoReply HandleE、OnReceiveE的handler返回它时不自动回复错误，也不计入错误数，用于不需要回复的act
+	ErrNoReply = errors.New("no reply")
+	// ErrIdentityBound BindIdentity 使用 RejectNew 时身份已经绑定了别的连接
+	ErrIdentityBound = errors.New("identity already bound")
+	// ErrSessionOffline SendToSession 时session没有连接，并且没有设置 WithOfflineQueue
+	ErrSessionOffline = errors.New("session offline")
+	// ErrBadRelayFrame MeshRelay 收到的消息格式不对
+	ErrBadRelayFrame = errors.New("bad relay frame")
+	// ErrServerRunning Restart时server还没有Shutdown
+	ErrServerRunning = errors.New("server running")
+	// ErrNoSeq Call 用的head不能带seq，回复没法和请求对应，见 btmsg.MsgHeadTcpSeq
+	ErrNoSeq = errors.New("head has no seq")
+	// ErrInvalidConfig ServerConfig 或者 ClientConfig 的 Validate 没有通过
+	ErrInvalidConfig = errors.New("invalid config")
+)
+
+// DefaultHandleErrorCode handler返回的错误不是 *HandleError 时回复的错误码
+const DefaultHandleErrorCode uint16 = 500
+
+// HandleError handler返回它时按Code和Text回复错误，可以被包装
+type HandleError struct {
+	Code uint16
+	Text string
+}
+
+func (l *HandleError) Error() string {
+	return fmt.Sprintf("handle error %d: %s", l.Code, l.Text)
+}
+
+// handleErrorReply err对应的错误码和内容
+func handleErrorReply(err error) (code uint16, text string) {
+	var he *HandleError
+	if errors.As(err, &he) {
+		return he.Code, he.Text
+	}
+	return DefaultHandleErrorCode, err.Error()
+}
+
+// ReplyError 服务端回复的错误，见 btmsg.Msg.SetError，可以用 errors.As 取出来
+type ReplyError struct {
+	act  uint16
+	code uint16
+	text string
+}
+
+func (l *ReplyError) Error() string {
+	return fmt.Sprintf("act %d reply error %d: %s", l.act, l.code, l.text)
+}
+
+func (l *ReplyError) Code() uint16 {
+	return l.code
+}
+
+func (l *ReplyError) Text() string {
+	return l.text
+}
+
+// Act 出错的请求的act
+func (l *ReplyError) Act() uint16 {
+	return l.act
+}
+
+// DialError 连接服务端失败，可以用 errors.Is 判断是 ErrDialTimeout/ErrDialRefused/ErrDialDns 中的哪一种
+type DialError struct {
+	Addr string
+	Kind error
+	Err  error
+}
+
+// joinDialErrors 所有地址都连接失败，每个地址的 *DialError 都可以用 errors.As 取出来
+func joinDialErrors(errs []error) error {
+	return errors.Join(errs...)
+}
+
+func newDialError(addr string, err error) *DialError {
+	return &DialError{
+		Addr: addr,
+		Kind: dialErrKind(err),
+		Err:  err,
+	}
+}
+
+func (l *DialError) Error() string {
+	if l.Kind == nil {
+		return "dial " + l.Addr + ": " + l.Err.Error()
+	}
+	return "dial " + l.Addr + ": " + l.Kind.Error() + ": " + l.Err.Error()
+}
+
+func (l *DialError) Unwrap() []error {
+	if l.Kind == nil {
+		return []error{l.Err}
+	}
+	return []error{l.Kind, l.Err}
+}
+
+func dialErrKind(err error) error {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsTimeout {
+			return ErrDialTimeout
+		}
+		return ErrDialDns
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrDialTimeout
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrDialTimeout
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return ErrDialRefused
+	}
+
+	return nil
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
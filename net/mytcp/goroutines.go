@@ -0,0 +1,28 @@
+package mytcp
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/winkb/tcp1/util"
+)
+
+type GoroutineInfo = util.NamedGoroutine
+
+// RunningGoroutines server和client内部还在运行的goroutine，名字里带连接id，比如 3_conn_read
+func RunningGoroutines() []GoroutineInfo {
+	return util.GoroutineSnapshot()
+}
+
+// DumpGoroutines 每行一个goroutine，排查泄漏或者Shutdown卡住时用
+func DumpGoroutines(w io.Writer) error {
+	now := time.Now()
+	for _, v := range RunningGoroutines() {
+		_, err := fmt.Fprintf(w, "%d\t%s\t%s\n", v.ID, v.Name, now.Sub(v.StartedAt).Round(time.Millisecond))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
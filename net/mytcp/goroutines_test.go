@@ -0,0 +1,50 @@
+package mytcp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+	"github.com/winkb/tcp1/net/mytcp/internal/leakcheck"
+)
+
+func TestRunningGoroutines(t *testing.T) {
+	last := leakcheck.LastID()
+
+	var got = make(chan bool, 1)
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		got <- true
+	})
+
+	cli := newTestClient(ts.listener.Addr().String())
+	cwg, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = cli.SendStruct(1, echoReq{Msg: "hi"})
+	<-got
+
+	var bf bytes.Buffer
+	_ = DumpGoroutines(&bf)
+	for _, name := range []string{"conn_accept", "_conn_read", "_conn_consume_input", "conn_write"} {
+		if !strings.Contains(bf.String(), name) {
+			t.Fatalf("%s not in dump:\n%s", name, bf.String())
+		}
+	}
+
+	cli.Close()
+	cwg.Wait()
+	stop()
+
+	if left := leakcheck.After(last); len(left) > 0 {
+		t.Fatalf("goroutines left %+v", left)
+	}
+}
+
+// verifyNoLeaks 见 testutil.VerifyNoLeaks，包内的测试导入testutil会循环导入
+func verifyNoLeaks(t testing.TB) {
+	t.Helper()
+	leakcheck.Verify(t)
+}
@@ -0,0 +1,62 @@
+// Package leakcheck 测试结束时检查 util.MyGoWg 启动的goroutine有没有退出，
+// 对外用 testutil.VerifyNoLeaks，mytcp包内的测试不能导入testutil，直接用这里的 Verify
+package leakcheck
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/util"
+)
+
+// Verify 测试开始时调用，测试结束时还有这个测试期间启动的goroutine没有退出就让测试失败
+// 检查在t的Cleanup里进行，在defer之后，最多等1秒，连接关闭之后读协程需要一点时间退出
+func Verify(t testing.TB) {
+	t.Helper()
+
+	last := LastID()
+	before := runtime.NumGoroutine()
+	t.Cleanup(func() {
+		deadline := time.Now().Add(time.Second)
+		for {
+			left := After(last)
+			if len(left) == 0 {
+				return
+			}
+
+			if time.Now().After(deadline) {
+				var bf bytes.Buffer
+				now := time.Now()
+				for _, v := range left {
+					fmt.Fprintf(&bf, "\n\t%s running %s", v.Name, now.Sub(v.StartedAt).Round(time.Millisecond))
+				}
+				t.Errorf("%d goroutines leaked, runtime goroutines %d -> %d:%s", len(left), before, runtime.NumGoroutine(), bf.String())
+				return
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+	})
+}
+
+// LastID 最后启动的还在运行的goroutine的ID
+func LastID() uint64 {
+	var last uint64
+	for _, v := range util.GoroutineSnapshot() {
+		last = v.ID
+	}
+	return last
+}
+
+// After ID大于last的goroutine，也就是last之后启动的
+func After(last uint64) []util.NamedGoroutine {
+	var res []util.NamedGoroutine
+	for _, v := range util.GoroutineSnapshot() {
+		if v.ID > last {
+			res = append(res, v)
+		}
+	}
+	return res
+}
@@ -0,0 +1,47 @@
+package leakcheck
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/winkb/tcp1/util"
+)
+
+type leakT struct {
+	testing.TB
+	cleanups []func()
+	failed   string
+}
+
+func (l *leakT) Helper() {}
+
+func (l *leakT) Cleanup(f func()) {
+	l.cleanups = append(l.cleanups, f)
+}
+
+func (l *leakT) Errorf(format string, args ...any) {
+	l.failed = fmt.Sprintf(format, args...)
+}
+
+func TestVerify(t *testing.T) {
+	lt := &leakT{TB: t}
+	Verify(lt)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	util.MyGoWg(&wg, "leaky_loop", func() {
+		<-stop
+	})
+
+	for _, f := range lt.cleanups {
+		f()
+	}
+	close(stop)
+	wg.Wait()
+
+	if !strings.Contains(lt.failed, "leaky_loop running") {
+		t.Fatalf("expect leak reported, got %q", lt.failed)
+	}
+}
@@ -0,0 +1,194 @@
+//go:build kcp
+
+// Package kcptransport 基于udp的kcp传输，适合丢包多、延迟高的链路，依赖 github.com/xtaci/kcp-go/v5，
+// 需要 -tags kcp 编译，避免不用kcp的项目也要下载这个依赖
+//
+//	tr := kcptransport.New(kcptransport.WithSessionTimeout(time.Second * 10))
+//	server := mytcp.NewTcpServer("8000", reader, mytcp.WithServerTransport(tr))
+//	client := mytcp.NewTcpClient("127.0.0.1:8000", mytcp.WithTransport(tr))
+package kcptransport
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/winkb/tcp1/net/mytcp"
+	"github.com/xtaci/kcp-go/v5"
+)
+
+const network = "kcp"
+
+var _ mytcp.Transport = (*Transport)(nil)
+
+type Transport struct {
+	sessionTimeout time.Duration
+	dataShards     int
+	parityShards   int
+	noDelay        [4]int
+	sndWnd         int
+	rcvWnd         int
+	listenPacket   func(addr string) (net.PacketConn, error)
+}
+
+type Option func(l *Transport)
+
+// WithSessionTimeout 超过d没有收到任何数据认为对方已经断开，连接按读错误关闭，会触发OnClose，默认30秒
+// kcp没有断开通知，空闲的连接要用心跳保持，心跳间隔要小于d
+func WithSessionTimeout(d time.Duration) Option {
+	return func(l *Transport) {
+		l.sessionTimeout = d
+	}
+}
+
+// WithFEC 前向纠错，每dataShards个包额外发parityShards个校验包，两端要一致，默认不开启
+func WithFEC(dataShards, parityShards int) Option {
+	return func(l *Transport) {
+		l.dataShards = dataShards
+		l.parityShards = parityShards
+	}
+}
+
+// WithNoDelay 见 kcp.UDPSession.SetNoDelay，默认是kcp的快速模式 1, 10, 2, 1
+func WithNoDelay(nodelay, interval, resend, nc int) Option {
+	return func(l *Transport) {
+		l.noDelay = [4]int{nodelay, interval, resend, nc}
+	}
+}
+
+// WithWindowSize 发送和接收窗口，单位是包，默认128
+func WithWindowSize(sndWnd, rcvWnd int) Option {
+	return func(l *Transport) {
+		l.sndWnd = sndWnd
+		l.rcvWnd = rcvWnd
+	}
+}
+
+// WithListenPacket 替换创建udp socket的方式，Dial时addr为空，测试可以用来模拟丢包
+func WithListenPacket(f func(addr string) (net.PacketConn, error)) Option {
+	return func(l *Transport) {
+		l.listenPacket = f
+	}
+}
+
+func New(opts ...Option) *Transport {
+	l := &Transport{
+		sessionTimeout: time.Second * 30,
+		noDelay:        [4]int{1, 10, 2, 1},
+		sndWnd:         128,
+		rcvWnd:         128,
+		listenPacket: func(addr string) (net.PacketConn, error) {
+			return net.ListenPacket("udp", addr)
+		},
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
+}
+
+func (l *Transport) Listen(addr string) (net.Listener, error) {
+	pc, err := l.listenPacket(addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "kcp listen:"+addr)
+	}
+
+	ln, err := kcp.ServeConn(nil, l.dataShards, l.parityShards, pc)
+	if err != nil {
+		_ = pc.Close()
+		return nil, errors.Wrap(err, "kcp listen:"+addr)
+	}
+
+	return &listener{ln: ln, pc: pc, transport: l, done: make(chan struct{})}, nil
+}
+
+// Dial 每个连接使用自己的udp socket，network不使用
+func (l *Transport) Dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	pc, err := l.listenPacket("")
+	if err != nil {
+		return nil, errors.Wrap(err, "kcp dial:"+addr)
+	}
+
+	s, err := kcp.NewConn(addr, nil, l.dataShards, l.parityShards, pc)
+	if err != nil {
+		_ = pc.Close()
+		return nil, errors.Wrap(err, "kcp dial:"+addr)
+	}
+
+	return l.newConn(s, pc), nil
+}
+
+func (l *Transport) newConn(s *kcp.UDPSession, pc net.PacketConn) *conn {
+	s.SetStreamMode(true)
+	s.SetNoDelay(l.noDelay[0], l.noDelay[1], l.noDelay[2], l.noDelay[3])
+	s.SetWindowSize(l.sndWnd, l.rcvWnd)
+	return &conn{UDPSession: s, pc: pc, timeout: l.sessionTimeout}
+}
+
+type listener struct {
+	ln        *kcp.Listener
+	pc        net.PacketConn
+	transport *Transport
+	done      chan struct{}
+	once      sync.Once
+}
+
+// Accept 关闭之后返回 *net.OpError，server按正常关闭处理
+func (l *listener) Accept() (net.Conn, error) {
+	s, err := l.ln.AcceptKCP()
+	if err != nil {
+		select {
+		case <-l.done:
+			return nil, &net.OpError{Op: "accept", Net: network, Addr: l.Addr(), Err: net.ErrClosed}
+		default:
+		}
+		return nil, err
+	}
+
+	// 服务端的session共用listener的socket，关闭连接时不能关闭它
+	return l.transport.newConn(s, nil), nil
+}
+
+func (l *listener) Close() error {
+	var err error
+	l.once.Do(func() {
+		close(l.done)
+		err = l.ln.Close()
+		_ = l.pc.Close()
+	})
+	return err
+}
+
+func (l *listener) Addr() net.Addr {
+	return l.pc.LocalAddr()
+}
+
+// conn 每次Read之前延长读超时，超过timeout没有数据返回超时错误，pc不为nil时是client自己的socket，关闭时一起关闭
+type conn struct {
+	*kcp.UDPSession
+	pc      net.PacketConn
+	timeout time.Duration
+}
+
+func (l *conn) Read(b []byte) (n int, err error) {
+	if l.timeout > 0 {
+		_ = l.UDPSession.SetReadDeadline(time.Now().Add(l.timeout))
+	}
+	return l.UDPSession.Read(b)
+}
+
+func (l *conn) Close() error {
+	err := l.UDPSession.Close()
+	if l.pc != nil {
+		_ = l.pc.Close()
+	}
+	return err
+}
@@ -0,0 +1,155 @@
+//go:build kcp
+
+package kcptransport
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+	"github.com/winkb/tcp1/net/mytcp"
+	"github.com/winkb/tcp1/net/mytcp/testutil"
+)
+
+type req struct {
+	N int
+}
+
+// lossyConn 随机丢弃rate比例的发送，模拟丢包的链路
+type lossyConn struct {
+	net.PacketConn
+	rate float64
+	lock sync.Mutex
+	rnd  *rand.Rand
+}
+
+func (l *lossyConn) WriteTo(p []byte, addr net.Addr) (n int, err error) {
+	l.lock.Lock()
+	drop := l.rnd.Float64() < l.rate
+	l.lock.Unlock()
+	if drop {
+		return len(p), nil
+	}
+	return l.PacketConn.WriteTo(p, addr)
+}
+
+func lossy(rate float64) Option {
+	var seed int64
+	return WithListenPacket(func(addr string) (net.PacketConn, error) {
+		if addr == "" {
+			addr = "127.0.0.1:0"
+		}
+		pc, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return nil, err
+		}
+		seed++
+		return &lossyConn{PacketConn: pc, rate: rate, rnd: rand.New(rand.NewSource(seed))}, nil
+	})
+}
+
+func startServer(t *testing.T, tr *Transport, f contracts.ServerReceiveCallback, onClose contracts.ServerCloseCallback) string {
+	testutil.VerifyNoLeaks(t)
+
+	ts := mytcp.NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()))
+	ts.OnReceive(f)
+	if onClose != nil {
+		ts.OnClose(onClose)
+	}
+
+	ln, err := tr.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg, err := ts.Serve(ln)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ts.Shutdown()
+		wg.Wait()
+	})
+
+	return ln.Addr().String()
+}
+
+// TestKcpLossyLink 5%丢包时所有请求都能收到正确的回复
+func TestKcpLossyLink(t *testing.T) {
+	tr := New(lossy(0.05), WithSessionTimeout(time.Second*5))
+	addr := startServer(t, tr, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		var v req
+		_, _ = msg.ToStruct(&v)
+		_ = conn.ReplyMsg(msg, req{N: v.N * 2})
+	}, nil)
+
+	cli := mytcp.NewTcpClient(addr, mytcp.WithTransport(tr), mytcp.WithHeadFactory(btmsg.FactoryMsgHeadTcpSeq()))
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+			defer cancel()
+			var rsp req
+			err := cli.Call(ctx, 1, req{N: i}, &rsp)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if rsp.N != i*2 {
+				t.Errorf("expect %d, got %d", i*2, rsp.N)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// TestKcpSessionTimeout client不再发送数据时，服务端超时之后触发OnClose
+func TestKcpSessionTimeout(t *testing.T) {
+	tr := New(WithSessionTimeout(time.Millisecond * 300))
+
+	var closed = make(chan string, 1)
+	addr := startServer(t, tr, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		s.Send(conn, msg)
+	}, func(s contracts.ITcpServer, conn *contracts.TcpConn, isServer bool, isClient bool) {
+		closed <- conn.GetRemoteIp()
+	})
+
+	// 直接用Transport拨号，只发一个帧，之后不再有任何数据
+	conn, err := tr.Dial(context.Background(), "udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	msg := btmsg.NewMsg(btmsg.NewMsgHeadTcpSeq(), nil)
+	msg.SetAct(1)
+	_ = msg.FromStruct(req{N: 1})
+	_, err = conn.Write(msg.ToSendByte())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ip := <-closed:
+		// 拨号的udp socket没有绑定ip，服务端看到的是拨号的目标ip
+		host, _, _ := net.SplitHostPort(addr)
+		if ip != host {
+			t.Fatalf("expect remote %s, got %s", host, ip)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("session not timed out")
+	}
+}
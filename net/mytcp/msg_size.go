@@ -0,0 +1,90 @@
+package mytcp
+
+import (
+	"sync/atomic"
+
+	"github.com/winkb/tcp1/btmsg"
+)
+
+// SizeBuckets 消息大小直方图每个桶的上界，字节，大小是head加body的长度
+var SizeBuckets = [...]int{64, 256, 1024, 4096, 16384, 65536}
+
+const (
+	MetricMsgSizeReceived = "tcp.msg.size.received"
+	MetricMsgSizeSent     = "tcp.msg.size.sent"
+)
+
+// MetricsSink 对接prometheus等监控，每个消息调用一次，不能阻塞
+type MetricsSink interface {
+	// ObserveHistogram name是 MetricMsgSizeReceived 这样的名字，attrs和 TraceHook 的一样
+	ObserveHistogram(name string, value float64, attrs []SpanAttr)
+}
+
+// WithServerMetrics 收发的每个消息的大小交给sink，Stats 里的直方图不需要设置它
+func WithServerMetrics(sink MetricsSink) ServerOption {
+	return func(l *tcpServer) {
+		l.sizes.sink = sink
+	}
+}
+
+// WithMetrics 和 WithServerMetrics 一样，发送的消息已经编码，attrs里没有act
+func WithMetrics(sink MetricsSink) ClientOption {
+	return func(l *tcpClient) {
+		l.sizes.sink = sink
+	}
+}
+
+// sizeHistogram 原子计数，收发的时候不加锁
+type sizeHistogram struct {
+	buckets [len(SizeBuckets) + 1]uint64
+}
+
+func (l *sizeHistogram) observe(n int) {
+	var i int
+	for i < len(SizeBuckets) && n > SizeBuckets[i] {
+		i++
+	}
+	atomic.AddUint64(&l.buckets[i], 1)
+}
+
+// snapshot 比 SizeBuckets 多一个，最后一个是超过所有上界的数量
+func (l *sizeHistogram) snapshot() []uint64 {
+	var res = make([]uint64, len(l.buckets))
+	for i := range l.buckets {
+		res[i] = atomic.LoadUint64(&l.buckets[i])
+	}
+	return res
+}
+
+type msgSizes struct {
+	received sizeHistogram
+	sent     sizeHistogram
+	sink     MetricsSink
+}
+
+func (l *msgSizes) observeReceived(msg btmsg.IMsg) {
+	n := int(msg.HeadSize() + msg.BodySize())
+	l.received.observe(n)
+	if l.sink != nil {
+		l.sink.ObserveHistogram(MetricMsgSizeReceived, float64(n), actAttrs(msg.GetAct()))
+	}
+}
+
+// observeSent msg为nil时没有act
+func (l *msgSizes) observeSent(msg btmsg.IMsg, n int) {
+	l.sent.observe(n)
+	if l.sink != nil {
+		var attrs []SpanAttr
+		if msg != nil {
+			attrs = actAttrs(msg.GetAct())
+		}
+		l.sink.ObserveHistogram(MetricMsgSizeSent, float64(n), attrs)
+	}
+}
+
+func actAttrs(act uint16) []SpanAttr {
+	return []SpanAttr{
+		{Key: "tcp.act", Value: act},
+		{Key: "tcp.act_name", Value: btmsg.ActName(act)},
+	}
+}
@@ -0,0 +1,120 @@
+package mytcp
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+type recordSink struct {
+	lock sync.Mutex
+	// obs name和act对应的大小
+	obs map[string][]float64
+}
+
+func (l *recordSink) ObserveHistogram(name string, value float64, attrs []SpanAttr) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	key := name
+	for _, v := range attrs {
+		if v.Key == "tcp.act" {
+			key = fmt.Sprintf("%s %v", name, v.Value)
+		}
+	}
+	if l.obs == nil {
+		l.obs = map[string][]float64{}
+	}
+	l.obs[key] = append(l.obs[key], value)
+}
+
+func (l *recordSink) get(key string) []float64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.obs[key]
+}
+
+func TestSizeHistogram(t *testing.T) {
+	var h sizeHistogram
+	for _, n := range []int{0, 64, 65, 256, 1024, 4097, 65536, 65537, 1 << 20} {
+		h.observe(n)
+	}
+	if got := fmt.Sprint(h.snapshot()); got != "[2 2 1 0 1 1 2]" {
+		t.Fatalf("buckets %s", got)
+	}
+}
+
+func TestMsgSizeStats(t *testing.T) {
+	verifyNoLeaks(t)
+
+	serverSink, clientSink := &recordSink{}, &recordSink{}
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), WithServerMetrics(serverSink))
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		conn.Send(newActMsg(3, msg.CopyBody()))
+	})
+	swg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		swg.Wait()
+	}()
+
+	var got = make(chan int, 2)
+	cli := newTestClient(ts.listener.Addr().String(), WithMetrics(clientSink))
+	cli.Handle(3, nil, func(msg btmsg.IMsg, req any) {
+		got <- len(msg.BodyByte())
+	})
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	for _, n := range []int{10, 2000} {
+		err = cli.SendMsg(newActMsg(1, make([]byte, n)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-got:
+		case <-time.After(time.Second * 3):
+			t.Fatal("timeout")
+		}
+	}
+
+	// 一个不超过64字节，一个在1K到4K之间
+	const expect = "[1 0 0 1 0 0 0]"
+	deadline := time.Now().Add(time.Second * 3)
+	for fmt.Sprint(ts.Stats().SentSizes) != expect && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 5)
+	}
+	st := ts.Stats()
+	cst := cli.Stats()
+	for name, v := range map[string][]uint64{
+		"server received": st.ReceivedSizes,
+		"server sent":     st.SentSizes,
+		"client received": cst.ReceivedSizes,
+		"client sent":     cst.SentSizes,
+		"route":           cli.RouteStats()[3].Sizes,
+	} {
+		if fmt.Sprint(v) != expect {
+			t.Fatalf("%s %v", name, v)
+		}
+	}
+
+	if v := serverSink.get(MetricMsgSizeReceived + " 1"); len(v) != 2 || v[1] <= 2000 {
+		t.Fatalf("server sink %v", serverSink.obs)
+	}
+	if v := serverSink.get(MetricMsgSizeSent + " 3"); len(v) != 2 {
+		t.Fatalf("server sink %v", serverSink.obs)
+	}
+	if len(clientSink.get(MetricMsgSizeSent)) != 2 || len(clientSink.get(MetricMsgSizeReceived+" 3")) != 2 {
+		t.Fatalf("client sink %v", clientSink.obs)
+	}
+}
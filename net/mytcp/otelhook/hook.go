@@ -0,0 +1,98 @@
+//go:build otel
+
+// Package otelhook 用OpenTelemetry实现 mytcp.TraceHook，依赖 go.opentelemetry.io/otel，
+// 需要 -tags otel 编译，避免不用OpenTelemetry的项目也要下载这个依赖
+//
+//	hook := otelhook.New(otel.GetTracerProvider())
+//	server := mytcp.NewTcpServer("8000", reader, mytcp.WithServerTraceHook(hook))
+//	client := mytcp.NewTcpClient("127.0.0.1:8000", mytcp.WithTraceHook(hook))
+//
+// 消息里只带trace id，服务端的span和客户端的在同一个trace里，父span是用trace id构造的远端span
+package otelhook
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/net/mytcp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/winkb/tcp1/net/mytcp"
+
+var _ mytcp.TraceHook = (*Hook)(nil)
+
+type Hook struct {
+	tracer trace.Tracer
+}
+
+func New(tp trace.TracerProvider) *Hook {
+	return &Hook{
+		tracer: tp.Tracer(instrumentationName),
+	}
+}
+
+// StartSpan ctx里没有span但是有消息带来的trace id时，用它作为远端的父span
+func (l *Hook) StartSpan(ctx context.Context, name string, attrs []mytcp.SpanAttr) (context.Context, func(err error)) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		if id, ok := btmsg.TraceIDFromContext(ctx); ok {
+			ctx = trace.ContextWithRemoteSpanContext(ctx, remoteParent(id))
+		}
+	}
+
+	kind := trace.SpanKindClient
+	if name == mytcp.SpanReceive {
+		kind = trace.SpanKindServer
+	}
+	ctx, span := l.tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(toAttrs(attrs)...))
+	ctx = btmsg.ContextWithTraceID(ctx, btmsg.TraceID(span.SpanContext().TraceID()))
+
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// remoteParent 消息里没有span id，用trace id的后8个字节代替
+func remoteParent(id btmsg.TraceID) trace.SpanContext {
+	var spanID trace.SpanID
+	copy(spanID[:], id[8:])
+
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID(id),
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+}
+
+func toAttrs(attrs []mytcp.SpanAttr) []attribute.KeyValue {
+	res := make([]attribute.KeyValue, 0, len(attrs))
+	for _, v := range attrs {
+		switch val := v.Value.(type) {
+		case string:
+			res = append(res, attribute.String(v.Key, val))
+		case bool:
+			res = append(res, attribute.Bool(v.Key, val))
+		case int:
+			res = append(res, attribute.Int(v.Key, val))
+		case int64:
+			res = append(res, attribute.Int64(v.Key, val))
+		case uint16:
+			res = append(res, attribute.Int64(v.Key, int64(val)))
+		case uint32:
+			res = append(res, attribute.Int64(v.Key, int64(val)))
+		case uint64:
+			res = append(res, attribute.Int64(v.Key, int64(val)))
+		default:
+			res = append(res, attribute.String(v.Key, fmt.Sprint(val)))
+		}
+	}
+	return res
+}
@@ -0,0 +1,105 @@
+//go:build otel
+
+package otelhook
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+	"github.com/winkb/tcp1/net/mytcp"
+	"github.com/winkb/tcp1/net/mytcp/testutil"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type req struct {
+	N int
+}
+
+// waitSpans 服务端的span在回复发出之后才结束，等到导出了n个
+func waitSpans(t *testing.T, exp *tracetest.InMemoryExporter, n int) map[string]tracetest.SpanStub {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second * 3)
+	for len(exp.GetSpans()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect %d spans, got %d", n, len(exp.GetSpans()))
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	var spans = map[string]tracetest.SpanStub{}
+	for _, v := range exp.GetSpans() {
+		spans[v.Name] = v
+	}
+	return spans
+}
+
+// TestHookSpans client的span是调用方span的子span，服务端处理消息的span和它在同一个trace里，
+// 回调里用ctx创建的span是处理消息的span的子span
+func TestHookSpans(t *testing.T) {
+	testutil.VerifyNoLeaks(t)
+
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	defer func() {
+		_ = tp.Shutdown(context.Background())
+	}()
+	tracer := tp.Tracer("test")
+	hook := New(tp)
+
+	ts := mytcp.NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpV2()), mytcp.WithServerTraceHook(hook))
+	ts.OnReceiveCtx(func(ctx context.Context, s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		_, span := tracer.Start(ctx, "db")
+		span.End()
+
+		var v req
+		_, _ = msg.ToStruct(&v)
+		_ = conn.ReplyMsg(msg, &req{N: v.N * 2})
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg, err := ts.Serve(ln)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		wg.Wait()
+	}()
+
+	cli := mytcp.NewTcpClient(ln.Addr().String(), mytcp.WithHeadFactory(btmsg.FactoryMsgHeadTcpV2()), mytcp.WithTraceHook(hook))
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	var rsp req
+	err = cli.Call(ctx, 1, &req{N: 2}, &rsp)
+	root.End()
+	if err != nil || rsp.N != 4 {
+		t.Fatalf("rsp %d err %v", rsp.N, err)
+	}
+
+	spans := waitSpans(t, exp, 4)
+	rootSpan, call, receive, db := spans["root"], spans[mytcp.SpanCall], spans[mytcp.SpanReceive], spans["db"]
+	traceID := rootSpan.SpanContext.TraceID()
+
+	if call.Parent.SpanID() != rootSpan.SpanContext.SpanID() || call.SpanContext.TraceID() != traceID {
+		t.Fatalf("call parent %s trace %s", call.Parent.SpanID(), call.SpanContext.TraceID())
+	}
+	if receive.SpanContext.TraceID() != traceID || !receive.Parent.IsRemote() {
+		t.Fatalf("receive trace %s remote %v", receive.SpanContext.TraceID(), receive.Parent.IsRemote())
+	}
+	if db.Parent.SpanID() != receive.SpanContext.SpanID() || db.SpanContext.TraceID() != traceID {
+		t.Fatalf("db parent %s", db.Parent.SpanID())
+	}
+}
@@ -0,0 +1,82 @@
+package mytcp
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+const pipeNetwork = "pipe"
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string {
+	return pipeNetwork
+}
+
+func (pipeAddr) String() string {
+	return pipeNetwork
+}
+
+var _ net.Listener = (*PipeListener)(nil)
+var _ Transport = (*PipeListener)(nil)
+
+// PipeListener 内存里的listener，Dial用net.Pipe创建一对连接，一端交给Accept
+// server用Serve接受连接，client用 WithDialer(l.Dial)，测试不需要占用端口，可以同时有很多连接
+// 也可以当成 Transport 同时给server和client使用
+type PipeListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func NewPipeListener() *PipeListener {
+	return &PipeListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+func (l *PipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, &net.OpError{Op: "accept", Net: pipeNetwork, Addr: pipeAddr{}, Err: net.ErrClosed}
+	}
+}
+
+// Close 之后Accept和Dial都返回错误，已经建立的连接不受影响
+func (l *PipeListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+	return nil
+}
+
+// Listen 作为 Transport 使用时返回自己，addr不使用
+func (l *PipeListener) Listen(addr string) (net.Listener, error) {
+	return l, nil
+}
+
+func (l *PipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+// Dial 签名和 DialFunc 一样，network和addr不使用，等到Accept取走另一端才返回
+func (l *PipeListener) Dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	server, client := net.Pipe()
+
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-ctx.Done():
+		_ = server.Close()
+		_ = client.Close()
+		return nil, ctx.Err()
+	case <-l.done:
+		_ = server.Close()
+		_ = client.Close()
+		return nil, &net.OpError{Op: "dial", Net: pipeNetwork, Addr: pipeAddr{}, Err: net.ErrClosed}
+	}
+}
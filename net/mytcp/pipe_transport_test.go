@@ -0,0 +1,274 @@
+package mytcp
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// transport 同一组测试分别跑在真实的tcp和内存pipe上
+type transport struct {
+	name  string
+	serve func(ts *tcpServer) (*sync.WaitGroup, []ClientOption, error)
+}
+
+var transports = []transport{
+	{"tcp", func(ts *tcpServer) (*sync.WaitGroup, []ClientOption, error) {
+		wg, err := ts.Start()
+		return wg, nil, err
+	}},
+	{"pipe", func(ts *tcpServer) (*sync.WaitGroup, []ClientOption, error) {
+		pl := NewPipeListener()
+		wg, err := ts.Serve(pl)
+		return wg, []ClientOption{WithDialer(pl.Dial)}, err
+	}},
+}
+
+func eachTransport(t *testing.T, f func(t *testing.T, tr transport)) {
+	for _, tr := range transports {
+		tr := tr
+		t.Run(tr.name, func(t *testing.T) {
+			f(t, tr)
+		})
+	}
+}
+
+// startTransport 启动server，返回创建已连接client的函数
+func startTransport(t *testing.T, tr transport, f contracts.ServerReceiveCallback) (*tcpServer, func() *tcpClient, func()) {
+	verifyNoLeaks(t)
+
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()))
+	ts.OnReceive(f)
+	wg, opts, err := tr.serve(ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newClient := func() *tcpClient {
+		cli := newTestClient(ts.listener.Addr().String(), opts...)
+		_, err := cli.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = cli.Close()
+		})
+		return cli
+	}
+
+	return ts, newClient, func() {
+		ts.Shutdown()
+		wg.Wait()
+	}
+}
+
+func echoCallback(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+	var req callReq
+	_, _ = msg.ToStruct(&req)
+	_ = msg.FromStruct(&callRsp{N: req.N * 2})
+	s.Send(conn, msg)
+}
+
+func TestTransportCall(t *testing.T) {
+	eachTransport(t, func(t *testing.T, tr transport) {
+		_, newClient, stop := startTransport(t, tr, echoCallback)
+		defer stop()
+
+		cli := newClient()
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				var rsp callRsp
+				err := cli.Call(context.Background(), 1, &callReq{N: i}, &rsp)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if rsp.N != i*2 {
+					t.Errorf("expect %d, got %d", i*2, rsp.N)
+				}
+			}(i)
+		}
+		wg.Wait()
+	})
+}
+
+// TestTransportBatchedFrames 多个帧一次写入，server要逐个拆出来
+func TestTransportBatchedFrames(t *testing.T) {
+	eachTransport(t, func(t *testing.T, tr transport) {
+		_, newClient, stop := startTransport(t, tr, echoCallback)
+		defer stop()
+
+		const n = 50
+		var got = make(chan int, n)
+		cli := newClient()
+		cli.OnReceive(func(msg btmsg.IMsg) {
+			var rsp callRsp
+			_, _ = msg.ToStruct(&rsp)
+			got <- rsp.N
+		})
+
+		var batch []byte
+		for i := 0; i < n; i++ {
+			msg := btmsg.NewMsg(btmsg.NewMsgHeadTcpSeq(), nil)
+			msg.SetAct(1)
+			_ = msg.FromStruct(&callReq{N: i})
+			batch = append(batch, msg.ToSendByte()...)
+		}
+		err := cli.SendBytes(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var sum int
+		for i := 0; i < n; i++ {
+			select {
+			case v := <-got:
+				sum += v
+			case <-time.After(time.Second * 3):
+				t.Fatalf("timeout after %d replies", i)
+			}
+		}
+		if sum != n*(n-1) {
+			t.Fatalf("expect sum %d, got %d", n*(n-1), sum)
+		}
+	})
+}
+
+func TestTransportBroadcast(t *testing.T) {
+	eachTransport(t, func(t *testing.T, tr transport) {
+		ts, newClient, stop := startTransport(t, tr, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+			s.Broadcast(msg)
+		})
+		defer stop()
+
+		const n = 3
+		var got = make(chan string, n)
+		var clis []*tcpClient
+		for i := 0; i < n; i++ {
+			cli := newClient()
+			cli.OnReceive(func(msg btmsg.IMsg) {
+				var v echoReq
+				_, _ = msg.ToStruct(&v)
+				got <- v.Msg
+			})
+			clis = append(clis, cli)
+		}
+
+		deadline := time.Now().Add(time.Second * 3)
+		for connCount(ts) < n {
+			if time.Now().After(deadline) {
+				t.Fatal("conns not ready")
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+
+		_ = clis[0].SendStruct(1, echoReq{Msg: "hi"})
+		for i := 0; i < n; i++ {
+			select {
+			case v := <-got:
+				if v != "hi" {
+					t.Fatalf("got %q", v)
+				}
+			case <-time.After(time.Second * 3):
+				t.Fatal("timeout")
+			}
+		}
+	})
+}
+
+// TestTransportShutdown Shutdown之后client收到关闭，不能再建立新连接
+func TestTransportShutdown(t *testing.T) {
+	eachTransport(t, func(t *testing.T, tr transport) {
+		ts, newClient, stop := startTransport(t, tr, echoCallback)
+
+		var closed = make(chan struct{}, 1)
+		cli := newClient()
+		cli.OnClose(func(isServer bool, isClient bool) {
+			closed <- struct{}{}
+		})
+
+		var rsp callRsp
+		err := cli.Call(context.Background(), 1, &callReq{N: 1}, &rsp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stop()
+		select {
+		case <-closed:
+		case <-time.After(time.Second * 3):
+			t.Fatal("client not closed")
+		}
+
+		_, err = ts.listener.Accept()
+		if err == nil {
+			t.Fatal("expect accept error after shutdown")
+		}
+	})
+}
+
+func TestPipeListenerClosed(t *testing.T) {
+	pl := NewPipeListener()
+	_ = pl.Close()
+	_ = pl.Close()
+
+	_, err := pl.Dial(context.Background(), "tcp", "")
+	if err == nil {
+		t.Fatal("expect dial error")
+	}
+	_, err = pl.Accept()
+	if _, ok := err.(*net.OpError); !ok {
+		t.Fatalf("expect *net.OpError, got %v", err)
+	}
+
+	pl = NewPipeListener()
+	defer pl.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	_, err = pl.Dial(ctx, "tcp", "")
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expect DeadlineExceeded, got %v", err)
+	}
+}
+
+// TestServerTransport server和client通过 Transport 选择传输方式
+func TestServerTransport(t *testing.T) {
+	verifyNoLeaks(t)
+
+	pl := NewPipeListener()
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), WithServerTransport(pl))
+	ts.OnReceive(echoCallback)
+	wg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		wg.Wait()
+	}()
+
+	cli := newTestClient("pipe", WithTransport(pl))
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	var rsp callRsp
+	err = cli.Call(context.Background(), 1, &callReq{N: 21}, &rsp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp.N != 42 {
+		t.Fatalf("expect 42, got %d", rsp.N)
+	}
+}
@@ -0,0 +1,47 @@
+package mytcp
+
+// priorityBurst 连续处理这么多个高优先级的消息之后，有普通消息在等时先处理一个普通消息
+const priorityBurst = 8
+
+// prioritySelector 写协程从两个优先级的队列取消息，同一个队列里的顺序不变
+type prioritySelector[T any] struct {
+	high   <-chan T
+	normal <-chan T
+	burst  int
+}
+
+// try 不阻塞地按优先级取一个，都是空的时ok为false，调用方再阻塞等待两个队列，拿到之后调用took
+func (l *prioritySelector[T]) try() (v T, ok bool) {
+	if l.burst >= priorityBurst {
+		select {
+		case v = <-l.normal:
+			l.took(false)
+			return v, true
+		default:
+		}
+	}
+
+	select {
+	case v = <-l.high:
+		l.took(true)
+		return v, true
+	default:
+	}
+
+	select {
+	case v = <-l.normal:
+		l.took(false)
+		return v, true
+	default:
+	}
+
+	return v, false
+}
+
+func (l *prioritySelector[T]) took(high bool) {
+	if high {
+		l.burst++
+	} else {
+		l.burst = 0
+	}
+}
@@ -0,0 +1,176 @@
+package mytcp
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// priorityOrder 队列里已经有20个高优先级和5个普通消息时写入的顺序
+// 每8个高优先级插入一个普通消息，同一个优先级里按放入的顺序
+var priorityOrder = []string{
+	"h0", "h1", "h2", "h3", "h4", "h5", "h6", "h7", "n0",
+	"h8", "h9", "h10", "h11", "h12", "h13", "h14", "h15", "n1",
+	"h16", "h17", "h18", "h19", "n2", "n3", "n4",
+}
+
+func priorityLabel(high bool, i int) string {
+	if high {
+		return "h" + strconv.Itoa(i)
+	}
+	return "n" + strconv.Itoa(i)
+}
+
+func checkPriorityOrder(t *testing.T, got []string) {
+	t.Helper()
+	if len(got) != len(priorityOrder) {
+		t.Fatalf("got %v", got)
+	}
+	for i := range got {
+		if got[i] != priorityOrder[i] {
+			t.Fatalf("got %v, expect %v", got, priorityOrder)
+		}
+	}
+}
+
+func TestPrioritySelector(t *testing.T) {
+	high := make(chan string, 20)
+	normal := make(chan string, 5)
+	for i := 0; i < 20; i++ {
+		high <- priorityLabel(true, i)
+	}
+	for i := 0; i < 5; i++ {
+		normal <- priorityLabel(false, i)
+	}
+
+	ps := prioritySelector[string]{high: high, normal: normal}
+	var got []string
+	for v, ok := ps.try(); ok; v, ok = ps.try() {
+		got = append(got, v)
+	}
+	checkPriorityOrder(t, got)
+}
+
+// TestServerSendPriority 写协程阻塞期间排队的消息，按优先级写入
+func TestServerSendPriority(t *testing.T) {
+	verifyNoLeaks(t)
+
+	var lock sync.Mutex
+	var got []string
+	var done = make(chan struct{})
+
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()))
+	ts.OnSendMsg(func(conn *contracts.TcpConn, msg btmsg.IMsg) {
+		lock.Lock()
+		defer lock.Unlock()
+		got = append(got, string(msg.BodyByte()))
+		if len(got) == len(priorityOrder) {
+			close(done)
+		}
+	})
+	wg, err := ts.Serve(NewPipeListener())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		wg.Wait()
+	}()
+
+	a, b := net.Pipe()
+	defer b.Close()
+	go func() {
+		_, _ = io.Copy(io.Discard, b)
+	}()
+	conn := &contracts.TcpConn{
+		Conn:      &wrapConn{Conn: a},
+		Id:        ts.getConnAutoIncId(),
+		Input:     make(chan btmsg.IMsg, 5),
+		InputHigh: make(chan btmsg.IMsg, 20),
+		WaitConn:  make(chan bool),
+	}
+	for i := 0; i < 5; i++ {
+		ts.Send(conn, newActMsg(1, []byte(priorityLabel(false, i))))
+	}
+	for i := 0; i < 20; i++ {
+		ts.SendPriority(conn, newActMsg(1, []byte(priorityLabel(true, i))), contracts.PriorityHigh)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ts.ConsumeInput(ctx, conn)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout")
+	}
+	cancel()
+	<-stopped
+
+	lock.Lock()
+	defer lock.Unlock()
+	checkPriorityOrder(t, got)
+}
+
+// TestClientSendMsgPriority 高优先级不受 WithSendQueue 的policy影响，写入时排在普通消息前面
+func TestClientSendMsgPriority(t *testing.T) {
+	verifyNoLeaks(t)
+
+	cli := newTestClient("127.0.0.1:1", WithSendQueue(5, OverflowError))
+	a, b := net.Pipe()
+	defer b.Close()
+	cli.conn = a
+	cli.wait = make(chan bool)
+	cli.state = clientStateConnected
+
+	for i := 0; i < 5; i++ {
+		if err := cli.sendPriority([]byte(priorityLabel(false, i)+"\n"), contracts.PriorityNormal, nil, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cli.send([]byte("full\n")); err != ErrSendQueueFull {
+		t.Fatalf("got %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := cli.sendPriority([]byte(priorityLabel(true, i)+"\n"), contracts.PriorityHigh, nil, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		cli.LoopWrite()
+	}()
+
+	var got []string
+	var line []byte
+	var buf [1]byte
+	for len(got) < len(priorityOrder) {
+		if _, err := b.Read(buf[:]); err != nil {
+			t.Fatal(err)
+		}
+		if buf[0] == '\n' {
+			got = append(got, string(line))
+			line = nil
+			continue
+		}
+		line = append(line, buf[0])
+	}
+	close(cli.wait)
+	<-stopped
+	_ = a.Close()
+
+	checkPriorityOrder(t, got)
+}
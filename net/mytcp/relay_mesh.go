@@ -0,0 +1,239 @@
+package mytcp
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+	. "github.com/winkb/tcp1/util"
+)
+
+const (
+	// meshQueueSize 每个peer排队等待发送的消息数，满了之后丢弃
+	meshQueueSize = 256
+	// meshRetry peer连接不上时重试的间隔，连上之后断开由client的 WithReconnect 重连
+	meshRetry = time.Millisecond * 200
+)
+
+var _ Relay = (*MeshRelay)(nil)
+
+// MeshRelay 用这个包的server和client在实例之间两两直连的 Relay
+// 每个实例监听一个集群内部的地址，用client连接所有peer，Publish从自己的client发出去，收到的消息来自peer的client
+// 消息带着发布方的id，只转发一次，收到的不会再发给别的peer，peer断开期间发给它的消息丢弃
+type MeshRelay struct {
+	id      string
+	server  *tcpServer
+	handler RelayHandler
+
+	lock  sync.RWMutex
+	peers map[string]*meshPeer
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      *sync.WaitGroup
+	dropped uint64
+}
+
+type meshPeer struct {
+	addr   string
+	queue  chan []byte
+	lock   sync.RWMutex
+	client *tcpClient
+}
+
+// NewMeshRelay id在集群里唯一，addr是集群内部的监听地址，不要暴露给客户端
+func NewMeshRelay(id string, addr string) *MeshRelay {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &MeshRelay{
+		id:     id,
+		server: NewTcpServer(addr, btmsg.NewReader(btmsg.FactoryMsgHeadTcp())),
+		peers:  map[string]*meshPeer{},
+		ctx:    ctx,
+		cancel: cancel,
+		wg:     &sync.WaitGroup{},
+	}
+	l.server.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		if msg.GetAct() == btmsg.ActRelay {
+			l.receive(msg.BodyByte())
+		}
+	})
+	return l
+}
+
+// Start 开始监听，返回的wg在Close之后结束
+func (l *MeshRelay) Start() (*sync.WaitGroup, error) {
+	wg, err := l.server.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	MyGoWg(l.wg, "mesh_server", func() {
+		wg.Wait()
+	})
+	return l.wg, nil
+}
+
+// Addr 实际监听的地址，端口是0时由系统分配
+func (l *MeshRelay) Addr() string {
+	return l.server.listener.Addr().String()
+}
+
+// AddPeer 连接另一个实例的 Addr，连不上时一直重试，重复添加同一个地址没有效果
+func (l *MeshRelay) AddPeer(addr string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if _, ok := l.peers[addr]; ok || l.ctx.Err() != nil {
+		return
+	}
+
+	p := &meshPeer{addr: addr, queue: make(chan []byte, meshQueueSize)}
+	l.peers[addr] = p
+	MyGoWgCtx(l.ctx, l.wg, "mesh_peer", func(ctx context.Context) {
+		l.runPeer(ctx, p)
+	})
+}
+
+// Peers 每个peer当前是否连接着
+func (l *MeshRelay) Peers() map[string]bool {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	var res = make(map[string]bool, len(l.peers))
+	for addr, p := range l.peers {
+		p.lock.RLock()
+		res[addr] = p.client != nil && p.client.connected()
+		p.lock.RUnlock()
+	}
+	return res
+}
+
+// Dropped 因为peer断开或者排队满了丢弃的消息数
+func (l *MeshRelay) Dropped() uint64 {
+	return atomic.LoadUint64(&l.dropped)
+}
+
+// Publish 交给每个peer的发送协程，不等待发送完成
+func (l *MeshRelay) Publish(topic string, frame []byte) error {
+	body := encodeRelayFrame(l.id, topic, frame)
+
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	for _, p := range l.peers {
+		select {
+		case p.queue <- body:
+		default:
+			atomic.AddUint64(&l.dropped, 1)
+		}
+	}
+	return nil
+}
+
+// Subscribe 要在Start之前调用
+func (l *MeshRelay) Subscribe(h RelayHandler) {
+	l.handler = h
+}
+
+// Close 断开所有peer，停止监听
+func (l *MeshRelay) Close() {
+	l.lock.Lock()
+	l.cancel()
+	l.lock.Unlock()
+
+	l.server.Shutdown()
+}
+
+// runPeer 连接peer，把排队的消息按顺序发给它
+func (l *MeshRelay) runPeer(ctx context.Context, p *meshPeer) {
+	for {
+		cli := NewTcpClient(p.addr, WithReconnect(meshRetry, meshRetry*10, 0), WithDialTimeout(meshRetry*5))
+		_, err := cli.StartContext(ctx)
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(meshRetry):
+				continue
+			}
+		}
+
+		p.lock.Lock()
+		p.client = cli
+		p.lock.Unlock()
+
+		l.sendLoop(ctx, p, cli)
+		cli.Close()
+		<-cli.Done()
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (l *MeshRelay) sendLoop(ctx context.Context, p *meshPeer, cli *tcpClient) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-cli.Done():
+			return
+		case body := <-p.queue:
+			if !cli.connected() {
+				atomic.AddUint64(&l.dropped, 1)
+				continue
+			}
+			err := cli.SendMsg(btmsg.NewActMsg(btmsg.ActRelay, body))
+			if err != nil {
+				atomic.AddUint64(&l.dropped, 1)
+				log.Err(errors.Wrapf(err, "relay to %s", p.addr))
+			}
+		}
+	}
+}
+
+// receive peer发过来的消息，自己发布的不处理
+func (l *MeshRelay) receive(body []byte) {
+	origin, topic, frame, err := decodeRelayFrame(body)
+	if err != nil {
+		log.Err(err)
+		return
+	}
+	if origin == l.id || l.handler == nil {
+		return
+	}
+	l.handler(topic, frame)
+}
+
+// encodeRelayFrame 发布方的id和topic前面各有两个字节的长度，剩下的是frame
+func encodeRelayFrame(origin, topic string, frame []byte) []byte {
+	var body = make([]byte, 0, 4+len(origin)+len(topic)+len(frame))
+	body = binary.BigEndian.AppendUint16(body, uint16(len(origin)))
+	body = append(body, origin...)
+	body = binary.BigEndian.AppendUint16(body, uint16(len(topic)))
+	body = append(body, topic...)
+	return append(body, frame...)
+}
+
+func decodeRelayFrame(body []byte) (origin, topic string, frame []byte, err error) {
+	var fields [2]string
+	for i := range fields {
+		if len(body) < 2 {
+			return "", "", nil, errors.Wrap(ErrBadRelayFrame, "short header")
+		}
+		n := int(binary.BigEndian.Uint16(body))
+		body = body[2:]
+		if len(body) < n {
+			return "", "", nil, errors.Wrapf(ErrBadRelayFrame, "field %d want %d bytes", i, n)
+		}
+		fields[i] = string(body[:n])
+		body = body[n:]
+	}
+	return fields[0], fields[1], body, nil
+}
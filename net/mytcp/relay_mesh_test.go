@@ -0,0 +1,170 @@
+package mytcp
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+)
+
+const actRelayed uint16 = 30
+
+// relayNode 一个server实例，带着自己的mesh和一个收广播的client
+type relayNode struct {
+	mesh   *MeshRelay
+	meshWg *sync.WaitGroup
+	server *tcpServer
+	wg     *sync.WaitGroup
+	cli    *tcpClient
+	got    chan string
+}
+
+func startRelayNode(t *testing.T, id, meshAddr string) *relayNode {
+	n := &relayNode{mesh: NewMeshRelay(id, meshAddr), got: make(chan string, 100)}
+	var err error
+	n.meshWg, err = n.mesh.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n.server = NewTcpServer("127.0.0.1:0", btmsg.NewReader(btmsg.FactoryMsgHeadTcp()), WithRelay(n.mesh))
+	n.wg, err = n.server.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n.cli = NewTcpClient(n.server.listener.Addr().String())
+	n.cli.OnReceive(func(msg btmsg.IMsg) {
+		if msg.GetAct() == actRelayed {
+			n.got <- string(msg.BodyByte())
+		}
+	})
+	if _, err = n.cli.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitServerConns(t, n.server, 1)
+	return n
+}
+
+func (l *relayNode) stop() {
+	l.cli.Close()
+	<-l.cli.Done()
+	l.server.Shutdown()
+	l.wg.Wait()
+	l.mesh.Close()
+	l.meshWg.Wait()
+}
+
+func waitServerConns(t testing.TB, ts *tcpServer, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second * 3)
+	for len(ts.snapshotConns()) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect %d conns, got %d", n, len(ts.snapshotConns()))
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+func connectMesh(nodes ...*relayNode) {
+	for _, a := range nodes {
+		for _, b := range nodes {
+			if a != b {
+				a.mesh.AddPeer(b.mesh.Addr())
+			}
+		}
+	}
+}
+
+func waitPeers(t *testing.T, n *relayNode, addr string, connected bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second * 5)
+	for n.mesh.Peers()[addr] != connected {
+		if time.Now().After(deadline) {
+			t.Fatalf("peer %s expect connected %v", addr, connected)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+// expectRelayed 每个节点的client都只收到一次body
+func expectRelayed(t *testing.T, body string, nodes ...*relayNode) {
+	t.Helper()
+	for i, n := range nodes {
+		select {
+		case v := <-n.got:
+			if v != body {
+				t.Fatalf("node %d expect %s, got %s", i, body, v)
+			}
+		case <-time.After(time.Second * 3):
+			t.Fatalf("node %d timeout waiting %s", i, body)
+		}
+	}
+}
+
+func TestMeshRelayBroadcast(t *testing.T) {
+	verifyNoLeaks(t)
+
+	a := startRelayNode(t, "a", "127.0.0.1:0")
+	defer a.stop()
+	b := startRelayNode(t, "b", "127.0.0.1:0")
+	defer b.stop()
+	c := startRelayNode(t, "c", "127.0.0.1:0")
+	cAddr := c.mesh.Addr()
+
+	connectMesh(a, b, c)
+	for _, n := range []*relayNode{a, b, c} {
+		for _, m := range []*relayNode{a, b, c} {
+			if n != m {
+				waitPeers(t, n, m.mesh.Addr(), true)
+			}
+		}
+	}
+
+	// 不同实例发布的消息经过不同的连接，收到的顺序不确定，一个一个等
+	a.server.Broadcast(btmsg.NewActMsg(actRelayed, []byte("1")))
+	expectRelayed(t, "1", a, b, c)
+	b.server.Broadcast(btmsg.NewActMsg(actRelayed, []byte("2")))
+	expectRelayed(t, "2", a, b, c)
+
+	// 收到的转发不会再转发，等一会也没有重复的
+	time.Sleep(time.Millisecond * 100)
+	for i, n := range []*relayNode{a, b, c} {
+		if len(n.got) != 0 {
+			t.Fatalf("node %d got duplicate %s", i, <-n.got)
+		}
+	}
+
+	// c断开之后a和b之间照常转发
+	c.stop()
+	waitPeers(t, a, cAddr, false)
+	waitPeers(t, b, cAddr, false)
+	a.server.Broadcast(btmsg.NewActMsg(actRelayed, []byte("3")))
+	expectRelayed(t, "3", a, b)
+
+	// c在同一个地址重启，a和b重连上之后也能收到
+	c = startRelayNode(t, "c", cAddr)
+	defer c.stop()
+	connectMesh(a, b, c)
+	for _, n := range []*relayNode{a, b} {
+		waitPeers(t, n, cAddr, true)
+		waitPeers(t, c, n.mesh.Addr(), true)
+	}
+	a.server.Broadcast(btmsg.NewActMsg(actRelayed, []byte("4")))
+	expectRelayed(t, "4", a, b, c)
+	c.server.Broadcast(btmsg.NewActMsg(actRelayed, []byte("5")))
+	expectRelayed(t, "5", a, b, c)
+}
+
+func TestRelayFrame(t *testing.T) {
+	body := encodeRelayFrame("a", RelayTopicBroadcast, []byte("frame"))
+	origin, topic, frame, err := decodeRelayFrame(body)
+	if err != nil || origin != "a" || topic != RelayTopicBroadcast || string(frame) != "frame" {
+		t.Fatalf("%s %s %s %v", origin, topic, frame, err)
+	}
+
+	if _, _, _, err = decodeRelayFrame(body[:3]); err == nil {
+		t.Fatal("expect error")
+	}
+}
@@ -0,0 +1,115 @@
+package mytcp
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+	"github.com/winkb/tcp1/util/numfn"
+)
+
+// Logger AccessLog输出用，*log.Logger 和 *zerolog.Logger 都满足
+type Logger interface {
+	Printf(format string, v ...any)
+}
+
+// ServerMiddleware 包装OnReceive的回调，比如 server.OnReceive(AccessLog()(onReceive))
+type ServerMiddleware func(next contracts.ServerReceiveCallback) contracts.ServerReceiveCallback
+
+type accessLog struct {
+	logger  Logger
+	slow    time.Duration
+	samples map[uint16]*accessSample
+}
+
+// accessSample 每n条记录一条
+type accessSample struct {
+	n     uint64
+	count uint64
+}
+
+type AccessLogOption func(l *accessLog)
+
+// WithAccessLogger 默认输出到zerolog的全局logger
+func WithAccessLogger(logger Logger) AccessLogOption {
+	return func(l *accessLog) {
+		l.logger = logger
+	}
+}
+
+// WithAccessLogSample acts里的act每n条只记录第一条，用于很频繁的act，没有列出的act都记录
+func WithAccessLogSample(n uint64, acts ...uint16) AccessLogOption {
+	return func(l *accessLog) {
+		if n <= 1 {
+			return
+		}
+		for _, act := range acts {
+			l.samples[act] = &accessSample{n: n}
+		}
+	}
+}
+
+// WithAccessLogSlow 只记录处理时间不少于d的消息
+func WithAccessLogSlow(d time.Duration) AccessLogOption {
+	return func(l *accessLog) {
+		l.slow = d
+	}
+}
+
+// AccessLog 每处理一条消息记录一行：时间、连接id、ip、act、body大小、耗时、结果、trace id
+// 回调panic时记录为panic之后继续panic，被采样跳过的消息直接调用next，没有额外的分配
+func AccessLog(opts ...AccessLogOption) ServerMiddleware {
+	l := &accessLog{
+		logger:  &log.Logger,
+		samples: map[uint16]*accessSample{},
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return func(next contracts.ServerReceiveCallback) contracts.ServerReceiveCallback {
+		return func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+			if l.skip(msg.GetAct()) {
+				next(s, conn, msg)
+				return
+			}
+			l.handle(next, s, conn, msg)
+		}
+	}
+}
+
+func (l *accessLog) skip(act uint16) bool {
+	sample, ok := l.samples[act]
+	if !ok {
+		return false
+	}
+	return (atomic.AddUint64(&sample.count, 1)-1)%sample.n != 0
+}
+
+func (l *accessLog) handle(next contracts.ServerReceiveCallback, s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+	// 回调可能Release消息，先取出要记录的内容
+	act := msg.GetAct()
+	size := len(msg.BodyByte())
+	traceID, hasTrace := msg.GetTraceID()
+	start := time.Now()
+
+	outcome := "panic"
+	defer func() {
+		dur := time.Since(start)
+		if dur < l.slow {
+			return
+		}
+		trace := "-"
+		if hasTrace {
+			trace = traceID.String()
+		}
+		l.logger.Printf("%s conn=%d ip=%s act=%s(%d) size=%d dur=%s outcome=%s trace=%s",
+			start.Format(time.RFC3339Nano), conn.Id, conn.GetRemoteIp(),
+			btmsg.ActName(act), act, size, numfn.HumanDuration(dur), outcome, trace)
+	}()
+
+	next(s, conn, msg)
+	outcome = "ok"
+}
@@ -0,0 +1,127 @@
+package mytcp
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+type lineLogger struct {
+	lock  sync.Mutex
+	lines []string
+}
+
+func (l *lineLogger) Printf(format string, v ...any) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *lineLogger) take() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	res := l.lines
+	l.lines = nil
+	return res
+}
+
+func accessMsg(act uint16, body string) btmsg.IMsg {
+	msg := btmsg.NewMsg(btmsg.NewMsgHeadTcpSeq(), []byte(body))
+	msg.SetAct(act)
+	return msg
+}
+
+func TestAccessLog(t *testing.T) {
+	logger := &lineLogger{}
+	conn := &contracts.TcpConn{Id: 7}
+	var handled int
+	h := AccessLog(WithAccessLogger(logger), WithAccessLogSample(3, 5))(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		handled++
+		if msg.GetAct() == 6 {
+			panic("bad")
+		}
+	})
+
+	h(nil, conn, accessMsg(1, "hello"))
+	lines := logger.take()
+	if len(lines) != 1 {
+		t.Fatalf("expect 1 line, got %v", lines)
+	}
+	for _, v := range []string{"conn=7", "act=1(1)", "size=5", "outcome=ok"} {
+		if !strings.Contains(lines[0], v) {
+			t.Fatalf("%q not in %q", v, lines[0])
+		}
+	}
+
+	// 每3条记录1条
+	for i := 0; i < 7; i++ {
+		h(nil, conn, accessMsg(5, ""))
+	}
+	if n := len(logger.take()); n != 3 || handled != 8 {
+		t.Fatalf("expect 3 sampled lines of 8 handled, got %d of %d", n, handled)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("panic should propagate")
+			}
+		}()
+		h(nil, conn, accessMsg(6, ""))
+	}()
+	lines = logger.take()
+	if len(lines) != 1 || !strings.Contains(lines[0], "outcome=panic") {
+		t.Fatalf("panic lines %v", lines)
+	}
+}
+
+func TestAccessLogSlow(t *testing.T) {
+	logger := &lineLogger{}
+	h := AccessLog(WithAccessLogger(logger), WithAccessLogSlow(time.Millisecond*20))(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		if msg.GetAct() == 2 {
+			time.Sleep(time.Millisecond * 30)
+		}
+	})
+
+	h(nil, &contracts.TcpConn{}, accessMsg(1, ""))
+	h(nil, &contracts.TcpConn{}, accessMsg(2, ""))
+	lines := logger.take()
+	if len(lines) != 1 || !strings.Contains(lines[0], "act=2(2)") {
+		t.Fatalf("slow lines %v", lines)
+	}
+}
+
+// 被采样跳过的消息没有额外的分配
+func TestAccessLogSkipNoAlloc(t *testing.T) {
+	h := AccessLog(WithAccessLogger(&lineLogger{}), WithAccessLogSample(1<<62, 300))(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {})
+	conn := &contracts.TcpConn{}
+	msg := accessMsg(300, "")
+	h(nil, conn, msg)
+
+	allocs := testing.AllocsPerRun(1000, func() {
+		h(nil, conn, msg)
+	})
+	if allocs != 0 {
+		t.Fatalf("expect 0 allocs, got %v", allocs)
+	}
+}
+
+func BenchmarkAccessLogSkip(b *testing.B) {
+	h := AccessLog(WithAccessLogger(&lineLogger{}), WithAccessLogSample(1<<62, 300))(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {})
+	conn := &contracts.TcpConn{}
+	msg := accessMsg(300, "")
+	h(nil, conn, msg)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h(nil, conn, msg)
+	}
+}
@@ -0,0 +1,123 @@
+package mytcp
+
+import (
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+const (
+	// AdminForbiddenCode 连接没有通过 WithAdminConns 的allow时回复的错误码
+	AdminForbiddenCode uint16 = 403
+	// AdminBadRequestCode 请求的body解析不了
+	AdminBadRequestCode uint16 = 400
+)
+
+// AdminConnsReq 请求的body，Limit<=0或者超过上限时按上限
+type AdminConnsReq struct {
+	Offset int
+	Limit  int
+	// Events 同时返回最近多少个事件，见 RecentEvents，0不返回
+	Events int
+}
+
+// AdminConnsRsp Total是所有连接数，Conns按Id排序，从Offset开始
+type AdminConnsRsp struct {
+	Total  int
+	Conns  []AdminConn
+	Events []ServerEvent `json:",omitempty"`
+}
+
+type AdminConn struct {
+	Id          uint64
+	Remote      string
+	ConnectedAt time.Time
+	// LastActive 还没有收发过消息时是零值
+	LastActive time.Time
+	BytesIn    uint64
+	BytesOut   uint64
+	// Queued 已经Send还没有写入的消息数，Pending 这些消息的字节数，只在设置了 WithMaxTotalPendingBytes 时记录
+	Queued  int64
+	Pending int64
+	// Identity BindIdentity 绑定的身份
+	Identity string `json:",omitempty"`
+}
+
+type adminConns struct {
+	act      uint16
+	maxConns int
+	allow    func(conn *contracts.TcpConn) bool
+}
+
+// WithAdminConns 收到act时框架自己回复当前连接的列表，见 AdminConnsReq 和 AdminConnsRsp，不会交给OnReceive
+// allow返回false或者为nil时回复 AdminForbiddenCode，一次最多返回maxConns个连接，用Offset分页
+func WithAdminConns(act uint16, maxConns int, allow func(conn *contracts.TcpConn) bool) ServerOption {
+	return func(l *tcpServer) {
+		l.admin = &adminConns{act: act, maxConns: maxConns, allow: allow}
+	}
+}
+
+// handleAdmin 是admin的act时回复，返回true
+func (l *tcpServer) handleAdmin(conn *contracts.TcpConn, msg btmsg.IMsg) bool {
+	if l.admin == nil || msg.GetAct() != l.admin.act {
+		return false
+	}
+	if l.releaseMsg {
+		defer msg.Release()
+	}
+
+	var err error
+	if l.admin.allow == nil || !l.admin.allow(conn) {
+		err = conn.ReplyError(msg, AdminForbiddenCode, "forbidden")
+	} else {
+		var req AdminConnsReq
+		if len(msg.BodyByte()) > 0 {
+			_, err = msg.ToStruct(&req)
+		}
+		if err != nil {
+			err = conn.ReplyError(msg, AdminBadRequestCode, err.Error())
+		} else {
+			err = conn.ReplyMsg(msg, l.adminConns(req))
+		}
+	}
+	if err != nil {
+		log.Err(err)
+	}
+	return true
+}
+
+func (l *tcpServer) adminConns(req AdminConnsReq) AdminConnsRsp {
+	conns := l.snapshotConns()
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].Id < conns[j].Id
+	})
+
+	limit := req.Limit
+	if limit <= 0 || limit > l.admin.maxConns {
+		limit = l.admin.maxConns
+	}
+	var rsp = AdminConnsRsp{Total: len(conns), Conns: []AdminConn{}}
+	for i := req.Offset; i >= 0 && i < len(conns) && len(rsp.Conns) < limit; i++ {
+		v := conns[i]
+		st := v.Stats()
+		id, _ := l.ConnIdentity(v)
+		rsp.Conns = append(rsp.Conns, AdminConn{
+			Id:          v.Id,
+			Remote:      v.Conn.RemoteAddr().String(),
+			ConnectedAt: st.ConnectedAt,
+			LastActive:  st.LastActive,
+			BytesIn:     st.BytesIn,
+			BytesOut:    st.BytesOut,
+			Queued:      st.Queued,
+			Pending:     st.Pending,
+			Identity:    id,
+		})
+	}
+	if req.Events > 0 {
+		rsp.Events = l.RecentEvents(req.Events)
+	}
+	return rsp
+}
@@ -0,0 +1,69 @@
+package mytcp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/winkb/tcp1/contracts"
+)
+
+const actAdmin uint16 = 60
+
+// TestAdminConns 绑定了admin身份的连接可以分页查看所有连接，其他连接被拒绝
+func TestAdminConns(t *testing.T) {
+	var ts *tcpServer
+	ts, stop := startIdentityServer(t, WithAdminConns(actAdmin, 2, func(conn *contracts.TcpConn) bool {
+		id, _ := ts.ConnIdentity(conn)
+		return id == "admin"
+	}))
+	defer stop()
+
+	admin := loginClient(t, ts, nil)
+	defer admin.Close()
+	if err := admin.Call(context.Background(), 1, &echoReq{Msg: "admin"}, &echoReq{}); err != nil {
+		t.Fatal(err)
+	}
+	user := loginClient(t, ts, nil)
+	defer user.Close()
+	if err := user.Call(context.Background(), 1, &echoReq{Msg: "tom"}, &echoReq{}); err != nil {
+		t.Fatal(err)
+	}
+	guest := loginClient(t, ts, nil)
+	defer guest.Close()
+	waitServerConns(t, ts, 3)
+
+	var rsp AdminConnsRsp
+	var replyErr *ReplyError
+	err := user.Call(context.Background(), actAdmin, &AdminConnsReq{}, &rsp)
+	if !errors.As(err, &replyErr) || replyErr.Code() != AdminForbiddenCode {
+		t.Fatalf("expect forbidden, got %v", err)
+	}
+
+	// 一次最多2个，按连接的顺序
+	if err = admin.Call(context.Background(), actAdmin, &AdminConnsReq{Limit: 10}, &rsp); err != nil {
+		t.Fatal(err)
+	}
+	if rsp.Total != 3 || len(rsp.Conns) != 2 {
+		t.Fatalf("rsp %+v", rsp)
+	}
+	first := rsp.Conns[0]
+	if first.Identity != "admin" || rsp.Conns[1].Identity != "tom" || first.Id >= rsp.Conns[1].Id {
+		t.Fatalf("conns %+v", rsp.Conns)
+	}
+	if first.Remote == "" || first.ConnectedAt.IsZero() || first.LastActive.IsZero() || first.BytesIn == 0 || first.BytesOut == 0 {
+		t.Fatalf("admin conn %+v", first)
+	}
+
+	rsp = AdminConnsRsp{}
+	if err = admin.Call(context.Background(), actAdmin, &AdminConnsReq{Offset: 2, Events: 2}, &rsp); err != nil {
+		t.Fatal(err)
+	}
+	if rsp.Total != 3 || len(rsp.Conns) != 1 || rsp.Conns[0].Identity != "" || rsp.Conns[0].BytesIn != 0 {
+		t.Fatalf("rsp %+v", rsp)
+	}
+	// 最近的事件是后两个连接
+	if len(rsp.Events) != 2 || rsp.Events[1].Kind != EventConnect || rsp.Events[1].ConnId != rsp.Conns[0].Id {
+		t.Fatalf("events %+v", rsp.Events)
+	}
+}
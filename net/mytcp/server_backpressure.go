@@ -0,0 +1,153 @@
+package mytcp
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/winkb/tcp1/contracts"
+	. "github.com/winkb/tcp1/util"
+)
+
+// BackpressurePolicy 所有连接待写的字节数超过 WithMaxTotalPendingBytes 时怎么处理
+type BackpressurePolicy int
+
+const (
+	// BackpressureReject 丢弃新的发送，SendWithTimeout 返回 ErrBackpressure
+	BackpressureReject BackpressurePolicy = iota
+	// BackpressurePause 所有连接暂停读，待写的数据写出去之后恢复，请求少了回复也就少了
+	BackpressurePause
+	// BackpressureCloseLargest 从待写最多的连接开始关闭，直到低于上限
+	BackpressureCloseLargest
+)
+
+const (
+	MetricPendingBytes = "tcp.pending.bytes"
+	// backpressurePoll BackpressurePause 暂停时检查的间隔
+	backpressurePoll = time.Millisecond * 5
+	// pendingReportInterval 上报 MetricPendingBytes 的间隔
+	pendingReportInterval = time.Second
+)
+
+// GaugeSink WithServerMetrics 的sink同时实现它时定时上报 MetricPendingBytes，可以在到达上限之前报警
+type GaugeSink interface {
+	SetGauge(name string, value float64, attrs []SpanAttr)
+}
+
+type serverBackpressure struct {
+	budget *contracts.PendingBudget
+	policy BackpressurePolicy
+	shed   chan struct{}
+	// closed 因为 BackpressureCloseLargest 关闭的连接数
+	closed uint64
+}
+
+// WithMaxTotalPendingBytes 限制所有连接已经Send还没有写入的字节数，超过max时按policy处理
+// 单个连接写得慢只会挡住自己的发送，连接很多时加起来可能占用很多内存，见 Stats 的PendingBytes
+func WithMaxTotalPendingBytes(max int64, policy BackpressurePolicy) ServerOption {
+	return func(l *tcpServer) {
+		bp := &serverBackpressure{
+			budget: &contracts.PendingBudget{Max: max, Reject: policy == BackpressureReject},
+			policy: policy,
+		}
+		if policy == BackpressureCloseLargest {
+			bp.shed = make(chan struct{}, 1)
+			bp.budget.Over = func() {
+				select {
+				case bp.shed <- struct{}{}:
+				default:
+				}
+			}
+		}
+		l.backpressure = bp
+	}
+}
+
+func (l *tcpServer) budget() *contracts.PendingBudget {
+	if l.backpressure == nil {
+		return nil
+	}
+	return l.backpressure.budget
+}
+
+// startBackpressure BackpressureCloseLargest 的关闭和指标上报在一个协程里
+func (l *tcpServer) startBackpressure(wg *sync.WaitGroup) {
+	bp := l.backpressure
+	if bp == nil {
+		return
+	}
+	gauge, _ := l.sizes.sink.(GaugeSink)
+	if bp.shed == nil && gauge == nil {
+		return
+	}
+
+	MyGoWgCtx(l.ctx, wg, "backpressure", func(ctx context.Context) {
+		ticker := time.NewTicker(pendingReportInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-bp.shed:
+				l.closeLargest()
+			case <-ticker.C:
+				if gauge != nil {
+					gauge.SetGauge(MetricPendingBytes, float64(bp.budget.Total()), nil)
+				}
+			}
+		}
+	})
+}
+
+// closeLargest 关闭的连接待写的数据在写协程退出之后才释放，已经关闭的不算在里面，避免多关
+func (l *tcpServer) closeLargest() {
+	bp := l.backpressure
+	conns := l.snapshotConns()
+	pending := make(map[uint64]int64, len(conns))
+	var live int64
+	for _, v := range conns {
+		v.Lock.RLock()
+		closed := v.IsClose
+		v.Lock.RUnlock()
+		if !closed {
+			pending[v.Id] = atomic.LoadInt64(&v.Pending)
+			live += pending[v.Id]
+		}
+	}
+
+	over := live - bp.budget.Max
+	if over <= 0 {
+		return
+	}
+	sort.Slice(conns, func(i, j int) bool {
+		return pending[conns[i].Id] > pending[conns[j].Id]
+	})
+
+	for _, v := range conns {
+		if over <= 0 || pending[v.Id] <= 0 {
+			return
+		}
+		l.CloseConn(v)
+		atomic.AddUint64(&bp.closed, 1)
+		over -= pending[v.Id]
+	}
+}
+
+// waitBackpressure BackpressurePause 超过上限时在读下一个消息之前等待
+func (l *tcpServer) waitBackpressure(ctx context.Context) {
+	bp := l.backpressure
+	if bp == nil || bp.policy != BackpressurePause {
+		return
+	}
+
+	for bp.budget.Total() > bp.budget.Max {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backpressurePoll):
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package mytcp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// slowReaders n个连接，对端都不读，写协程一直阻塞在写入上，peers[i]是conns[i]的对端
+func slowReaders(t *testing.T, ts *tcpServer, ln *PipeListener, n int) (peers []net.Conn, conns []*contracts.TcpConn) {
+	for i := 0; i < n; i++ {
+		c, err := ln.Dial(context.Background(), pipeNetwork, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		peers = append(peers, c)
+	}
+	t.Cleanup(func() {
+		for _, c := range peers {
+			_ = c.Close()
+		}
+	})
+
+	waitServerConns(t, ts, n)
+	// 按顺序accept，id和Dial的顺序一样
+	conns = ts.snapshotConns()
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].Id < conns[j].Id
+	})
+	return peers, conns
+}
+
+func startBackpressureServer(t *testing.T, opts ...ServerOption) (*tcpServer, *PipeListener, func()) {
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), opts...)
+	ln := NewPipeListener()
+	wg, err := ts.Serve(ln)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts, ln, func() {
+		ts.Shutdown()
+		wg.Wait()
+	}
+}
+
+// TestBackpressureReject 很多写得慢的连接同时发送，待写的字节数一直不超过上限
+func TestBackpressureReject(t *testing.T) {
+	verifyNoLeaks(t)
+
+	body := make([]byte, 1024)
+	size := contracts.FrameSize(newActMsg(1, body))
+	max := size * 16
+	ts, ln, stop := startBackpressureServer(t, WithMaxTotalPendingBytes(max, BackpressureReject))
+	defer stop()
+
+	peers, conns := slowReaders(t, ts, ln, 20)
+
+	var peak int64
+	var sendWg sync.WaitGroup
+	var sampling = make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sampling:
+				return
+			default:
+			}
+			if v := ts.Stats().PendingBytes; v > atomic.LoadInt64(&peak) {
+				atomic.StoreInt64(&peak, v)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	var backpressure int64
+	for _, conn := range conns {
+		for i := 0; i < 5; i++ {
+			sendWg.Add(1)
+			go func(conn *contracts.TcpConn) {
+				defer sendWg.Done()
+				err := conn.SendWithTimeout(newActMsg(1, body), time.Millisecond*200)
+				if errors.Is(err, contracts.ErrBackpressure) {
+					atomic.AddInt64(&backpressure, 1)
+				}
+			}(conn)
+		}
+	}
+	sendWg.Wait()
+	close(sampling)
+
+	if atomic.LoadInt64(&peak) > max {
+		t.Fatalf("pending peak %d over %d", peak, max)
+	}
+	st := ts.Stats()
+	if backpressure == 0 || st.BackpressureRejected != uint64(backpressure) {
+		t.Fatalf("backpressure %d, stats %+v", backpressure, st)
+	}
+
+	// 关闭之后待写的都释放，对端先关闭，写协程不用等到写超时
+	for _, p := range peers {
+		_ = p.Close()
+	}
+	stop()
+	if v := ts.budget().Total(); v != 0 {
+		t.Fatalf("pending %d after shutdown", v)
+	}
+}
+
+func TestBackpressureCloseLargest(t *testing.T) {
+	verifyNoLeaks(t)
+
+	body := make([]byte, 1024)
+	size := contracts.FrameSize(newActMsg(1, body))
+	ts, ln, stop := startBackpressureServer(t, WithMaxTotalPendingBytes(size*6, BackpressureCloseLargest))
+	defer stop()
+
+	peers, conns := slowReaders(t, ts, ln, 3)
+	// 前两个连接各一个，最后一个排队6个，超过上限时只关闭它
+	var sendWg sync.WaitGroup
+	for i, conn := range conns {
+		n := 1
+		if i == len(conns)-1 {
+			n = 6
+		}
+		for j := 0; j < n; j++ {
+			sendWg.Add(1)
+			go func(conn *contracts.TcpConn) {
+				defer sendWg.Done()
+				conn.Send(newActMsg(1, body))
+			}(conn)
+		}
+	}
+	sendWg.Wait()
+
+	largest := conns[len(conns)-1]
+	deadline := time.Now().Add(time.Second * 3)
+	for ts.Stats().BackpressureClosed == 0 || ts.Stats().PendingBytes > size*6 {
+		if time.Now().After(deadline) {
+			t.Fatalf("stats %+v", ts.Stats())
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	if st := ts.Stats(); st.BackpressureClosed != 1 || st.Conns != 2 {
+		t.Fatalf("stats %+v", st)
+	}
+	if _, ok := ts.getConnById(largest.Id); ok {
+		t.Fatal("largest conn not closed")
+	}
+
+	// 剩下的连接开始读之后全部写完
+	for _, p := range peers[:len(peers)-1] {
+		go func(p net.Conn) {
+			_, _ = io.Copy(io.Discard, p)
+		}(p)
+	}
+	deadline = time.Now().Add(time.Second * 3)
+	for ts.Stats().PendingBytes != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("stats %+v", ts.Stats())
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+// TestBackpressurePause 超过上限时不再读新的请求，写出去之后恢复
+func TestBackpressurePause(t *testing.T) {
+	verifyNoLeaks(t)
+
+	body := make([]byte, 1024)
+	size := contracts.FrameSize(newActMsg(1, body))
+	ts, ln, stop := startBackpressureServer(t, WithMaxTotalPendingBytes(size, BackpressurePause))
+	defer stop()
+
+	var received = make(chan struct{}, 1)
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		received <- struct{}{}
+	})
+
+	peers, conns := slowReaders(t, ts, ln, 1)
+	// 一个在写协程里，一个等着交给写协程
+	for i := 0; i < 2; i++ {
+		go conns[0].Send(newActMsg(1, body))
+	}
+	deadline := time.Now().Add(time.Second * 3)
+	for ts.Stats().PendingBytes <= size {
+		if time.Now().After(deadline) {
+			t.Fatalf("stats %+v", ts.Stats())
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	cli := newTestClient("pipe", WithDialer(ln.Dial))
+	if _, err := cli.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	if err := cli.SendMsg(newActMsg(2, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-received:
+		t.Fatal("read while over the limit")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	go func() {
+		_, _ = io.Copy(io.Discard, peers[0])
+	}()
+	select {
+	case <-received:
+	case <-time.After(time.Second * 3):
+		t.Fatal("read not resumed")
+	}
+}
@@ -0,0 +1,115 @@
+package mytcp
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// serverBans 按ip记录协议错误，滑动窗口内次数达到threshold之后在duration内拒绝这个ip的新连接
+type serverBans struct {
+	lock       sync.Mutex
+	threshold  int
+	window     time.Duration
+	duration   time.Duration
+	violations map[string][]time.Time
+	// banned ip对应解封的时间
+	banned   map[string]time.Time
+	rejected uint64
+}
+
+// WithViolationBan 同一个ip在window内有threshold个连接因为数据没法解析被断开(magic错误、超过最大长度等)，
+// duration内accept之后直接关闭它的新连接，见 Bans 和 Unban，默认不封禁
+func WithViolationBan(threshold int, window time.Duration, duration time.Duration) ServerOption {
+	return func(l *tcpServer) {
+		l.bans.threshold = threshold
+		l.bans.window = window
+		l.bans.duration = duration
+	}
+}
+
+// Bans 正在封禁的ip和解封的时间
+func (l *tcpServer) Bans() map[string]time.Time {
+	l.bans.lock.Lock()
+	defer l.bans.lock.Unlock()
+
+	now := time.Now()
+	var res = map[string]time.Time{}
+	for ip, until := range l.bans.banned {
+		if now.Before(until) {
+			res[ip] = until
+		}
+	}
+	return res
+}
+
+// Unban 立即解封ip，同时清除它之前的错误记录
+func (l *tcpServer) Unban(ip string) {
+	l.bans.lock.Lock()
+	defer l.bans.lock.Unlock()
+
+	delete(l.bans.banned, ip)
+	delete(l.bans.violations, ip)
+}
+
+// violation 记录一次协议错误，达到次数时开始封禁，返回true
+func (l *serverBans) violation(ip string, now time.Time) bool {
+	if l.threshold <= 0 {
+		return false
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.violations == nil {
+		l.violations = map[string][]time.Time{}
+		l.banned = map[string]time.Time{}
+	}
+
+	// 顺便清理窗口之外的记录，不再出错的ip不会一直占着内存
+	since := now.Add(-l.window)
+	for k, times := range l.violations {
+		if k != ip && !times[len(times)-1].After(since) {
+			delete(l.violations, k)
+		}
+	}
+
+	var times []time.Time
+	for _, v := range l.violations[ip] {
+		if v.After(since) {
+			times = append(times, v)
+		}
+	}
+	times = append(times, now)
+
+	if len(times) < l.threshold {
+		l.violations[ip] = times
+		return false
+	}
+
+	delete(l.violations, ip)
+	l.banned[ip] = now.Add(l.duration)
+	return true
+}
+
+// isBanned 到期的在这里删除，被拒绝时计数
+func (l *serverBans) isBanned(ip string, now time.Time) bool {
+	if l.threshold <= 0 {
+		return false
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	until, ok := l.banned[ip]
+	if !ok {
+		return false
+	}
+	if !now.Before(until) {
+		delete(l.banned, ip)
+		return false
+	}
+
+	atomic.AddUint64(&l.rejected, 1)
+	return true
+}
@@ -0,0 +1,128 @@
+package mytcp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+)
+
+// sendOversized 发一个超过最大长度的消息，等服务端断开
+func sendOversized(t *testing.T, addr string) {
+	t.Helper()
+
+	cli := newTestClient(addr)
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	_ = cli.SendStruct(1, echoReq{Msg: "longer than 8 bytes"})
+	select {
+	case <-cli.Done():
+	case <-time.After(time.Second * 3):
+		t.Fatal("expect server to close conn")
+	}
+}
+
+// expectRejected 连接之后没有发送任何数据就被关闭
+func expectRejected(t *testing.T, addr string) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 3))
+	_, err = conn.Read(make([]byte, 1))
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("expect EOF, got %v", err)
+	}
+}
+
+func TestViolationBan(t *testing.T) {
+	verifyNoLeaks(t)
+
+	ts := NewTcpServer("127.0.0.1:0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq(), btmsg.WithMaxBodySize(8)),
+		WithViolationBan(2, time.Second, time.Millisecond*200), WithFirstMessageTimeout(time.Second))
+	swg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		swg.Wait()
+	}()
+	addr := ts.listener.Addr().String()
+
+	sendOversized(t, addr)
+	if len(ts.Bans()) != 0 {
+		t.Fatal("banned after 1 violation")
+	}
+	sendOversized(t, addr)
+	until, ok := ts.Bans()["127.0.0.1"]
+	if !ok || time.Until(until) > time.Millisecond*200 {
+		t.Fatalf("bans %v", ts.Bans())
+	}
+
+	expectRejected(t, addr)
+	if n := ts.Stats().BannedConns; n != 1 {
+		t.Fatalf("banned conns %d", n)
+	}
+
+	// 到期之后可以正常连接
+	time.Sleep(time.Until(until) + time.Millisecond*10)
+	if len(ts.Bans()) != 0 {
+		t.Fatalf("bans %v", ts.Bans())
+	}
+	sendOversized(t, addr)
+	sendOversized(t, addr)
+	if len(ts.Bans()) != 1 {
+		t.Fatalf("bans %v", ts.Bans())
+	}
+
+	ts.Unban("127.0.0.1")
+	if len(ts.Bans()) != 0 {
+		t.Fatalf("bans %v", ts.Bans())
+	}
+	sendOversized(t, addr)
+	if len(ts.Bans()) != 0 {
+		t.Fatal("violations not cleared by Unban")
+	}
+	if n := ts.Stats().BannedConns; n != 1 {
+		t.Fatalf("banned conns %d", n)
+	}
+}
+
+func TestViolationWindow(t *testing.T) {
+	var bans = serverBans{threshold: 3, window: time.Second, duration: time.Minute}
+	now := time.Now()
+
+	bans.violation("a", now)
+	bans.violation("a", now.Add(time.Millisecond*500))
+	bans.violation("b", now.Add(time.Millisecond*600))
+	// 第一次已经在窗口之外
+	bans.violation("a", now.Add(time.Millisecond*1200))
+	if bans.isBanned("a", now.Add(time.Millisecond*1200)) {
+		t.Fatal("a banned")
+	}
+	bans.violation("a", now.Add(time.Millisecond*1300))
+	if !bans.isBanned("a", now.Add(time.Millisecond*1300)) {
+		t.Fatal("a not banned")
+	}
+	if bans.isBanned("a", now.Add(time.Minute*2)) {
+		t.Fatal("ban not expired")
+	}
+
+	// 窗口之外的ip被清理
+	bans.violation("c", now.Add(time.Second*3))
+	if _, ok := bans.violations["b"]; ok || len(bans.violations) != 1 {
+		t.Fatalf("violations %v", bans.violations)
+	}
+}
@@ -0,0 +1,131 @@
+package mytcp
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+type autoBatch struct {
+	window  time.Duration
+	maxMsgs int
+}
+
+// WithAutoBatch 写协程拿到一个消息之后再等window，期间同一个连接的消息合成一个 btmsg.ActBatch 写入，最多maxMsgs个
+// 每个消息都多等最多window，适合频繁的小消息，客户端的读取自动拆开，见 btmsg.BatchReader
+// 文本协议的连接和本身是 btmsg.ActBatch 的消息不合并
+func WithAutoBatch(window time.Duration, maxMsgs int) ServerOption {
+	return func(l *tcpServer) {
+		l.autoBatch = &autoBatch{window: window, maxMsgs: maxMsgs}
+	}
+}
+
+func batchable(conn *contracts.TcpConn, msg btmsg.IMsg) bool {
+	if msg.GetAct() == btmsg.ActBatch {
+		return false
+	}
+
+	conn.Lock.RLock()
+	defer conn.Lock.RUnlock()
+	return conn.Protocol != contracts.ProtocolText
+}
+
+// writeNext 没有设置 WithAutoBatch 时直接写msg，设置了时收集window内的消息一起写
+func (l *tcpServer) writeNext(ctx context.Context, conn *contracts.TcpConn, msg btmsg.IMsg, ps *prioritySelector[btmsg.IMsg]) {
+	if l.autoBatch == nil || !batchable(conn, msg) {
+		l.writeSend(conn, msg)
+		return
+	}
+
+	msgs := []btmsg.IMsg{msg}
+	// next 不能合并的消息，写完batch之后再写，保持顺序
+	var next btmsg.IMsg
+	timer := time.NewTimer(l.autoBatch.window)
+	defer timer.Stop()
+
+collect:
+	for len(msgs) < l.autoBatch.maxMsgs {
+		var v btmsg.IMsg
+		var ok bool
+		if v, ok = ps.try(); !ok {
+			select {
+			case <-ctx.Done():
+				break collect
+			case <-timer.C:
+				break collect
+			case v = <-conn.InputHigh:
+				ps.took(true)
+			case v = <-conn.Input:
+				ps.took(false)
+			}
+		}
+
+		if !batchable(conn, v) {
+			next = v
+			break
+		}
+		msgs = append(msgs, v)
+	}
+
+	l.writeBatch(conn, msgs)
+	if next != nil {
+		l.writeSend(conn, next)
+	}
+}
+
+// writeBatch 只有一个消息时单独写，发送的回调和统计还是按每个消息
+func (l *tcpServer) writeBatch(conn *contracts.TcpConn, msgs []btmsg.IMsg) {
+	if len(msgs) == 1 {
+		l.writeSend(conn, msgs[0])
+		return
+	}
+
+	defer func() {
+		// 对应Send里的Reserve和Retain
+		for _, msg := range msgs {
+			conn.Unreserve(msg)
+			msg.Release()
+		}
+	}()
+
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	if l.stop != 0 {
+		return
+	}
+
+	conn.Lock.RLock()
+	defer conn.Lock.RUnlock()
+	if conn.IsClose {
+		log.Print("conn is closed, drop msg")
+		return
+	}
+
+	batch := btmsg.NewBatch()
+	frames := make([][]byte, len(msgs))
+	for i, msg := range msgs {
+		// batchable 已经排除了 btmsg.ActBatch
+		frames[i], _ = batch.Add(msg)
+		l.fireSend(conn, msg, frames[i])
+	}
+
+	_ = conn.Conn.SetWriteDeadline(time.Now().Add(l.timeout))
+	err := writeFull(conn.Conn, batch.Msg().ToSendByte())
+	if err != nil {
+		l.event(EventError, conn.Id, conn.Conn.RemoteAddr().String(), err.Error())
+		log.Err(errors.Wrapf(err, "conn %d write batch err", conn.Id))
+		l.closeAfterWriteErr(conn, err)
+		return
+	}
+
+	for i, msg := range msgs {
+		l.sizes.observeSent(msg, len(frames[i]))
+		l.countSent(conn, len(frames[i]))
+		l.dedup.recordReply(conn.Id, msg, len(frames[i]))
+	}
+}
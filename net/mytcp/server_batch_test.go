@@ -0,0 +1,179 @@
+package mytcp
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+const actBatched uint16 = 50
+
+func startBatchServer(tb testing.TB, opts ...ServerOption) (*tcpServer, *PipeListener) {
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), opts...)
+	ln := NewPipeListener()
+	wg, err := ts.Serve(ln)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		ts.Shutdown()
+		wg.Wait()
+	})
+	return ts, ln
+}
+
+// TestAutoBatchOrder 合并发送的消息在客户端拆开之后顺序不变
+func TestAutoBatchOrder(t *testing.T) {
+	verifyNoLeaks(t)
+	ts, ln := startBatchServer(t, WithAutoBatch(time.Millisecond*5, 64))
+
+	const n = 500
+	got := make(chan string, n)
+	cli := newTestClient("pipe", WithDialer(ln.Dial))
+	cli.OnReceive(func(msg btmsg.IMsg) {
+		got <- string(msg.BodyByte())
+	})
+	if _, err := cli.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cli.Close()
+		<-cli.Done()
+	}()
+	waitServerConns(t, ts, 1)
+	conn := ts.snapshotConns()[0]
+
+	for i := 0; i < n; i++ {
+		conn.Send(newActMsg(actBatched, []byte(strconv.Itoa(i))))
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case v := <-got:
+			if v != strconv.Itoa(i) {
+				t.Fatalf("expect %d, got %s", i, v)
+			}
+		case <-time.After(time.Second * 3):
+			t.Fatalf("timeout waiting %d", i)
+		}
+	}
+}
+
+// TestAutoBatchFrame window内排队的消息在一个 btmsg.ActBatch 里写出去
+func TestAutoBatchFrame(t *testing.T) {
+	verifyNoLeaks(t)
+	ts, ln := startBatchServer(t, WithAutoBatch(time.Millisecond*50, 64))
+
+	peer, err := ln.Dial(context.Background(), pipeNetwork, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	waitServerConns(t, ts, 1)
+	conn := ts.snapshotConns()[0]
+
+	for i := 0; i < 3; i++ {
+		conn.Send(newActMsg(actBatched, []byte(strconv.Itoa(i))))
+	}
+
+	_ = peer.SetReadDeadline(time.Now().Add(time.Second * 3))
+	res := btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()).ReadMsg(NewWrapConn(peer))
+	if res.GetErr() != nil {
+		t.Fatal(res.GetErr())
+	}
+	if act := res.GetMsg().GetAct(); act != btmsg.ActBatch {
+		t.Fatalf("expect batch, got act %d", act)
+	}
+}
+
+// TestServerReadBatch 客户端发的batch在服务端按顺序交给回调
+func TestServerReadBatch(t *testing.T) {
+	verifyNoLeaks(t)
+	ts, ln := startBatchServer(t)
+
+	got := make(chan string, 10)
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		got <- string(msg.BodyByte())
+	})
+
+	cli := newTestClient("pipe", WithDialer(ln.Dial))
+	if _, err := cli.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cli.Close()
+		<-cli.Done()
+	}()
+
+	batch := btmsg.NewBatch()
+	for i := 0; i < 3; i++ {
+		_, _ = batch.Add(newActMsg(actBatched, []byte(strconv.Itoa(i))))
+	}
+	if err := cli.SendMsg(batch.Msg()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case v := <-got:
+			if v != strconv.Itoa(i) {
+				t.Fatalf("expect %d, got %s", i, v)
+			}
+		case <-time.After(time.Second * 3):
+			t.Fatalf("timeout waiting %d", i)
+		}
+	}
+}
+
+func benchmarkServerSend(b *testing.B, opts ...ServerOption) {
+	ts := NewTcpServer("127.0.0.1:0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), opts...)
+	wg, err := ts.Start()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		wg.Wait()
+	}()
+
+	const perOp = 1000
+	var received int64
+	done := make(chan struct{}, 1)
+	cli := newTestClient(ts.listener.Addr().String())
+	cli.OnReceive(func(msg btmsg.IMsg) {
+		if atomic.AddInt64(&received, 1)%perOp == 0 {
+			done <- struct{}{}
+		}
+	})
+	if _, err = cli.Start(); err != nil {
+		b.Fatal(err)
+	}
+	defer func() {
+		cli.Close()
+		<-cli.Done()
+	}()
+	waitServerConns(b, ts, 1)
+	conn := ts.snapshotConns()[0]
+	body := []byte("tick")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < perOp; j++ {
+			conn.Send(newActMsg(actBatched, body))
+		}
+		<-done
+	}
+}
+
+// BenchmarkServerSend 每次给一个连接发1000条很小的消息，等客户端全部收到
+func BenchmarkServerSend(b *testing.B) {
+	b.Run("unbatched", func(b *testing.B) {
+		benchmarkServerSend(b)
+	})
+	b.Run("batched", func(b *testing.B) {
+		benchmarkServerSend(b, WithAutoBatch(time.Millisecond, 128))
+	})
+}
@@ -0,0 +1,64 @@
+package mytcp
+
+import (
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// bindRetryMaxInterval 重试间隔翻倍的上限
+const bindRetryMaxInterval = time.Second * 10
+
+type serverBindRetry struct {
+	attempts int
+	interval time.Duration
+}
+
+// WithBindRetry 端口还被占用(EADDRINUSE)时最多尝试attempts次，间隔从interval开始每次翻倍
+// 滚动重启时旧进程可能还没释放端口，权限不足、地址错误这些不会重试
+func WithBindRetry(attempts int, interval time.Duration) ServerOption {
+	return func(l *tcpServer) {
+		if interval <= 0 {
+			interval = time.Second
+		}
+		l.bindRetry = serverBindRetry{attempts: attempts, interval: interval}
+	}
+}
+
+// WithServerLogger server的日志，比如 WithBindRetry 每次重试，默认是zerolog的全局logger
+func WithServerLogger(logger Logger) ServerOption {
+	return func(l *tcpServer) {
+		l.logger = logger
+	}
+}
+
+// listenRetry 返回的错误包装最后一次的错误，带上尝试的次数，Shutdown时停止重试
+func (l *tcpServer) listenRetry() error {
+	interval := l.bindRetry.interval
+	for attempt := 1; ; attempt++ {
+		ln, err := l.listenOnce()
+		if err == nil {
+			l.listener = ln
+			return nil
+		}
+
+		if !errors.Is(err, syscall.EADDRINUSE) || attempt >= l.bindRetry.attempts {
+			return errors.Wrapf(err, "listen %s failed after %d attempts", l.addr, attempt)
+		}
+
+		l.logger.Printf("listen %s attempt %d/%d: %v, retry in %s", l.addr, attempt, l.bindRetry.attempts, err, interval)
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+		case <-l.ctx.Done():
+			timer.Stop()
+			return errors.Wrapf(err, "listen %s stopped after %d attempts", l.addr, attempt)
+		}
+
+		interval *= 2
+		if interval > bindRetryMaxInterval {
+			interval = bindRetryMaxInterval
+		}
+	}
+}
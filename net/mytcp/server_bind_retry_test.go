@@ -0,0 +1,71 @@
+package mytcp
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/winkb/tcp1/btmsg"
+)
+
+// occupyPort 占用一个端口，返回端口号
+func occupyPort(t *testing.T) (net.Listener, string) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ln, strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+}
+
+func TestBindRetry(t *testing.T) {
+	verifyNoLeaks(t)
+
+	old, port := occupyPort(t)
+	time.AfterFunc(time.Millisecond*50, func() {
+		_ = old.Close()
+	})
+
+	logger := &lineLogger{}
+	ts := NewTcpServer(port, btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), WithBindRetry(10, time.Millisecond*20), WithServerLogger(logger))
+	wg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Shutdown()
+	wg.Wait()
+
+	lines := logger.take()
+	if len(lines) == 0 || !strings.Contains(lines[0], "attempt 1/10") {
+		t.Fatalf("log %v", lines)
+	}
+}
+
+func TestBindRetryGiveUp(t *testing.T) {
+	old, port := occupyPort(t)
+	defer old.Close()
+
+	logger := &lineLogger{}
+	ts := NewTcpServer(port, btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), WithBindRetry(3, time.Millisecond), WithServerLogger(logger))
+	_, err := ts.Start()
+	if !errors.Is(err, syscall.EADDRINUSE) || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Fatalf("got %v", err)
+	}
+	if n := len(logger.take()); n != 2 {
+		t.Fatalf("expect 2 retry logs, got %d", n)
+	}
+
+	// 地址错误不重试
+	ts = NewTcpServer("99999", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), WithBindRetry(3, time.Second), WithServerLogger(logger))
+	start := time.Now()
+	_, err = ts.Start()
+	if err == nil || !strings.Contains(err.Error(), "after 1 attempts") || time.Since(start) > time.Millisecond*500 {
+		t.Fatalf("got %v", err)
+	}
+	if n := len(logger.take()); n != 0 {
+		t.Fatalf("expect no retry logs, got %d", n)
+	}
+}
@@ -0,0 +1,230 @@
+package mytcp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+	. "github.com/winkb/tcp1/util"
+)
+
+// broadcastQueueSize 每个worker排队的广播数，满了之后BroadcastAsync阻塞
+const broadcastQueueSize = 16
+
+// WithBroadcastWorkers Broadcast分给n个协程并发投递，连接很多时减少一次广播的耗时
+// 每个连接按id固定由一个协程投递，同一个连接收到广播的顺序和调用Broadcast的顺序一致
+func WithBroadcastWorkers(n int) ServerOption {
+	return func(l *tcpServer) {
+		if n > 0 {
+			l.broadcast = &broadcastWorkers{n: n}
+		}
+	}
+}
+
+// WithBroadcastTimeout 广播时每个连接最多等待d，写得慢的连接跳过这次广播，不拖慢其他连接
+func WithBroadcastTimeout(d time.Duration) ServerOption {
+	return func(l *tcpServer) {
+		l.broadcastTimeout = d
+	}
+}
+
+type broadcastJob struct {
+	msg   btmsg.IMsg
+	conns []*contracts.TcpConn
+	batch *broadcastBatch
+}
+
+// broadcastBatch 一次广播，所有worker完成之后关闭done
+type broadcastBatch struct {
+	pending int32
+	done    chan struct{}
+}
+
+func (l *broadcastBatch) finish() {
+	if atomic.AddInt32(&l.pending, -1) == 0 {
+		close(l.done)
+	}
+}
+
+type broadcastWorkers struct {
+	n    int
+	jobs []chan broadcastJob
+	// lock 一次广播的所有分片进入队列之后才轮到下一次，worker退出时也要拿到它
+	lock   sync.Mutex
+	closed bool
+}
+
+func (l *tcpServer) startBroadcastWorkers(wg *sync.WaitGroup) {
+	if l.broadcast == nil {
+		return
+	}
+
+	bw := l.broadcast
+	bw.lock.Lock()
+	defer bw.lock.Unlock()
+
+	// Restart时重新启动
+	bw.closed = false
+	bw.jobs = make([]chan broadcastJob, bw.n)
+	for i := range bw.jobs {
+		jobs := make(chan broadcastJob, broadcastQueueSize)
+		bw.jobs[i] = jobs
+
+		MyGoWgCtx(l.ctx, wg, fmt.Sprintf("broadcast_%d", i), func(ctx context.Context) {
+			defer l.stopBroadcastWorker(jobs)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-jobs:
+					for _, conn := range job.conns {
+						l.enqueue(ctx, conn, job.msg)
+					}
+					job.batch.finish()
+				}
+			}
+		})
+	}
+}
+
+// stopBroadcastWorker Shutdown之后还在排队的广播直接完成，等待done的调用方不会一直阻塞
+func (l *tcpServer) stopBroadcastWorker(jobs chan broadcastJob) {
+	bw := l.broadcast
+	bw.lock.Lock()
+	defer bw.lock.Unlock()
+
+	bw.closed = true
+	for {
+		select {
+		case job := <-jobs:
+			job.batch.finish()
+		default:
+			return
+		}
+	}
+}
+
+// snapshotConns 调用时的所有连接，之后新建立的连接收不到这次广播
+func (l *tcpServer) snapshotConns() []*contracts.TcpConn {
+	var res []*contracts.TcpConn
+	l.conns.Range(func(key, value any) bool {
+		v, ok := value.(*contracts.TcpConn)
+		if ok {
+			res = append(res, v)
+		}
+		return true
+	})
+	return res
+}
+
+// enqueue 和Send一样交给连接的写协程，连接关闭、server停止或者超过 WithBroadcastTimeout 时不再等待
+func (l *tcpServer) enqueue(ctx context.Context, conn *contracts.TcpConn, v btmsg.IMsg) {
+	conn.Lock.RLock()
+	closed := conn.IsClose
+	conn.Lock.RUnlock()
+	if closed {
+		return
+	}
+
+	var timeout <-chan time.Time
+	if l.broadcastTimeout > 0 {
+		timer := time.NewTimer(l.broadcastTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	if err := conn.Reserve(v); err != nil {
+		return
+	}
+
+	// 写完之后在writeSend里Release
+	v.Retain()
+	select {
+	case conn.Input <- v:
+		return
+	case <-conn.WaitConn:
+	case <-ctx.Done():
+	case <-timeout:
+		log.Err(errors.Wrapf(contracts.ErrSendTimeout, "conn %d broadcast %s", conn.Id, btmsg.ActName(v.GetAct())))
+	}
+	conn.Unreserve(v)
+	v.Release()
+}
+
+// Broadcast 发送的是调用时bt的拷贝，之后修改bt不影响广播出去的内容
+// 所有连接共用这一个拷贝，写入之前已经编码过一次，并发写入时不会再修改它
+// 返回时已经交给了调用时的所有连接
+func (l *tcpServer) Broadcast(bt btmsg.IMsg) {
+	<-l.BroadcastAsync(bt)
+}
+
+// BroadcastAsync 和Broadcast一样，没有设置 WithBroadcastWorkers 时在返回之前完成
+// 设置了时交给worker之后返回，全部交给连接之后关闭返回的channel，不需要等待时可以忽略它
+// 设置了 WithRelay 时同时转发给其他实例，返回的channel不等待它们
+func (l *tcpServer) BroadcastAsync(bt btmsg.IMsg) <-chan struct{} {
+	done := l.broadcastLocal(bt)
+	l.publish(RelayTopicBroadcast, bt)
+	return done
+}
+
+// broadcastLocal 只发给本实例的连接
+func (l *tcpServer) broadcastLocal(bt btmsg.IMsg) <-chan struct{} {
+	bt = bt.Clone()
+	bt.ToSendByte()
+	conns := l.snapshotConns()
+
+	batch := &broadcastBatch{done: make(chan struct{})}
+	if !l.broadcastAsync(bt, conns, batch) {
+		for _, v := range conns {
+			l.enqueue(l.ctx, v, bt)
+		}
+		close(batch.done)
+	}
+
+	return batch.done
+}
+
+// broadcastAsync 分给worker，没有设置worker或者还没有Serve时返回false
+func (l *tcpServer) broadcastAsync(bt btmsg.IMsg, conns []*contracts.TcpConn, batch *broadcastBatch) bool {
+	bw := l.broadcast
+	if bw == nil {
+		return false
+	}
+
+	parts := make([][]*contracts.TcpConn, bw.n)
+	for _, v := range conns {
+		i := v.Id % uint64(bw.n)
+		parts[i] = append(parts[i], v)
+	}
+
+	// 先算好数量，避免前面的worker完成时提前关闭done
+	batch.pending = int32(bw.n)
+
+	bw.lock.Lock()
+	defer bw.lock.Unlock()
+
+	if bw.jobs == nil {
+		return false
+	}
+
+	for i, part := range parts {
+		if len(part) == 0 || bw.closed {
+			batch.finish()
+			continue
+		}
+
+		select {
+		case bw.jobs[i] <- broadcastJob{msg: bt, conns: part, batch: batch}:
+		case <-l.ctx.Done():
+			batch.finish()
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,248 @@
+package mytcp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// fakeConns 往server里放n个连接，Input由单独的协程消费，记录收到的act
+type fakeConns struct {
+	conns []*contracts.TcpConn
+	acts  [][]uint16
+	wg    sync.WaitGroup
+	pipes []net.Conn
+}
+
+func addFakeConns(ts *tcpServer, n int, record bool) *fakeConns {
+	fc := &fakeConns{acts: make([][]uint16, n)}
+	for i := 0; i < n; i++ {
+		a, b := net.Pipe()
+		fc.pipes = append(fc.pipes, b)
+		conn := &contracts.TcpConn{
+			Conn:     &wrapConn{Conn: a},
+			Id:       ts.getConnAutoIncId(),
+			Input:    make(chan btmsg.IMsg),
+			WaitConn: make(chan bool),
+		}
+		fc.conns = append(fc.conns, conn)
+		ts.saveConn(conn.Id, conn)
+
+		fc.wg.Add(1)
+		go func(i int) {
+			defer fc.wg.Done()
+			for {
+				select {
+				case msg := <-conn.Input:
+					if record {
+						fc.acts[i] = append(fc.acts[i], msg.GetAct())
+					}
+					msg.Release()
+				case <-conn.WaitConn:
+					return
+				}
+			}
+		}(i)
+	}
+	return fc
+}
+
+func (l *fakeConns) close() {
+	for _, v := range l.conns {
+		closeWait(v)
+	}
+	l.wg.Wait()
+	for _, v := range l.pipes {
+		_ = v.Close()
+	}
+}
+
+func startBroadcastServer(t testing.TB, opts ...ServerOption) (*tcpServer, func()) {
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), opts...)
+	wg, err := ts.Serve(NewPipeListener())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts, func() {
+		ts.Shutdown()
+		wg.Wait()
+	}
+}
+
+// TestBroadcastWorkersOrder 连续的异步广播，每个连接收到的顺序和调用顺序一致
+func TestBroadcastWorkersOrder(t *testing.T) {
+	verifyNoLeaks(t)
+	ts, stop := startBroadcastServer(t, WithBroadcastWorkers(4))
+	defer stop()
+
+	fc := addFakeConns(ts, 50, true)
+	var last <-chan struct{}
+	for i := 0; i < 200; i++ {
+		msg := btmsg.NewMsg(btmsg.NewMsgHeadTcpSeq(), nil)
+		msg.SetAct(uint16(i))
+		last = ts.BroadcastAsync(msg)
+	}
+
+	select {
+	case <-last:
+	case <-time.After(time.Second * 5):
+		t.Fatal("broadcast not done")
+	}
+	// 最后一次完成时每个连接都已经收到了之前的所有广播
+	fc.close()
+
+	for i, acts := range fc.acts {
+		if len(acts) != 200 {
+			t.Fatalf("conn %d got %d msgs", i, len(acts))
+		}
+		for j, act := range acts {
+			if act != uint16(j) {
+				t.Fatalf("conn %d msg %d act %d", i, j, act)
+			}
+		}
+	}
+}
+
+// TestBroadcastWorkersShutdown 连接不再消费时Shutdown，等待中的广播也会完成
+func TestBroadcastWorkersShutdown(t *testing.T) {
+	verifyNoLeaks(t)
+	ts, stop := startBroadcastServer(t, WithBroadcastWorkers(2))
+
+	var conns []*contracts.TcpConn
+	for i := 0; i < 4; i++ {
+		a, b := net.Pipe()
+		defer b.Close()
+		conn := &contracts.TcpConn{
+			Conn:     &wrapConn{Conn: a},
+			Id:       ts.getConnAutoIncId(),
+			Input:    make(chan btmsg.IMsg),
+			WaitConn: make(chan bool),
+		}
+		conns = append(conns, conn)
+		ts.saveConn(conn.Id, conn)
+	}
+
+	var dones []<-chan struct{}
+	// 不超过队列长度，BroadcastAsync不会阻塞
+	for i := 0; i < broadcastQueueSize; i++ {
+		dones = append(dones, ts.BroadcastAsync(btmsg.NewMsg(btmsg.NewMsgHeadTcpSeq(), nil)))
+	}
+
+	stop()
+	for _, done := range dones {
+		select {
+		case <-done:
+		case <-time.After(time.Second * 3):
+			t.Fatal("broadcast blocked after shutdown")
+		}
+	}
+}
+
+func BenchmarkBroadcast(b *testing.B) {
+	for _, n := range []int{10000, 50000} {
+		for _, workers := range []int{0, 8} {
+			b.Run(fmt.Sprintf("conns=%d/workers=%d", n, workers), func(b *testing.B) {
+				var opts []ServerOption
+				if workers > 0 {
+					opts = append(opts, WithBroadcastWorkers(workers))
+				}
+				ts, stop := startBroadcastServer(b, opts...)
+				fc := addFakeConns(ts, n, false)
+				msg := btmsg.NewMsg(btmsg.NewMsgHeadTcpSeq(), []byte("tick"))
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					ts.Broadcast(msg)
+				}
+				b.StopTimer()
+
+				fc.close()
+				stop()
+			})
+		}
+	}
+}
+
+// stuckConn Input没有人消费的连接
+func stuckConn(t *testing.T, ts *tcpServer) *contracts.TcpConn {
+	a, b := net.Pipe()
+	t.Cleanup(func() {
+		_ = b.Close()
+	})
+	conn := &contracts.TcpConn{
+		Conn:     &wrapConn{Conn: a},
+		Id:       ts.getConnAutoIncId(),
+		Input:    make(chan btmsg.IMsg),
+		WaitConn: make(chan bool),
+	}
+	ts.saveConn(conn.Id, conn)
+	return conn
+}
+
+func TestSendWithTimeout(t *testing.T) {
+	verifyNoLeaks(t)
+	ts, stop := startBroadcastServer(t)
+	defer stop()
+
+	conn := stuckConn(t, ts)
+	start := time.Now()
+	err := ts.SendWithTimeout(conn, newActMsg(1, nil), time.Millisecond*30)
+	if !errors.Is(err, contracts.ErrSendTimeout) || time.Since(start) < time.Millisecond*30 {
+		t.Fatalf("got %v after %v", err, time.Since(start))
+	}
+	if err = conn.SendWithTimeout(newActMsg(1, nil), 0); !errors.Is(err, contracts.ErrSendTimeout) {
+		t.Fatalf("got %v", err)
+	}
+
+	fc := addFakeConns(ts, 1, true)
+	if err = ts.SendWithTimeout(fc.conns[0], newActMsg(2, nil), time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	closeWait(conn)
+	if err = conn.SendWithTimeout(newActMsg(1, nil), time.Second); !errors.Is(err, ErrConnClosed) {
+		t.Fatalf("got %v", err)
+	}
+	fc.close()
+	if len(fc.acts[0]) != 1 || fc.acts[0][0] != 2 {
+		t.Fatalf("acts %v", fc.acts[0])
+	}
+
+	stop()
+	if err = ts.SendWithTimeout(conn, newActMsg(1, nil), time.Second); !errors.Is(err, ErrConnClosed) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+// TestBroadcastTimeout 卡住的连接不影响其他连接收到广播
+func TestBroadcastTimeout(t *testing.T) {
+	verifyNoLeaks(t)
+	for _, opts := range [][]ServerOption{nil, {WithBroadcastWorkers(2)}} {
+		ts, stop := startBroadcastServer(t, append(opts, WithBroadcastTimeout(time.Millisecond*20))...)
+		stuck := stuckConn(t, ts)
+		fc := addFakeConns(ts, 3, true)
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			ts.Broadcast(newActMsg(uint16(i+1), nil))
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Fatalf("broadcast took %v", d)
+		}
+
+		closeWait(stuck)
+		fc.close()
+		for i, acts := range fc.acts {
+			if fmt.Sprint(acts) != "[1 2 3]" {
+				t.Fatalf("conn %d acts %v", i, acts)
+			}
+		}
+		stop()
+	}
+}
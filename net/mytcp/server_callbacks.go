@@ -0,0 +1,32 @@
+package mytcp
+
+import (
+	"github.com/winkb/tcp1/contracts"
+)
+
+// serverCallbacks OnReceive、OnReceiveCtx、OnClose、OnCloseReason 设置的回调，每次设置整体替换
+// 读的时候不用加锁，Start之后再设置也没有数据竞争，之后收到的消息马上用新的回调
+type serverCallbacks struct {
+	receive contracts.ServerReceiveCallback
+	// receiveCtx OnReceiveCtx设置，和receive只有一个有效
+	receiveCtx contracts.ServerReceiveCtxCallback
+	// close OnClose 设置的回调也转成了 ServerCloseReasonCallback
+	close contracts.ServerCloseReasonCallback
+}
+
+func (l *tcpServer) loadCallbacks() *serverCallbacks {
+	return l.callbacks.Load()
+}
+
+// setCallbacks 复制一份修改之后替换
+func (l *tcpServer) setCallbacks(f func(cb *serverCallbacks)) {
+	l.callbackLock.Lock()
+	defer l.callbackLock.Unlock()
+
+	var cb serverCallbacks
+	if old := l.callbacks.Load(); old != nil {
+		cb = *old
+	}
+	f(&cb)
+	l.callbacks.Store(&cb)
+}
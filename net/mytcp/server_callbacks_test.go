@@ -0,0 +1,70 @@
+package mytcp
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// TestCallbacksAfterStart Start之后马上连接，同时注册回调，-race下不能有数据竞争，注册之后的消息用新的回调
+func TestCallbacksAfterStart(t *testing.T) {
+	verifyNoLeaks(t)
+
+	ln := NewPipeListener()
+	ts := NewTcpServer("pipe", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), WithServerTransport(ln))
+	wg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		wg.Wait()
+	}()
+
+	var received = make(chan struct{}, 1)
+	var closed = make(chan struct{}, 1)
+	var register sync.WaitGroup
+	register.Add(1)
+	go func() {
+		defer register.Done()
+		ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+			select {
+			case received <- struct{}{}:
+			default:
+			}
+		})
+		ts.OnClose(func(s contracts.ITcpServer, conn *contracts.TcpConn, isServer bool, isClient bool) {
+			closed <- struct{}{}
+		})
+	}()
+
+	cli := newTestClient("pipe", WithDialer(ln.Dial))
+	if _, err = cli.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 注册之前的消息交给默认回调，一直发到新的回调收到为止
+	var deadline = time.After(time.Second * 3)
+	for done := false; !done; {
+		_ = cli.SendStruct(1, echoReq{})
+		select {
+		case <-received:
+			done = true
+		case <-time.After(time.Millisecond * 5):
+		case <-deadline:
+			t.Fatal("callback not called")
+		}
+	}
+	register.Wait()
+
+	_ = cli.Close()
+	<-cli.Done()
+	select {
+	case <-closed:
+	case <-time.After(time.Second * 3):
+		t.Fatal("close callback not called")
+	}
+}
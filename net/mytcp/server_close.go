@@ -0,0 +1,86 @@
+package mytcp
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// defaultCloseTimeout Close等待排队的消息写完的时间
+const defaultCloseTimeout = time.Second * 5
+
+// Close 实现 io.Closer，不再接受新连接，等已经Send的消息写完，最多等 defaultCloseTimeout 或者 StartContext 的ctx的deadline，
+// 之后Shutdown并等待所有协程退出，超时返回的错误里带有没写出去的消息数量
+// 可以重复调用，之后的调用返回第一次的结果，Start之前调用不会panic，不能在server的回调里调用
+// 以前的 Close(conn) 改名为 CloseConn，方法名被 io.Closer 占用，没法保留转发的旧方法，调用的地方要改成 CloseConn
+func (l *tcpServer) Close() error {
+	l.closeOnce.Do(func() {
+		l.closeErr = l.closeGraceful(l.closeTimeout())
+	})
+	return l.closeErr
+}
+
+func (l *tcpServer) closeGraceful(timeout time.Duration) error {
+	// 写消息时持有读锁，这里用写锁会等到写超时
+	l.lock.RLock()
+	ln, wg, ctx := l.listener, l.wg, l.ctx
+	l.lock.RUnlock()
+
+	if ln == nil {
+		// 还没有Start，之后只能Restart
+		l.lock.Lock()
+		if l.stop == 0 {
+			l.stop = 2
+			l.cancel()
+		}
+		l.lock.Unlock()
+		return nil
+	}
+
+	// 已经Shutdown时ln已经关闭，ctx也已经结束
+	_ = ln.Close()
+	dropped := l.waitQueued(ctx, timeout)
+	if dropped > 0 {
+		// 先关闭连接让阻塞的写返回，Shutdown才能拿到写锁
+		l.conns.Range(func(key, value any) bool {
+			l.closeWithReason(value.(*contracts.TcpConn), contracts.CloseShutdown)
+			return true
+		})
+	}
+
+	l.Shutdown()
+	wg.Wait()
+
+	if dropped > 0 {
+		return errors.Errorf("close: %d msgs dropped", dropped)
+	}
+	return nil
+}
+
+// waitQueued 等所有连接排队的消息写完，返回超时时还没写的数量
+func (l *tcpServer) waitQueued(ctx context.Context, timeout time.Duration) int64 {
+	var deadline = time.Now().Add(timeout)
+	var ticker = time.NewTicker(time.Millisecond * 5)
+	defer ticker.Stop()
+
+	for {
+		var queued int64
+		l.conns.Range(func(key, value any) bool {
+			queued += atomic.LoadInt64(&value.(*contracts.TcpConn).Queued)
+			return true
+		})
+		if queued <= 0 || time.Now().After(deadline) {
+			return queued
+		}
+
+		select {
+		case <-ctx.Done():
+			// 被Shutdown了，连接都已经关闭
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package mytcp
+
+import (
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// closeWithReason 所有服务端关闭连接的地方都从这里走，先记录的原因有效，可以重复调用
+// 关闭之后读协程退出，由 LoopRead 调用一次关闭的回调
+func (l *tcpServer) closeWithReason(conn *contracts.TcpConn, reason contracts.CloseReason) {
+	conn.SetCloseReason(reason)
+	_ = conn.Conn.Close()
+}
+
+// closeAfterWriteErr 写了一半的帧没法接着写，关闭连接
+// 写的时候对端已经断开不算写出错，pipe两边关闭都是 io.ErrClosedPipe，自己关闭的已经记录过原因
+func (l *tcpServer) closeAfterWriteErr(conn *contracts.TcpConn, err error) {
+	reason := contracts.CloseWriteError
+	if isPeerClosed(err) || errors.Is(err, io.ErrClosedPipe) {
+		reason = contracts.ClosePeerClosed
+	}
+	l.closeWithReason(conn, reason)
+}
+
+// readCloseReason LoopRead 退出时调用，err为nil表示Shutdown取消了ctx
+// 已经记录过原因时以记录的为准，否则按读到的错误判断
+func readCloseReason(conn *contracts.TcpConn, err error) contracts.CloseReason {
+	switch {
+	case err == nil:
+		conn.SetCloseReason(contracts.CloseShutdown)
+	case isPeerClosed(err):
+		conn.SetCloseReason(contracts.ClosePeerClosed)
+	case errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrClosedPipe):
+		conn.SetCloseReason(contracts.CloseServerClosed)
+	case isTimeout(err):
+		conn.SetCloseReason(contracts.CloseIdleTimeout)
+	default:
+		conn.SetCloseReason(contracts.CloseProtocolError)
+	}
+	return conn.CloseReason()
+}
+
+// isPeerClosed 对端关闭或者重置了连接
+func isPeerClosed(err error) bool {
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,237 @@
+package mytcp
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// reasonServer 记录每个连接关闭的回调，pipe上的连接由测试直接读写
+type reasonServer struct {
+	ts      *tcpServer
+	ln      *PipeListener
+	wg      *sync.WaitGroup
+	lock    sync.Mutex
+	reasons map[uint64][]contracts.CloseReason
+	closed  chan uint64
+}
+
+func startReasonServer(t *testing.T, r btmsg.IMsgReader, opts ...ServerOption) *reasonServer {
+	verifyNoLeaks(t)
+
+	if r == nil {
+		r = btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq())
+	}
+	rs := &reasonServer{
+		ln:      NewPipeListener(),
+		reasons: map[uint64][]contracts.CloseReason{},
+		closed:  make(chan uint64, 16),
+	}
+	rs.ts = NewTcpServer("0", r, append(opts, WithServerOnCloseReason(func(s contracts.ITcpServer, conn *contracts.TcpConn, reason contracts.CloseReason) {
+		rs.lock.Lock()
+		rs.reasons[conn.Id] = append(rs.reasons[conn.Id], reason)
+		rs.lock.Unlock()
+		rs.closed <- conn.Id
+	}))...)
+
+	wg, err := rs.ts.Serve(rs.ln)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.wg = wg
+	return rs
+}
+
+// dial 返回对端和服务端的连接
+func (l *reasonServer) dial(t *testing.T) (net.Conn, *contracts.TcpConn) {
+	t.Helper()
+
+	n := len(l.ts.snapshotConns())
+	peer, err := l.ln.Dial(context.Background(), "pipe", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = peer.Close()
+	})
+	waitServerConns(t, l.ts, n+1)
+
+	var last *contracts.TcpConn
+	for _, v := range l.ts.snapshotConns() {
+		if last == nil || v.Id > last.Id {
+			last = v
+		}
+	}
+	return peer, last
+}
+
+func (l *reasonServer) waitClosed(t *testing.T, id uint64) {
+	t.Helper()
+
+	select {
+	case got := <-l.closed:
+		if got != id {
+			t.Fatalf("expect conn %d closed, got %d", id, got)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatalf("conn %d close callback not called", id)
+	}
+}
+
+// stop Shutdown之后检查每个连接都只回调了一次
+func (l *reasonServer) stop(t *testing.T, expect map[uint64]contracts.CloseReason) {
+	t.Helper()
+
+	l.ts.Shutdown()
+	l.wg.Wait()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if len(l.reasons) != len(expect) {
+		t.Fatalf("expect %v, got %v", expect, l.reasons)
+	}
+	for id, reason := range expect {
+		got := l.reasons[id]
+		if len(got) != 1 || got[0] != reason {
+			t.Fatalf("conn %d: expect [%v], got %v", id, reason, got)
+		}
+	}
+}
+
+func TestCloseReasonPeerClosed(t *testing.T) {
+	rs := startReasonServer(t, nil)
+	peer, conn := rs.dial(t)
+
+	_ = peer.Close()
+	rs.waitClosed(t, conn.Id)
+	rs.stop(t, map[uint64]contracts.CloseReason{conn.Id: contracts.ClosePeerClosed})
+}
+
+func TestCloseReasonServerClosed(t *testing.T) {
+	rs := startReasonServer(t, nil)
+	_, conn := rs.dial(t)
+
+	rs.ts.CloseConn(conn)
+	rs.ts.CloseConn(conn)
+	rs.waitClosed(t, conn.Id)
+	rs.stop(t, map[uint64]contracts.CloseReason{conn.Id: contracts.CloseServerClosed})
+}
+
+func TestCloseReasonIdleTimeout(t *testing.T) {
+	rs := startReasonServer(t, nil, WithFirstMessageTimeout(time.Millisecond*50))
+	_, conn := rs.dial(t)
+
+	rs.waitClosed(t, conn.Id)
+	rs.stop(t, map[uint64]contracts.CloseReason{conn.Id: contracts.CloseIdleTimeout})
+}
+
+func TestCloseReasonKicked(t *testing.T) {
+	rs := startReasonServer(t, nil)
+	_, old := rs.dial(t)
+	_, conn := rs.dial(t)
+
+	if err := rs.ts.BindIdentity(old, "tom", KickOld); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.ts.BindIdentity(conn, "tom", KickOld); err != nil {
+		t.Fatal(err)
+	}
+	rs.waitClosed(t, old.Id)
+	rs.stop(t, map[uint64]contracts.CloseReason{
+		old.Id:  contracts.CloseKicked,
+		conn.Id: contracts.CloseShutdown,
+	})
+}
+
+// TestCloseReasonWriteError 对端一直不读，写超时之后关闭连接
+func TestCloseReasonWriteError(t *testing.T) {
+	rs := startReasonServer(t, nil, WithServerWriteTimeout(time.Millisecond*50))
+	_, conn := rs.dial(t)
+
+	rs.ts.Send(conn, newActMsg(1, []byte("never read")))
+	rs.waitClosed(t, conn.Id)
+	rs.stop(t, map[uint64]contracts.CloseReason{conn.Id: contracts.CloseWriteError})
+}
+
+func TestCloseReasonProtocolError(t *testing.T) {
+	rs := startReasonServer(t, btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq(), btmsg.WithMaxBodySize(8)))
+	peer, conn := rs.dial(t)
+
+	go func() {
+		_, _ = peer.Write(newActMsg(1, []byte("longer than 8 bytes")).ToSendByte())
+	}()
+	rs.waitClosed(t, conn.Id)
+	rs.stop(t, map[uint64]contracts.CloseReason{conn.Id: contracts.CloseProtocolError})
+}
+
+// TestCloseReasonShutdown Shutdown时没有断开的连接也回调一次，之后对端再断开不会再回调
+func TestCloseReasonShutdown(t *testing.T) {
+	rs := startReasonServer(t, nil)
+	peer, conn := rs.dial(t)
+	_, other := rs.dial(t)
+
+	rs.stop(t, map[uint64]contracts.CloseReason{
+		conn.Id:  contracts.CloseShutdown,
+		other.Id: contracts.CloseShutdown,
+	})
+	_ = peer.Close()
+	if conn.CloseReason() != contracts.CloseShutdown {
+		t.Fatalf("reason %v", conn.CloseReason())
+	}
+}
+
+// TestCloseReasonCompat OnClose 的两个参数由 CloseReason 得到
+func TestCloseReasonCompat(t *testing.T) {
+	verifyNoLeaks(t)
+
+	type flags struct{ isServer, isClient bool }
+	closed := make(chan flags, 1)
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()))
+	ts.OnClose(func(s contracts.ITcpServer, conn *contracts.TcpConn, isServer bool, isClient bool) {
+		closed <- flags{isServer, isClient}
+	})
+	ln := NewPipeListener()
+	wg, err := ts.Serve(ln)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		wg.Wait()
+	}()
+
+	peer, err := ln.Dial(context.Background(), "pipe", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitServerConns(t, ts, 1)
+	_ = peer.Close()
+	select {
+	case got := <-closed:
+		if got.isServer || !got.isClient {
+			t.Fatalf("flags %+v", got)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("close callback not called")
+	}
+
+	for reason, expect := range map[contracts.CloseReason]flags{
+		contracts.ClosePeerClosed:    {false, true},
+		contracts.CloseServerClosed:  {true, false},
+		contracts.CloseIdleTimeout:   {true, false},
+		contracts.CloseKicked:        {true, false},
+		contracts.CloseWriteError:    {true, true},
+		contracts.CloseProtocolError: {true, false},
+		contracts.CloseShutdown:      {true, false},
+	} {
+		isServer, isClient := reason.Flags()
+		if (flags{isServer, isClient}) != expect {
+			t.Fatalf("%v: expect %+v", reason, expect)
+		}
+	}
+}
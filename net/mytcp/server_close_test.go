@@ -0,0 +1,133 @@
+package mytcp
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+)
+
+func TestCloseBeforeStart(t *testing.T) {
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()))
+	if err := ts.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cli := newTestClient("127.0.0.1:1")
+	if err := cli.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCloseDrain Close之前Send的消息都能写出去，重复Close返回一样的结果
+func TestCloseDrain(t *testing.T) {
+	verifyNoLeaks(t)
+
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()))
+	ln := NewPipeListener()
+	if _, err := ts.Serve(ln); err != nil {
+		t.Fatal(err)
+	}
+
+	peer, err := ln.Dial(context.Background(), pipeNetwork, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	waitServerConns(t, ts, 1)
+	conn := ts.snapshotConns()[0]
+
+	var received = make(chan int, 1)
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		reader := btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq())
+		var count int
+		for reader.ReadMsg(NewWrapConn(peer)).GetErr() == nil {
+			count++
+		}
+		received <- count
+	}()
+
+	// peer还没有开始读，消息都在排队
+	const n = 20
+	var senders sync.WaitGroup
+	for i := 0; i < n; i++ {
+		senders.Add(1)
+		go func() {
+			defer senders.Done()
+			conn.Send(newActMsg(2, []byte("drain")))
+		}()
+	}
+	for atomic.LoadInt64(&conn.Queued) < n {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err = ts.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = ts.Close(); err != nil {
+		t.Fatal(err)
+	}
+	senders.Wait()
+	if v := <-received; v != n {
+		t.Fatalf("expect %d msgs, got %d", n, v)
+	}
+	if st := ts.Stats(); st.State != ServerStateStopped {
+		t.Fatalf("stats %+v", st)
+	}
+}
+
+// TestCloseRaceShutdown 同时Close和Shutdown，Close等到协程都退出才返回
+func TestCloseRaceShutdown(t *testing.T) {
+	verifyNoLeaks(t)
+
+	for i := 0; i < 10; i++ {
+		ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()))
+		ln := NewPipeListener()
+		wg, err := ts.Serve(ln)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cli := newTestClient("pipe", WithDialer(ln.Dial))
+		if _, err = cli.Start(); err != nil {
+			t.Fatal(err)
+		}
+		waitServerConns(t, ts, 1)
+
+		var done sync.WaitGroup
+		done.Add(2)
+		go func() {
+			defer done.Done()
+			ts.Shutdown()
+		}()
+		go func() {
+			defer done.Done()
+			if err := ts.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		done.Wait()
+
+		stopped := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(time.Second * 3):
+			t.Fatal("not stopped")
+		}
+		_ = cli.Close()
+		<-cli.Done()
+	}
+}
@@ -0,0 +1,80 @@
+package mytcp
+
+import (
+	"context"
+	"time"
+)
+
+// StartContext 和Start一样，ctx结束时和Close一样先等排队的消息写完再Shutdown，
+// ctx有deadline时最多等到deadline，没有时等 defaultCloseTimeout
+// 连接的协程和 OnReceiveCtx 的ctx都从ctx派生，能取到ctx里的值，要等Shutdown之后才结束
+// ctx结束之后调用Close可以等待停止完成并拿到结果，还在运行时返回 ErrServerRunning
+func (l *tcpServer) StartContext(ctx context.Context) error {
+	l.lock.Lock()
+	if l.stop == 0 && l.wg != nil {
+		l.lock.Unlock()
+		return ErrServerRunning
+	}
+	l.cancel()
+	l.ctx, l.cancel = context.WithCancel(detachedContext{parent: ctx})
+	l.startCtx = ctx
+	serverCtx := l.ctx
+	l.lock.Unlock()
+
+	_, err := l.Start()
+	if err != nil {
+		return err
+	}
+
+	// 不在wg里，closeGraceful要等wg
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = l.Close()
+		case <-serverCtx.Done():
+		}
+	}()
+	return nil
+}
+
+// stopped Shutdown之后关闭
+func (l *tcpServer) stopped() <-chan struct{} {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.ctx.Done()
+}
+
+// closeTimeout StartContext 的ctx有deadline时Close最多等到deadline
+func (l *tcpServer) closeTimeout() time.Duration {
+	l.lock.RLock()
+	ctx := l.startCtx
+	l.lock.RUnlock()
+
+	if ctx != nil {
+		if deadline, ok := ctx.Deadline(); ok {
+			return time.Until(deadline)
+		}
+	}
+	return defaultCloseTimeout
+}
+
+// detachedContext 只继承parent的值，不继承取消和deadline，go1.21之后可以用 context.WithoutCancel
+type detachedContext struct {
+	parent context.Context
+}
+
+func (l detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (l detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (l detachedContext) Err() error {
+	return nil
+}
+
+func (l detachedContext) Value(key any) any {
+	return l.parent.Value(key)
+}
@@ -0,0 +1,96 @@
+package mytcp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+type ctxKey struct{}
+
+// TestStartContext 回调的ctx能取到StartContext的值，ctx结束之后server停止
+func TestStartContext(t *testing.T) {
+	verifyNoLeaks(t)
+
+	ln := NewPipeListener()
+	ts := NewTcpServer("pipe", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), WithServerTransport(ln))
+	var values = make(chan any, 1)
+	ts.OnReceiveCtx(func(ctx context.Context, s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		values <- ctx.Value(ctxKey{})
+	})
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "root"))
+	if err := ts.StartContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ts.StartContext(ctx); !errors.Is(err, ErrServerRunning) {
+		t.Fatalf("expect running, got %v", err)
+	}
+
+	cli := newTestClient("pipe", WithDialer(ln.Dial))
+	if _, err := cli.Start(); err != nil {
+		t.Fatal(err)
+	}
+	_ = cli.SendStruct(1, echoReq{})
+	if v := <-values; v != "root" {
+		t.Fatalf("expect root, got %v", v)
+	}
+
+	cancel()
+	select {
+	case <-cli.Done():
+	case <-time.After(time.Second * 3):
+		t.Fatal("conn not closed")
+	}
+	if err := ts.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if st := ts.Stats(); st.State != ServerStateStopped {
+		t.Fatalf("stats %+v", st)
+	}
+}
+
+// TestStartContextDeadline ctx的deadline到了不再等排队的消息
+func TestStartContextDeadline(t *testing.T) {
+	verifyNoLeaks(t)
+
+	ln := NewPipeListener()
+	ts := NewTcpServer("pipe", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), WithServerTransport(ln))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	if err := ts.StartContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// peer不读，消息一直在排队
+	peer, err := ln.Dial(context.Background(), pipeNetwork, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	waitServerConns(t, ts, 1)
+	conn := ts.snapshotConns()[0]
+	for i := 0; i < 3; i++ {
+		go conn.Send(newActMsg(2, []byte("x")))
+	}
+	for atomic.LoadInt64(&conn.Queued) < 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	<-ctx.Done()
+	start := time.Now()
+	err = ts.Close()
+	if err == nil || !strings.Contains(err.Error(), "dropped") {
+		t.Fatalf("expect dropped, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("close took %v", d)
+	}
+}
@@ -0,0 +1,151 @@
+package mytcp
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// serverDedup 每个连接记住最近收到的seq，客户端超时重发的请求不再交给回调
+type serverDedup struct {
+	window int
+	// replayBytes 大于0时缓存回复，重复的请求直接发缓存的回复，超过这个大小的回复不缓存
+	replayBytes int
+
+	lock  sync.Mutex
+	conns map[uint64]*dedupWindow
+
+	duplicates uint64
+	replayed   uint64
+}
+
+// dedupWindow 环形记录最近window个seq，满了之后覆盖最旧的
+type dedupWindow struct {
+	lock    sync.Mutex
+	seqs    []uint32
+	next    int
+	entries map[uint32]*dedupEntry
+}
+
+type dedupEntry struct {
+	reply btmsg.IMsg
+}
+
+// WithDedup 每个连接记住最近window个请求的seq，seq相同的请求只交给回调一次，之后的直接丢弃
+// seq是0的消息不检查，连接断开之后记录清除，重连之后的重发不算重复
+func WithDedup(window int) ServerOption {
+	return func(l *tcpServer) {
+		l.dedup.window = window
+	}
+}
+
+// WithDedupReplay 配合 WithDedup，重复的请求发送第一次的回复，回复是第一个seq相同的消息
+// 每个连接最多缓存window个不超过maxReplyBytes的回复，还没有回复时重复的请求直接丢弃
+func WithDedupReplay(maxReplyBytes int) ServerOption {
+	return func(l *tcpServer) {
+		l.dedup.replayBytes = maxReplyBytes
+	}
+}
+
+func (l *serverDedup) enabled() bool {
+	return l.window > 0
+}
+
+// duplicate 读协程调用，seq已经在窗口里时返回缓存的回复，没有时记录下来
+func (l *serverDedup) duplicate(connId uint64, seq uint32) (dup bool, reply btmsg.IMsg) {
+	if !l.enabled() || seq == 0 {
+		return false, nil
+	}
+
+	w := l.get(connId, true)
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if e, ok := w.entries[seq]; ok {
+		atomic.AddUint64(&l.duplicates, 1)
+		if e.reply != nil {
+			atomic.AddUint64(&l.replayed, 1)
+			return true, e.reply.Clone()
+		}
+		return true, nil
+	}
+
+	if len(w.seqs) < l.window {
+		w.seqs = append(w.seqs, seq)
+	} else {
+		delete(w.entries, w.seqs[w.next])
+		w.seqs[w.next] = seq
+		w.next = (w.next + 1) % l.window
+	}
+	w.entries[seq] = &dedupEntry{}
+	return false, nil
+}
+
+// recordReply 写协程调用，窗口里的seq第一次发出的消息当成回复缓存
+func (l *serverDedup) recordReply(connId uint64, msg btmsg.IMsg, size int) {
+	if l.replayBytes <= 0 || msg.GetSeq() == 0 || btmsg.IsControlAct(msg.GetAct()) || size > l.replayBytes {
+		return
+	}
+
+	w := l.get(connId, false)
+	if w == nil {
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if e, ok := w.entries[msg.GetSeq()]; ok && e.reply == nil {
+		e.reply = msg.Clone()
+	}
+}
+
+func (l *serverDedup) get(connId uint64, create bool) *dedupWindow {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	w := l.conns[connId]
+	if w == nil && create {
+		if l.conns == nil {
+			l.conns = map[uint64]*dedupWindow{}
+		}
+		w = &dedupWindow{entries: map[uint32]*dedupEntry{}}
+		l.conns[connId] = w
+	}
+	return w
+}
+
+// removeConn 连接关闭时清除
+func (l *serverDedup) removeConn(connId uint64) {
+	if !l.enabled() {
+		return
+	}
+
+	l.lock.Lock()
+	delete(l.conns, connId)
+	l.lock.Unlock()
+}
+
+// reset Shutdown时清除所有连接的记录
+func (l *serverDedup) reset() {
+	l.lock.Lock()
+	l.conns = nil
+	l.lock.Unlock()
+}
+
+// dropDuplicate 重复的请求返回true，有缓存的回复时发给conn
+func (l *tcpServer) dropDuplicate(conn *contracts.TcpConn, msg btmsg.IMsg) bool {
+	dup, reply := l.dedup.duplicate(conn.Id, msg.GetSeq())
+	if !dup {
+		return false
+	}
+
+	if l.releaseMsg {
+		msg.Release()
+	}
+	if reply != nil {
+		l.Send(conn, reply)
+	}
+	return true
+}
@@ -0,0 +1,134 @@
+package mytcp
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+const actDedup uint16 = 40
+
+// startDedupServer 回调每次执行都回复执行的次数，重复执行时回复不一样
+func startDedupServer(t *testing.T, opts ...ServerOption) (ts *tcpServer, calls *int64, cli *tcpClient, got chan btmsg.IMsg) {
+	verifyNoLeaks(t)
+
+	calls = new(int64)
+	ts = NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), opts...)
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		n := atomic.AddInt64(calls, 1)
+		_ = conn.ReplyMsg(msg, strconv.FormatInt(n, 10))
+	})
+	ln := NewPipeListener()
+	wg, err := ts.Serve(ln)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got = make(chan btmsg.IMsg, 10)
+	cli = newTestClient("pipe", WithDialer(ln.Dial))
+	cli.OnReceive(func(msg btmsg.IMsg) {
+		got <- msg.Clone()
+	})
+	if _, err = cli.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cli.Close()
+		<-cli.Done()
+		ts.Shutdown()
+		wg.Wait()
+	})
+	return ts, calls, cli, got
+}
+
+func sendSeq(t *testing.T, cli *tcpClient, seq uint32) {
+	t.Helper()
+	msg := newActMsg(actDedup, []byte("req"))
+	msg.SetSeq(seq)
+	if err := cli.SendMsg(msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectReply(t *testing.T, got <-chan btmsg.IMsg) btmsg.IMsg {
+	t.Helper()
+	select {
+	case v := <-got:
+		return v
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout waiting reply")
+	}
+	return nil
+}
+
+func expectNoReply(t *testing.T, got <-chan btmsg.IMsg) {
+	t.Helper()
+	select {
+	case v := <-got:
+		t.Fatalf("unexpected reply seq %d %s", v.GetSeq(), v.BodyByte())
+	case <-time.After(time.Millisecond * 100):
+	}
+}
+
+// TestDedupReplay 同一个seq发两次，回调只执行一次，两次收到一样的回复
+func TestDedupReplay(t *testing.T) {
+	ts, calls, cli, got := startDedupServer(t, WithDedup(16), WithDedupReplay(1024))
+
+	sendSeq(t, cli, 7)
+	first := expectReply(t, got)
+	sendSeq(t, cli, 7)
+	second := expectReply(t, got)
+
+	if n := atomic.LoadInt64(calls); n != 1 {
+		t.Fatalf("handler ran %d times", n)
+	}
+	if first.GetSeq() != 7 || second.GetSeq() != first.GetSeq() || string(second.BodyByte()) != string(first.BodyByte()) {
+		t.Fatalf("replies differ: %d %s, %d %s", first.GetSeq(), first.BodyByte(), second.GetSeq(), second.BodyByte())
+	}
+	if st := ts.Stats(); st.DuplicateMsgs != 1 || st.ReplayedReplies != 1 {
+		t.Fatalf("stats %+v", st)
+	}
+}
+
+// TestDedupDrop 没有 WithDedupReplay 时重复的请求直接丢弃，seq是0的不检查
+func TestDedupDrop(t *testing.T) {
+	ts, calls, cli, got := startDedupServer(t, WithDedup(16))
+
+	sendSeq(t, cli, 7)
+	expectReply(t, got)
+	sendSeq(t, cli, 7)
+	expectNoReply(t, got)
+
+	sendSeq(t, cli, 0)
+	sendSeq(t, cli, 0)
+	expectReply(t, got)
+	expectReply(t, got)
+
+	if n := atomic.LoadInt64(calls); n != 3 {
+		t.Fatalf("handler ran %d times", n)
+	}
+	if st := ts.Stats(); st.DuplicateMsgs != 1 || st.ReplayedReplies != 0 {
+		t.Fatalf("stats %+v", st)
+	}
+}
+
+// TestDedupWindow 超过窗口大小之后最旧的seq不再记录，重发会再执行
+func TestDedupWindow(t *testing.T) {
+	_, calls, cli, got := startDedupServer(t, WithDedup(2))
+
+	for _, seq := range []uint32{1, 2, 3, 1, 3} {
+		sendSeq(t, cli, seq)
+	}
+	for i := 0; i < 4; i++ {
+		expectReply(t, got)
+	}
+	expectNoReply(t, got)
+
+	if n := atomic.LoadInt64(calls); n != 4 {
+		t.Fatalf("handler ran %d times", n)
+	}
+}
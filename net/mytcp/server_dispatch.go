@@ -0,0 +1,88 @@
+package mytcp
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+	. "github.com/winkb/tcp1/util"
+)
+
+// dispatchQueueSize 每个worker排队的消息数，满了之后对应连接的读取暂停
+const dispatchQueueSize = 64
+
+// WithDispatchWorkers OnReceive回调在n个共用的协程里执行，限制同时处理消息的数量
+// 和默认一样保证同一个连接的消息按收到的顺序串行处理：每个连接按id固定由一个协程处理，
+// 代价是同一个协程上的连接会互相等待，回调里不要长时间阻塞
+func WithDispatchWorkers(n int) ServerOption {
+	return func(l *tcpServer) {
+		if n > 0 {
+			l.dispatch = &dispatchWorkers{n: n}
+		}
+	}
+}
+
+type dispatchJob struct {
+	conn *contracts.TcpConn
+	msg  btmsg.IMsg
+}
+
+type dispatchWorkers struct {
+	n    int
+	jobs []chan dispatchJob
+}
+
+func (l *tcpServer) startDispatchWorkers(wg *sync.WaitGroup) {
+	if l.dispatch == nil {
+		return
+	}
+
+	dw := l.dispatch
+	dw.jobs = make([]chan dispatchJob, dw.n)
+	for i := range dw.jobs {
+		jobs := make(chan dispatchJob, dispatchQueueSize)
+		dw.jobs[i] = jobs
+
+		MyGoWgCtx(l.ctx, wg, fmt.Sprintf("dispatch_%d", i), func(ctx context.Context) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-jobs:
+					l.dispatchReceive(job.conn, job.msg)
+				}
+			}
+		})
+	}
+}
+
+// dispatchReceive 一个回调panic不能让共用这个协程的其他连接停止处理
+func (l *tcpServer) dispatchReceive(conn *contracts.TcpConn, msg btmsg.IMsg) {
+	defer l.recoverReceive(conn, msg)
+
+	l.handelReceive(conn, msg)
+}
+
+// recoverReceive 回调panic时记录日志，要直接defer调用
+func (l *tcpServer) recoverReceive(conn *contracts.TcpConn, msg btmsg.IMsg) {
+	if v := recover(); v != nil {
+		log.Err(errors.Errorf("conn %d receive %s panic: %v\n%s", conn.Id, btmsg.ActName(msg.GetAct()), v, debug.Stack()))
+	}
+}
+
+// dispatchTo 交给连接对应的worker，ctx取消时放弃
+func (l *tcpServer) dispatchTo(ctx context.Context, conn *contracts.TcpConn, msg btmsg.IMsg) {
+	jobs := l.dispatch.jobs[conn.Id%uint64(l.dispatch.n)]
+	select {
+	case jobs <- dispatchJob{conn: conn, msg: msg}:
+	case <-ctx.Done():
+		if l.releaseMsg {
+			msg.Release()
+		}
+	}
+}
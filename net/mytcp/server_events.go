@@ -0,0 +1,86 @@
+package mytcp
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultEventLogSize 没有设置 WithEventLog 时保留的事件数
+const defaultEventLogSize = 1000
+
+// ServerEvent 的Kind
+const (
+	EventConnect  = "connect"
+	EventClose    = "close"
+	EventError    = "error"
+	EventKick     = "kick"
+	EventBan      = "ban"
+	EventShutdown = "shutdown"
+)
+
+// ServerEvent 一条事件记录，见 RecentEvents
+type ServerEvent struct {
+	Time   time.Time
+	Kind   string
+	ConnId uint64 `json:",omitempty"`
+	Remote string `json:",omitempty"`
+	// Detail 关闭的原因、错误、被踢的身份、shutdown的阶段等
+	Detail string `json:",omitempty"`
+}
+
+// eventRing 固定大小的环，满了之后覆盖最旧的，size是0时不记录
+type eventRing struct {
+	size int
+	lock sync.Mutex
+	buf  []ServerEvent
+	next int
+}
+
+// WithEventLog 保留最近size个连接、关闭、错误、踢人、封禁和shutdown的事件，默认1000，<=0不记录
+// 不需要开启日志，出问题之后用 RecentEvents 或者 WithAdminConns 查看
+func WithEventLog(size int) ServerOption {
+	return func(l *tcpServer) {
+		l.events.size = size
+	}
+}
+
+func (l *eventRing) add(ev ServerEvent) {
+	if l.size <= 0 {
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if len(l.buf) < l.size {
+		l.buf = append(l.buf, ev)
+		return
+	}
+	l.buf[l.next] = ev
+	l.next = (l.next + 1) % l.size
+}
+
+// recent 最近n个，从旧到新，n<=0或者超过已有的数量时返回全部
+func (l *eventRing) recent(n int) []ServerEvent {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if n <= 0 || n > len(l.buf) {
+		n = len(l.buf)
+	}
+	var res = make([]ServerEvent, 0, n)
+	// 没有满时next是0，buf本身就是从旧到新
+	for i := len(l.buf) - n; i < len(l.buf); i++ {
+		res = append(res, l.buf[(l.next+i)%len(l.buf)])
+	}
+	return res
+}
+
+// RecentEvents 最近n个事件，从旧到新，n<=0时返回保留的全部
+func (l *tcpServer) RecentEvents(n int) []ServerEvent {
+	return l.events.recent(n)
+}
+
+func (l *tcpServer) event(kind string, connId uint64, remote string, detail string) {
+	l.events.add(ServerEvent{Time: time.Now(), Kind: kind, ConnId: connId, Remote: remote, Detail: detail})
+}
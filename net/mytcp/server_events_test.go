@@ -0,0 +1,95 @@
+package mytcp
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+)
+
+// TestEventRingEviction 超过容量之后丢弃最旧的，返回的顺序从旧到新
+func TestEventRingEviction(t *testing.T) {
+	ring := eventRing{size: 3}
+	if v := ring.recent(0); len(v) != 0 {
+		t.Fatalf("events %+v", v)
+	}
+
+	for i := 1; i <= 5; i++ {
+		ring.add(ServerEvent{Kind: EventConnect, ConnId: uint64(i)})
+		if i == 2 {
+			expectEventIds(t, ring.recent(0), 1, 2)
+		}
+	}
+	expectEventIds(t, ring.recent(0), 3, 4, 5)
+	expectEventIds(t, ring.recent(2), 4, 5)
+	expectEventIds(t, ring.recent(10), 3, 4, 5)
+
+	off := eventRing{}
+	off.add(ServerEvent{Kind: EventConnect})
+	if v := off.recent(0); len(v) != 0 {
+		t.Fatalf("events %+v", v)
+	}
+}
+
+func expectEventIds(t *testing.T, events []ServerEvent, ids ...uint64) {
+	t.Helper()
+	var got []string
+	for _, v := range events {
+		got = append(got, strconv.FormatUint(v.ConnId, 10))
+	}
+	if len(events) != len(ids) {
+		t.Fatalf("expect %v, got %v", ids, got)
+	}
+	for i, id := range ids {
+		if events[i].ConnId != id {
+			t.Fatalf("expect %v, got %v", ids, got)
+		}
+	}
+}
+
+// TestServerEvents 连接、关闭和shutdown都有记录
+func TestServerEvents(t *testing.T) {
+	verifyNoLeaks(t)
+
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), WithEventLog(100))
+	ln := NewPipeListener()
+	wg, err := ts.Serve(ln)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cli := newTestClient("pipe", WithDialer(ln.Dial))
+	if _, err = cli.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitServerConns(t, ts, 1)
+	cli.Close()
+	<-cli.Done()
+	waitServerConns(t, ts, 0)
+
+	ts.Shutdown()
+	wg.Wait()
+
+	var kinds []string
+	for _, v := range ts.RecentEvents(0) {
+		if v.Time.IsZero() || time.Since(v.Time) > time.Minute {
+			t.Fatalf("event %+v", v)
+		}
+		kinds = append(kinds, v.Kind)
+	}
+	expect := []string{EventConnect, EventClose, EventShutdown, EventShutdown}
+	if len(kinds) != len(expect) {
+		t.Fatalf("expect %v, got %v", expect, kinds)
+	}
+	for i := range expect {
+		if kinds[i] != expect[i] {
+			t.Fatalf("expect %v, got %v", expect, kinds)
+		}
+	}
+
+	events := ts.RecentEvents(0)
+	if events[0].ConnId != 1 || events[1].ConnId != 1 || events[1].Detail == "" || events[3].Detail != "done" {
+		t.Fatalf("events %+v", events)
+	}
+}
@@ -0,0 +1,73 @@
+package mytcp
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// ServerReceiveCallbackE 返回错误时自动回复，见 OnReceiveE
+type ServerReceiveCallbackE func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) error
+
+// serverHandleErrors OnReceiveE 的回调返回错误的次数
+type serverHandleErrors struct {
+	lock sync.Mutex
+	errs map[uint16]uint64
+}
+
+// OnReceiveE 和OnReceive一样，f返回错误时用相同的seq回复 btmsg.ActError，错误写到日志并计入 HandleErrors
+// 错误码见 HandleError，返回 ErrNoReply 时什么都不做
+func (l *tcpServer) OnReceiveE(f ServerReceiveCallbackE) {
+	l.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		err := f(s, conn, msg)
+		if err != nil {
+			l.handleReceiveError(conn, msg, err)
+		}
+	})
+}
+
+// HandleServerE 返回 OnReceiveE 的回调，req已经解码成*T，解码失败按 DefaultHandleErrorCode 回复
+func HandleServerE[T any](h func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg, req *T) error) ServerReceiveCallbackE {
+	return func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) error {
+		req, err := btmsg.ToStructT[T](msg)
+		if err != nil {
+			return errors.Wrap(err, "decode")
+		}
+		return h(s, conn, msg, req)
+	}
+}
+
+// HandleErrors 每个act的 OnReceiveE 回调返回错误的次数，不包括 ErrNoReply
+func (l *tcpServer) HandleErrors() map[uint16]uint64 {
+	l.handleErrs.lock.Lock()
+	defer l.handleErrs.lock.Unlock()
+
+	var res = make(map[uint16]uint64, len(l.handleErrs.errs))
+	for act, n := range l.handleErrs.errs {
+		res[act] = n
+	}
+	return res
+}
+
+func (l *tcpServer) handleReceiveError(conn *contracts.TcpConn, msg btmsg.IMsg, err error) {
+	if errors.Is(err, ErrNoReply) {
+		return
+	}
+
+	act := msg.GetAct()
+	l.handleErrs.lock.Lock()
+	if l.handleErrs.errs == nil {
+		l.handleErrs.errs = map[uint16]uint64{}
+	}
+	l.handleErrs.errs[act]++
+	l.handleErrs.lock.Unlock()
+
+	l.logger.Printf("conn %d handle act %s: %v", conn.Id, btmsg.ActName(act), err)
+
+	code, text := handleErrorReply(err)
+	if err = conn.ReplyError(msg, code, text); err != nil {
+		l.logger.Printf("conn %d error reply act %s: %v", conn.Id, btmsg.ActName(act), err)
+	}
+}
@@ -0,0 +1,82 @@
+package mytcp
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// TestServerOnReceiveE 回调返回错误时自动回复错误，ErrNoReply不回复
+func TestServerOnReceiveE(t *testing.T) {
+	verifyNoLeaks(t)
+
+	logger := &lineLogger{}
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), WithServerLogger(logger))
+	ts.OnReceiveE(HandleServerE(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg, req *callReq) error {
+		switch {
+		case req.N < 0:
+			return errors.Wrap(&HandleError{Code: 404, Text: "missing"}, "lookup")
+		case req.N == 0:
+			return errors.New("boom")
+		case req.N == 1:
+			return ErrNoReply
+		}
+		return conn.ReplyMsg(msg, &callRsp{N: req.N + 1})
+	}))
+	wg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		wg.Wait()
+	}()
+
+	cli := newTestClient(ts.listener.Addr().String())
+	if _, err = cli.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	call := func(n int) (callRsp, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+		defer cancel()
+
+		var rsp callRsp
+		err := cli.Call(ctx, 10, &callReq{N: n}, &rsp)
+		return rsp, err
+	}
+
+	for n, want := range map[int]uint16{-1: 404, 0: DefaultHandleErrorCode} {
+		_, err = call(n)
+		var replyErr *ReplyError
+		if !errors.As(err, &replyErr) || replyErr.Code() != want || replyErr.Act() != 10 {
+			t.Fatalf("call %d: expect code %d, got %v", n, want, err)
+		}
+	}
+	if _, err = call(1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect no reply, got %v", err)
+	}
+	if rsp, err := call(2); err != nil || rsp.N != 3 {
+		t.Fatalf("rsp %+v err %v", rsp, err)
+	}
+
+	// 解码失败也回复错误
+	var replyErr *ReplyError
+	if err = cli.Call(context.Background(), 10, "not a callReq", &callRsp{}); !errors.As(err, &replyErr) || replyErr.Code() != DefaultHandleErrorCode {
+		t.Fatalf("expect decode error reply, got %v", err)
+	}
+
+	if n := ts.HandleErrors()[10]; n != 3 {
+		t.Fatalf("handle errors %d", n)
+	}
+	lines := logger.take()
+	if len(lines) != 3 || !strings.Contains(lines[0], "handle act 10") {
+		t.Fatalf("log %v", lines)
+	}
+}
@@ -0,0 +1,201 @@
+package mytcp
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/winkb/tcp1/contracts"
+	. "github.com/winkb/tcp1/util"
+)
+
+const (
+	ServerStateIdle    = "idle"
+	ServerStateRunning = "running"
+	ServerStateStopped = "stopped"
+)
+
+// ServerStats /stats 和 WithStatusAct 返回的内容
+type ServerStats struct {
+	// State 还没有Serve是 ServerStateIdle，Shutdown之后是 ServerStateStopped
+	State string
+	// Uptime 最近一次Serve到现在的时间，没有运行时是0
+	Uptime time.Duration
+	// Conns 当前的连接数
+	Conns int
+	// TotalConns 启动以来接受的连接数
+	TotalConns    uint64
+	OversizedMsgs uint64
+	// FirstMessageTimeouts 因为 WithFirstMessageTimeout 关闭的连接数
+	FirstMessageTimeouts uint64
+	// BannedConns 因为 WithViolationBan 封禁被直接关闭的连接数
+	BannedConns uint64
+	// PendingBytes 所有连接已经Send还没有写入的字节数，只在设置了 WithMaxTotalPendingBytes 时记录
+	PendingBytes int64
+	// BackpressureRejected BackpressureClosed 超过 WithMaxTotalPendingBytes 之后拒绝的发送和关闭的连接数
+	BackpressureRejected uint64
+	BackpressureClosed   uint64
+	// DuplicateMsgs 因为 WithDedup 丢弃的重复请求，ReplayedReplies 是其中发送了缓存回复的
+	DuplicateMsgs   uint64
+	ReplayedReplies uint64
+	// ReceivedRate SentRate 所有连接加起来的速率，每个连接的见 TcpConn.Stats
+	ReceivedRate contracts.RateWindows
+	SentRate     contracts.RateWindows
+	// ReceivedSizes SentSizes 收发消息的大小分布，桶见 SizeBuckets
+	ReceivedSizes []uint64
+	SentSizes     []uint64
+	// Latency 没有开启 WithLatency 时为nil
+	Latency map[uint16]LatencyStats `json:",omitempty"`
+}
+
+type serverHealth struct {
+	addr   string
+	stats  bool
+	ln     net.Listener
+	server *http.Server
+}
+
+// WithHealthEndpoint Start时在addr上启动http服务，Shutdown时一起关闭，不设置时不会监听
+// /healthz Start成功之后返回200，/readyz 只有正在接受连接时返回200，Shutdown之后返回503
+func WithHealthEndpoint(addr string) ServerOption {
+	return func(l *tcpServer) {
+		if l.health == nil {
+			l.health = &serverHealth{}
+		}
+		l.health.addr = addr
+	}
+}
+
+// WithHealthStats 健康检查的http服务加上 /stats，返回 Stats 的json，需要同时设置 WithHealthEndpoint
+func WithHealthStats() ServerOption {
+	return func(l *tcpServer) {
+		if l.health == nil {
+			l.health = &serverHealth{}
+		}
+		l.health.stats = true
+	}
+}
+
+// Stats 只读原子计数，不遍历连接，可以频繁调用
+func (l *tcpServer) Stats() ServerStats {
+	now := time.Now()
+	var state = ServerStateIdle
+	var uptime time.Duration
+	l.lock.RLock()
+	switch {
+	case l.stop != 0:
+		state = ServerStateStopped
+	case l.wg != nil:
+		state = ServerStateRunning
+		uptime = now.Sub(l.startedAt)
+	}
+	l.lock.RUnlock()
+
+	var pending int64
+	var rejected, closed uint64
+	if bp := l.backpressure; bp != nil {
+		pending = bp.budget.Total()
+		rejected = bp.budget.Rejected()
+		closed = atomic.LoadUint64(&bp.closed)
+	}
+
+	return ServerStats{
+		State:                state,
+		Uptime:               uptime,
+		Conns:                int(atomic.LoadInt64(&l.connCount)),
+		TotalConns:           atomic.LoadUint64(&l.lastId),
+		OversizedMsgs:        l.OversizedMsgs(),
+		FirstMessageTimeouts: atomic.LoadUint64(&l.firstMsgTimeouts),
+		BannedConns:          atomic.LoadUint64(&l.bans.rejected),
+		PendingBytes:         pending,
+		BackpressureRejected: rejected,
+		BackpressureClosed:   closed,
+		DuplicateMsgs:        atomic.LoadUint64(&l.dedup.duplicates),
+		ReplayedReplies:      atomic.LoadUint64(&l.dedup.replayed),
+		ReceivedRate:         l.rates.received.Windows(now),
+		SentRate:             l.rates.sent.Windows(now),
+		ReceivedSizes:        l.sizes.received.snapshot(),
+		SentSizes:            l.sizes.sent.snapshot(),
+		Latency:              l.Latency(),
+	}
+}
+
+// HealthAddr 健康检查实际监听的地址，没有启动时为空
+func (l *tcpServer) HealthAddr() string {
+	if l.health == nil || l.health.ln == nil {
+		return ""
+	}
+	return l.health.ln.Addr().String()
+}
+
+// ready 已经Serve并且没有Shutdown
+func (l *tcpServer) ready() bool {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return l.wg != nil && l.stop == 0
+}
+
+func (l *tcpServer) healthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !l.ready() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	})
+	if l.health.stats {
+		mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(l.Stats())
+		})
+	}
+	return mux
+}
+
+// listenHealth 在accept之前监听，失败时Start返回错误
+func (l *tcpServer) listenHealth() error {
+	if l.health == nil || l.health.addr == "" {
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", l.health.addr)
+	if err != nil {
+		return errors.Wrap(err, "health listen:"+l.health.addr)
+	}
+
+	l.health.ln = ln
+	l.health.server = &http.Server{Handler: l.healthHandler()}
+	return nil
+}
+
+func (l *tcpServer) serveHealth(wg *sync.WaitGroup) {
+	if l.health == nil || l.health.server == nil {
+		return
+	}
+
+	MyGoWgCtx(l.ctx, wg, "health", func(ctx context.Context) {
+		err := l.health.server.Serve(l.health.ln)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Err(errors.Wrap(err, "health serve"))
+		}
+	})
+}
+
+func (l *tcpServer) closeHealth() {
+	if l.health == nil || l.health.server == nil {
+		return
+	}
+
+	_ = l.health.server.Close()
+}
@@ -0,0 +1,123 @@
+package mytcp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+func getStatus(t *testing.T, url string) int {
+	rsp, err := http.Get(url)
+	if err != nil {
+		return 0
+	}
+	_, _ = io.Copy(io.Discard, rsp.Body)
+	_ = rsp.Body.Close()
+	return rsp.StatusCode
+}
+
+func TestHealthEndpoint(t *testing.T) {
+	verifyNoLeaks(t)
+
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()),
+		WithHealthEndpoint("127.0.0.1:0"), WithHealthStats())
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		s.Send(conn, msg)
+	})
+	if ts.HealthAddr() != "" {
+		t.Fatal("health should not listen before Start")
+	}
+
+	wg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := "http://" + ts.HealthAddr()
+
+	if code := getStatus(t, base+"/healthz"); code != http.StatusOK {
+		t.Fatalf("healthz %d", code)
+	}
+	if code := getStatus(t, base+"/readyz"); code != http.StatusOK {
+		t.Fatalf("readyz %d", code)
+	}
+
+	cli := newTestClient(ts.listener.Addr().String())
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	err = cli.Call(context.Background(), 1, &callReq{N: 1}, &callRsp{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsp, err := http.Get(base + "/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st ServerStats
+	err = json.NewDecoder(rsp.Body).Decode(&st)
+	_ = rsp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Conns != 1 || st.TotalConns != 1 {
+		t.Fatalf("stats %+v", st)
+	}
+
+	ts.Shutdown()
+	wg.Wait()
+	if code := getStatus(t, base+"/readyz"); code != 0 {
+		t.Fatalf("health should be closed after Shutdown, got %d", code)
+	}
+}
+
+// TestHealthReadyz readyz只看是否在接受连接，Shutdown之后即使http还没有关闭也是503
+func TestHealthReadyz(t *testing.T) {
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), WithHealthStats())
+	h := ts.healthHandler()
+	code := func() int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return w.Code
+	}
+
+	if code() != http.StatusServiceUnavailable {
+		t.Fatal("expect 503 before Start")
+	}
+	wg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code() != http.StatusOK {
+		t.Fatal("expect 200 after Start")
+	}
+	ts.Shutdown()
+	wg.Wait()
+	if code() != http.StatusServiceUnavailable {
+		t.Fatal("expect 503 after Shutdown")
+	}
+}
+
+func TestHealthDisabled(t *testing.T) {
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()))
+	wg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		wg.Wait()
+	}()
+
+	if ts.HealthAddr() != "" {
+		t.Fatal("health should not start without WithHealthEndpoint")
+	}
+}
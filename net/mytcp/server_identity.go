@@ -0,0 +1,165 @@
+package mytcp
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// DuplicatePolicy 同一个身份已经有连接时，新的连接 BindIdentity 怎么处理
+type DuplicatePolicy int
+
+const (
+	// KickOld 关闭之前绑定这个身份的连接，设置了 WithIdentityKickMsg 时先发送它
+	KickOld DuplicatePolicy = iota
+	// RejectNew 返回 ErrIdentityBound，由handler决定怎么回复
+	RejectNew
+	// Allow 多个连接同时绑定同一个身份
+	Allow
+)
+
+// serverIdentities 身份和连接的对应关系，连接关闭时自动解绑
+type serverIdentities struct {
+	lock  sync.Mutex
+	conns map[string]map[uint64]*contracts.TcpConn
+	ids   map[uint64]string
+	kick  func(conn *contracts.TcpConn, id string) btmsg.IMsg
+}
+
+// WithIdentityKickMsg KickOld 关闭旧连接之前发给它的消息，比如"在别处登录"，返回nil不发送
+func WithIdentityKickMsg(f func(conn *contracts.TcpConn, id string) btmsg.IMsg) ServerOption {
+	return func(l *tcpServer) {
+		l.identities.kick = f
+	}
+}
+
+// BindIdentity 认证之后把conn绑定到身份id，一个连接只有一个身份，重新绑定时先解绑之前的
+// 同一个身份同时在多个连接上绑定时按policy处理，连接已经关闭返回 ErrConnClosed
+// 设置了 WithOfflineQueue 时返回之前把这个身份排队的消息交给conn
+func (l *tcpServer) BindIdentity(conn *contracts.TcpConn, id string, policy DuplicatePolicy) error {
+	kicked, err := l.identities.bind(conn, id, policy)
+	if err != nil {
+		return err
+	}
+
+	for _, old := range kicked {
+		l.kickConn(old, id)
+	}
+	l.offline.attach(id, conn)
+	return nil
+}
+
+// UnbindIdentity 解绑conn的身份，没有绑定时没有效果
+func (l *tcpServer) UnbindIdentity(conn *contracts.TcpConn) {
+	l.identities.unbind(conn.Id)
+}
+
+// IdentityConns 绑定到id的连接，没有时返回nil
+func (l *tcpServer) IdentityConns(id string) []*contracts.TcpConn {
+	l.identities.lock.Lock()
+	defer l.identities.lock.Unlock()
+
+	var res []*contracts.TcpConn
+	for _, conn := range l.identities.conns[id] {
+		res = append(res, conn)
+	}
+	return res
+}
+
+// ConnIdentity conn绑定的身份
+func (l *tcpServer) ConnIdentity(conn *contracts.TcpConn) (id string, ok bool) {
+	l.identities.lock.Lock()
+	defer l.identities.lock.Unlock()
+
+	id, ok = l.identities.ids[conn.Id]
+	return
+}
+
+// kickConn 同步写完kick消息再关闭，避免消息还在队列里连接就关了
+func (l *tcpServer) kickConn(conn *contracts.TcpConn, id string) {
+	l.event(EventKick, conn.Id, conn.Conn.RemoteAddr().String(), id)
+	if l.identities.kick != nil {
+		if msg := l.identities.kick(conn, id); msg != nil {
+			// writeMsg 会Release，和Send一样先Retain，不受 WithMaxTotalPendingBytes 限制
+			msg.Retain()
+			l.writeMsg(conn, msg)
+		}
+	}
+	l.closeConn(conn, contracts.CloseKicked)
+}
+
+// bind 在同一把锁里检查和修改，两个连接同时绑定同一个身份时按先后顺序处理
+// 连接关闭时先设置IsClose再解绑，所以这里看到没有关闭的连接，之后一定会被解绑
+func (l *serverIdentities) bind(conn *contracts.TcpConn, id string, policy DuplicatePolicy) (kicked []*contracts.TcpConn, err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	conn.Lock.RLock()
+	closed := conn.IsClose
+	conn.Lock.RUnlock()
+	if closed {
+		return nil, errors.Wrapf(ErrConnClosed, "bind identity %s", id)
+	}
+
+	if old, ok := l.ids[conn.Id]; ok {
+		if old == id {
+			return nil, nil
+		}
+		l.remove(conn.Id)
+	}
+
+	exist := l.conns[id]
+	switch policy {
+	case RejectNew:
+		if len(exist) > 0 {
+			return nil, errors.Wrapf(ErrIdentityBound, "identity %s", id)
+		}
+	case KickOld:
+		for cid, old := range exist {
+			kicked = append(kicked, old)
+			l.remove(cid)
+		}
+	}
+
+	if l.conns == nil {
+		l.conns = map[string]map[uint64]*contracts.TcpConn{}
+		l.ids = map[uint64]string{}
+	}
+	if l.conns[id] == nil {
+		l.conns[id] = map[uint64]*contracts.TcpConn{}
+	}
+	l.conns[id][conn.Id] = conn
+	l.ids[conn.Id] = id
+
+	return kicked, nil
+}
+
+func (l *serverIdentities) unbind(connId uint64) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.remove(connId)
+}
+
+func (l *serverIdentities) remove(connId uint64) {
+	id, ok := l.ids[connId]
+	if !ok {
+		return
+	}
+
+	delete(l.ids, connId)
+	delete(l.conns[id], connId)
+	if len(l.conns[id]) == 0 {
+		delete(l.conns, id)
+	}
+}
+
+func (l *serverIdentities) reset() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.conns = nil
+	l.ids = nil
+}
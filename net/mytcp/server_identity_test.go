@@ -0,0 +1,170 @@
+package mytcp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+const actKicked uint16 = 9
+
+// startIdentityServer act就是 DuplicatePolicy+1，body是身份
+func startIdentityServer(t *testing.T, opts ...ServerOption) (*tcpServer, func()) {
+	verifyNoLeaks(t)
+
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), opts...)
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		var req echoReq
+		_, _ = msg.ToStruct(&req)
+		err := ts.BindIdentity(conn, req.Msg, DuplicatePolicy(msg.GetAct()-1))
+		if err != nil {
+			_ = conn.ReplyError(msg, 1, err.Error())
+			return
+		}
+		_ = conn.ReplyMsg(msg, &req)
+	})
+	wg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ts, func() {
+		ts.Shutdown()
+		wg.Wait()
+	}
+}
+
+func loginClient(t *testing.T, ts *tcpServer, kicked chan<- struct{}) *tcpClient {
+	cli := newTestClient(ts.listener.Addr().String())
+	cli.OnReceive(func(msg btmsg.IMsg) {
+		if msg.GetAct() == actKicked && kicked != nil {
+			kicked <- struct{}{}
+		}
+	})
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cli
+}
+
+func waitIdentityConns(t *testing.T, ts *tcpServer, id string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second * 3)
+	for len(ts.IdentityConns(id)) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("identity %s expect %d conns, got %d", id, n, len(ts.IdentityConns(id)))
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+func TestBindIdentityKickOld(t *testing.T) {
+	ts, stop := startIdentityServer(t, WithIdentityKickMsg(func(conn *contracts.TcpConn, id string) btmsg.IMsg {
+		return newActMsg(actKicked, []byte(id))
+	}))
+	defer stop()
+
+	var kicked = make(chan struct{}, 1)
+	old := loginClient(t, ts, kicked)
+	defer old.Close()
+	err := old.Call(context.Background(), 1, &echoReq{Msg: "tom"}, &echoReq{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cli := loginClient(t, ts, nil)
+	defer cli.Close()
+	err = cli.Call(context.Background(), 1, &echoReq{Msg: "tom"}, &echoReq{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ch := range []<-chan struct{}{kicked, old.Done()} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second * 3):
+			t.Fatal("old conn not kicked")
+		}
+	}
+	conns := ts.IdentityConns("tom")
+	if len(conns) != 1 {
+		t.Fatalf("expect 1 conn, got %d", len(conns))
+	}
+	if id, ok := ts.ConnIdentity(conns[0]); !ok || id != "tom" {
+		t.Fatalf("identity %q %v", id, ok)
+	}
+}
+
+func TestBindIdentityRejectAndAllow(t *testing.T) {
+	ts, stop := startIdentityServer(t)
+	defer stop()
+
+	a, b := loginClient(t, ts, nil), loginClient(t, ts, nil)
+	defer b.Close()
+	for _, cli := range []*tcpClient{a, b} {
+		err := cli.Call(context.Background(), 3, &echoReq{Msg: "tom"}, &echoReq{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitIdentityConns(t, ts, "tom", 2)
+
+	c := loginClient(t, ts, nil)
+	defer c.Close()
+	err := c.Call(context.Background(), 2, &echoReq{Msg: "tom"}, &echoReq{})
+	var re *ReplyError
+	if !errors.As(err, &re) {
+		t.Fatalf("expect ReplyError, got %v", err)
+	}
+
+	// 关闭的连接自动解绑
+	a.Close()
+	waitIdentityConns(t, ts, "tom", 1)
+	b.Close()
+	waitIdentityConns(t, ts, "tom", 0)
+
+	err = c.Call(context.Background(), 2, &echoReq{Msg: "tom"}, &echoReq{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestBindIdentityConcurrent 同一个身份同时从很多连接绑定
+func TestBindIdentityConcurrent(t *testing.T) {
+	for _, policy := range []DuplicatePolicy{RejectNew, KickOld} {
+		var ids serverIdentities
+		var ok, kicked int64
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				res, err := ids.bind(&contracts.TcpConn{Id: uint64(i + 1)}, "tom", policy)
+				if err == nil {
+					atomic.AddInt64(&ok, 1)
+				} else if !errors.Is(err, ErrIdentityBound) {
+					t.Error(err)
+				}
+				atomic.AddInt64(&kicked, int64(len(res)))
+			}(i)
+		}
+		wg.Wait()
+
+		if len(ids.conns["tom"]) != 1 || len(ids.ids) != 1 {
+			t.Fatalf("policy %d: %d conns", policy, len(ids.conns["tom"]))
+		}
+		if policy == RejectNew && ok != 1 {
+			t.Fatalf("expect 1 bind, got %d", ok)
+		}
+		if policy == KickOld && (ok != 50 || kicked != 49) {
+			t.Fatalf("bind %d kicked %d", ok, kicked)
+		}
+	}
+}
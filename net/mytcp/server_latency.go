@@ -0,0 +1,93 @@
+package mytcp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+)
+
+// LatencyBuckets 延迟直方图每个桶的上界，毫秒
+var LatencyBuckets = []int64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 5000}
+
+type LatencyStats struct {
+	// Name btmsg.ActName，做统计的label
+	Name  string
+	Count uint64
+	// Buckets 比 LatencyBuckets 多一个，Buckets[i] 是延迟不超过LatencyBuckets[i]并且超过前一个上界的数量，最后一个是超过所有上界的数量
+	Buckets []uint64
+	SumMs   int64
+	MaxMs   int64
+	// Skewed 时间戳比服务端当前时间还晚的数量，两端时钟不同步，按0记录
+	Skewed uint64
+}
+
+type serverLatency struct {
+	lock sync.Mutex
+	acts map[uint16]*LatencyStats
+}
+
+// WithLatency 按act统计消息时间戳到OnReceive回调开始的延迟，客户端要用带时间戳的head，比如 btmsg.MsgHeadTcpV3
+func WithLatency() ServerOption {
+	return func(l *tcpServer) {
+		l.latency = &serverLatency{acts: map[uint16]*LatencyStats{}}
+	}
+}
+
+func (l *serverLatency) observe(msg btmsg.IMsg, now time.Time) {
+	ts := msg.GetTimestamp()
+	if ts == 0 {
+		return
+	}
+
+	var skewed bool
+	delta := now.UnixMilli() - ts
+	if delta < 0 {
+		delta = 0
+		skewed = true
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	st, ok := l.acts[msg.GetAct()]
+	if !ok {
+		st = &LatencyStats{Buckets: make([]uint64, len(LatencyBuckets)+1)}
+		l.acts[msg.GetAct()] = st
+	}
+
+	st.Count++
+	st.SumMs += delta
+	if delta > st.MaxMs {
+		st.MaxMs = delta
+	}
+	if skewed {
+		st.Skewed++
+	}
+
+	var i int
+	for i < len(LatencyBuckets) && delta > LatencyBuckets[i] {
+		i++
+	}
+	st.Buckets[i]++
+}
+
+// Latency 每个act的延迟统计，没有开启 WithLatency 时返回nil
+func (l *tcpServer) Latency() map[uint16]LatencyStats {
+	if l.latency == nil {
+		return nil
+	}
+
+	l.latency.lock.Lock()
+	defer l.latency.lock.Unlock()
+
+	var res = make(map[uint16]LatencyStats, len(l.latency.acts))
+	for act, st := range l.latency.acts {
+		cp := *st
+		cp.Name = btmsg.ActName(act)
+		cp.Buckets = append([]uint64(nil), st.Buckets...)
+		res[act] = cp
+	}
+
+	return res
+}
@@ -0,0 +1,78 @@
+package mytcp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+func TestServerLatencyObserve(t *testing.T) {
+	l := &serverLatency{acts: map[uint16]*LatencyStats{}}
+	now := time.UnixMilli(100000)
+
+	for _, ts := range []int64{
+		100000 - 30,   // 30ms
+		100000 - 3000, // 3s
+		100000 + 500,  // 时钟快了，按0记录
+		0,             // 没有时间戳，不记录
+	} {
+		hd := btmsg.NewMsgHeadTcpV3()
+		hd.SetAct(1)
+		hd.SetTimestamp(ts)
+		l.observe(btmsg.NewMsg(hd, nil), now)
+	}
+
+	st := l.acts[1]
+	if st.Count != 3 || st.Skewed != 1 || st.MaxMs != 3000 || st.SumMs != 3030 {
+		t.Fatalf("got %+v", st)
+	}
+	// 0 -> <=1，30 -> <=50，3000 -> <=5000
+	if st.Buckets[0] != 1 || st.Buckets[5] != 1 || st.Buckets[10] != 1 {
+		t.Fatalf("buckets %v", st.Buckets)
+	}
+}
+
+func TestServerLatency(t *testing.T) {
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpV3()), WithLatency())
+	var got = make(chan struct{}, 2)
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		got <- struct{}{}
+	})
+	swg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		swg.Wait()
+	}()
+
+	cli := newTestClient(ts.listener.Addr().String(), WithHeadFactory(btmsg.FactoryMsgHeadTcpV3()))
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	_ = cli.SendStruct(7, echoReq{Msg: "stamped"})
+
+	future := btmsg.NewMsg(btmsg.NewMsgHeadTcpV3(), nil)
+	future.SetAct(7)
+	future.SetTimestamp(time.Now().Add(time.Hour).UnixMilli())
+	_ = cli.SendMsg(future)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-got:
+		case <-time.After(time.Second * 3):
+			t.Fatal("timeout")
+		}
+	}
+
+	st := ts.Latency()[7]
+	if st.Count != 2 || st.Skewed != 1 {
+		t.Fatalf("got %+v", st)
+	}
+}
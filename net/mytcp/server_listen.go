@@ -0,0 +1,34 @@
+package mytcp
+
+import (
+	"context"
+	"os/signal"
+	"syscall"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// ListenAndServe 创建server，用h处理收到的消息，收到SIGINT或者SIGTERM时Shutdown
+// 一直阻塞到所有协程退出，启动失败时返回错误，正常停止返回nil
+func ListenAndServe(addr string, r btmsg.IMsgReader, h contracts.ServerReceiveCallback, opts ...ServerOption) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	return ListenAndServeContext(ctx, addr, r, h, opts...)
+}
+
+// ListenAndServeContext 和 ListenAndServe 一样，不处理信号，ctx结束时和 StartContext 一样停止
+// handler里调用 ITcpServer.Shutdown 也会让它返回，返回的是Close的结果
+func ListenAndServeContext(ctx context.Context, addr string, r btmsg.IMsgReader, h contracts.ServerReceiveCallback, opts ...ServerOption) error {
+	ts := NewTcpServer(addr, r, opts...)
+	ts.OnReceive(h)
+
+	err := ts.StartContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	<-ts.stopped()
+	return ts.Close()
+}
@@ -0,0 +1,81 @@
+package mytcp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// TestListenAndServeContext ctx结束时Shutdown并返回，handler里Shutdown也会返回
+func TestListenAndServeContext(t *testing.T) {
+	verifyNoLeaks(t)
+
+	ln := NewPipeListener()
+	ctx, cancel := context.WithCancel(context.Background())
+	var closed = make(chan struct{}, 1)
+	var done = make(chan error, 1)
+	go func() {
+		done <- ListenAndServeContext(ctx, "pipe", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+			var req echoReq
+			_, _ = msg.ToStruct(&req)
+			_ = conn.ReplyMsg(msg, &req)
+		}, WithServerTransport(ln), WithServerOnClose(func(s contracts.ITcpServer, conn *contracts.TcpConn, isServer bool, isClient bool) {
+			closed <- struct{}{}
+		}))
+	}()
+
+	cli := newTestClient("pipe", WithDialer(ln.Dial))
+	if _, err := cli.Start(); err != nil {
+		t.Fatal(err)
+	}
+	var rsp echoReq
+	if err := cli.Call(context.Background(), 1, &echoReq{Msg: "hi"}, &rsp); err != nil || rsp.Msg != "hi" {
+		t.Fatalf("rsp %+v %v", rsp, err)
+	}
+
+	cli.Close()
+	<-cli.Done()
+	<-closed
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("not stopped")
+	}
+
+	// handler里Shutdown
+	ln = NewPipeListener()
+	go func() {
+		done <- ListenAndServeContext(context.Background(), "pipe", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+			go s.Shutdown()
+		}, WithServerTransport(ln))
+	}()
+	cli = newTestClient("pipe", WithDialer(ln.Dial))
+	if _, err := cli.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	_ = cli.SendStruct(1, echoReq{})
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("not stopped")
+	}
+}
+
+func TestListenAndServeStartError(t *testing.T) {
+	err := ListenAndServeContext(context.Background(), "bad:addr:1", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), nil)
+	if err == nil {
+		t.Fatal("expect listen error")
+	}
+}
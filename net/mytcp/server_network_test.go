@@ -0,0 +1,103 @@
+package mytcp
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+type strAddr string
+
+func (l strAddr) Network() string { return "test" }
+func (l strAddr) String() string  { return string(l) }
+
+func TestRemoteIp(t *testing.T) {
+	var cases = []struct {
+		addr net.Addr
+		ip   string
+	}{
+		{&net.TCPAddr{IP: net.ParseIP("::1"), Port: 80}, "::1"},
+		{&net.TCPAddr{IP: net.ParseIP("::ffff:127.0.0.1"), Port: 80}, "127.0.0.1"},
+		{&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 80}, "10.0.0.1"},
+		{&net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 80}, "fe80::1"},
+		{strAddr("[::ffff:127.0.0.1]:80"), "127.0.0.1"},
+		{strAddr("[::1]:80"), "::1"},
+		{strAddr("pipe"), "pipe"},
+		{nil, ""},
+	}
+
+	for _, c := range cases {
+		if got := contracts.RemoteIp(c.addr); got != c.ip {
+			t.Fatalf("%v: expect %s, got %s", c.addr, c.ip, got)
+		}
+	}
+}
+
+// startNetworkServer 返回server看到的对端ip
+func startNetworkServer(t *testing.T, addr string, network string) (*tcpServer, <-chan string) {
+	verifyNoLeaks(t)
+
+	var remote = make(chan string, 1)
+	ts := NewTcpServer(addr, btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), WithServerNetwork(network))
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		remote <- conn.GetRemoteIp()
+	})
+	wg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ts.Shutdown()
+		wg.Wait()
+	})
+	return ts, remote
+}
+
+func dialRemoteIp(t *testing.T, addr string, network string, remote <-chan string) string {
+	t.Helper()
+
+	cli := newTestClient(addr, WithNetwork(network))
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	_ = cli.SendStruct(1, echoReq{})
+	select {
+	case v := <-remote:
+		return v
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout")
+	}
+	return ""
+}
+
+func TestServerNetwork(t *testing.T) {
+	ts, remote := startNetworkServer(t, "[::1]:0", "tcp6")
+	if got := dialRemoteIp(t, ts.listener.Addr().String(), "tcp6", remote); got != "::1" {
+		t.Fatalf("expect ::1, got %s", got)
+	}
+
+	// 只监听ipv4时ipv6连不上
+	ts, remote = startNetworkServer(t, "127.0.0.1:0", "tcp4")
+	port := strconv.Itoa(ts.listener.Addr().(*net.TCPAddr).Port)
+	if got := dialRemoteIp(t, "127.0.0.1:"+port, "tcp4", remote); got != "127.0.0.1" {
+		t.Fatalf("expect 127.0.0.1, got %s", got)
+	}
+	_, err := newTestClient("[::1]:"+port, WithNetwork("tcp6"), WithDialTimeout(time.Second)).Start()
+	if err == nil {
+		t.Fatal("expect tcp6 dial to fail")
+	}
+
+	// 双栈监听时ipv4的对端是 ::ffff:127.0.0.1，返回ipv4
+	ts, remote = startNetworkServer(t, "[::]:0", "tcp")
+	port = strconv.Itoa(ts.listener.Addr().(*net.TCPAddr).Port)
+	if got := dialRemoteIp(t, "127.0.0.1:"+port, "tcp4", remote); got != "127.0.0.1" {
+		t.Fatalf("expect 127.0.0.1, got %s", got)
+	}
+}
@@ -0,0 +1,275 @@
+package mytcp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// OfflineQueueStats 一个session排队的消息，见 WithOfflineQueue
+type OfflineQueueStats struct {
+	Count int
+	Bytes int
+	// Dropped 超过数量或者字节数的限制丢弃的旧消息
+	Dropped uint64
+	// Expired 超过ttl没有投递的消息
+	Expired uint64
+}
+
+// serverOffline session是 BindIdentity 绑定的身份，没有连接时发给它的消息在这里排队
+type serverOffline struct {
+	enabled  bool
+	maxCount int
+	maxBytes int
+	ttl      time.Duration
+
+	lock     sync.Mutex
+	sessions map[string]*offlineSession
+}
+
+type offlineSession struct {
+	lock  sync.Mutex
+	queue []offlineMsg
+	bytes int
+	stats OfflineQueueStats
+	timer *time.Timer
+	// removed 已经从sessions里删除，拿到锁之后看到它要重新取
+	removed bool
+}
+
+type offlineMsg struct {
+	msg  btmsg.IMsg
+	size int
+	at   time.Time
+}
+
+// WithOfflineQueue SendToSession 时session没有连接，最多排队maxCount个、maxBytes字节，超过时丢弃最旧的
+// 排队超过ttl的消息丢弃，<=0时不限制
+// 连接 BindIdentity 到这个session时先按顺序发出排队的消息，再发之后的消息
+func WithOfflineQueue(maxCount, maxBytes int, ttl time.Duration) ServerOption {
+	return func(l *tcpServer) {
+		l.offline.enabled = true
+		l.offline.maxCount = maxCount
+		l.offline.maxBytes = maxBytes
+		l.offline.ttl = ttl
+	}
+}
+
+// SendToSession 发给绑定到sessionId的所有连接，没有连接时排队，见 WithOfflineQueue
+// 没有设置 WithOfflineQueue 并且没有连接时返回 ErrSessionOffline，server已经停止返回 ErrConnClosed
+// 设置了 WithRelay 时同时转发给其他实例，session在别的实例上也返回 ErrSessionOffline
+func (l *tcpServer) SendToSession(sessionId string, msg btmsg.IMsg) error {
+	l.lock.RLock()
+	stop := l.stop
+	l.lock.RUnlock()
+	if stop != 0 {
+		return ErrConnClosed
+	}
+	l.publish(RelayTopicSessionPrefix+sessionId, msg)
+
+	// 同一个session可能绑定了多个连接，先编码好，不然每个连接的写协程都会改同一个head
+	msg = msg.Clone()
+	msg.ToSendByte()
+
+	if !l.offline.enabled {
+		conns := l.IdentityConns(sessionId)
+		if len(conns) == 0 {
+			return errors.Wrapf(ErrSessionOffline, "session %s", sessionId)
+		}
+		for _, conn := range conns {
+			conn.Send(msg)
+		}
+		return nil
+	}
+
+	s := l.offline.lockSession(sessionId, true)
+	defer s.lock.Unlock()
+
+	// 还有没发出去的消息时也排队，等连接绑定之后一起按顺序发
+	conns := l.IdentityConns(sessionId)
+	if len(conns) > 0 && len(s.queue) == 0 {
+		for _, conn := range conns {
+			conn.Send(msg)
+		}
+		l.offline.removeIfEmpty(sessionId, s)
+		return nil
+	}
+
+	l.offline.push(sessionId, s, msg, time.Now())
+	return nil
+}
+
+// OfflineQueues 还有排队消息的session
+func (l *tcpServer) OfflineQueues() map[string]OfflineQueueStats {
+	l.offline.lock.Lock()
+	sessions := make(map[string]*offlineSession, len(l.offline.sessions))
+	for id, s := range l.offline.sessions {
+		sessions[id] = s
+	}
+	l.offline.lock.Unlock()
+
+	var res = make(map[string]OfflineQueueStats, len(sessions))
+	for id, s := range sessions {
+		s.lock.Lock()
+		if !s.removed {
+			res[id] = s.stats
+		}
+		s.lock.Unlock()
+	}
+	return res
+}
+
+// attach BindIdentity 之后调用，在session的锁里发出排队的消息，这期间的SendToSession等它发完
+func (l *serverOffline) attach(id string, conn *contracts.TcpConn) {
+	if !l.enabled {
+		return
+	}
+
+	s := l.lockSession(id, false)
+	if s == nil {
+		return
+	}
+	defer s.lock.Unlock()
+
+	l.expire(s, time.Now())
+	for _, v := range s.queue {
+		conn.Send(v.msg)
+		v.msg.Release()
+	}
+	s.queue = nil
+	s.bytes = 0
+	s.stats.Count = 0
+	s.stats.Bytes = 0
+	l.removeIfEmpty(id, s)
+}
+
+// lockSession 返回加了锁的session，create为false并且没有排队时返回nil
+func (l *serverOffline) lockSession(id string, create bool) *offlineSession {
+	for {
+		l.lock.Lock()
+		s := l.sessions[id]
+		if s == nil {
+			if !create {
+				l.lock.Unlock()
+				return nil
+			}
+			s = &offlineSession{}
+			if l.sessions == nil {
+				l.sessions = map[string]*offlineSession{}
+			}
+			l.sessions[id] = s
+		}
+		l.lock.Unlock()
+
+		s.lock.Lock()
+		if !s.removed {
+			return s
+		}
+		s.lock.Unlock()
+	}
+}
+
+// push 调用方持有s.lock，超过限制时从最旧的开始丢弃
+func (l *serverOffline) push(id string, s *offlineSession, msg btmsg.IMsg, now time.Time) {
+	msg.Retain()
+	// 新建的消息head里的长度在发送时才设置，这里用body的长度
+	size := int(msg.HeadSize()) + len(msg.BodyByte())
+	s.queue = append(s.queue, offlineMsg{msg: msg, size: size, at: now})
+	s.bytes += size
+
+	l.expire(s, now)
+	for len(s.queue) > 0 && ((l.maxCount > 0 && len(s.queue) > l.maxCount) || (l.maxBytes > 0 && s.bytes > l.maxBytes)) {
+		s.pop().msg.Release()
+		s.stats.Dropped++
+	}
+	s.stats.Count = len(s.queue)
+	s.stats.Bytes = s.bytes
+
+	if l.ttl > 0 && s.timer == nil && len(s.queue) > 0 {
+		s.timer = time.AfterFunc(l.ttl, func() {
+			l.onTimer(id, s)
+		})
+	}
+	l.removeIfEmpty(id, s)
+}
+
+// expire 调用方持有s.lock
+func (l *serverOffline) expire(s *offlineSession, now time.Time) {
+	if l.ttl <= 0 {
+		return
+	}
+	for len(s.queue) > 0 && now.Sub(s.queue[0].at) >= l.ttl {
+		s.pop().msg.Release()
+		s.stats.Expired++
+	}
+	s.stats.Count = len(s.queue)
+	s.stats.Bytes = s.bytes
+}
+
+// onTimer 最旧的消息到期时触发，还有排队的消息时等下一个到期
+func (l *serverOffline) onTimer(id string, s *offlineSession) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.removed {
+		return
+	}
+
+	now := time.Now()
+	l.expire(s, now)
+	if len(s.queue) > 0 {
+		s.timer.Reset(l.ttl - now.Sub(s.queue[0].at))
+		return
+	}
+	l.removeIfEmpty(id, s)
+}
+
+// removeIfEmpty 调用方持有s.lock，排队的消息都处理完之后删掉session，统计也一起清掉
+func (l *serverOffline) removeIfEmpty(id string, s *offlineSession) {
+	if len(s.queue) > 0 {
+		return
+	}
+
+	s.removed = true
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+
+	l.lock.Lock()
+	if l.sessions[id] == s {
+		delete(l.sessions, id)
+	}
+	l.lock.Unlock()
+}
+
+// reset Shutdown时丢弃所有排队的消息
+func (l *serverOffline) reset() {
+	l.lock.Lock()
+	sessions := l.sessions
+	l.sessions = nil
+	l.lock.Unlock()
+
+	for _, s := range sessions {
+		s.lock.Lock()
+		for _, v := range s.queue {
+			v.msg.Release()
+		}
+		s.queue = nil
+		s.removed = true
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+		s.lock.Unlock()
+	}
+}
+
+func (l *offlineSession) pop() offlineMsg {
+	v := l.queue[0]
+	l.queue[0] = offlineMsg{}
+	l.queue = l.queue[1:]
+	l.bytes -= v.size
+	return v
+}
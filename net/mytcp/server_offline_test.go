@@ -0,0 +1,185 @@
+package mytcp
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+)
+
+const actOffline uint16 = 20
+
+// sessionClient 登录到session，收到的 actOffline 消息的body按顺序写到got
+func sessionClient(t *testing.T, ts *tcpServer, session string, got chan<- string) *tcpClient {
+	cli := newTestClient(ts.listener.Addr().String())
+	cli.OnReceive(func(msg btmsg.IMsg) {
+		if msg.GetAct() == actOffline {
+			got <- string(msg.BodyByte())
+		}
+	})
+	if _, err := cli.Start(); err != nil {
+		t.Fatal(err)
+	}
+	err := cli.Call(context.Background(), 1, &echoReq{Msg: session}, &echoReq{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cli
+}
+
+func sendToSession(t *testing.T, ts *tcpServer, session string, from, to int) {
+	for i := from; i < to; i++ {
+		err := ts.SendToSession(session, newActMsg(actOffline, []byte(strconv.Itoa(i))))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+}
+
+func expectSessionMsgs(t *testing.T, got <-chan string, from, to int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		select {
+		case v := <-got:
+			if v != strconv.Itoa(i) {
+				t.Fatalf("expect %d, got %s", i, v)
+			}
+		case <-time.After(time.Second * 3):
+			t.Fatalf("timeout waiting %d", i)
+		}
+	}
+}
+
+// TestSendToSessionOffline 断开期间发的消息在重新登录之后按顺序收到，并且在之后的消息前面
+func TestSendToSessionOffline(t *testing.T) {
+	ts, stop := startIdentityServer(t, WithOfflineQueue(100, 0, time.Minute))
+	defer stop()
+
+	got := make(chan string, 100)
+	cli := sessionClient(t, ts, "tom", got)
+	sendToSession(t, ts, "tom", 0, 3)
+	expectSessionMsgs(t, got, 0, 3)
+
+	cli.Close()
+	waitIdentityConns(t, ts, "tom", 0)
+	sendToSession(t, ts, "tom", 3, 13)
+	st := ts.OfflineQueues()["tom"]
+	if st.Count != 10 || st.Dropped != 0 {
+		t.Fatalf("stats %+v", st)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// 和登录同时发，不能插到排队的消息前面
+		for len(ts.IdentityConns("tom")) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		sendToSession(t, ts, "tom", 13, 20)
+	}()
+
+	cli = sessionClient(t, ts, "tom", got)
+	defer cli.Close()
+	wg.Wait()
+
+	expectSessionMsgs(t, got, 3, 20)
+	if len(ts.OfflineQueues()) != 0 {
+		t.Fatalf("queues %v", ts.OfflineQueues())
+	}
+}
+
+func TestSendToSessionOverflow(t *testing.T) {
+	msgSize := int(newActMsg(actOffline, nil).HeadSize()) + 1
+	ts, stop := startIdentityServer(t, WithOfflineQueue(3, msgSize*3, 0))
+	defer stop()
+
+	sendToSession(t, ts, "tom", 0, 5)
+	st := ts.OfflineQueues()["tom"]
+	if st.Count != 3 || st.Bytes != msgSize*3 || st.Dropped != 2 {
+		t.Fatalf("stats %+v", st)
+	}
+
+	// 两位数的body多一个字节，按字节数丢弃
+	sendToSession(t, ts, "tom", 10, 12)
+	st = ts.OfflineQueues()["tom"]
+	if st.Count != 2 || st.Dropped != 5 {
+		t.Fatalf("stats %+v", st)
+	}
+
+	got := make(chan string, 10)
+	cli := sessionClient(t, ts, "tom", got)
+	defer cli.Close()
+	expectSessionMsgs(t, got, 10, 12)
+}
+
+func TestSendToSessionExpire(t *testing.T) {
+	ts, stop := startIdentityServer(t, WithOfflineQueue(10, 0, time.Millisecond*50))
+	defer stop()
+
+	sendToSession(t, ts, "tom", 0, 2)
+	if st := ts.OfflineQueues()["tom"]; st.Count != 2 {
+		t.Fatalf("stats %+v", st)
+	}
+
+	deadline := time.Now().Add(time.Second * 3)
+	for len(ts.OfflineQueues()) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("queues %v", ts.OfflineQueues())
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	got := make(chan string, 10)
+	cli := sessionClient(t, ts, "tom", got)
+	defer cli.Close()
+	sendToSession(t, ts, "tom", 5, 6)
+	expectSessionMsgs(t, got, 5, 6)
+}
+
+func TestSendToSessionWithoutQueue(t *testing.T) {
+	ts, stop := startIdentityServer(t)
+	defer stop()
+
+	err := ts.SendToSession("tom", newActMsg(actOffline, nil))
+	if !errors.Is(err, ErrSessionOffline) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+// TestSendToSessionAllow 多个连接绑定同一个session时每个连接都收到，同一个消息不能被几个写协程同时编码
+func TestSendToSessionAllow(t *testing.T) {
+	ts, stop := startIdentityServer(t)
+	defer stop()
+
+	var gots []chan string
+	for i := 0; i < 2; i++ {
+		got := make(chan string, 100)
+		cli := newTestClient(ts.listener.Addr().String())
+		cli.OnReceive(func(msg btmsg.IMsg) {
+			if msg.GetAct() == actOffline {
+				got <- string(msg.BodyByte())
+			}
+		})
+		if _, err := cli.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer cli.Close()
+		err := cli.Call(context.Background(), uint16(Allow)+1, &echoReq{Msg: "tom"}, &echoReq{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		gots = append(gots, got)
+	}
+	waitIdentityConns(t, ts, "tom", 2)
+
+	sendToSession(t, ts, "tom", 0, 50)
+	for _, got := range gots {
+		expectSessionMsgs(t, got, 0, 50)
+	}
+}
@@ -0,0 +1,88 @@
+package mytcp
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/winkb/tcp1/contracts"
+)
+
+type ServerOption func(l *tcpServer)
+
+// WithReleaseMsg OnReceive回调返回之后调用msg.Release，配合 btmsg.WithPooledMsg 的reader使用
+// 回调返回之后还要使用消息需要先调用msg.Retain，Send会自己Retain直到写完
+func WithReleaseMsg() ServerOption {
+	return func(l *tcpServer) {
+		l.releaseMsg = true
+	}
+}
+
+// WithChunkAssembly 每个连接收到的 btmsg.ActChunk 分片还原成完整的消息再交给OnReceive，见 btmsg.ChunkAssembler
+func WithChunkAssembly(maxSize int, timeout time.Duration) ServerOption {
+	return func(l *tcpServer) {
+		l.chunks = &chunkConfig{maxSize: maxSize, timeout: timeout}
+	}
+}
+
+// WithServerPassThroughControlFrames ping和pong在自动处理之后也交给OnReceive，默认业务看不到
+func WithServerPassThroughControlFrames() ServerOption {
+	return func(l *tcpServer) {
+		l.passControl = true
+	}
+}
+
+// WithServerTransport Start时用t监听，默认 TCPTransport
+func WithServerTransport(t Transport) ServerOption {
+	return func(l *tcpServer) {
+		l.transport = t
+	}
+}
+
+// WithServerNetwork tcp同时监听ipv4和ipv6(系统默认)，tcp4只监听ipv4，tcp6只监听ipv6，默认tcp
+// 只对实现了ListenNetwork的Transport有效，比如 TCPTransport
+func WithServerNetwork(network string) ServerOption {
+	return func(l *tcpServer) {
+		l.network = network
+	}
+}
+
+// WithFirstMessageTimeout accept之后d之内没有收到一个完整的消息就关闭连接，比如端口扫描和只建立连接的健康检查
+// 关闭的连接数见 ServerStats.FirstMessageTimeouts，收到第一个消息之后不再限制，默认不限制
+func WithFirstMessageTimeout(d time.Duration) ServerOption {
+	return func(l *tcpServer) {
+		l.firstMsgTimeout = d
+	}
+}
+
+// WithServerTLS Start和Serve接受的连接用cfg做tls握手，握手在第一次读写时进行
+func WithServerTLS(cfg *tls.Config) ServerOption {
+	return func(l *tcpServer) {
+		l.tlsConfig = cfg
+	}
+}
+
+// WithServerWriteTimeout 写一个消息的超时，默认3秒，超时之后关闭连接，关闭的原因是 CloseWriteError
+func WithServerWriteTimeout(d time.Duration) ServerOption {
+	return func(l *tcpServer) {
+		l.timeout = d
+	}
+}
+
+// WithServerOnClose 和 OnClose 一样，用于 ListenAndServe 这种拿不到server的场景
+func WithServerOnClose(f contracts.ServerCloseCallback) ServerOption {
+	return func(l *tcpServer) {
+		l.OnClose(f)
+	}
+}
+
+// WithServerOnCloseReason 和 OnCloseReason 一样
+func WithServerOnCloseReason(f contracts.ServerCloseReasonCallback) ServerOption {
+	return func(l *tcpServer) {
+		l.OnCloseReason(f)
+	}
+}
+
+type chunkConfig struct {
+	maxSize int
+	timeout time.Duration
+}
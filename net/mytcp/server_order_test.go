@@ -0,0 +1,101 @@
+package mytcp
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+type seqReq struct {
+	N int
+}
+
+// TestServerOrderedDispatch 每个连接的消息按发送顺序处理，默认模式和 WithDispatchWorkers 都要保证
+func TestServerOrderedDispatch(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	total := 100000
+	if testing.Short() {
+		total = 10000
+	}
+	const clients = 4
+
+	modes := []struct {
+		name string
+		opts []ServerOption
+	}{
+		{"default", nil},
+		{"workers", []ServerOption{WithDispatchWorkers(3)}},
+	}
+
+	for _, mode := range modes {
+		t.Run(mode.name, func(t *testing.T) {
+			verifyNoLeaks(t)
+
+			var lock sync.Mutex
+			var last = map[uint64]int{}
+			var received int
+			var done = make(chan struct{})
+
+			ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), mode.opts...)
+			ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+				var req seqReq
+				_, _ = msg.ToStruct(&req)
+
+				lock.Lock()
+				defer lock.Unlock()
+				if req.N != last[conn.Id]+1 {
+					t.Errorf("conn %d expect %d, got %d", conn.Id, last[conn.Id]+1, req.N)
+				}
+				last[conn.Id] = req.N
+				received++
+				if received == total {
+					close(done)
+				}
+			})
+			wg, err := ts.Start()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				ts.Shutdown()
+				wg.Wait()
+			}()
+
+			var sendWg sync.WaitGroup
+			for i := 0; i < clients; i++ {
+				cli := newTestClient(ts.listener.Addr().String())
+				_, err = cli.Start()
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer cli.Close()
+
+				sendWg.Add(1)
+				go func() {
+					defer sendWg.Done()
+					for n := 1; n <= total/clients; n++ {
+						err := cli.SendStruct(1, seqReq{N: n})
+						if err != nil {
+							t.Error(err)
+							return
+						}
+					}
+				}()
+			}
+			sendWg.Wait()
+
+			select {
+			case <-done:
+			case <-time.After(time.Minute):
+				lock.Lock()
+				defer lock.Unlock()
+				t.Fatalf("received %d of %d", received, total)
+			}
+		})
+	}
+}
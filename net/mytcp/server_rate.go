@@ -0,0 +1,33 @@
+package mytcp
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// serverRates 所有连接加起来的收发速率，每个连接的速率和总量记在 TcpConn 上，见 TcpConn.Stats
+type serverRates struct {
+	received contracts.RateCounter
+	sent     contracts.RateCounter
+}
+
+func (l *tcpServer) countReceived(conn *contracts.TcpConn, msg btmsg.IMsg) {
+	now := time.Now()
+	n := int(msg.HeadSize() + msg.BodySize())
+	conn.Received.Add(now, n)
+	atomic.AddUint64(&conn.BytesIn, uint64(n))
+	atomic.StoreInt64(&conn.LastActive, now.UnixNano())
+	l.rates.received.Add(now, n)
+}
+
+// countSent n是写入的帧的长度
+func (l *tcpServer) countSent(conn *contracts.TcpConn, n int) {
+	now := time.Now()
+	conn.Sent.Add(now, n)
+	atomic.AddUint64(&conn.BytesOut, uint64(n))
+	atomic.StoreInt64(&conn.LastActive, now.UnixNano())
+	l.rates.sent.Add(now, n)
+}
@@ -0,0 +1,83 @@
+package mytcp
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/contracts"
+)
+
+func TestRateCounterWindows(t *testing.T) {
+	var c contracts.RateCounter
+	start := time.Unix(1000, 0)
+
+	// 前60秒每秒10个100字节的消息，最后一秒多10个
+	for sec := 0; sec < 60; sec++ {
+		n := 10
+		if sec == 59 {
+			n = 20
+		}
+		for i := 0; i < n; i++ {
+			c.Add(start.Add(time.Duration(sec)*time.Second), 100)
+		}
+	}
+	// 当前这一秒不算
+	c.Add(start.Add(time.Second*60), 100)
+
+	w := c.Windows(start.Add(time.Second*60 + time.Millisecond*500))
+	if w.Last1s.Msgs != 20 || w.Last1s.Bytes != 2000 {
+		t.Fatalf("1s %+v", w.Last1s)
+	}
+	if w.Last10s.Msgs != 11 || w.Last60s.Msgs != 610.0/60 {
+		t.Fatalf("10s %+v 60s %+v", w.Last10s, w.Last60s)
+	}
+
+	// 过了60秒之后都是0，桶被新的一秒覆盖之后旧的数据不算
+	w = c.Windows(start.Add(time.Second * 200))
+	if w.Last60s.Msgs != 0 {
+		t.Fatalf("60s %+v", w.Last60s)
+	}
+	c.Add(start.Add(time.Second*61), 100)
+	if w = c.Windows(start.Add(time.Second * 62)); w.Last1s.Msgs != 1 || w.Last60s.Msgs != 592.0/60 {
+		t.Fatalf("1s %+v 60s %+v", w.Last1s, w.Last60s)
+	}
+}
+
+// TestServerRates 每个连接和整个server的收发都记录下来
+func TestServerRates(t *testing.T) {
+	ts, calls, cli, got := startDedupServer(t)
+
+	for seq := uint32(1); seq <= 5; seq++ {
+		sendSeq(t, cli, seq)
+		expectReply(t, got)
+	}
+	if n := atomic.LoadInt64(calls); n != 5 {
+		t.Fatalf("calls %d", n)
+	}
+
+	// 写入之后才记录，客户端收到回复的时候可能还没有记录
+	conn := ts.snapshotConns()[0]
+	var next time.Time
+	var in, out contracts.Rate
+	deadline := time.Now().Add(time.Second * 3)
+	for {
+		next = time.Now().Add(time.Second)
+		in = conn.Received.Windows(next).Last10s
+		out = conn.Sent.Windows(next).Last10s
+		if in.Msgs == 0.5 && out.Msgs == 0.5 && in.Bytes != 0 && out.Bytes != 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("conn in %+v out %+v", in, out)
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	if st := ts.rates.received.Windows(next); st.Last10s != in {
+		t.Fatalf("server %+v conn %+v", st.Last10s, in)
+	}
+	if st := conn.Stats(); st.Pending != 0 {
+		t.Fatalf("conn stats %+v", st)
+	}
+}
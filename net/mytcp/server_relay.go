@@ -0,0 +1,84 @@
+package mytcp
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/winkb/tcp1/btmsg"
+)
+
+const (
+	// RelayTopicBroadcast Broadcast 转发到其他实例的topic
+	RelayTopicBroadcast = "broadcast"
+	// RelayTopicSessionPrefix SendToSession 转发的topic是这个前缀加上session
+	RelayTopicSessionPrefix = "session/"
+)
+
+// RelayHandler frame是发布方server编码好的完整消息
+type RelayHandler func(topic string, frame []byte)
+
+// Relay 在多个server实例之间转发广播，见 WithRelay，自带的实现是 MeshRelay
+type Relay interface {
+	// Publish 发给其他实例，不会交给自己的handler，不能阻塞
+	Publish(topic string, frame []byte) error
+	// Subscribe 其他实例Publish的消息交给h
+	Subscribe(h RelayHandler)
+}
+
+// WithRelay Broadcast 和 SendToSession 同时通过r发给其他实例，由它们发给自己的连接
+// 收到的转发只发给本实例的连接，不会再转发，所有实例的reader要一样
+// 转发的 SendToSession 只发给已经绑定的连接，不进入 WithOfflineQueue 的队列
+func WithRelay(r Relay) ServerOption {
+	return func(l *tcpServer) {
+		l.relay = r
+		r.Subscribe(l.onRelay)
+	}
+}
+
+func (l *tcpServer) publish(topic string, msg btmsg.IMsg) {
+	if l.relay == nil {
+		return
+	}
+
+	err := l.relay.Publish(topic, msg.ToSendByte())
+	if err != nil {
+		log.Err(errors.Wrapf(err, "relay publish %s", topic))
+	}
+}
+
+// onRelay 其他实例转发过来的消息
+func (l *tcpServer) onRelay(topic string, frame []byte) {
+	l.lock.RLock()
+	stop := l.stop
+	l.lock.RUnlock()
+	if stop != 0 {
+		return
+	}
+
+	res := l.reader.ReadMsg(&relayFrame{bytes.NewReader(frame)})
+	if res.GetErr() != nil {
+		log.Err(errors.Wrapf(res.GetErr(), "relay decode %s", topic))
+		return
+	}
+	msg := res.GetMsg()
+
+	switch {
+	case topic == RelayTopicBroadcast:
+		<-l.broadcastLocal(msg)
+	case strings.HasPrefix(topic, RelayTopicSessionPrefix):
+		for _, conn := range l.IdentityConns(strings.TrimPrefix(topic, RelayTopicSessionPrefix)) {
+			conn.Send(msg)
+		}
+	}
+}
+
+// relayFrame 从一段内存读一个消息
+type relayFrame struct {
+	*bytes.Reader
+}
+
+func (l *relayFrame) ReadMessage() (messageType int, p []byte, err error) {
+	return 0, nil, errors.New("relay frame has no message")
+}
@@ -0,0 +1,184 @@
+package mytcp
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+	. "github.com/winkb/tcp1/util"
+)
+
+// BusyErrorCode 并发数满了时回复的错误码，客户端的Call返回 *ReplyError
+const BusyErrorCode uint16 = 503
+
+// ErrBusy 并发数满了，回复的错误文本
+var ErrBusy = errors.New("busy")
+
+// serverRouteLimits SetConcurrencyLimit 设置的每个act的并发限制
+type serverRouteLimits struct {
+	lock   sync.RWMutex
+	limits map[uint16]*routeLimit
+}
+
+// routeLimit 一个act的信号量，满了之后最多queue个排队，超过timeout回复busy
+type routeLimit struct {
+	sem      chan struct{}
+	queue    int64
+	timeout  time.Duration
+	inFlight int64
+	waiting  int64
+	rejected uint64
+}
+
+type LimitOption func(l *routeLimit)
+
+// WithLimitQueue 满了之后最多size个请求排队，等待超过timeout回复busy，默认不排队直接回复busy
+func WithLimitQueue(size int, timeout time.Duration) LimitOption {
+	return func(l *routeLimit) {
+		l.queue = int64(size)
+		l.timeout = timeout
+	}
+}
+
+// RouteLimitStats 一个act的并发统计
+type RouteLimitStats struct {
+	// Limit SetConcurrencyLimit 设置的并发数
+	Limit    int
+	InFlight int64
+	Waiting  int64
+	Rejected uint64
+}
+
+// SetConcurrencyLimit act的回调最多同时运行n个，n<=0取消限制
+// 设置了限制的act在单独的协程里处理，不会阻塞这个连接的其他消息，同一个连接这个act的消息不再保证按顺序处理
+// 满了之后默认立即回复 BusyErrorCode，用 WithLimitQueue 改成排队
+func (l *tcpServer) SetConcurrencyLimit(act uint16, n int, opts ...LimitOption) {
+	l.routeLimits.lock.Lock()
+	defer l.routeLimits.lock.Unlock()
+
+	if l.routeLimits.limits == nil {
+		l.routeLimits.limits = map[uint16]*routeLimit{}
+	}
+	if n <= 0 {
+		delete(l.routeLimits.limits, act)
+		return
+	}
+
+	lim := &routeLimit{sem: make(chan struct{}, n)}
+	for _, opt := range opts {
+		opt(lim)
+	}
+	l.routeLimits.limits[act] = lim
+}
+
+// RouteLimitStats 每个设置了并发限制的act的统计
+func (l *tcpServer) RouteLimitStats() map[uint16]RouteLimitStats {
+	l.routeLimits.lock.RLock()
+	defer l.routeLimits.lock.RUnlock()
+
+	var res = map[uint16]RouteLimitStats{}
+	for act, lim := range l.routeLimits.limits {
+		res[act] = RouteLimitStats{
+			Limit:    cap(lim.sem),
+			InFlight: atomic.LoadInt64(&lim.inFlight),
+			Waiting:  atomic.LoadInt64(&lim.waiting),
+			Rejected: atomic.LoadUint64(&lim.rejected),
+		}
+	}
+	return res
+}
+
+func (l *serverRouteLimits) get(act uint16) *routeLimit {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return l.limits[act]
+}
+
+func (l *routeLimit) tryAcquire() bool {
+	select {
+	case l.sem <- struct{}{}:
+		atomic.AddInt64(&l.inFlight, 1)
+		return true
+	default:
+		return false
+	}
+}
+
+// wait 排队等待，stop关闭或者超时返回false
+func (l *routeLimit) wait(stop <-chan bool) bool {
+	defer atomic.AddInt64(&l.waiting, -1)
+
+	var timeout <-chan time.Time
+	if l.timeout > 0 {
+		timer := time.NewTimer(l.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case l.sem <- struct{}{}:
+		atomic.AddInt64(&l.inFlight, 1)
+		return true
+	case <-timeout:
+		return false
+	case <-stop:
+		return false
+	}
+}
+
+func (l *routeLimit) release() {
+	atomic.AddInt64(&l.inFlight, -1)
+	<-l.sem
+}
+
+// enqueue 还能排队时占一个位置
+func (l *routeLimit) enqueue() bool {
+	if atomic.AddInt64(&l.waiting, 1) <= l.queue {
+		return true
+	}
+	atomic.AddInt64(&l.waiting, -1)
+	return false
+}
+
+// dispatchLimited 拿到信号量之后在新的协程里处理，满了并且不能排队时回复busy，连接断开时放弃排队
+func (l *tcpServer) dispatchLimited(lim *routeLimit, conn *contracts.TcpConn, msg btmsg.IMsg) {
+	acquired := lim.tryAcquire()
+	if !acquired && !lim.enqueue() {
+		l.replyBusy(lim, conn, msg)
+		return
+	}
+
+	l.lock.RLock()
+	wg := l.wg
+	l.lock.RUnlock()
+
+	MyGoWg(wg, fmt.Sprintf("%d_route_%d", conn.Id, msg.GetAct()), func() {
+		defer l.recoverReceive(conn, msg)
+
+		if !acquired && !lim.wait(conn.WaitConn) {
+			l.replyBusy(lim, conn, msg)
+			return
+		}
+		defer lim.release()
+
+		l.runReceive(conn, msg)
+	})
+}
+
+func (l *tcpServer) replyBusy(lim *routeLimit, conn *contracts.TcpConn, msg btmsg.IMsg) {
+	atomic.AddUint64(&lim.rejected, 1)
+
+	err := conn.ReplyError(msg, BusyErrorCode, ErrBusy.Error())
+	if err != nil {
+		log.Err(errors.Wrapf(err, "conn %d busy reply act %s", conn.Id, btmsg.ActName(msg.GetAct())))
+	}
+	if l.releaseMsg {
+		msg.Release()
+	}
+}
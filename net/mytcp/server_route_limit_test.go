@@ -0,0 +1,129 @@
+package mytcp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+const actReport uint16 = 200
+
+// runLimited client同时Call 50次act 200，返回成功和busy的数量、server回调同时运行的最大数
+func runLimited(t *testing.T, opts ...LimitOption) (ok int, busy int, peak int64, stats RouteLimitStats) {
+	var running, max int64
+	var release = make(chan struct{})
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		n := atomic.AddInt64(&running, 1)
+		for {
+			old := atomic.LoadInt64(&max)
+			if n <= old || atomic.CompareAndSwapInt64(&max, old, n) {
+				break
+			}
+		}
+		<-release
+		time.Sleep(time.Millisecond * 2)
+		atomic.AddInt64(&running, -1)
+		_ = conn.ReplyMsg(msg, &callRsp{N: 1})
+	})
+	defer stop()
+	ts.SetConcurrencyLimit(actReport, 3, opts...)
+
+	cli := newTestClient(ts.listener.Addr().String())
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var rsp callRsp
+			err := cli.Call(context.Background(), actReport, &callReq{}, &rsp)
+			lock.Lock()
+			defer lock.Unlock()
+
+			var replyErr *ReplyError
+			switch {
+			case err == nil:
+				ok++
+			case errors.As(err, &replyErr) && replyErr.Code() == BusyErrorCode:
+				busy++
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+
+	// 等到50个请求都到了回调、排队或者被拒绝，再一起放行
+	deadline := time.Now().Add(time.Second * 3)
+	for time.Now().Before(deadline) {
+		stats = ts.RouteLimitStats()[actReport]
+		if stats.InFlight+stats.Waiting+int64(stats.Rejected) == 50 && atomic.LoadInt64(&running) == stats.InFlight {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	return ok, busy, atomic.LoadInt64(&max), stats
+}
+
+func TestConcurrencyLimitQueue(t *testing.T) {
+	ok, busy, peak, stats := runLimited(t, WithLimitQueue(50, time.Second*3))
+	if ok != 50 || busy != 0 || peak != 3 {
+		t.Fatalf("ok %d busy %d peak %d", ok, busy, peak)
+	}
+	if stats.Limit != 3 || stats.InFlight != 3 || stats.Waiting != 47 {
+		t.Fatalf("stats %+v", stats)
+	}
+}
+
+func TestConcurrencyLimitReject(t *testing.T) {
+	ok, busy, peak, stats := runLimited(t)
+	if ok != 3 || busy != 47 || peak != 3 {
+		t.Fatalf("ok %d busy %d peak %d", ok, busy, peak)
+	}
+	if stats.InFlight != 3 || stats.Rejected != 47 {
+		t.Fatalf("stats %+v", stats)
+	}
+}
+
+// TestConcurrencyLimitOther 其他act和取消限制之后的act不受影响
+func TestConcurrencyLimitOther(t *testing.T) {
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		_ = conn.ReplyMsg(msg, &callRsp{N: int(msg.GetAct())})
+	})
+	defer stop()
+	ts.SetConcurrencyLimit(actReport, 1)
+	ts.SetConcurrencyLimit(actReport, 0)
+	ts.SetConcurrencyLimit(actReport+1, 1)
+
+	cli := newTestClient(ts.listener.Addr().String())
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	for _, act := range []uint16{1, actReport, actReport + 1} {
+		var rsp callRsp
+		if err = cli.Call(context.Background(), act, &callReq{}, &rsp); err != nil || rsp.N != int(act) {
+			t.Fatalf("act %d rsp %+v err %v", act, rsp, err)
+		}
+	}
+	if stats := ts.RouteLimitStats(); len(stats) != 1 || stats[actReport+1].Limit != 1 {
+		t.Fatalf("stats %+v", stats)
+	}
+}
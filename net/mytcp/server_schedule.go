@@ -0,0 +1,155 @@
+package mytcp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// broadcastScheduleId BroadcastAfter 在serverSchedule里用的连接id，连接的id从1开始
+const broadcastScheduleId uint64 = 0
+
+// serverSchedule SendAfter 和 BroadcastAfter 还没到时间的发送，连接关闭或者Shutdown时取消
+type serverSchedule struct {
+	lock   sync.Mutex
+	seq    uint64
+	timers map[uint64]map[uint64]*scheduledSend
+}
+
+type scheduledSend struct {
+	timer *time.Timer
+	msg   btmsg.IMsg
+}
+
+// SendAfter delay之后把msg发给conn，连接在这之前关闭或者Shutdown时不再发送
+// 返回的cancel可以重复调用，已经发出去之后调用没有效果，连接已经关闭或者server已经停止返回 ErrConnClosed
+func (l *tcpServer) SendAfter(conn *contracts.TcpConn, msg btmsg.IMsg, delay time.Duration) (cancel func(), err error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	if l.stop != 0 {
+		return nil, ErrConnClosed
+	}
+
+	return l.schedule.add(conn, msg, delay, func() {
+		conn.Send(msg)
+	})
+}
+
+// BroadcastAfter delay之后广播msg，收到的是那时候的所有连接，Shutdown时取消
+func (l *tcpServer) BroadcastAfter(msg btmsg.IMsg, delay time.Duration) (cancel func(), err error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	if l.stop != 0 {
+		return nil, ErrConnClosed
+	}
+
+	return l.schedule.add(nil, msg, delay, func() {
+		l.Broadcast(msg)
+	})
+}
+
+// add conn是nil时是广播，msg在发送或者取消之后Release
+// 和 serverIdentities.bind 一样在锁里检查IsClose，连接关闭时先设置IsClose再调用cancelConn
+func (l *serverSchedule) add(conn *contracts.TcpConn, msg btmsg.IMsg, delay time.Duration, send func()) (cancel func(), err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	connId := broadcastScheduleId
+	if conn != nil {
+		conn.Lock.RLock()
+		closed := conn.IsClose
+		conn.Lock.RUnlock()
+		if closed {
+			return nil, ErrConnClosed
+		}
+		connId = conn.Id
+	}
+
+	if l.timers == nil {
+		l.timers = map[uint64]map[uint64]*scheduledSend{}
+	}
+	if l.timers[connId] == nil {
+		l.timers[connId] = map[uint64]*scheduledSend{}
+	}
+
+	l.seq++
+	id := l.seq
+	msg.Retain()
+	item := &scheduledSend{msg: msg}
+	l.timers[connId][id] = item
+	item.timer = time.AfterFunc(delay, func() {
+		if l.take(connId, id) == nil {
+			return
+		}
+		defer msg.Release()
+		send()
+	})
+
+	return func() {
+		if v := l.take(connId, id); v != nil {
+			v.timer.Stop()
+			v.msg.Release()
+		}
+	}, nil
+}
+
+// take 从记录里拿走，拿到的一方负责发送或者Release，已经被拿走时返回nil
+func (l *serverSchedule) take(connId uint64, id uint64) *scheduledSend {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	v, ok := l.timers[connId][id]
+	if !ok {
+		return nil
+	}
+
+	delete(l.timers[connId], id)
+	if len(l.timers[connId]) == 0 {
+		delete(l.timers, connId)
+	}
+	return v
+}
+
+// cancelConn 取消发给这个连接的所有定时发送
+func (l *serverSchedule) cancelConn(connId uint64) {
+	l.lock.Lock()
+	items := l.timers[connId]
+	delete(l.timers, connId)
+	l.lock.Unlock()
+
+	stopScheduled(items)
+}
+
+// reset Shutdown时取消所有的定时发送
+func (l *serverSchedule) reset() {
+	l.lock.Lock()
+	timers := l.timers
+	l.timers = nil
+	l.lock.Unlock()
+
+	for _, items := range timers {
+		stopScheduled(items)
+	}
+}
+
+func (l *serverSchedule) pending() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	var n int
+	for _, items := range l.timers {
+		n += len(items)
+	}
+	return n
+}
+
+func stopScheduled(items map[uint64]*scheduledSend) {
+	for _, v := range items {
+		v.timer.Stop()
+		v.msg.Release()
+	}
+}
@@ -0,0 +1,98 @@
+package mytcp
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+func waitPending(t *testing.T, ts *tcpServer, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second * 3)
+	for ts.schedule.pending() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect %d pending, got %d", n, ts.schedule.pending())
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+func TestSendAfter(t *testing.T) {
+	var connCh = make(chan *contracts.TcpConn, 1)
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		connCh <- conn
+	})
+	defer stop()
+
+	var acts = make(chan uint16, 10)
+	cli := newTestClient(ts.listener.Addr().String())
+	cli.OnReceive(func(msg btmsg.IMsg) {
+		acts <- msg.GetAct()
+	})
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	_ = cli.SendStruct(1, nil)
+	conn := <-connCh
+
+	start := time.Now()
+	_, err = ts.SendAfter(conn, newActMsg(5, nil), time.Millisecond*30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ts.BroadcastAfter(newActMsg(6, nil), time.Millisecond*40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []uint16{5, 6} {
+		select {
+		case act := <-acts:
+			if act != expect || time.Since(start) < time.Millisecond*30 {
+				t.Fatalf("got act %d after %v", act, time.Since(start))
+			}
+		case <-time.After(time.Second * 3):
+			t.Fatal("timeout")
+		}
+	}
+
+	// 主动取消
+	c1, _ := ts.SendAfter(conn, newActMsg(7, nil), time.Millisecond*20)
+	c2, _ := ts.BroadcastAfter(newActMsg(8, nil), time.Millisecond*20)
+	c1()
+	c2()
+	c1()
+	waitPending(t, ts, 0)
+	select {
+	case act := <-acts:
+		t.Fatalf("canceled act %d received", act)
+	case <-time.After(time.Millisecond * 60):
+	}
+
+	// 连接断开时取消
+	_, err = ts.SendAfter(conn, newActMsg(9, nil), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitPending(t, ts, 1)
+	cli.Close()
+	waitPending(t, ts, 0)
+	if _, err = ts.SendAfter(conn, newActMsg(9, nil), time.Hour); !errors.Is(err, ErrConnClosed) {
+		t.Fatalf("expect ErrConnClosed, got %v", err)
+	}
+
+	// Shutdown时取消
+	_, err = ts.BroadcastAfter(newActMsg(10, nil), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop()
+	waitPending(t, ts, 0)
+	if _, err = ts.BroadcastAfter(newActMsg(10, nil), time.Hour); !errors.Is(err, ErrConnClosed) {
+		t.Fatalf("expect ErrConnClosed, got %v", err)
+	}
+}
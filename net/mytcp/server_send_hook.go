@@ -0,0 +1,89 @@
+package mytcp
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+	. "github.com/winkb/tcp1/util"
+)
+
+type ServerSendCallback func(conn *contracts.TcpConn, frame []byte)
+type ServerSendMsgCallback func(conn *contracts.TcpConn, msg btmsg.IMsg)
+
+type sendEvent struct {
+	conn  *contracts.TcpConn
+	frame []byte
+}
+
+// serverSendHooks 写入连接之前的回调，都要在Start之前设置
+type serverSendHooks struct {
+	frame   ServerSendCallback
+	msg     ServerSendMsgCallback
+	async   ServerSendCallback
+	events  chan sendEvent
+	dropped uint64
+}
+
+// OnSend 每个消息写入连接之前调用，广播时每个连接调用一次，frame是要写入的完整数据，只在回调里有效，不能修改
+// 在连接的写协程里同步执行，回调返回之前这个连接不会写入，不能长时间阻塞，耗时的处理用 OnSendAsync
+// 执行时持有server的读锁，回调里不能调用Shutdown
+func (l *tcpServer) OnSend(f ServerSendCallback) {
+	l.sendHooks.frame = f
+}
+
+// OnSendMsg 和 OnSend 一样，参数是消息，回调里不能修改它
+func (l *tcpServer) OnSendMsg(f ServerSendMsgCallback) {
+	l.sendHooks.msg = f
+}
+
+// OnSendAsync 和 OnSend 一样，frame是拷贝，在单独的协程里按顺序调用，不阻塞写入
+// 最多排队size个，满了之后丢弃，丢弃的数量见 SendHookDropped
+func (l *tcpServer) OnSendAsync(f ServerSendCallback, size int) {
+	l.sendHooks.async = f
+	l.sendHooks.events = make(chan sendEvent, size)
+}
+
+// SendHookDropped OnSendAsync 因为排队满了丢弃的数量
+func (l *tcpServer) SendHookDropped() uint64 {
+	return atomic.LoadUint64(&l.sendHooks.dropped)
+}
+
+// startSendHook Shutdown时退出，还在排队的不再调用
+func (l *tcpServer) startSendHook(wg *sync.WaitGroup) {
+	hooks := &l.sendHooks
+	if hooks.async == nil {
+		return
+	}
+
+	MyGoWgCtx(l.ctx, wg, "send_hook", func(ctx context.Context) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev := <-hooks.events:
+				hooks.async(ev.conn, ev.frame)
+			}
+		}
+	})
+}
+
+// fireSend writeSend写入之前调用
+func (l *tcpServer) fireSend(conn *contracts.TcpConn, msg btmsg.IMsg, frame []byte) {
+	hooks := &l.sendHooks
+	if hooks.msg != nil {
+		hooks.msg(conn, msg)
+	}
+	if hooks.frame != nil {
+		hooks.frame(conn, frame)
+	}
+	if hooks.async != nil {
+		select {
+		case hooks.events <- sendEvent{conn: conn, frame: append([]byte(nil), frame...)}:
+		default:
+			atomic.AddUint64(&hooks.dropped, 1)
+		}
+	}
+}
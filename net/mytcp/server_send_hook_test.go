@@ -0,0 +1,140 @@
+package mytcp
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+func TestServerOnSend(t *testing.T) {
+	verifyNoLeaks(t)
+
+	var lock sync.Mutex
+	var frames = map[uint64][]byte{}
+	var acts = map[uint64]uint16{}
+	var async = make(chan []byte, 10)
+
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()))
+	ts.OnSend(func(conn *contracts.TcpConn, frame []byte) {
+		lock.Lock()
+		defer lock.Unlock()
+		frames[conn.Id] = append([]byte(nil), frame...)
+	})
+	ts.OnSendMsg(func(conn *contracts.TcpConn, msg btmsg.IMsg) {
+		lock.Lock()
+		defer lock.Unlock()
+		acts[conn.Id] = msg.GetAct()
+	})
+	ts.OnSendAsync(func(conn *contracts.TcpConn, frame []byte) {
+		async <- frame
+	}, 10)
+	wg, err := ts.Serve(NewPipeListener())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		wg.Wait()
+	}()
+
+	fc := addFakeConns(ts, 3, false)
+	for _, p := range fc.pipes {
+		go func(p net.Conn) {
+			_, _ = io.Copy(io.Discard, p)
+		}(p)
+	}
+	// fakeConns不经过writeSend，这里直接交给它
+	bt := newActMsg(7, []byte("hello"))
+	for _, conn := range fc.conns {
+		bt.Retain()
+		ts.writeSend(conn, bt)
+	}
+	fc.close()
+
+	expect := bt.ToSendByte()
+	if len(frames) != 3 || len(acts) != 3 {
+		t.Fatalf("frames %d acts %d", len(frames), len(acts))
+	}
+	for id, frame := range frames {
+		if !bytes.Equal(frame, expect) || acts[id] != 7 {
+			t.Fatalf("conn %d frame %v act %d", id, frame, acts[id])
+		}
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case frame := <-async:
+			if !bytes.Equal(frame, expect) {
+				t.Fatalf("async frame %v", frame)
+			}
+		case <-time.After(time.Second * 3):
+			t.Fatal("timeout")
+		}
+	}
+}
+
+// TestServerOnSendBroadcast 广播时每个连接调用一次，异步回调慢的时候丢弃而不是阻塞写入
+func TestServerOnSendBroadcast(t *testing.T) {
+	var connCh = make(chan *contracts.TcpConn, 3)
+	var count = make(chan uint64, 10)
+	var release = make(chan struct{})
+
+	verifyNoLeaks(t)
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()))
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		connCh <- conn
+	})
+	ts.OnSend(func(conn *contracts.TcpConn, frame []byte) {
+		count <- conn.Id
+	})
+	ts.OnSendAsync(func(conn *contracts.TcpConn, frame []byte) {
+		<-release
+	}, 1)
+	swg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		swg.Wait()
+	}()
+	defer close(release)
+
+	var received = make(chan uint16, 10)
+	for i := 0; i < 3; i++ {
+		cli := newTestClient(ts.listener.Addr().String())
+		cli.OnReceive(func(msg btmsg.IMsg) {
+			received <- msg.GetAct()
+		})
+		_, err = cli.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cli.Close()
+		_ = cli.SendStruct(1, nil)
+		<-connCh
+	}
+
+	ts.Broadcast(newActMsg(8, nil))
+	var ids = map[uint64]bool{}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-received:
+		case <-time.After(time.Second * 3):
+			t.Fatal("broadcast blocked by send hook")
+		}
+		ids[<-count] = true
+	}
+	if len(ids) != 3 {
+		t.Fatalf("hook conns %v", ids)
+	}
+	// 第一个在回调里阻塞，第二个排队，第三个丢弃
+	if n := ts.SendHookDropped(); n != 1 {
+		t.Fatalf("dropped %d", n)
+	}
+}
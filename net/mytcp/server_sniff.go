@@ -0,0 +1,64 @@
+package mytcp
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+var errPeekNotSupported = errors.New("peek not supported")
+
+type peeker interface {
+	Peek(n int) ([]byte, error)
+}
+
+// serverSniff 连接开头是magic的按帧读，否则用text读
+type serverSniff struct {
+	magic [2]byte
+	text  btmsg.IMsgReader
+}
+
+// WithProtocolSniffing 同时接受btmsg的帧和换行结尾的文本，比如老客户端迁移期间
+// 连接的前两个字节是magic时用server的reader，reader要用 btmsg.WithMagic 设置同样的magic，
+// 否则用text读，比如 btmsg.NewLineReader，连接的 TcpConn.Protocol 是 ProtocolText，
+// 发给它的消息只写body加上\n。只对tcp连接有效，websocket的连接总是帧
+func WithProtocolSniffing(magic [2]byte, text btmsg.IMsgReader) ServerOption {
+	return func(l *tcpServer) {
+		l.sniff = &serverSniff{magic: magic, text: text}
+	}
+}
+
+// connReader 探测连接的协议，返回这个连接使用的reader
+// 读前两个字节出错时按帧处理，由reader读到同样的错误走正常的关闭流程
+func (l *tcpServer) connReader(conn *contracts.TcpConn) btmsg.IMsgReader {
+	if l.sniff == nil {
+		return l.reader
+	}
+
+	p, ok := conn.Conn.(peeker)
+	if !ok {
+		return l.reader
+	}
+
+	head, err := p.Peek(len(l.sniff.magic))
+	if err != nil || bytes.Equal(head, l.sniff.magic[:]) {
+		return l.reader
+	}
+
+	conn.Lock.Lock()
+	conn.Protocol = contracts.ProtocolText
+	conn.Lock.Unlock()
+	return l.sniff.text
+}
+
+// sendFrame 要写入conn的数据，文本连接只写body和换行，调用方持有conn.Lock的读锁
+func sendFrame(conn *contracts.TcpConn, msg btmsg.IMsg) []byte {
+	if conn.Protocol == contracts.ProtocolText {
+		body := msg.BodyByte()
+		frame := make([]byte, 0, len(body)+1)
+		return append(append(frame, body...), '\n')
+	}
+	return msg.ToSendByte()
+}
@@ -0,0 +1,86 @@
+package mytcp
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+const actText uint16 = 50
+
+// TestProtocolSniffing 文本客户端和帧客户端同时连接同一个server
+func TestProtocolSniffing(t *testing.T) {
+	verifyNoLeaks(t)
+
+	var magic = [2]byte{0xAB, 0xCD}
+	var protocols = make(chan contracts.ConnProtocol, 4)
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq(), btmsg.WithMagic(magic, 0)),
+		WithProtocolSniffing(magic, btmsg.NewLineReader(actText, 0)))
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		protocols <- conn.Protocol
+		rsp := btmsg.NewReplyTo(msg)
+		rsp.SetAct(msg.GetAct())
+		rsp.SetBody(append([]byte("echo "), msg.BodyByte()...))
+		conn.Send(rsp)
+	})
+	swg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		swg.Wait()
+	}()
+
+	text, err := net.Dial("tcp", ts.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer text.Close()
+
+	var replies = make(chan btmsg.IMsg, 2)
+	cli := newTestClient(ts.listener.Addr().String(), WithMagic(magic))
+	cli.OnReceive(func(msg btmsg.IMsg) {
+		replies <- msg.Clone()
+	})
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	_, _ = text.Write([]byte("hello\r\nworld\n"))
+	// SendMsg发的是调用方创建的消息，不带magic
+	_ = cli.SendStruct(7, echoReq{Msg: "framed"})
+
+	lines := bufio.NewReader(text)
+	_ = text.SetReadDeadline(time.Now().Add(time.Second * 3))
+	for _, expect := range []string{"echo hello\n", "echo world\n"} {
+		line, err := lines.ReadString('\n')
+		if err != nil || line != expect {
+			t.Fatalf("line %q err %v", line, err)
+		}
+	}
+
+	select {
+	case msg := <-replies:
+		if msg.GetAct() != 7 || !strings.HasPrefix(string(msg.BodyByte()), "echo {") {
+			t.Fatalf("act %d body %q", msg.GetAct(), msg.BodyByte())
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout")
+	}
+
+	var got = map[contracts.ConnProtocol]int{}
+	for i := 0; i < 3; i++ {
+		got[<-protocols]++
+	}
+	if got[contracts.ProtocolText] != 2 || got[contracts.ProtocolFramed] != 1 {
+		t.Fatalf("protocols %v", got)
+	}
+}
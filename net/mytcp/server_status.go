@@ -0,0 +1,30 @@
+package mytcp
+
+import (
+	"github.com/rs/zerolog/log"
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// WithStatusAct 收到act时框架自己回复 Stats，body用请求的codec编码，不会交给OnReceive
+// 监控可以用现有的客户端查询，不需要 WithHealthEndpoint，任何连接都可以查询，不要把act暴露给不信任的客户端
+func WithStatusAct(act uint16) ServerOption {
+	return func(l *tcpServer) {
+		l.status = &act
+	}
+}
+
+// handleStatus 是status的act时回复，返回true
+func (l *tcpServer) handleStatus(conn *contracts.TcpConn, msg btmsg.IMsg) bool {
+	if l.status == nil || msg.GetAct() != *l.status {
+		return false
+	}
+	if l.releaseMsg {
+		defer msg.Release()
+	}
+
+	if err := conn.ReplyMsg(msg, l.Stats()); err != nil {
+		log.Err(err)
+	}
+	return true
+}
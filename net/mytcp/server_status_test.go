@@ -0,0 +1,62 @@
+package mytcp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+const actStatus uint16 = 70
+
+// TestStatusAct 回复能解码成 ServerStats
+func TestStatusAct(t *testing.T) {
+	verifyNoLeaks(t)
+
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), WithStatusAct(actStatus))
+	if st := ts.Stats(); st.State != ServerStateIdle || st.Uptime != 0 {
+		t.Fatalf("stats %+v", st)
+	}
+	var received = make(chan struct{}, 1)
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		received <- struct{}{}
+	})
+
+	ln := NewPipeListener()
+	wg, err := ts.Serve(ln)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cli := newTestClient("pipe", WithDialer(ln.Dial))
+	if _, err = cli.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	var st ServerStats
+	if err = cli.Call(context.Background(), actStatus, nil, &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.State != ServerStateRunning || st.Uptime <= 0 || st.Conns != 1 || st.TotalConns != 1 || len(st.ReceivedSizes) != len(SizeBuckets)+1 {
+		t.Fatalf("stats %+v", st)
+	}
+	select {
+	case <-received:
+		t.Fatal("status act passed to OnReceive")
+	default:
+	}
+
+	cli.Close()
+	<-cli.Done()
+	waitServerConns(t, ts, 0)
+	if st = ts.Stats(); st.Conns != 0 {
+		t.Fatalf("stats %+v", st)
+	}
+
+	ts.Shutdown()
+	wg.Wait()
+	if st = ts.Stats(); st.State != ServerStateStopped || st.Uptime != 0 {
+		t.Fatalf("stats %+v", st)
+	}
+}
@@ -1,78 +1,383 @@
 package mytcp
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
 	"fmt"
+	"github.com/pkg/errors"
 	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
 	"github.com/winkb/tcp1/util"
 	"net"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+type clientReceiveCallback = contracts.ClientReceiveCallback
+type clientCloseCallback = contracts.ClientCloseCallback
+type clientErrorCallback func(err error)
 
+// DialFunc 和 net.Dialer.DialContext 一样，可以替换成socks5等代理
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+const (
+	clientStateIdle = iota
+	clientStateConnected
+	clientStateReconnecting
+	// clientStateRestoring 重连成功，OnReconnected 还没返回，只有回调里的发送会写到新连接上
+	clientStateRestoring
+	clientStateClosed
 )
 
-type clientReceiveCallback func(msg btmsg.IMsg)
-type clientCloseCallback func(isServer bool, isClient bool)
+// ITcpClient 保留给还在用 mytcp.ITcpClient 的代码，和 contracts.ITcpClient 是同一个类型，
+// 连接的读写循环(LoopRead等)已经不在接口里
+//
+// Deprecated: 使用 contracts.ITcpClient
+type ITcpClient = contracts.ITcpClient
 
-type ITcpClient interface {
+// clientLoop 连接的读写循环，client内部使用，不属于 ITcpClient
+type clientLoop interface {
 	LoopRead()
-	ReleaseChan()
 	LoopWrite()
 	LoopReceive()
-	Close()
-	Send(v btmsg.IMsg)
-	OnReceive(f clientReceiveCallback)
-	OnClose(f clientCloseCallback)
-	Start() (wg *sync.WaitGroup, err error)
-	HasClosed() chan bool
+	ReleaseChan()
 }
 
+var _ clientLoop = (*tcpClient)(nil)
 var _ ITcpClient = (*tcpClient)(nil)
 
 type tcpClient struct {
-	input           chan btmsg.IMsg
-	output          chan btmsg.IMsg
-	wait            chan bool
-	conn            net.Conn
-	closeCallback   clientCloseCallback
-	receiveCallback clientReceiveCallback
-	addr            string
+	input             chan []byte
+	inputHigh         chan []byte // contracts.PriorityHigh 的消息，不受 WithSendQueue 的policy影响
+	output            chan btmsg.IMsg
+	wait              chan bool
+	conn              net.Conn
+	closeCallback     clientCloseCallback
+	receiveCallback   clientReceiveCallback
+	errorCallback     clientErrorCallback
+	addr              string
+	dialTimeout       time.Duration
+	tlsConfig         *tls.Config
+	head              func() btmsg.IHead
+	reader            btmsg.IMsgReader
+	maxMsgSize        uint32
+	byteOrder         binary.ByteOrder
+	magic             *[2]byte
+	compressor        btmsg.Compressor
+	compressThreshold int
+	calls             *clientCalls
+	heartbeat         clientHeartbeat
+	state             int
+	stateLock         sync.RWMutex
+	copySendBytes     bool
+	done              chan struct{}
+	doneOnce          sync.Once
+	localAddr         string
+	dialControl       func(network, address string, c syscall.RawConn) error
+	dialer            DialFunc
+	transport         Transport
+	wsPath            string
+	readIdleTimeout   time.Duration
+	counter           clientCounter
+	closing           int32
+	stop              chan struct{}
+	stopOnce          sync.Once
+	ready             chan struct{}
+	hookInput         chan []byte   // OnReconnected 里发送的消息，每个连接一个
+	released          chan struct{} // 关闭之后LoopWrite才开始写input里的消息
+	reconnect         clientReconnect
+	reconnected       clientReconnectedCallback
+	router            clientRouter
+	panicCallback     clientPanicCallback
+	panicPolicy       PanicPolicy
+	closed            chan bool
+	errLock           sync.Mutex
+	err               error
+	connErr           error
+	addrs             clientAddrs
+	resolver          *clientResolver
+	writeBuffer       clientWriteBuffer
+	sendQueue         clientSendQueue
+	codec             btmsg.Codec
+	passControl       bool
+	traceHook         TraceHook
+	sizes             msgSizes
+	network           string
 }
 
 func (l *tcpClient) Start() (wg *sync.WaitGroup, err error) {
+	return l.StartContext(context.Background())
+}
+
+// StartContext ctx 控制连接服务端的过程，取消或者超时都会让Start返回错误
+// 连接成功之后ctx被取消等同于调用Close
+func (l *tcpClient) StartContext(ctx context.Context) (wg *sync.WaitGroup, err error) {
 	wg = &sync.WaitGroup{}
 	// conn server
-	err = l.connServer()
+	conn, err := l.connServer(ctx)
 	if err != nil {
+		l.setErr(err)
+		l.closeStop()
+		l.closeDone()
+		return
+	}
+
+	l.stateLock.Lock()
+	if l.state != clientStateIdle {
+		l.stateLock.Unlock()
+		_ = conn.Close()
+		err = ErrClientClosed
 		return
 	}
+	l.conn = conn
+	l.state = clientStateConnected
+	l.stateLock.Unlock()
+
+	var loopWg = &sync.WaitGroup{}
+	l.startConnLoops(loopWg)
+	// on msg
+	util.MyGoWg(loopWg, "conn_receive", l.LoopReceive)
+	// 连接断开之后决定重连还是结束
+	util.MyGoWg(loopWg, "conn_supervise", func() {
+		l.supervise(ctx, loopWg)
+	})
+
+	util.MyGoWg(wg, "conn_done", func() {
+		loopWg.Wait()
+		l.closeDone()
+	})
+
+	return
+}
+
+// startConnLoops 每个连接各自的协程，连接断开后退出
+func (l *tcpClient) startConnLoops(wg *sync.WaitGroup) {
 	// read
 	util.MyGoWg(wg, "conn_read", l.LoopRead)
 	// write
 	util.MyGoWg(wg, "conn_write", l.LoopWrite)
-	// on msg
-	util.MyGoWg(wg, "conn_receive", l.LoopReceive)
 
-	return
+	if l.heartbeat.interval > 0 {
+		l.heartbeat.touch()
+		util.MyGoWg(wg, "conn_heartbeat", l.LoopHeartbeat)
+	}
+}
+
+// current 当前连接和它的关闭信号，重连之后会变
+func (l *tcpClient) current() (net.Conn, chan bool) {
+	l.stateLock.RLock()
+	defer l.stateLock.RUnlock()
+
+	return l.conn, l.wait
 }
 
-func (l *tcpClient) connServer() error {
-	conn, err := net.Dial("tcp", l.addr)
+// connected 当前连接着，不在重连中
+func (l *tcpClient) connected() bool {
+	l.stateLock.RLock()
+	defer l.stateLock.RUnlock()
+
+	return l.state == clientStateConnected
+}
+
+func (l *tcpClient) closeStop() {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+}
+
+func (l *tcpClient) closeDone() {
+	l.doneOnce.Do(func() {
+		close(l.closed)
+		close(l.done)
+	})
+}
+
+// Done 客户端彻底结束并且所有协程都退出之后关闭，开启重连时单次断开不会关闭
+func (l *tcpClient) Done() <-chan struct{} {
+	return l.done
+}
+
+// Err Done关闭之前返回nil，之后返回结束的原因，和context.Context.Err一样
+// 调用Close是 ErrClientClosed，连接断开是 ErrConnClosed 或读取时的错误，
+// 连接失败是 *DialError，放弃重连是 ErrReconnectGaveUp
+func (l *tcpClient) Err() error {
+	select {
+	case <-l.done:
+	default:
+		return nil
+	}
+
+	l.errLock.Lock()
+	defer l.errLock.Unlock()
+	return l.err
+}
+
+// setErr 只记录第一个原因
+func (l *tcpClient) setErr(err error) {
+	l.errLock.Lock()
+	defer l.errLock.Unlock()
+
+	if l.err == nil {
+		l.err = err
+	}
+}
+
+// setConnErr 记录当前连接断开的原因，同一个连接只记录第一个
+func (l *tcpClient) setConnErr(err error) {
+	l.errLock.Lock()
+	defer l.errLock.Unlock()
+
+	if l.connErr == nil {
+		l.connErr = err
+	}
+}
+
+func (l *tcpClient) takeConnErr() error {
+	l.errLock.Lock()
+	defer l.errLock.Unlock()
+
+	err := l.connErr
+	l.connErr = nil
+	if err == nil {
+		err = ErrConnClosed
+	}
+	return err
+}
+
+func (l *tcpClient) defaultDialer() (DialFunc, error) {
+	var d = &net.Dialer{
+		Control: l.dialControl,
+	}
+
+	if l.localAddr != "" {
+		local, err := net.ResolveTCPAddr(l.dialNetwork(), l.localAddr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "resolve local addr %q", l.localAddr)
+		}
+		d.LocalAddr = local
+	}
+
+	return d.DialContext, nil
+}
+
+func (l *tcpClient) connServer(ctx context.Context) (net.Conn, error) {
+	var dial = l.dialer
+	if dial == nil && l.transport != nil {
+		dial = l.transport.Dial
+	}
+	if dial == nil {
+		var err error
+		dial, err = l.defaultDialer()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if l.resolver != nil {
+		dial = l.resolver.wrap(dial)
+	}
+	if l.wsPath != "" {
+		dial = l.wsDial(dial)
+	}
+
+	// 超时包括tls握手，多个地址时是所有地址加起来的时间
+	if l.dialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.dialTimeout)
+		defer cancel()
+	}
+
+	addrs := l.addrs.candidates()
+	if len(addrs) == 1 {
+		return l.dialAddr(ctx, dial, addrs[0])
+	}
+
+	var errs []error
+	for i, addr := range addrs {
+		// 剩下的时间平均分给剩下的地址，避免一个地址把时间用完
+		var addrCtx = ctx
+		var cancel context.CancelFunc = func() {}
+		if deadline, ok := ctx.Deadline(); ok {
+			addrCtx, cancel = context.WithTimeout(ctx, time.Until(deadline)/time.Duration(len(addrs)-i))
+		}
+
+		conn, err := l.dialAddr(addrCtx, dial, addr)
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, joinDialErrors(errs)
+}
+
+func (l *tcpClient) dialAddr(ctx context.Context, dial DialFunc, addr string) (net.Conn, error) {
+	conn, err := dial(ctx, l.dialNetwork(), addr)
 	if err != nil {
-		return err
+		l.addrs.fail(addr)
+		return nil, newDialError(addr, err)
 	}
-	l.conn = conn
-	return nil
+
+	// websocket握手时已经用wss
+	if l.tlsConfig != nil && l.wsPath == "" {
+		tc := tls.Client(conn, l.clientTLSConfig(addr))
+		err = tc.HandshakeContext(ctx)
+		if err != nil {
+			_ = conn.Close()
+			l.addrs.fail(addr)
+			return nil, newDialError(addr, err)
+		}
+		conn = tc
+	}
+
+	l.addrs.success(addr)
+	atomic.StoreInt64(&l.counter.connectedAt, time.Now().UnixNano())
+	return &countConn{Conn: conn, counter: &l.counter}, nil
 }
 
-func (l *tcpClient) handelReadClose(isServer bool, isClient bool) {
-	close(l.wait)
-	if l.closeCallback != nil {
-		l.closeCallback(isServer, isClient)
+func (l *tcpClient) clientTLSConfig(addr string) *tls.Config {
+	if l.tlsConfig.ServerName != "" || l.tlsConfig.InsecureSkipVerify {
+		return l.tlsConfig
+	}
+
+	cfg := l.tlsConfig.Clone()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	cfg.ServerName = host
+	return cfg
+}
+
+// TLSConnectionState 返回tls握手结果，可用于证书校验，非tls连接时ok为false
+func (l *tcpClient) TLSConnectionState() (state tls.ConnectionState, ok bool) {
+	conn, _ := l.current()
+	if cc, ok := conn.(*countConn); ok {
+		conn = cc.Conn
+	}
+	if ws, ok := conn.(*wsConn); ok {
+		conn = ws.UnderlyingConn()
+	}
+
+	tc, ok := conn.(*tls.Conn)
+	if !ok {
+		return
 	}
+	return tc.ConnectionState(), true
 }
 
-func (l *tcpClient) handelReceive(msg btmsg.IMsg) {
-	if l.receiveCallback != nil {
-		l.receiveCallback(msg)
+func (l *tcpClient) handelReadClose(wait chan bool, isServer bool, isClient bool) {
+	close(wait)
+	l.calls.reset()
+	if l.closeCallback != nil {
+		l.closeCallback(isServer, isClient)
 	}
 }
 
@@ -80,31 +385,79 @@ func (l *tcpClient) OnClose(f clientCloseCallback) {
 	l.closeCallback = f
 }
 
+func (l *tcpClient) handelError(err error) {
+	if l.errorCallback != nil {
+		l.errorCallback(err)
+	}
+}
+
+func (l *tcpClient) OnError(f clientErrorCallback) {
+	l.errorCallback = f
+}
+
 func (l *tcpClient) LoopRead() {
+	rawConn, wait := l.current()
+
+	var raw = rawConn
+	if l.readIdleTimeout > 0 {
+		raw = &idleConn{Conn: rawConn, idle: l.readIdleTimeout}
+	}
+	var conn = NewWrapConn(newBufConn(raw))
+	// 服务端 WithAutoBatch 合并的消息拆开
+	var reader = btmsg.NewBatchReader(l.reader)
 
 	for {
-		r := btmsg.NewReader(func() btmsg.IHead {
-			return btmsg.NewMsgHeadTcp()
-		})
-		res := r.ReadMsg(NewWrapConn(l.conn))
+		res := reader.ReadMsg(conn)
 		if err := res.GetErr(); err != nil {
+			if l.readIdleTimeout > 0 && isTimeout(err) {
+				err = errors.Wrapf(ErrReadIdleTimeout, "no data in %v", l.readIdleTimeout)
+				l.setConnErr(err)
+				l.handelError(err)
+				_ = rawConn.Close()
+				l.handelReadClose(wait, true, false)
+				return
+			}
+
 			if res.IsCloseByServer() {
-				l.handelReadClose(true, false)
+				l.handelReadClose(wait, true, false)
 				return
 			}
 
 			if res.IsCloseByClient() {
-				l.handelReadClose(false, true)
+				l.handelReadClose(wait, false, true)
 				return
 			}
 
-			if err != nil {
-				l.log("conn read", err)
+			// 帧已经错乱，后面的数据没法再解析，只能断开
+			if errors.Is(err, btmsg.ErrMsgTooLarge) {
+				atomic.AddUint64(&l.counter.oversized, 1)
+			}
+			err = errors.Wrap(err, "conn read")
+			l.setConnErr(err)
+			l.handelError(err)
+			_ = rawConn.Close()
+			l.handelReadClose(wait, true, false)
+			return
+		}
+
+		l.heartbeat.touch()
+		atomic.AddUint64(&l.counter.msgReceived, 1)
+
+		msg := res.GetMsg()
+		l.sizes.observeReceived(msg)
+		if btmsg.IsControlAct(msg.GetAct()) {
+			l.handleControl(msg)
+			if !l.passControl {
 				continue
 			}
+		} else if l.calls.dispatch(msg) {
+			continue
 		}
 
-		l.output <- res.GetMsg()
+		select {
+		case l.output <- msg:
+		case <-l.stop:
+		}
 	}
 }
 
@@ -113,72 +466,398 @@ func (l *tcpClient) log(msg string, err interface{}) {
 }
 
 func (l *tcpClient) LoopWrite() {
+	conn, wait := l.current()
+	write := func(bt []byte) {
+		err := writeFull(conn, bt)
+		atomic.AddInt64(&l.counter.pending, -1)
+		if err != nil {
+			l.log("conn write", err)
+			return
+		}
+		atomic.AddUint64(&l.counter.msgSent, 1)
+		l.sizes.observeSent(nil, len(bt))
+	}
+
+	if !l.writeRestoring(wait, write) {
+		return
+	}
+	if l.writeBuffer.size > 0 {
+		l.loopWriteBuffered(conn, wait)
+		return
+	}
+
+	ps := prioritySelector[[]byte]{high: l.inputHigh, normal: l.input}
 	for {
-		select {
-		case msg, ok := <-l.input:
-			if !ok {
-				return
-			}
+		if bt, ok := ps.try(); ok {
+			write(bt)
+			continue
+		}
 
-			_, err := l.conn.Write(msg.ToSendByte())
-			if err != nil {
-				l.log("conn write", err)
-				continue
-			}
-		case <-l.wait:
+		select {
+		case bt := <-l.inputHigh:
+			ps.took(true)
+			write(bt)
+		case bt := <-l.input:
+			ps.took(false)
+			write(bt)
+		case <-wait:
 			return
 		}
 	}
 }
 
+// writeRestoring OnReconnected 返回之前只写回调里发送的消息，其他的留在input里
+// 返回false表示连接已经断开
+func (l *tcpClient) writeRestoring(wait chan bool, write func(bt []byte)) bool {
+	l.stateLock.RLock()
+	hookInput, released := l.hookInput, l.released
+	l.stateLock.RUnlock()
+
+	for {
+		select {
+		case <-released:
+			return true
+		default:
+		}
+
+		select {
+		case bt := <-hookInput:
+			write(bt)
+		case <-released:
+			return true
+		case <-wait:
+			return false
+		}
+	}
+}
+
 func (l *tcpClient) LoopReceive() {
 	for {
 		select {
-		case bt, ok := <-l.output:
-			if !ok {
-				return
-			}
-			l.handelReceive(bt)
-		case <-l.wait:
+		case msg := <-l.output:
+			l.safeReceive(msg)
+		case <-l.stop:
 			return
 		}
 	}
 }
 
+// Deprecated: 收发chan由客户端自己管理，不再需要调用，保留只是为了兼容，多次调用也没有影响
 func (l *tcpClient) ReleaseChan() {
-	select {
-	case <-l.wait:
-	default:
-		close(l.output)
-		close(l.input)
+}
+
+// Close 开启了 WithWriteBuffer 时先把缓冲区写出去再关闭，最多等 closeFlushTimeout
+// 实现 io.Closer，可以重复调用，总是返回nil，需要等发送队列写完用 CloseGraceful
+func (l *tcpClient) Close() error {
+	l.flushBeforeClose()
+	l.setErr(ErrClientClosed)
+
+	// 先关闭连接让阻塞的发送和写协程返回，再改状态，closing 让它们返回 ErrClientClosed
+	atomic.StoreInt32(&l.closing, 1)
+	l.closeStop()
+	conn, _ := l.current()
+	if conn != nil {
+		_ = conn.Close()
 	}
+
+	l.stateLock.Lock()
+	l.state = clientStateClosed
+	last := l.conn
+	l.stateLock.Unlock()
+
+	if last == nil {
+		// 还没连接成功过，没有协程需要等待
+		l.closeDone()
+	} else if last != conn {
+		// 期间重连成功换了连接
+		_ = last.Close()
+	}
+
+	return nil
 }
 
-func (l *tcpClient) Close() {
-	l.conn.Close()
-	l.ReleaseChan()
+// CloseGraceful 不再接受新的发送，等已经在排队的消息写完再关闭连接，最多等待timeout
+// 超时返回的错误里带有没写出去的消息数量，Close则是直接关闭
+func (l *tcpClient) CloseGraceful(timeout time.Duration) error {
+	atomic.StoreInt32(&l.closing, 1)
+
+	var deadline = time.Now().Add(timeout)
+	var ticker = time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+
+	var dropped int64
+	for {
+		dropped = atomic.LoadInt64(&l.counter.pending)
+		if dropped <= 0 || time.Now().After(deadline) {
+			break
+		}
+
+		_, wait := l.current()
+		select {
+		case <-wait:
+			// 连接已经断开，排队的消息不可能再写出去
+		case <-ticker.C:
+			continue
+		}
+		break
+	}
+
+	l.Close()
+
+	select {
+	case <-l.done:
+	case <-time.After(time.Until(deadline)):
+	}
+
+	if dropped > 0 {
+		return errors.Errorf("close graceful: %d msgs dropped", dropped)
+	}
+
+	return nil
 }
 
+// Deprecated: 使用Done，和Done同时关闭，不会发送值
 func (l *tcpClient) HasClosed() chan bool {
-	return l.wait
+	return l.closed
+}
+
+func (l *tcpClient) Send(v btmsg.IMsg) error {
+	return l.SendMsg(v)
+}
+
+// SendMsg 调用过Close返回 ErrClientClosed，连接没建立或者已经断开返回 ErrNotConnected
+func (l *tcpClient) SendMsg(msg btmsg.IMsg) (err error) {
+	return l.SendMsgPriority(msg, contracts.PriorityNormal)
+}
+
+// SendMsgPriority 和SendMsg一样，contracts.PriorityHigh 的消息先于排队的普通消息写入，
+// 连续写了一些高优先级的消息之后会插入一个普通消息，普通消息不会一直等
+func (l *tcpClient) SendMsgPriority(msg btmsg.IMsg, prio contracts.Priority) (err error) {
+	return l.sendMsg(msg, prio, false)
+}
+
+// sendMsg early 见 sendPriority
+func (l *tcpClient) sendMsg(msg btmsg.IMsg, prio contracts.Priority, early bool) (err error) {
+	if l.traceHook != nil {
+		var end func(err error)
+		_, end = l.startSpan(context.Background(), SpanSend, msg)
+		defer func() {
+			end(err)
+		}()
+	}
+
+	bt, err := l.encode(msg)
+	if err != nil {
+		return err
+	}
+	return l.sendPriority(bt, prio, nil, early)
+}
+
+// SendBytes 直接发送已经编码好的帧，不做任何转换
+// 调用之后不要再修改v，除非开启了 WithCopySendBytes
+func (l *tcpClient) SendBytes(v []byte) error {
+	if l.copySendBytes {
+		v = append([]byte(nil), v...)
+	}
+	return l.send(v)
+}
+
+func (l *tcpClient) send(bt []byte) error {
+	return l.sendCancel(bt, nil)
 }
 
-func (l *tcpClient) Send(v btmsg.IMsg) {
-	l.input <- v
+func (l *tcpClient) sendCancel(bt []byte, cancel <-chan struct{}) error {
+	return l.sendPriority(bt, contracts.PriorityNormal, cancel, false)
+}
+
+// sendPriority 开启重连时，连接断开期间的发送会等到重连成功并且OnReconnected返回之后再发出去
+// cancel 关闭时放弃等待，early 是 OnReconnected 回调里的发送和心跳，回调返回之前就写到新连接上
+func (l *tcpClient) sendPriority(bt []byte, prio contracts.Priority, cancel <-chan struct{}, early bool) error {
+	input := l.input
+	if prio == contracts.PriorityHigh {
+		input = l.inputHigh
+	}
+
+	for {
+		if atomic.LoadInt32(&l.closing) != 0 {
+			return ErrClientClosed
+		}
+
+		// 阻塞之前释放锁，对端不读时Close拿不到写锁会一直卡住
+		l.stateLock.RLock()
+		state, wait, ready, hookInput := l.state, l.wait, l.ready, l.hookInput
+		l.stateLock.RUnlock()
+
+		switch state {
+		case clientStateClosed:
+			return ErrClientClosed
+		case clientStateIdle:
+			return ErrNotConnected
+		case clientStateRestoring:
+			if early {
+				return l.sendRestoring(bt, hookInput, wait, cancel)
+			}
+			fallthrough
+		case clientStateReconnecting:
+			select {
+			case <-ready:
+				continue
+			case <-l.stop:
+				return ErrNotConnected
+			case <-cancel:
+				return ErrNotConnected
+			}
+		}
+
+		// 写入socket之后由LoopWrite减掉
+		atomic.AddInt64(&l.counter.pending, 1)
+
+		if prio != contracts.PriorityHigh {
+			if handled, err := l.tryEnqueue(bt); handled {
+				return err
+			}
+		}
+
+		select {
+		case <-wait:
+			atomic.AddInt64(&l.counter.pending, -1)
+			if l.reconnect.enabled() {
+				continue
+			}
+			return ErrNotConnected
+		case <-l.stop:
+			atomic.AddInt64(&l.counter.pending, -1)
+			// 没有开启重连时连接断开也会关闭stop，这时和 <-wait 一样
+			if atomic.LoadInt32(&l.closing) != 0 {
+				return ErrClientClosed
+			}
+			return ErrNotConnected
+		case <-cancel:
+			atomic.AddInt64(&l.counter.pending, -1)
+			return ErrNotConnected
+		case input <- bt:
+			return nil
+		}
+	}
+}
+
+// sendRestoring 新连接断开时不再等下一次重连，OnReconnected 返回错误之后会重试
+func (l *tcpClient) sendRestoring(bt []byte, input chan []byte, wait chan bool, cancel <-chan struct{}) error {
+	// 写入socket之后由LoopWrite减掉
+	atomic.AddInt64(&l.counter.pending, 1)
+
+	select {
+	case input <- bt:
+		return nil
+	case <-wait:
+	case <-l.stop:
+	case <-cancel:
+	}
+	atomic.AddInt64(&l.counter.pending, -1)
+	return ErrNotConnected
+}
+
+// SendChunks 把msg拆成不超过chunkSize的分片依次发送，服务端要开启 WithChunkAssembly
+// 中途失败时已经发出去的分片会在服务端超时丢弃
+func (l *tcpClient) SendChunks(msg btmsg.IMsg, chunkSize int) error {
+	for _, chunk := range btmsg.SplitChunks(msg, chunkSize) {
+		err := l.SendMsg(chunk)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newMsg 按 WithCodec 编码body，没设置时由head决定
+func (l *tcpClient) newMsg(hd btmsg.IHead) *btmsg.Msg {
+	return btmsg.NewMsgWithCodec(hd, nil, l.codec)
+}
+
+// SendStruct 用act和v构造消息后发送，v的编码方式见 WithCodec
+func (l *tcpClient) SendStruct(act uint16, v any) error {
+	return l.sendStruct(act, v, false)
+}
+
+func (l *tcpClient) sendStruct(act uint16, v any, early bool) error {
+	hd := l.head()
+	hd.SetAct(act)
+
+	msg := l.newMsg(hd)
+	err := msg.FromStruct(v)
+	if err != nil {
+		return err
+	}
+
+	return l.sendMsg(msg, contracts.PriorityNormal, early)
 }
 
 func (l *tcpClient) OnReceive(f clientReceiveCallback) {
 	l.receiveCallback = f
 }
 
-func NewTcpClient(addr string) *tcpClient {
-	return &tcpClient{
-		input:           make(chan btmsg.IMsg),
+// OnReceiveMsg 每收到一个完整的帧回调一次，和OnReceive是同一个回调
+func (l *tcpClient) OnReceiveMsg(f clientReceiveCallback) {
+	l.receiveCallback = f
+}
+
+func NewTcpClientTLS(addr string, cfg *tls.Config, opts ...ClientOption) *tcpClient {
+	return NewTcpClient(addr, append([]ClientOption{WithTLS(cfg)}, opts...)...)
+}
+
+func NewTcpClient(addr string, opts ...ClientOption) *tcpClient {
+	l := &tcpClient{
+		input:           make(chan []byte),
+		inputHigh:       make(chan []byte),
 		output:          make(chan btmsg.IMsg),
 		wait:            make(chan bool),
+		done:            make(chan struct{}),
+		closed:          make(chan bool),
+		stop:            make(chan struct{}),
+		ready:           make(chan struct{}),
 		conn:            nil,
 		closeCallback:   nil,
 		receiveCallback: nil,
 		addr:            addr,
+		head:            btmsg.FactoryMsgHeadTcp(),
+		calls:           newClientCalls(),
+		released:        make(chan struct{}),
+	}
+	// 第一次连接没有 OnReconnected，不用等
+	close(l.released)
+
+	l.addrs.add(addr)
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	if l.sendQueue.size > 0 {
+		l.input = make(chan []byte, l.sendQueue.size)
+		l.inputHigh = make(chan []byte, writeQueueSize)
+	} else if l.writeBuffer.size > 0 {
+		// 有排队的消息才能一次写入多条
+		l.input = make(chan []byte, writeQueueSize)
+		l.inputHigh = make(chan []byte, writeQueueSize)
+	}
+
+	if l.byteOrder != nil {
+		l.head = btmsg.FactoryWithByteOrder(l.head, l.byteOrder)
 	}
+	if l.magic != nil {
+		l.head = btmsg.FactoryWithMagic(l.head, *l.magic)
+	}
+
+	var readerOpts = []btmsg.ReaderOption{btmsg.WithMaxBodySize(l.maxMsgSize), btmsg.WithReplyAct(l.calls.replyAct)}
+	if l.compressThreshold > 0 || l.compressor != nil {
+		if l.compressor == nil {
+			l.compressor = btmsg.DefaultCompressor
+		}
+		readerOpts = append(readerOpts, btmsg.WithDecompressor(l.compressor, 0))
+	}
+
+	if l.reader == nil {
+		l.reader = btmsg.NewReaderWithCodec(l.head, l.codec, readerOpts...)
+	}
+
+	return l
 }
@@ -0,0 +1,694 @@
+package mytcp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+func TestClientDialRefused(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	cli := newTestClient(addr, WithDialTimeout(time.Second))
+	_, err = cli.Start()
+	if !errors.Is(err, ErrDialRefused) {
+		t.Fatalf("expect ErrDialRefused, got %v", err)
+	}
+}
+
+func TestClientDialContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cli := newTestClient("127.0.0.1:1")
+	_, err := cli.StartContext(ctx)
+	if err == nil {
+		t.Fatal("expect err")
+	}
+
+	var dialErr *DialError
+	if !errors.As(err, &dialErr) {
+		t.Fatalf("expect DialError, got %T", err)
+	}
+}
+
+type echoReq struct {
+	Msg string
+}
+
+func TestClientSendStruct(t *testing.T) {
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()))
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		s.Send(conn, msg)
+	})
+	swg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		swg.Wait()
+	}()
+
+	var got = make(chan echoReq, 1)
+	cli := newTestClient(ts.listener.Addr().String())
+	cli.OnReceive(func(msg btmsg.IMsg) {
+		var v echoReq
+		_, _ = msg.ToStruct(&v)
+		if msg.GetAct() == 100 {
+			got <- v
+		}
+	})
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	err = cli.SendStruct(100, echoReq{Msg: "shutdown;"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case v := <-got:
+		if v.Msg != "shutdown;" {
+			t.Fatalf("got %q", v.Msg)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout")
+	}
+}
+
+func TestClientMaxMsgSize(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		hd := btmsg.NewMsgHeadTcpSeq()
+		hd.SetAct(1)
+		hd.SetSize(1024)
+		_, _ = conn.Write(hd.ToBytes())
+		time.Sleep(time.Second)
+	}()
+
+	var gotErr = make(chan error, 1)
+	var closed = make(chan bool, 1)
+	cli := newTestClient(ln.Addr().String(), WithMaxMsgSize(512))
+	cli.OnError(func(err error) {
+		gotErr <- err
+	})
+	cli.OnClose(func(isServer bool, isClient bool) {
+		closed <- true
+	})
+	wg, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err = <-gotErr:
+		if !errors.Is(err, btmsg.ErrMsgTooLarge) {
+			t.Fatalf("expect ErrMsgTooLarge, got %v", err)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout")
+	}
+
+	<-closed
+	wg.Wait()
+
+	var tooLarge *btmsg.MsgTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Size != 1024 {
+		t.Fatalf("expect declared size 1024, got %v", err)
+	}
+	if st := cli.Stats(); st.Oversized != 1 {
+		t.Fatalf("oversized %d", st.Oversized)
+	}
+}
+
+func TestClientSendErr(t *testing.T) {
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {})
+	defer stop()
+
+	cli := newTestClient(ts.listener.Addr().String())
+
+	err := cli.SendStruct(1, echoReq{})
+	if !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("expect ErrNotConnected, got %v", err)
+	}
+
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cli.SendStruct(1, echoReq{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cli.Close()
+
+	err = cli.SendStruct(1, echoReq{})
+	if !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("expect ErrClientClosed, got %v", err)
+	}
+}
+
+func TestClientSendBytes(t *testing.T) {
+	var got = make(chan echoReq, 1)
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		var v echoReq
+		_, _ = msg.ToStruct(&v)
+		got <- v
+	})
+	defer stop()
+
+	cli := newTestClient(ts.listener.Addr().String(), WithCopySendBytes())
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	hd := btmsg.NewMsgHeadTcpSeq()
+	hd.SetAct(1)
+	msg := btmsg.NewMsg(hd, nil)
+	_ = msg.FromStruct(echoReq{Msg: "bytes"})
+
+	bt := msg.ToSendByte()
+	err = cli.SendBytes(bt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range bt {
+		bt[i] = 0
+	}
+
+	select {
+	case v := <-got:
+		if v.Msg != "bytes" {
+			t.Fatalf("got %q", v.Msg)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout")
+	}
+}
+
+func TestClientStartContextCancel(t *testing.T) {
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {})
+	defer stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cli := newTestClient(ts.listener.Addr().String())
+	wg, err := cli.StartContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+
+	select {
+	case <-cli.Done():
+	case <-time.After(time.Second * 3):
+		t.Fatal("expect done")
+	}
+
+	wg.Wait()
+
+	err = cli.SendStruct(1, echoReq{})
+	if !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("expect ErrClientClosed, got %v", err)
+	}
+}
+
+func TestClientLocalAddr(t *testing.T) {
+	var remote = make(chan string, 1)
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		remote <- conn.Conn.RemoteAddr().String()
+	})
+	defer stop()
+
+	cli := newTestClient(ts.listener.Addr().String(), WithLocalAddr("127.0.0.1:0"))
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	_ = cli.SendStruct(1, echoReq{})
+	if got := <-remote; got != cli.conn.LocalAddr().String() {
+		t.Fatalf("server see %s, client local %s", got, cli.conn.LocalAddr())
+	}
+
+	bad := newTestClient(ts.listener.Addr().String(), WithLocalAddr("not an addr"))
+	_, err = bad.Start()
+	if err == nil {
+		t.Fatal("expect invalid local addr err")
+	}
+}
+
+func TestClientStats(t *testing.T) {
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		s.Send(conn, msg)
+	})
+	defer stop()
+
+	cli := newTestClient(ts.listener.Addr().String())
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	for i := 0; i < 3; i++ {
+		err = cli.Call(context.Background(), 1, &callReq{N: i}, &callRsp{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	st := cli.Stats()
+	if st.MsgSent != 3 || st.MsgReceived != 3 {
+		t.Fatalf("msg sent %d received %d", st.MsgSent, st.MsgReceived)
+	}
+	if st.BytesSent == 0 || st.BytesSent != st.BytesReceived {
+		t.Fatalf("bytes sent %d received %d", st.BytesSent, st.BytesReceived)
+	}
+	if st.Connected <= 0 {
+		t.Fatal("expect connected duration")
+	}
+}
+
+func TestClientCloseGraceful(t *testing.T) {
+	var lock sync.Mutex
+	var got int
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		lock.Lock()
+		got++
+		lock.Unlock()
+	})
+	defer stop()
+
+	cli := newTestClient(ts.listener.Addr().String())
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 100
+	for i := 0; i < n; i++ {
+		err = cli.SendStruct(1, echoReq{Msg: "x"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = cli.CloseGraceful(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cli.SendStruct(1, echoReq{})
+	if !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("expect ErrClientClosed, got %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second * 3)
+	for {
+		lock.Lock()
+		v := got
+		lock.Unlock()
+		if v == n {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server got %d, expect %d", v, n)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+// TestClientCloseWhileSendBlocked 对端不读，发送卡在写协程上时Close也要马上返回
+func TestClientCloseWhileSendBlocked(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	cli := newTestClient(ln.Addr().String())
+	wg, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := <-accepted
+	defer peer.Close()
+
+	sendErr := make(chan error, 1)
+	go func() {
+		body := make([]byte, 64*1024)
+		for {
+			if err := cli.SendMsg(newActMsg(1, body)); err != nil {
+				sendErr <- err
+				return
+			}
+		}
+	}()
+	// 等socket的缓冲区写满
+	time.Sleep(time.Millisecond * 300)
+
+	closed := make(chan struct{})
+	go func() {
+		_ = cli.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second * 3):
+		t.Fatal("close blocked by pending send")
+	}
+
+	if err = <-sendErr; !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("expect ErrClientClosed, got %v", err)
+	}
+	wg.Wait()
+}
+
+func TestClientServerCloseWithoutReleaseChan(t *testing.T) {
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		s.CloseConn(conn)
+	})
+	defer stop()
+
+	cli := newTestClient(ts.listener.Addr().String())
+	cli.OnClose(func(isServer bool, isClient bool) {
+		// 旧代码里的调用，现在多次调用也不会panic
+		cli.ReleaseChan()
+		cli.ReleaseChan()
+	})
+	wg, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = cli.SendStruct(1, echoReq{})
+
+	select {
+	case <-cli.Done():
+	case <-time.After(time.Second * 3):
+		t.Fatal("expect done")
+	}
+	wg.Wait()
+
+	err = cli.SendStruct(1, echoReq{})
+	if !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("expect ErrNotConnected, got %v", err)
+	}
+
+	cli.Close()
+	cli.Close()
+
+	if !errors.Is(cli.Err(), ErrConnClosed) {
+		t.Fatalf("expect Err ErrConnClosed, got %v", cli.Err())
+	}
+}
+
+func TestClientErr(t *testing.T) {
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {})
+	defer stop()
+
+	cli := newTestClient(ts.listener.Addr().String())
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cli.Err() != nil {
+		t.Fatalf("expect nil before done, got %v", cli.Err())
+	}
+
+	cli.Close()
+	<-cli.Done()
+	<-cli.HasClosed()
+
+	if !errors.Is(cli.Err(), ErrClientClosed) {
+		t.Fatalf("expect ErrClientClosed, got %v", cli.Err())
+	}
+
+	bad := newTestClient("127.0.0.1:1")
+	_, _ = bad.Start()
+	<-bad.Done()
+
+	var dialErr *DialError
+	if !errors.As(bad.Err(), &dialErr) {
+		t.Fatalf("expect DialError, got %v", bad.Err())
+	}
+}
+
+// tagCodec body前面加一个字节，确认两端都用了同一个codec
+type tagCodec struct{}
+
+func (tagCodec) Marshal(v any) ([]byte, error) {
+	bt, err := btmsg.JsonCodec{}.Marshal(v)
+	return append([]byte{'#'}, bt...), err
+}
+
+func (tagCodec) Unmarshal(bt []byte, v any) error {
+	if len(bt) == 0 || bt[0] != '#' {
+		return errors.New("missing tag")
+	}
+	return btmsg.JsonCodec{}.Unmarshal(bt[1:], v)
+}
+
+func (tagCodec) ID() byte {
+	return 100
+}
+
+func TestClientWithCodec(t *testing.T) {
+	ts := NewTcpServer("0", btmsg.NewReaderWithCodec(btmsg.FactoryMsgHeadTcpSeq(), tagCodec{}))
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		var req callReq
+		if _, err := msg.ToStruct(&req); err != nil {
+			return
+		}
+		_ = msg.FromStruct(&callRsp{N: req.N + 1})
+		s.Send(conn, msg)
+	})
+	swg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		swg.Wait()
+	}()
+
+	cli := newTestClient(ts.listener.Addr().String(), WithCodec(tagCodec{}))
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	var rsp callRsp
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	err = cli.Call(ctx, 1, &callReq{N: 1}, &rsp)
+	if err != nil || rsp.N != 2 {
+		t.Fatalf("rsp %+v err %v", rsp, err)
+	}
+}
+
+func TestClientLargeBody(t *testing.T) {
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		s.Send(conn, msg)
+	})
+	defer stop()
+
+	var got = make(chan []byte, 1)
+	cli := newTestClient(ts.listener.Addr().String(), WithMaxMsgSize(8<<20))
+	cli.OnReceive(func(msg btmsg.IMsg) {
+		got <- msg.BodyByte()
+	})
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	body := make([]byte, 5<<20)
+	for i := range body {
+		body[i] = byte(i)
+	}
+	hd := btmsg.NewMsgHeadTcpSeq()
+	hd.SetAct(1)
+	err = cli.SendMsg(btmsg.NewMsg(hd, body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case bt := <-got:
+		if len(bt) != len(body) || bt[len(bt)-1] != body[len(body)-1] || bt[12345] != body[12345] {
+			t.Fatalf("got %d bytes", len(bt))
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timeout")
+	}
+}
+
+func TestClientBatchedFrames(t *testing.T) {
+	const n = 100
+
+	var serverGot []int
+	var lock sync.Mutex
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		var v callReq
+		_, _ = msg.ToStruct(&v)
+		lock.Lock()
+		serverGot = append(serverGot, v.N)
+		lock.Unlock()
+		s.Send(conn, msg)
+	})
+	defer stop()
+
+	cli := newTestClient(ts.listener.Addr().String())
+	var got = make(chan int, n)
+	cli.OnReceive(func(msg btmsg.IMsg) {
+		var v callReq
+		_, _ = msg.ToStruct(&v)
+		got <- v.N
+	})
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	// 100个帧拼在一起一次写出去
+	var bt []byte
+	for i := 0; i < n; i++ {
+		hd := btmsg.NewMsgHeadTcpSeq()
+		hd.SetAct(1)
+		msg := btmsg.NewMsg(hd, nil)
+		_ = msg.FromStruct(callReq{N: i})
+		bt = append(bt, msg.ToSendByte()...)
+	}
+	err = cli.SendBytes(bt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < n; i++ {
+		select {
+		case v := <-got:
+			if v != i {
+				t.Fatalf("frame %d got %d", i, v)
+			}
+		case <-time.After(time.Second * 3):
+			t.Fatalf("timeout after %d frames", i)
+		}
+	}
+
+	lock.Lock()
+	if len(serverGot) != n {
+		t.Fatalf("server got %d frames", len(serverGot))
+	}
+	for i, v := range serverGot {
+		if v != i {
+			t.Fatalf("server frame %d got %d", i, v)
+		}
+	}
+	lock.Unlock()
+
+	if st := cli.Stats(); st.MsgReceived != n {
+		t.Fatalf("msg received %d", st.MsgReceived)
+	}
+}
+
+func TestClientByteOrder(t *testing.T) {
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq(), btmsg.WithByteOrder(binary.LittleEndian), btmsg.WithMaxBodySize(1024)))
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		s.Send(conn, msg)
+	})
+	swg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		swg.Wait()
+	}()
+
+	cli := newTestClient(ts.listener.Addr().String(), WithByteOrder(binary.LittleEndian))
+	var got = make(chan string, 1)
+	cli.OnReceive(func(msg btmsg.IMsg) {
+		var v echoReq
+		_, _ = msg.ToStruct(&v)
+		got <- v.Msg
+	})
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	_ = cli.SendStruct(1, echoReq{Msg: "little"})
+	select {
+	case v := <-got:
+		if v != "little" {
+			t.Fatalf("got %q", v)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout")
+	}
+
+	// 默认大端的客户端连小端的服务端，长度解析错，服务端断开连接
+	mismatch := newTestClient(ts.listener.Addr().String())
+	_, err = mismatch.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mismatch.Close()
+
+	_ = mismatch.SendStruct(1, echoReq{Msg: "big"})
+	select {
+	case <-mismatch.Done():
+	case <-time.After(time.Second * 3):
+		t.Fatal("expect server to close conn")
+	}
+	if n := ts.OversizedMsgs(); n != 1 {
+		t.Fatalf("oversized %d", n)
+	}
+}
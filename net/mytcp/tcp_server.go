@@ -1,8 +1,11 @@
 package mytcp
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -10,38 +13,116 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/winkb/tcp1/btmsg"
-	. "github.com/winkb/tcp1/contracts"
+	"github.com/winkb/tcp1/contracts"
 	. "github.com/winkb/tcp1/util"
 )
 
 type tcpServer struct {
-	listener        net.Listener
-	closeCallback   ServerCloseCallback
-	receiveCallback ServerReceiveCallback
-	addr            string
-	conns           sync.Map
-	lastId          uint64
-	stop            int
-	lock            sync.RWMutex
-	reader          btmsg.IMsgReader
-	timeout         time.Duration
-}
-
-func NewTcpServer(port string, r btmsg.IMsgReader) *tcpServer {
-	return &tcpServer{
-		listener: nil,
-		closeCallback: func(s ITcpServer, conn *TcpConn, isServer bool, isClient bool) {
+	listener net.Listener
+	// traceHook 见 WithServerTraceHook
+	traceHook   TraceHook
+	addr        string
+	conns       sync.Map
+	lastId      uint64
+	stop        int
+	lock        sync.RWMutex
+	reader      btmsg.IMsgReader
+	timeout     time.Duration
+	oversized   uint64
+	releaseMsg  bool
+	latency     *serverLatency
+	chunks      *chunkConfig
+	passControl bool
+	// ctx Shutdown时取消，每个连接的context从它派生
+	ctx    context.Context
+	cancel context.CancelFunc
+	// wg Serve返回的WaitGroup，WsHandler接入的连接也加在上面
+	wg        *sync.WaitGroup
+	transport Transport
+	health    *serverHealth
+	broadcast *broadcastWorkers
+	dispatch  *dispatchWorkers
+	// identities BindIdentity 绑定的身份
+	identities serverIdentities
+	bindRetry  serverBindRetry
+	logger     Logger
+	network    string
+	// broadcastTimeout 广播给每个连接的等待时间，0一直等
+	broadcastTimeout time.Duration
+	schedule         serverSchedule
+	firstMsgTimeout  time.Duration
+	// firstMsgTimeouts 因为 WithFirstMessageTimeout 关闭的连接数
+	firstMsgTimeouts uint64
+	bans             serverBans
+	sendHooks        serverSendHooks
+	sizes            msgSizes
+	sniff            *serverSniff
+	offline          serverOffline
+	relay            Relay
+	backpressure     *serverBackpressure
+	dedup            serverDedup
+	autoBatch        *autoBatch
+	rates            serverRates
+	routeLimits      serverRouteLimits
+	handleErrs       serverHandleErrors
+	admin            *adminConns
+	// status WithStatusAct 设置的act
+	status *uint16
+	// connCount conns里的连接数，Stats 不用遍历conns
+	connCount int64
+	// startedAt 最近一次Serve的时间
+	startedAt time.Time
+	events    eventRing
+	tlsConfig *tls.Config
+	// closeOnce closeErr 见Close，Restart时重置
+	closeOnce sync.Once
+	closeErr  error
+	// startCtx StartContext 的ctx
+	startCtx context.Context
+	// callbacks 见 serverCallbacks，callbackLock 只在设置时使用
+	callbacks    atomic.Pointer[serverCallbacks]
+	callbackLock sync.Mutex
+}
+
+// serverLoop 每个连接的读写循环，server内部使用，不属于 ITcpServer
+type serverLoop interface {
+	LoopAccept(f func(conn net.Conn))
+	LoopRead(ctx context.Context, conn *contracts.TcpConn)
+	ConsumeInput(ctx context.Context, conn *contracts.TcpConn)
+	ConsumeOutput(ctx context.Context, conn *contracts.TcpConn)
+}
+
+var _ contracts.ITcpServer = (*tcpServer)(nil)
+var _ serverLoop = (*tcpServer)(nil)
+
+func NewTcpServer(port string, r btmsg.IMsgReader, opts ...ServerOption) *tcpServer {
+	l := &tcpServer{
+		listener:  nil,
+		addr:      listenAddr(port),
+		conns:     sync.Map{},
+		lastId:    0,
+		stop:      0,
+		lock:      sync.RWMutex{},
+		reader:    r,
+		timeout:   time.Second * 3,
+		transport: TCPTransport{},
+		logger:    &log.Logger,
+		events:    eventRing{size: defaultEventLogSize},
+	}
+
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+	l.callbacks.Store(&serverCallbacks{
+		receive: func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
 		},
-		receiveCallback: func(s ITcpServer, conn *TcpConn, msg btmsg.IMsg) {
+		close: func(s contracts.ITcpServer, conn *contracts.TcpConn, reason contracts.CloseReason) {
 		},
-		addr:    ":" + port,
-		conns:   sync.Map{},
-		lastId:  0,
-		stop:    0,
-		lock:    sync.RWMutex{},
-		reader:  r,
-		timeout: time.Second * 3,
+	})
+
+	for _, opt := range opts {
+		opt(l)
 	}
+
+	return l
 }
 
 func (l *tcpServer) LoopAccept(f func(conn net.Conn)) {
@@ -69,6 +150,11 @@ func (l *tcpServer) LoopAccept(f func(conn net.Conn)) {
 	}
 }
 
+// OversizedMsgs 因为消息超过reader的 btmsg.WithMaxBodySize 而断开的连接数
+func (l *tcpServer) OversizedMsgs() uint64 {
+	return atomic.LoadUint64(&l.oversized)
+}
+
 func (l *tcpServer) getConnAutoIncId() uint64 {
 	for {
 		val := atomic.LoadUint64(&l.lastId)
@@ -80,37 +166,55 @@ func (l *tcpServer) getConnAutoIncId() uint64 {
 	}
 }
 
-func (l *tcpServer) getConnById(id uint64) (conn *TcpConn, ok bool) {
+func (l *tcpServer) getConnById(id uint64) (conn *contracts.TcpConn, ok bool) {
 	v, o := l.conns.Load(id)
 	if !o {
 		return
 	}
 
-	conn, ok = v.(*TcpConn)
+	conn, ok = v.(*contracts.TcpConn)
 
 	return
 }
 
-func (l *tcpServer) saveConn(id uint64, conn *TcpConn) {
+func (l *tcpServer) saveConn(id uint64, conn *contracts.TcpConn) {
 	l.conns.Store(id, conn)
+	atomic.AddInt64(&l.connCount, 1)
 }
 
 func (l *tcpServer) removeConn(id uint64) {
-	l.conns.Delete(id)
+	if _, ok := l.conns.LoadAndDelete(id); ok {
+		atomic.AddInt64(&l.connCount, -1)
+	}
 }
 
-func (l *tcpServer) ConsumeOutput(conn *TcpConn) {
+// ConsumeOutput 按LoopRead读到的顺序处理，同一个连接的回调串行执行，前一个返回之后才处理下一个
+// 设置了 WithDispatchWorkers 时按同样的顺序交给连接对应的worker
+func (l *tcpServer) ConsumeOutput(ctx context.Context, conn *contracts.TcpConn) {
 	for {
 		select {
-		case <-conn.WaitConn:
+		case <-ctx.Done():
 			return
 		case msg := <-conn.Output:
+			if l.dispatch != nil {
+				l.dispatchTo(ctx, conn, msg)
+				continue
+			}
 			l.handelReceive(conn, msg)
 		}
 	}
 }
 
-func (l *tcpServer) writeSend(conn *TcpConn, msg btmsg.IMsg) {
+func (l *tcpServer) writeSend(conn *contracts.TcpConn, msg btmsg.IMsg) {
+	// 对应Send里的Reserve
+	defer conn.Unreserve(msg)
+	l.writeMsg(conn, msg)
+}
+
+func (l *tcpServer) writeMsg(conn *contracts.TcpConn, msg btmsg.IMsg) {
+	// 对应Send里的Retain
+	defer msg.Release()
+
 	l.lock.RLock()
 	defer l.lock.RUnlock()
 
@@ -118,7 +222,6 @@ func (l *tcpServer) writeSend(conn *TcpConn, msg btmsg.IMsg) {
 		return
 	}
 
-	_ = conn.Conn.SetWriteDeadline(time.Now().Add(l.timeout))
 	id := conn.Id
 
 	var err error
@@ -129,40 +232,81 @@ func (l *tcpServer) writeSend(conn *TcpConn, msg btmsg.IMsg) {
 		return
 	}
 
-	_, err = conn.Conn.Write(msg.ToSendByte())
+	frame := sendFrame(conn, msg)
+	l.fireSend(conn, msg, frame)
+	// 回调的耗时不算在写超时里
+	_ = conn.Conn.SetWriteDeadline(time.Now().Add(l.timeout))
+	err = writeFull(conn.Conn, frame)
 	if err != nil {
+		l.event(EventError, id, conn.Conn.RemoteAddr().String(), err.Error())
 		log.Err(errors.Wrapf(err, "conn %d write err", id))
+		l.closeAfterWriteErr(conn, err)
 		return
 	}
+	l.sizes.observeSent(msg, len(frame))
+	l.countSent(conn, len(frame))
+	l.dedup.recordReply(id, msg, len(frame))
 
-	log.Print("input id", id, "msg", msg.GetAct(), string(msg.BodyByte()))
+	log.Print("input id", id, "msg", btmsg.ActName(msg.GetAct()), string(msg.BodyByte()))
 }
 
-func (l *tcpServer) ConsumeInput(conn *TcpConn) {
-	for {
+// ConsumeInput 先写 PriorityHigh 的消息，见 prioritySelector
+func (l *tcpServer) ConsumeInput(ctx context.Context, conn *contracts.TcpConn) {
+	ps := prioritySelector[btmsg.IMsg]{high: conn.InputHigh, normal: conn.Input}
+	for ctx.Err() == nil {
+		if msg, ok := ps.try(); ok {
+			l.writeNext(ctx, conn, msg, &ps)
+			continue
+		}
+
 		select {
-		case <-conn.WaitConn:
+		case <-ctx.Done():
 			return
+		case msg := <-conn.InputHigh:
+			ps.took(true)
+			l.writeNext(ctx, conn, msg, &ps)
 		case msg := <-conn.Input:
-			l.writeSend(conn, msg)
+			ps.took(false)
+			l.writeNext(ctx, conn, msg, &ps)
 		}
 	}
 }
 
-func (l *tcpServer) LoopRead(conn *TcpConn) {
+// LoopRead ctx是这个连接的context，连接关闭或者Shutdown时取消
+func (l *tcpServer) LoopRead(ctx context.Context, conn *contracts.TcpConn) {
+	var chunks *btmsg.ChunkAssembler
+	if l.chunks != nil {
+		chunks = btmsg.NewChunkAssembler(l.chunks.maxSize, l.chunks.timeout)
+	}
+
+	// readErr 为nil时是ctx结束退出的，见 readCloseReason
+	var readErr error
 	defer func() {
-		select {
-		case <-conn.WaitConn:
-		default:
-			close(conn.WaitConn)
+		if chunks != nil {
+			chunks.Close()
 		}
+
+		l.handelReadClose(conn, readCloseReason(conn, readErr))
 	}()
+
+	// 收到第一个消息之前的读超时，之后清除
+	waitFirst := l.firstMsgTimeout > 0
+	if waitFirst {
+		_ = conn.Conn.SetReadDeadline(time.Now().Add(l.firstMsgTimeout))
+	}
+	// 收到的 btmsg.ActBatch 拆开之后一个一个处理
+	reader := btmsg.NewBatchReader(l.connReader(conn))
 	for {
 		select {
-		case <-conn.WaitConn:
+		case <-ctx.Done():
 			return
 		default:
-			res := l.reader.ReadMsg(conn.Conn)
+			l.waitBackpressure(ctx)
+			if ctx.Err() != nil {
+				continue
+			}
+
+			res := l.readMsg(reader, conn)
 			err := res.GetErr()
 			conn.Lock.Lock()
 			if err != nil {
@@ -172,64 +316,185 @@ func (l *tcpServer) LoopRead(conn *TcpConn) {
 			conn.Lock.Unlock()
 
 			if err != nil {
-
-				if res.IsCloseByClient() {
-					l.handelReadClose(conn, false, true)
+				readErr = err
+				l.event(EventClose, conn.Id, conn.Conn.RemoteAddr().String(), err.Error())
+				l.identities.unbind(conn.Id)
+				l.schedule.cancelConn(conn.Id)
+				l.dedup.removeConn(conn.Id)
+
+				if waitFirst && isTimeout(err) {
+					atomic.AddUint64(&l.firstMsgTimeouts, 1)
+					l.closeWithReason(conn, contracts.CloseIdleTimeout)
 					return
 				}
 
-				if res.IsCloseByServer() {
-					l.handelReadClose(conn, true, true)
+				// 正常断开不算违规，回调在defer里
+				if res.IsCloseByClient() || res.IsCloseByServer() {
 					return
 				}
 
+				if errors.Is(err, btmsg.ErrMsgTooLarge) {
+					atomic.AddUint64(&l.oversized, 1)
+				}
+				if ip := conn.GetRemoteIp(); l.bans.violation(ip, time.Now()) {
+					l.event(EventBan, conn.Id, ip, "too many violations")
+				}
+
+				// 数据已经没法继续解析，关闭连接让对端知道
+				l.closeWithReason(conn, contracts.CloseProtocolError)
 				log.Err(errors.Wrap(err, "read"))
 				return
 			}
 
-			conn.Output <- res.GetMsg()
+			if waitFirst {
+				waitFirst = false
+				_ = conn.Conn.SetReadDeadline(time.Time{})
+			}
+
+			msg := res.GetMsg()
+			l.sizes.observeReceived(msg)
+			l.countReceived(conn, msg)
+			if btmsg.IsControlAct(msg.GetAct()) {
+				if msg.GetAct() == btmsg.ActPing {
+					pong := btmsg.NewReplyTo(msg)
+					pong.SetAct(btmsg.ActPong)
+					l.SendPriority(conn, pong, contracts.PriorityHigh)
+				}
+
+				if !l.passControl {
+					if l.releaseMsg {
+						msg.Release()
+					}
+					continue
+				}
+			}
+
+			if chunks != nil && msg.GetAct() == btmsg.ActChunk {
+				full, err := chunks.Feed(msg, time.Now())
+				if l.releaseMsg {
+					msg.Release()
+				}
+				if err != nil {
+					log.Err(errors.Wrapf(err, "conn %d chunk", conn.Id))
+					continue
+				}
+				if full == nil {
+					continue
+				}
+				msg = full
+			}
+
+			if l.handleStatus(conn, msg) || l.handleAdmin(conn, msg) || l.dropDuplicate(conn, msg) {
+				continue
+			}
+
+			select {
+			case conn.Output <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// readMsg reader panic时当成读错误，断开这个连接，对端发来的数据不能让服务崩溃
+func (l *tcpServer) readMsg(reader btmsg.IMsgReader, conn *contracts.TcpConn) (res btmsg.IReadResult) {
+	defer func() {
+		if v := recover(); v != nil {
+			res = btmsg.NewReaderResult(errors.Errorf("conn %d read panic: %v", conn.Id, v), nil, nil)
 		}
+	}()
+
+	return reader.ReadMsg(conn.Conn)
+}
+
+// closeWait 通知Send这个连接已经关闭，可以重复调用，只有读协程会调用
+func closeWait(conn *contracts.TcpConn) {
+	select {
+	case <-conn.WaitConn:
+	default:
+		close(conn.WaitConn)
 	}
 }
 
-func (l *tcpServer) handelReadClose(conn *TcpConn, isServer bool, isClient bool) {
-	close(conn.WaitConn)
-	if l.closeCallback != nil {
-		l.closeCallback(l, conn, isServer, isClient)
+// handelReadClose 只在 LoopRead 退出时调用，每个连接只调用一次关闭的回调
+func (l *tcpServer) handelReadClose(conn *contracts.TcpConn, reason contracts.CloseReason) {
+	closeWait(conn)
+	if f := l.loadCallbacks().close; f != nil {
+		f(l, conn, reason)
 	}
 }
 
-func (l *tcpServer) handelReceive(conn *TcpConn, bt btmsg.IMsg) {
-	if l.receiveCallback != nil {
-		l.receiveCallback(l, conn, bt)
+// handelReceive 设置了 SetConcurrencyLimit 的act交给 dispatchLimited
+func (l *tcpServer) handelReceive(conn *contracts.TcpConn, bt btmsg.IMsg) {
+	if lim := l.routeLimits.get(bt.GetAct()); lim != nil {
+		l.dispatchLimited(lim, conn, bt)
+		return
+	}
+	l.runReceive(conn, bt)
+}
+
+func (l *tcpServer) runReceive(conn *contracts.TcpConn, bt btmsg.IMsg) {
+	if l.latency != nil {
+		l.latency.observe(bt, time.Now())
+	}
+
+	cb := l.loadCallbacks()
+	if l.traceHook != nil || cb.receiveCtx != nil {
+		l.receiveWithCtx(conn, bt)
+	} else if cb.receive != nil {
+		cb.receive(l, conn, bt)
+	}
+
+	if l.releaseMsg {
+		bt.Release()
 	}
 }
 
+// Shutdown 还没有Start、Start失败或者已经Shutdown过时直接返回
+// 只在改状态时持有锁，关闭连接和listener时不持有
 func (l *tcpServer) Shutdown() {
 	l.lock.Lock()
-	defer l.lock.Unlock()
-
-	if l.stop != 0 {
+	if l.stop != 0 || l.listener == nil {
+		l.lock.Unlock()
 		return
 	}
 
 	l.stop = 2
+	l.cancel()
+	ln := l.listener
+	l.lock.Unlock()
+
+	l.event(EventShutdown, 0, "", "begin")
 
 	l.conns.Range(func(key, value any) bool {
-		v, ok := value.(*TcpConn)
+		v, ok := value.(*contracts.TcpConn)
 		if ok {
-			_ = v.Conn.Close()
+			l.closeWithReason(v, contracts.CloseShutdown)
 		}
 		return true
 	})
 
-	err := l.listener.Close()
-	if err != nil {
+	// Close已经关闭过listener
+	err := ln.Close()
+	if err != nil && !errors.Is(err, net.ErrClosed) {
 		fmt.Println(err)
 	}
+
+	l.closeHealth()
+	l.identities.reset()
+	l.schedule.reset()
+	l.offline.reset()
+	l.dedup.reset()
+	l.event(EventShutdown, 0, "", "done")
+}
+
+func (l *tcpServer) Send(conn *contracts.TcpConn, v btmsg.IMsg) {
+	l.SendPriority(conn, v, contracts.PriorityNormal)
 }
 
-func (l *tcpServer) Send(conn *TcpConn, v btmsg.IMsg) {
+// SendPriority 和Send一样，PriorityHigh 的消息不用排在已经在等待的普通消息后面
+func (l *tcpServer) SendPriority(conn *contracts.TcpConn, v btmsg.IMsg, prio contracts.Priority) {
 	l.lock.RLock()
 	if l.stop != 0 {
 		l.lock.RUnlock()
@@ -244,7 +509,31 @@ func (l *tcpServer) Send(conn *TcpConn, v btmsg.IMsg) {
 	}
 	conn.Lock.RUnlock()
 
-	conn.Input <- v
+	if err := conn.Reserve(v); err != nil {
+		log.Err(errors.Wrapf(err, "conn %d send %s", conn.Id, btmsg.ActName(v.GetAct())))
+		return
+	}
+
+	// 写完之后在writeSend里Release，池化的消息在回调返回之后也不会被提前回收
+	v.Retain()
+	select {
+	case conn.InputFor(prio) <- v:
+	case <-conn.WaitConn:
+		conn.Unreserve(v)
+		v.Release()
+	}
+}
+
+// SendWithTimeout 和Send一样，d之内没有交给连接返回 ErrSendTimeout，连接已经关闭或者server已经停止返回 ErrConnClosed
+func (l *tcpServer) SendWithTimeout(conn *contracts.TcpConn, v btmsg.IMsg, d time.Duration) error {
+	l.lock.RLock()
+	if l.stop != 0 {
+		l.lock.RUnlock()
+		return ErrConnClosed
+	}
+	l.lock.RUnlock()
+
+	return conn.SendWithTimeout(v, d)
 }
 
 func (l *tcpServer) SendById(id uint64, v btmsg.IMsg) {
@@ -257,63 +546,180 @@ func (l *tcpServer) SendById(id uint64, v btmsg.IMsg) {
 	l.Send(conn, v)
 }
 
-func (l *tcpServer) OnReceive(f ServerReceiveCallback) {
-	l.receiveCallback = f
+// OnReceive 同一个连接的消息按发送的顺序逐个回调，不同连接之间并发
+// OnReceive 替换之前 OnReceive 或者 OnReceiveCtx 设置的回调，Start之后也可以调用，注册之前收到的消息交给之前的回调
+func (l *tcpServer) OnReceive(f contracts.ServerReceiveCallback) {
+	l.setCallbacks(func(cb *serverCallbacks) {
+		cb.receive = f
+		cb.receiveCtx = nil
+	})
+}
+
+// OnClose 和OnReceive一样，Start之后也可以调用，isServer isClient 见 CloseReason.Flags
+func (l *tcpServer) OnClose(f contracts.ServerCloseCallback) {
+	l.OnCloseReason(f.Reason())
 }
 
-func (l *tcpServer) OnClose(f ServerCloseCallback) {
-	l.closeCallback = f
+// OnCloseReason 替换 OnClose 设置的回调，每个连接只调用一次，Shutdown时还没有断开的连接也会调用
+func (l *tcpServer) OnCloseReason(f contracts.ServerCloseReasonCallback) {
+	l.setCallbacks(func(cb *serverCallbacks) {
+		cb.close = f
+	})
 }
 
+// Start 监听NewTcpServer时的端口，之后和Serve一样
 func (l *tcpServer) Start() (wg *sync.WaitGroup, err error) {
-	wg = &sync.WaitGroup{}
 	// conn server
 	err = l.listen()
 	if err != nil {
 		return
 	}
+
+	wg, err = l.Serve(l.listener)
+	if err != nil {
+		// 失败之后Shutdown什么都不做
+		_ = l.listener.Close()
+		l.lock.Lock()
+		l.listener = nil
+		l.lock.Unlock()
+	}
+	return
+}
+
+// Restart Shutdown之后重新监听NewTcpServer时的地址，OnReceive、OnClose等回调和选项都保留
+// 还在运行时返回 ErrServerRunning，会先等上一次Start的协程全部退出，不能在server的回调里调用
+// 端口是0时重新分配端口
+func (l *tcpServer) Restart() (wg *sync.WaitGroup, err error) {
+	err = l.reset()
+	if err != nil {
+		return
+	}
+
+	return l.Start()
+}
+
+// reset 重置Shutdown修改的状态和连接记录
+func (l *tcpServer) reset() error {
+	l.lock.Lock()
+	if l.stop == 0 && l.wg != nil {
+		l.lock.Unlock()
+		return ErrServerRunning
+	}
+	old := l.wg
+	l.lock.Unlock()
+
+	if old != nil {
+		old.Wait()
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.stop = 0
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+	l.listener = nil
+	l.wg = nil
+	l.closeOnce = sync.Once{}
+	l.closeErr = nil
+	l.startCtx = nil
+	l.conns.Range(func(key, value any) bool {
+		l.removeConn(key.(uint64))
+		return true
+	})
+	l.identities.reset()
+	return nil
+}
+
+// Serve 在ln上接受连接，Shutdown时关闭ln，测试可以用 NewPipeListener 代替真实的端口
+// 设置了 WithHealthEndpoint 时健康检查监听失败返回错误，ln由调用方关闭
+func (l *tcpServer) Serve(ln net.Listener) (wg *sync.WaitGroup, err error) {
+	wg = &sync.WaitGroup{}
+	err = l.listenHealth()
+	if err != nil {
+		return nil, err
+	}
+
+	l.startBroadcastWorkers(wg)
+	l.startDispatchWorkers(wg)
+	l.startSendHook(wg)
+	l.startBackpressure(wg)
+
+	if l.tlsConfig != nil {
+		ln = tls.NewListener(ln, l.tlsConfig)
+	}
+
+	l.lock.Lock()
+	l.wg = wg
+	l.listener = ln
+	l.startedAt = time.Now()
+	l.lock.Unlock()
+
 	// read
-	MyGoWg(wg, "conn_accept", func() {
+	MyGoWgCtx(l.ctx, wg, "conn_accept", func(ctx context.Context) {
 		l.LoopAccept(func(conn net.Conn) {
 			// 注意 这里不能阻塞 lock,因为accept，有lock判断
+			l.serveConn(ctx, wg, conn)
+		})
+	})
+	l.serveHealth(wg)
 
-			newId := l.getConnAutoIncId()
-			myConn := &TcpConn{
-				Conn: &wrapConn{
-					Conn: conn,
-				},
-				Id:       newId,
-				Input:    make(chan btmsg.IMsg),
-				Output:   make(chan btmsg.IMsg),
-				WaitConn: make(chan bool),
-			}
+	fmt.Println("start server " + ln.Addr().String())
 
-			MyGoWg(wg, fmt.Sprintf("%d_conn_read", newId), func() {
-				l.LoopRead(myConn)
-			})
+	return
+}
+
+// serveConn 启动conn的读写协程并保存，tcp和websocket的连接都从这里进来，调用方持有l.lock的读锁
+func (l *tcpServer) serveConn(ctx context.Context, wg *sync.WaitGroup, conn net.Conn) {
+	if l.bans.isBanned(contracts.RemoteIp(conn.RemoteAddr()), time.Now()) {
+		l.event(EventBan, 0, conn.RemoteAddr().String(), "rejected")
+		_ = conn.Close()
+		return
+	}
 
-			MyGoWg(wg, fmt.Sprintf("%d_conn_consume_input", newId), func() {
-				l.ConsumeInput(myConn)
-			})
+	newId := l.getConnAutoIncId()
+	myConn := &contracts.TcpConn{
+		Conn: &wrapConn{
+			Conn: newBufConn(conn),
+		},
+		Id:          newId,
+		Input:       make(chan btmsg.IMsg),
+		InputHigh:   make(chan btmsg.IMsg),
+		Output:      make(chan btmsg.IMsg),
+		WaitConn:    make(chan bool),
+		Budget:      l.budget(),
+		ConnectedAt: time.Now(),
+	}
 
-			MyGoWg(wg, fmt.Sprintf("%d_conn_consume_output", newId), func() {
-				l.ConsumeOutput(myConn)
-			})
+	l.event(EventConnect, newId, conn.RemoteAddr().String(), "")
 
-			fmt.Println(conn.RemoteAddr().String() + "conn success")
+	// 读协程退出时取消，另外两个协程跟着退出
+	connCtx, cancel := context.WithCancel(ctx)
 
-			l.saveConn(newId, myConn)
-		})
+	MyGoWgCtx(connCtx, wg, fmt.Sprintf("%d_conn_read", newId), func(ctx context.Context) {
+		defer cancel()
+		l.LoopRead(ctx, myConn)
 	})
 
-	fmt.Println("start server " + l.addr)
+	MyGoWgCtx(connCtx, wg, fmt.Sprintf("%d_conn_consume_input", newId), func(ctx context.Context) {
+		l.ConsumeInput(ctx, myConn)
+	})
 
-	return
+	MyGoWgCtx(connCtx, wg, fmt.Sprintf("%d_conn_consume_output", newId), func(ctx context.Context) {
+		l.ConsumeOutput(ctx, myConn)
+	})
+
+	fmt.Println(conn.RemoteAddr().String() + "conn success")
+
+	l.saveConn(newId, myConn)
 }
 
 func (l *tcpServer) listen() (err error) {
+	if l.bindRetry.attempts > 1 {
+		return l.listenRetry()
+	}
+
 	var conn net.Listener
-	conn, err = net.Listen("tcp", l.addr)
+	conn, err = l.listenOnce()
 	if err != nil {
 		err = errors.Wrap(err, "dial:"+l.addr)
 		return
@@ -322,18 +728,27 @@ func (l *tcpServer) listen() (err error) {
 	return
 }
 
-func (l *tcpServer) Broadcast(bt btmsg.IMsg) {
-	l.conns.Range(func(key, value any) bool {
-		v, ok := value.(*TcpConn)
-		if !ok {
-			return false
-		}
-		l.Send(v, bt)
-		return true
-	})
+func (l *tcpServer) listenOnce() (net.Listener, error) {
+	if nl, ok := l.transport.(networkListener); ok && l.network != "" {
+		return nl.ListenNetwork(l.network, l.addr)
+	}
+	return l.transport.Listen(l.addr)
 }
 
-func (l *tcpServer) Close(conn *TcpConn) {
+// listenAddr port可以只是端口，也可以是完整的地址，ipv6要带方括号，比如 [::1]:8000
+func listenAddr(port string) string {
+	if strings.Contains(port, ":") {
+		return port
+	}
+	return ":" + port
+}
+
+// CloseConn 服务端主动关闭conn，关闭的原因是 CloseServerClosed
+func (l *tcpServer) CloseConn(conn *contracts.TcpConn) {
+	l.closeConn(conn, contracts.CloseServerClosed)
+}
+
+func (l *tcpServer) closeConn(conn *contracts.TcpConn, reason contracts.CloseReason) {
 	l.lock.RLock()
 	defer l.lock.RUnlock()
 
@@ -346,18 +761,22 @@ func (l *tcpServer) Close(conn *TcpConn) {
 
 	var err error
 	conn.Lock.RLock()
-	defer conn.Lock.RUnlock()
-	if conn.IsClose {
+	closed := conn.IsClose
+	conn.Lock.RUnlock()
+	if closed {
 		log.Print("conn is closed, drop msg")
 		return
 	}
 
+	conn.SetCloseReason(reason)
 	err = conn.Conn.Close()
 	if err != nil {
 		log.Err(errors.Wrapf(err, "conn %d close err", id))
 		return
 	}
 
+	// 先关闭连接，正在写的writeSend出错返回之后才能拿到写锁
+	conn.Lock.Lock()
 	conn.IsClose = true
-
+	conn.Lock.Unlock()
 }
@@ -0,0 +1,663 @@
+package mytcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+func TestServerMsgTooLarge(t *testing.T) {
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq(), btmsg.WithMaxBodySize(8)))
+	swg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		swg.Wait()
+	}()
+
+	cli := newTestClient(ts.listener.Addr().String())
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	_ = cli.SendStruct(1, echoReq{Msg: "longer than 8 bytes"})
+
+	select {
+	case <-cli.Done():
+	case <-time.After(time.Second * 3):
+		t.Fatal("expect server to close conn")
+	}
+
+	if n := ts.OversizedMsgs(); n != 1 {
+		t.Fatalf("oversized %d", n)
+	}
+}
+
+func TestServerReleaseMsg(t *testing.T) {
+	const n = 50
+
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq(), btmsg.WithPooledMsg()), WithReleaseMsg())
+	// Send会Retain到写完，回调返回之后消息被回收也不影响
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		s.Send(conn, msg)
+	})
+	swg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		swg.Wait()
+	}()
+
+	cli := newTestClient(ts.listener.Addr().String())
+	var got = make(chan string, n)
+	cli.OnReceive(func(msg btmsg.IMsg) {
+		var v echoReq
+		_, _ = msg.ToStruct(&v)
+		got <- v.Msg
+	})
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	for i := 0; i < n; i++ {
+		_ = cli.SendStruct(1, echoReq{Msg: fmt.Sprintf("msg-%d", i)})
+	}
+
+	for i := 0; i < n; i++ {
+		select {
+		case v := <-got:
+			if v != fmt.Sprintf("msg-%d", i) {
+				t.Fatalf("frame %d got %q", i, v)
+			}
+		case <-time.After(time.Second * 3):
+			t.Fatalf("timeout after %d", i)
+		}
+	}
+}
+
+func TestServerMagicResync(t *testing.T) {
+	var magic = [2]byte{0xAB, 0xCD}
+	var skipped = make(chan int, 1)
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq(), btmsg.WithMagic(magic, 0), btmsg.WithCorruptCallback(func(n int) {
+		skipped <- n
+	})))
+	var got = make(chan string, 1)
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		var v echoReq
+		_, _ = msg.ToStruct(&v)
+		got <- v.Msg
+	})
+	swg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		swg.Wait()
+	}()
+
+	cli := newTestClient(ts.listener.Addr().String(), WithMagic(magic))
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	_ = cli.SendBytes([]byte{1, 2, 3, 4, 5})
+	_ = cli.SendStruct(1, echoReq{Msg: "after garbage"})
+
+	select {
+	case v := <-got:
+		if v != "after garbage" {
+			t.Fatalf("got %q", v)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout")
+	}
+	if n := <-skipped; n != 5 {
+		t.Fatalf("skipped %d", n)
+	}
+}
+
+func TestServerChunkAssembly(t *testing.T) {
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq(), btmsg.WithMaxBodySize(64<<10+64)), WithChunkAssembly(4<<20, time.Second))
+	var got = make(chan btmsg.IMsg, 1)
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		got <- msg
+	})
+	swg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		swg.Wait()
+	}()
+
+	cli := newTestClient(ts.listener.Addr().String())
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	body := bytes.Repeat([]byte("chunk"), 400<<10)
+	err = cli.SendChunks(newActMsg(9, body), 64<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg := <-got:
+		if msg.GetAct() != 9 || !bytes.Equal(msg.BodyByte(), body) {
+			t.Fatalf("act %d len %d", msg.GetAct(), len(msg.BodyByte()))
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timeout")
+	}
+}
+
+// 回调里广播请求的拷贝，同时修改请求本身，两个客户端收到的都是拷贝时的内容
+func TestServerBroadcastClone(t *testing.T) {
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()))
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		rsp := msg.Clone()
+		rsp.SetAct(2)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Broadcast(rsp)
+		}()
+
+		for i := 0; i < 100; i++ {
+			_ = msg.FromStruct(echoReq{Msg: fmt.Sprintf("mutated-%d", i)})
+			msg.SetAct(uint16(i))
+			msg.ToSendByte()
+		}
+		wg.Wait()
+	})
+	swg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		swg.Wait()
+	}()
+
+	var got = make(chan string, 2)
+	var clis []*tcpClient
+	for i := 0; i < 2; i++ {
+		cli := newTestClient(ts.listener.Addr().String())
+		cli.OnReceive(func(msg btmsg.IMsg) {
+			var v echoReq
+			_, _ = msg.ToStruct(&v)
+			got <- fmt.Sprintf("%d %s", msg.GetAct(), v.Msg)
+		})
+		_, err = cli.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cli.Close()
+		clis = append(clis, cli)
+	}
+
+	// 等两个连接都注册到服务端
+	deadline := time.Now().Add(time.Second * 3)
+	for connCount(ts) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("conns not ready")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	_ = clis[0].SendStruct(1, echoReq{Msg: "original"})
+	for i := 0; i < 2; i++ {
+		select {
+		case v := <-got:
+			if v != "2 original" {
+				t.Fatalf("got %q", v)
+			}
+		case <-time.After(time.Second * 3):
+			t.Fatal("timeout")
+		}
+	}
+}
+
+func connCount(ts *tcpServer) int {
+	var n int
+	ts.conns.Range(func(key, value any) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+type panicReader struct {
+	btmsg.IMsgReader
+}
+
+func (l *panicReader) ReadMsg(r btmsg.IReader) btmsg.IReadResult {
+	res := l.IMsgReader.ReadMsg(r)
+	if res.GetErr() == nil && res.GetMsg().GetAct() == 13 {
+		panic("bad frame")
+	}
+	return res
+}
+
+// 畸形的数据和reader的panic都只断开那一个连接
+func TestServerMalformedInput(t *testing.T) {
+	ts := NewTcpServer("0", &panicReader{btmsg.NewReader(btmsg.FactoryMsgHeadVersioned(btmsg.VersionLatest))})
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		s.Send(conn, msg)
+	})
+	swg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		swg.Wait()
+	}()
+
+	bad := btmsg.FactoryMsgHeadVersioned(btmsg.VersionLatest)()
+	bad.SetAct(13)
+	huge := btmsg.FactoryMsgHeadVersioned(btmsg.VersionLatest)()
+	huge.SetSize(0xFFFFFFFF)
+
+	var inputs = [][]byte{
+		// 不认识的版本号
+		{9, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0},
+		// 长度很大但是没有数据
+		append(huge.ToBytes(), 1, 2, 3),
+		btmsg.NewMsg(bad, nil).ToSendByte(),
+	}
+
+	for i, bt := range inputs {
+		cli := newTestClient(ts.listener.Addr().String(), WithHeadFactory(btmsg.FactoryMsgHeadVersioned(btmsg.VersionLatest)))
+		_, err = cli.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = cli.SendBytes(bt)
+		if i == 1 {
+			// 对端没发完就断开，server不能一直等着也不能按声明的长度分配
+			cli.Close()
+		}
+
+		select {
+		case <-cli.Done():
+		case <-time.After(time.Second * 3):
+			t.Fatalf("input %d: expect conn closed", i)
+		}
+		cli.Close()
+	}
+
+	cli := newTestClient(ts.listener.Addr().String(), WithHeadFactory(btmsg.FactoryMsgHeadVersioned(btmsg.VersionLatest)))
+	var got = make(chan uint16, 1)
+	cli.OnReceive(func(msg btmsg.IMsg) {
+		got <- msg.GetAct()
+	})
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	_ = cli.SendStruct(1, echoReq{Msg: "ok"})
+	select {
+	case act := <-got:
+		if act != 1 {
+			t.Fatalf("act %d", act)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("server stopped serving")
+	}
+}
+
+// panicCodec 用来确认原始body的转发没有经过codec
+type panicCodec struct{}
+
+func (panicCodec) Marshal(v any) ([]byte, error) { panic("codec marshal") }
+
+func (panicCodec) Unmarshal(bt []byte, v any) error { panic("codec unmarshal") }
+
+func (panicCodec) ID() byte { return 0 }
+
+// 从一个连接收到的body原样转发给另一个连接，不经过codec
+func TestServerRelayRawBody(t *testing.T) {
+	var target = make(chan *contracts.TcpConn, 1)
+	ts := NewTcpServer("0", btmsg.NewReaderWithCodec(btmsg.FactoryMsgHeadTcpSeq(), panicCodec{}))
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		if msg.GetAct() == 1 {
+			target <- conn
+			return
+		}
+
+		out := newActMsg(msg.GetAct(), nil)
+		out.SetBody(msg.GetBody())
+		s.Send(<-target, out)
+	})
+	swg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		swg.Wait()
+	}()
+
+	var got = make(chan [32]byte, 1)
+	dst := newTestClient(ts.listener.Addr().String(), WithCodec(panicCodec{}))
+	dst.OnReceive(func(msg btmsg.IMsg) {
+		got <- sha256.Sum256(msg.GetBody())
+	})
+	_, err = dst.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	_ = dst.SendMsg(newActMsg(1, nil))
+
+	src := newTestClient(ts.listener.Addr().String(), WithCodec(panicCodec{}))
+	_, err = src.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	payload := make([]byte, 100*1024)
+	_, _ = rand.Read(payload)
+	msg := newActMsg(2, nil)
+	msg.SetBody(payload)
+	err = src.SendMsg(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case sum := <-got:
+		if sum != sha256.Sum256(payload) {
+			t.Fatal("checksum mismatch")
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("relay timeout")
+	}
+}
+
+// 同一个server同一个act，两个客户端用不同的编码，都按各自的编码收到回复
+func TestServerMixedContentType(t *testing.T) {
+	var types = make(chan byte, 2)
+	ts := NewTcpServer("0", btmsg.NewReaderWithCodec(btmsg.FactoryMsgHeadTcpV2(), btmsg.JsonCodec{}))
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		types <- msg.GetContentType()
+		req, err := btmsg.ToStructT[callReq](msg)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_ = conn.ReplyMsg(msg, &callRsp{N: req.N * 2})
+	})
+	swg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		swg.Wait()
+	}()
+
+	for i, c := range []btmsg.Codec{btmsg.JsonCodec{}, btmsg.GobCodec{}} {
+		cli := newTestClient(ts.listener.Addr().String(), WithHeadFactory(btmsg.FactoryMsgHeadTcpV2()), WithCodec(c))
+		_, err = cli.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var rsp callRsp
+		err = cli.Call(context.Background(), 3, &callReq{N: i + 1}, &rsp)
+		cli.Close()
+		if err != nil || rsp.N != (i+1)*2 {
+			t.Fatalf("codec %d: rsp %+v err %v", c.ID(), rsp, err)
+		}
+		if got := <-types; got != c.ID() {
+			t.Fatalf("server got content type %d, expect %d", got, c.ID())
+		}
+	}
+}
+
+// TestServerRestart 同一个server Shutdown之后Restart，回调和选项不用重新设置
+func TestServerRestart(t *testing.T) {
+	verifyNoLeaks(t)
+
+	var closed int64
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), WithBroadcastWorkers(2))
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		var req echoReq
+		_, _ = msg.ToStruct(&req)
+		_ = ts.BindIdentity(conn, req.Msg, KickOld)
+		_ = conn.ReplyMsg(msg, &req)
+	})
+	ts.OnClose(func(s contracts.ITcpServer, conn *contracts.TcpConn, isServer bool, isClient bool) {
+		atomic.AddInt64(&closed, 1)
+	})
+
+	call := func() {
+		cli := newTestClient(ts.listener.Addr().String())
+		_, err := cli.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cli.Close()
+
+		var rsp echoReq
+		err = cli.Call(context.Background(), 1, &echoReq{Msg: "tom"}, &rsp)
+		if err != nil || rsp.Msg != "tom" {
+			t.Fatalf("rsp %+v err %v", rsp, err)
+		}
+		if len(ts.IdentityConns("tom")) != 1 {
+			t.Fatal("identity not bound")
+		}
+		<-ts.BroadcastAsync(newActMsg(2, nil))
+	}
+
+	wg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	call()
+	if _, err = ts.Restart(); !errors.Is(err, ErrServerRunning) {
+		t.Fatalf("expect ErrServerRunning, got %v", err)
+	}
+	ts.Shutdown()
+	wg.Wait()
+
+	wg, err = ts.Restart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if connCount(ts) != 0 || len(ts.IdentityConns("tom")) != 0 {
+		t.Fatal("conns not reset")
+	}
+	call()
+	ts.Shutdown()
+	wg.Wait()
+
+	if n := atomic.LoadInt64(&closed); n != 2 {
+		t.Fatalf("expect 2 close callbacks, got %d", n)
+	}
+}
+
+// TestServerFirstMessageTimeout 只建立连接或者只发了半个消息的连接被关闭，发过消息的连接不受影响
+func TestServerFirstMessageTimeout(t *testing.T) {
+	verifyNoLeaks(t)
+
+	var closed = make(chan bool, 3)
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), WithFirstMessageTimeout(time.Millisecond*50))
+	ts.OnClose(func(s contracts.ITcpServer, conn *contracts.TcpConn, isServer bool, isClient bool) {
+		closed <- isServer
+	})
+	swg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		swg.Wait()
+	}()
+
+	cli := newTestClient(ts.listener.Addr().String())
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	_ = cli.SendStruct(1, echoReq{Msg: "hi"})
+
+	silent, err := net.Dial("tcp", ts.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	partial, err := net.Dial("tcp", ts.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer partial.Close()
+	_, _ = partial.Write([]byte{1, 2})
+
+	for _, c := range []net.Conn{silent, partial} {
+		_ = c.SetReadDeadline(time.Now().Add(time.Second * 3))
+		_, err = c.Read(make([]byte, 1))
+		if !errors.Is(err, io.EOF) {
+			t.Fatalf("expect EOF, got %v", err)
+		}
+		if isServer := <-closed; !isServer {
+			t.Fatal("expect closed by server")
+		}
+	}
+
+	time.Sleep(time.Millisecond * 100)
+	stats := ts.Stats()
+	if stats.FirstMessageTimeouts != 2 || stats.Conns != 1 {
+		t.Fatalf("stats %+v", stats)
+	}
+	select {
+	case <-cli.Done():
+		t.Fatal("active conn closed")
+	default:
+	}
+}
+
+func TestShutdownBeforeStart(t *testing.T) {
+	verifyNoLeaks(t)
+
+	ts := NewTcpServer("127.0.0.1:0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()))
+	ts.Shutdown()
+	ts.Shutdown()
+	if st := ts.Stats(); st.State != ServerStateIdle {
+		t.Fatalf("stats %+v", st)
+	}
+
+	// Shutdown之前没有改状态，还能正常Start
+	wg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Shutdown()
+	wg.Wait()
+}
+
+func TestShutdownAfterFailedStart(t *testing.T) {
+	verifyNoLeaks(t)
+
+	used, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := NewTcpServer(used.Addr().String(), btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()))
+	if _, err = ts.Start(); err == nil {
+		t.Fatal("expect address in use")
+	}
+	ts.Shutdown()
+	if st := ts.Stats(); st.State != ServerStateIdle {
+		t.Fatalf("stats %+v", st)
+	}
+
+	// 健康检查端口被占用时listener已经打开过，也要能Shutdown
+	hs := NewTcpServer("127.0.0.1:0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()), WithHealthEndpoint(used.Addr().String()))
+	if _, err = hs.Start(); err == nil {
+		t.Fatal("expect health address in use")
+	}
+	hs.Shutdown()
+	_ = used.Close()
+
+	wg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Shutdown()
+	wg.Wait()
+}
+
+func TestShutdownConcurrent(t *testing.T) {
+	verifyNoLeaks(t)
+
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()))
+	ln := NewPipeListener()
+	wg, err := ts.Serve(ln)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli := newTestClient("pipe", WithDialer(ln.Dial))
+	if _, err = cli.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	waitServerConns(t, ts, 1)
+
+	var done sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			ts.Shutdown()
+		}()
+	}
+	done.Wait()
+	wg.Wait()
+
+	var shutdowns int
+	for _, v := range ts.RecentEvents(0) {
+		if v.Kind == EventShutdown {
+			shutdowns++
+		}
+	}
+	if shutdowns != 2 {
+		t.Fatalf("expect one begin and one done, got %d events", shutdowns)
+	}
+	ts.Shutdown()
+}
@@ -0,0 +1,105 @@
+package testutil
+
+import (
+	"sync"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+	"github.com/winkb/tcp1/net/mytcp"
+)
+
+var _ contracts.ITcpClient = (*FakeClient)(nil)
+
+// FakeClient 内存里的 contracts.ITcpClient，不连接服务端
+// Send的消息用Sent查看，Receive模拟收到服务端的消息
+type FakeClient struct {
+	lock            sync.Mutex
+	sent            []btmsg.IMsg
+	started         bool
+	done            chan struct{}
+	closeOnce       sync.Once
+	receiveCallback contracts.ClientReceiveCallback
+	closeCallback   contracts.ClientCloseCallback
+}
+
+func NewFakeClient() *FakeClient {
+	return &FakeClient{
+		done: make(chan struct{}),
+	}
+}
+
+func (l *FakeClient) Start() (wg *sync.WaitGroup, err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.started = true
+	return &sync.WaitGroup{}, nil
+}
+
+func (l *FakeClient) Send(v btmsg.IMsg) error {
+	return l.SendMsg(v)
+}
+
+// SendMsg 记录msg的副本，和真实的client一样，Start之前返回 mytcp.ErrNotConnected，Close之后返回 mytcp.ErrClientClosed
+func (l *FakeClient) SendMsg(msg btmsg.IMsg) error {
+	select {
+	case <-l.done:
+		return mytcp.ErrClientClosed
+	default:
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if !l.started {
+		return mytcp.ErrNotConnected
+	}
+	l.sent = append(l.sent, msg.Clone())
+	return nil
+}
+
+func (l *FakeClient) OnReceive(f contracts.ClientReceiveCallback) {
+	l.receiveCallback = f
+}
+
+func (l *FakeClient) OnClose(f contracts.ClientCloseCallback) {
+	l.closeCallback = f
+}
+
+// Receive 模拟收到服务端的msg，同步调用OnReceive设置的回调
+func (l *FakeClient) Receive(msg btmsg.IMsg) {
+	if l.receiveCallback != nil {
+		l.receiveCallback(msg)
+	}
+}
+
+func (l *FakeClient) Close() error {
+	l.close(true, false)
+	return nil
+}
+
+// Disconnect 模拟服务端断开连接
+func (l *FakeClient) Disconnect() {
+	l.close(false, true)
+}
+
+func (l *FakeClient) close(isServer bool, isClient bool) {
+	l.closeOnce.Do(func() {
+		close(l.done)
+		if l.closeCallback != nil {
+			l.closeCallback(isServer, isClient)
+		}
+	})
+}
+
+func (l *FakeClient) Done() <-chan struct{} {
+	return l.done
+}
+
+// Sent 按顺序返回Send过的消息
+func (l *FakeClient) Sent() []btmsg.IMsg {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return append([]btmsg.IMsg(nil), l.sent...)
+}
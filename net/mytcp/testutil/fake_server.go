@@ -0,0 +1,214 @@
+package testutil
+
+import (
+	"sync"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+var _ contracts.ITcpServer = (*FakeServer)(nil)
+
+// Sent FakeServer 记录的一次发送，Conn为nil表示Broadcast
+type Sent struct {
+	Conn *contracts.TcpConn
+	Msg  btmsg.IMsg
+}
+
+// FakeServer 内存里的 contracts.ITcpServer，不监听端口
+// 用Connect创建连接，Receive模拟收到消息，发出去的消息用Sent查看
+type FakeServer struct {
+	lock            sync.Mutex
+	conns           map[uint64]*contracts.TcpConn
+	lastId          uint64
+	sent            []Sent
+	closed          []uint64
+	started         bool
+	shutdown        bool
+	receiveCallback contracts.ServerReceiveCallback
+	closeCallback   contracts.ServerCloseCallback
+}
+
+func NewFakeServer() *FakeServer {
+	return &FakeServer{
+		conns: map[uint64]*contracts.TcpConn{},
+	}
+}
+
+func (l *FakeServer) Start() (wg *sync.WaitGroup, err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.started = true
+	return &sync.WaitGroup{}, nil
+}
+
+// Close 和Shutdown一样，没有排队的消息需要等待
+func (l *FakeServer) Close() error {
+	l.Shutdown()
+	return nil
+}
+
+func (l *FakeServer) Shutdown() {
+	l.lock.Lock()
+	l.shutdown = true
+	var conns []*contracts.TcpConn
+	for _, v := range l.conns {
+		conns = append(conns, v)
+	}
+	l.lock.Unlock()
+
+	for _, v := range conns {
+		l.disconnect(v, true, false)
+	}
+}
+
+// Started Start之后并且没有Shutdown
+func (l *FakeServer) Started() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.started && !l.shutdown
+}
+
+func (l *FakeServer) OnReceive(f contracts.ServerReceiveCallback) {
+	l.receiveCallback = f
+}
+
+func (l *FakeServer) OnClose(f contracts.ServerCloseCallback) {
+	l.closeCallback = f
+}
+
+// Connect 创建一个连接，conn.Send发送的消息也会出现在Sent里，没有调用Sent时最多缓存64条
+func (l *FakeServer) Connect() *contracts.TcpConn {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.lastId++
+	conn := &contracts.TcpConn{
+		Id:       l.lastId,
+		Input:    make(chan btmsg.IMsg, 64),
+		Output:   make(chan btmsg.IMsg),
+		WaitConn: make(chan bool),
+	}
+	l.conns[conn.Id] = conn
+	return conn
+}
+
+// Receive 模拟conn收到msg，同步调用OnReceive设置的回调
+func (l *FakeServer) Receive(conn *contracts.TcpConn, msg btmsg.IMsg) {
+	if l.receiveCallback != nil {
+		l.receiveCallback(l, conn, msg)
+	}
+}
+
+// Disconnect 模拟客户端断开连接
+func (l *FakeServer) Disconnect(conn *contracts.TcpConn) {
+	l.disconnect(conn, false, true)
+}
+
+func (l *FakeServer) disconnect(conn *contracts.TcpConn, isServer bool, isClient bool) {
+	conn.Lock.Lock()
+	if conn.IsClose {
+		conn.Lock.Unlock()
+		return
+	}
+	conn.IsClose = true
+	close(conn.WaitConn)
+	conn.Lock.Unlock()
+
+	l.lock.Lock()
+	l.drainConnLocked(conn)
+	delete(l.conns, conn.Id)
+	l.closed = append(l.closed, conn.Id)
+	l.lock.Unlock()
+
+	if l.closeCallback != nil {
+		l.closeCallback(l, conn, isServer, isClient)
+	}
+}
+
+// Send 记录msg的副本，调用方之后修改msg不影响记录
+func (l *FakeServer) Send(conn *contracts.TcpConn, v btmsg.IMsg) {
+	conn.Lock.RLock()
+	closed := conn.IsClose
+	conn.Lock.RUnlock()
+	if closed {
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.sent = append(l.sent, Sent{Conn: conn, Msg: v.Clone()})
+}
+
+func (l *FakeServer) SendById(id uint64, v btmsg.IMsg) {
+	l.lock.Lock()
+	conn, ok := l.conns[id]
+	l.lock.Unlock()
+	if !ok {
+		return
+	}
+
+	l.Send(conn, v)
+}
+
+func (l *FakeServer) Broadcast(bt btmsg.IMsg) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.sent = append(l.sent, Sent{Msg: bt.Clone()})
+}
+
+// CloseConn 服务端主动关闭conn
+func (l *FakeServer) CloseConn(conn *contracts.TcpConn) {
+	l.disconnect(conn, true, false)
+}
+
+// Sent 按顺序返回所有发送，conn.Send 发送的消息在调用Sent时才收集，排在之前的记录后面
+func (l *FakeServer) Sent() []Sent {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.drainLocked()
+	return append([]Sent(nil), l.sent...)
+}
+
+// SentTo 发给conn的消息，不包括Broadcast
+func (l *FakeServer) SentTo(conn *contracts.TcpConn) []btmsg.IMsg {
+	var res []btmsg.IMsg
+	for _, v := range l.Sent() {
+		if v.Conn == conn {
+			res = append(res, v.Msg)
+		}
+	}
+	return res
+}
+
+// Closed 已经断开的连接id，按断开的顺序
+func (l *FakeServer) Closed() []uint64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return append([]uint64(nil), l.closed...)
+}
+
+// drainLocked 收集conn.Send写到Input里的消息，Send已经Retain过，这里记录副本之后Release
+func (l *FakeServer) drainLocked() {
+	for _, conn := range l.conns {
+		l.drainConnLocked(conn)
+	}
+}
+
+func (l *FakeServer) drainConnLocked(conn *contracts.TcpConn) {
+	for {
+		select {
+		case v := <-conn.Input:
+			l.sent = append(l.sent, Sent{Conn: conn, Msg: v.Clone()})
+			v.Release()
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package testutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+	"github.com/winkb/tcp1/net/mytcp"
+)
+
+type greet struct {
+	Name string
+}
+
+func newGreet(act uint16, name string) btmsg.IMsg {
+	msg := btmsg.NewMsg(btmsg.NewMsgHeadTcp(), nil)
+	msg.SetAct(act)
+	_ = msg.FromStruct(greet{Name: name})
+	return msg
+}
+
+func TestFakeServer(t *testing.T) {
+	s := NewFakeServer()
+	var closed []bool
+	s.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		var req greet
+		_, _ = msg.ToStruct(&req)
+		switch msg.GetAct() {
+		case 1:
+			_ = conn.ReplyMsg(msg, greet{Name: "hi " + req.Name})
+		case 2:
+			msg.SetAct(3)
+			s.Broadcast(msg)
+		case 4:
+			s.CloseConn(conn)
+		}
+	})
+	s.OnClose(func(s contracts.ITcpServer, conn *contracts.TcpConn, isServer bool, isClient bool) {
+		closed = append(closed, isServer)
+	})
+	_, _ = s.Start()
+
+	a, b := s.Connect(), s.Connect()
+	s.Receive(a, newGreet(1, "tom"))
+	s.SendById(b.Id, newGreet(5, "direct"))
+	s.Receive(b, newGreet(2, "all"))
+
+	sent := s.SentTo(a)
+	if len(sent) != 1 {
+		t.Fatalf("expect 1 msg to a, got %d", len(sent))
+	}
+	var rsp greet
+	_, _ = sent[0].ToStruct(&rsp)
+	if rsp.Name != "hi tom" || sent[0].GetAct() != 1 {
+		t.Fatalf("got act %d %+v", sent[0].GetAct(), rsp)
+	}
+
+	all := s.Sent()
+	if len(all) != 3 {
+		t.Fatalf("expect 3 sent, got %d", len(all))
+	}
+	if all[0].Conn != b || all[1].Conn != nil || all[1].Msg.GetAct() != 3 {
+		t.Fatalf("unexpected order %+v", all)
+	}
+
+	s.Receive(b, newGreet(4, ""))
+	s.Disconnect(a)
+	s.Disconnect(a)
+	if got := s.Closed(); len(got) != 2 || got[0] != b.Id || got[1] != a.Id {
+		t.Fatalf("closed %v", got)
+	}
+	if len(closed) != 2 || !closed[0] || closed[1] {
+		t.Fatalf("close callbacks %v", closed)
+	}
+
+	s.Send(a, newGreet(1, "late"))
+	if len(s.SentTo(a)) != 1 {
+		t.Fatal("send to closed conn should be dropped")
+	}
+
+	s.Shutdown()
+	if s.Started() {
+		t.Fatal("expect stopped")
+	}
+}
+
+func TestFakeClient(t *testing.T) {
+	var cli contracts.ITcpClient = NewFakeClient()
+	fake := cli.(*FakeClient)
+
+	if err := cli.Send(newGreet(1, "early")); !errors.Is(err, mytcp.ErrNotConnected) {
+		t.Fatalf("expect ErrNotConnected, got %v", err)
+	}
+
+	var got []string
+	cli.OnReceive(func(msg btmsg.IMsg) {
+		var v greet
+		_, _ = msg.ToStruct(&v)
+		got = append(got, v.Name)
+	})
+	var closedBy []bool
+	cli.OnClose(func(isServer bool, isClient bool) {
+		closedBy = append(closedBy, isClient)
+	})
+	_, _ = cli.Start()
+
+	msg := newGreet(1, "tom")
+	_ = cli.Send(msg)
+	_ = msg.FromStruct(greet{Name: "changed"})
+	fake.Receive(newGreet(2, "jerry"))
+
+	sent := fake.Sent()
+	var v greet
+	_, _ = sent[0].ToStruct(&v)
+	if len(sent) != 1 || v.Name != "tom" {
+		t.Fatalf("sent %d %+v", len(sent), v)
+	}
+	if len(got) != 1 || got[0] != "jerry" {
+		t.Fatalf("received %v", got)
+	}
+
+	fake.Disconnect()
+	cli.Close()
+	select {
+	case <-cli.Done():
+	default:
+		t.Fatal("expect done")
+	}
+	if len(closedBy) != 1 || !closedBy[0] {
+		t.Fatalf("close callbacks %v", closedBy)
+	}
+	if err := cli.Send(msg); !errors.Is(err, mytcp.ErrClientClosed) {
+		t.Fatalf("expect ErrClientClosed, got %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package testutil
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+	"github.com/winkb/tcp1/net/mytcp"
+)
+
+// Server mytcp.NewTcpServer 返回的server在测试里用到的方法
+type Server interface {
+	contracts.ITcpServer
+	Serve(ln net.Listener) (wg *sync.WaitGroup, err error)
+	Stats() mytcp.ServerStats
+}
+
+// Client mytcp.NewTcpClient 返回的client在测试里用到的方法
+type Client interface {
+	contracts.ITcpClient
+	Call(ctx context.Context, act uint16, req any, rsp any) error
+	SendStruct(act uint16, v any) error
+}
+
+type serverConfig struct {
+	reader    btmsg.IMsgReader
+	opts      []mytcp.ServerOption
+	onReceive contracts.ServerReceiveCallback
+	onClose   contracts.ServerCloseCallback
+}
+
+type Option func(l *serverConfig)
+
+// WithReader 默认是 btmsg.FactoryMsgHeadTcpSeq 的reader
+func WithReader(r btmsg.IMsgReader) Option {
+	return func(l *serverConfig) {
+		l.reader = r
+	}
+}
+
+// WithServerOptions 传给 mytcp.NewTcpServer 的选项
+func WithServerOptions(opts ...mytcp.ServerOption) Option {
+	return func(l *serverConfig) {
+		l.opts = append(l.opts, opts...)
+	}
+}
+
+// WithOnReceive 在Start之前设置，避免和读协程竞争
+func WithOnReceive(f contracts.ServerReceiveCallback) Option {
+	return func(l *serverConfig) {
+		l.onReceive = f
+	}
+}
+
+func WithOnClose(f contracts.ServerCloseCallback) Option {
+	return func(l *serverConfig) {
+		l.onClose = f
+	}
+}
+
+// TestServer 监听127.0.0.1的随机端口，测试结束时自动Shutdown并等待所有协程退出
+type TestServer struct {
+	Server
+	t  testing.TB
+	ln net.Listener
+}
+
+// StartTestServer 启动server，同时用 VerifyNoLeaks 检查测试结束后没有遗留的协程
+func StartTestServer(t testing.TB, opts ...Option) *TestServer {
+	t.Helper()
+	VerifyNoLeaks(t)
+
+	cfg := &serverConfig{
+		reader: btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()),
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	s := mytcp.NewTcpServer("0", cfg.reader, cfg.opts...)
+	if cfg.onReceive != nil {
+		s.OnReceive(cfg.onReceive)
+	}
+	if cfg.onClose != nil {
+		s.OnClose(cfg.onClose)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg, err := s.Serve(ln)
+	if err != nil {
+		_ = ln.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.Shutdown()
+		wg.Wait()
+	})
+
+	return &TestServer{Server: s, t: t, ln: ln}
+}
+
+// Addr client连接用的地址
+func (l *TestServer) Addr() string {
+	return l.ln.Addr().String()
+}
+
+// WaitForConns 等到至少有n个连接，超时让测试失败，只能在测试的协程里调用
+func (l *TestServer) WaitForConns(n int, timeout time.Duration) {
+	l.t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for l.Stats().Conns < n {
+		if time.Now().After(deadline) {
+			l.t.Fatalf("wait for %d conns, got %d", n, l.Stats().Conns)
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+// TestClient 已经连接的client，测试结束时自动Close
+type TestClient struct {
+	Client
+	// Timeout SendAndWaitReply 等待回复的时间，默认3秒
+	Timeout time.Duration
+}
+
+// StartTestClient 连接addr，连接失败让测试失败，和 StartTestServer 一样默认用 btmsg.MsgHeadTcpSeq
+func StartTestClient(t testing.TB, addr string, opts ...mytcp.ClientOption) *TestClient {
+	t.Helper()
+
+	opts = append([]mytcp.ClientOption{mytcp.WithHeadFactory(btmsg.FactoryMsgHeadTcpSeq())}, opts...)
+	cli := mytcp.NewTcpClient(addr, opts...)
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cli.Close()
+	})
+
+	return &TestClient{Client: cli, Timeout: time.Second * 3}
+}
+
+// SendAndWaitReply 用Call发送req并等待回复解码到rsp，超过Timeout返回 context.DeadlineExceeded
+func (l *TestClient) SendAndWaitReply(act uint16, req any, rsp any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), l.Timeout)
+	defer cancel()
+
+	return l.Call(ctx, act, req, rsp)
+}
@@ -0,0 +1,14 @@
+package testutil
+
+import (
+	"testing"
+
+	"github.com/winkb/tcp1/net/mytcp/internal/leakcheck"
+)
+
+// VerifyNoLeaks 测试开始时调用，测试结束时还有这个测试期间启动的goroutine没有退出就让测试失败
+// 检查在t的Cleanup里进行，在defer之后，最多等1秒，连接关闭之后读协程需要一点时间退出
+func VerifyNoLeaks(t testing.TB) {
+	t.Helper()
+	leakcheck.Verify(t)
+}
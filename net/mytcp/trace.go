@@ -0,0 +1,38 @@
+package mytcp
+
+import (
+	"context"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// ensureTraceID 消息没有trace id时生成一个，head不能带flags时不生成
+func ensureTraceID(msg btmsg.IMsg) {
+	if _, ok := msg.GetTraceID(); ok {
+		return
+	}
+
+	msg.SetFlags(msg.GetFlags() | btmsg.FlagTraceID)
+	if !msg.HasFlag(btmsg.FlagTraceID) {
+		return
+	}
+	msg.SetTraceID(btmsg.NewTraceID())
+}
+
+// MsgContext msg带trace id时放进ctx，传给下游的调用
+func MsgContext(ctx context.Context, msg btmsg.IMsg) context.Context {
+	if id, ok := msg.GetTraceID(); ok {
+		return btmsg.ContextWithTraceID(ctx, id)
+	}
+	return ctx
+}
+
+// OnReceiveCtx 和OnReceive一样，替换之前设置的回调
+// ctx在Shutdown时取消，带着消息的trace id，设置了 WithServerTraceHook 时还带着处理消息的span
+func (l *tcpServer) OnReceiveCtx(f contracts.ServerReceiveCtxCallback) {
+	l.setCallbacks(func(cb *serverCallbacks) {
+		cb.receiveCtx = f
+		cb.receive = nil
+	})
+}
@@ -0,0 +1,93 @@
+package mytcp
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// SpanAttr span的属性，Value是基本类型
+type SpanAttr struct {
+	Key   string
+	Value any
+}
+
+// TraceHook 在处理消息、SendMsg和Call前后调用，不依赖具体的tracing实现，OpenTelemetry的实现见 otelhook
+// StartSpan 返回的ctx要带上span，并且用 btmsg.ContextWithTraceID 带上trace id，发送的消息会用它作为trace id
+// end在结束时调用一次，err为nil表示成功
+type TraceHook interface {
+	StartSpan(ctx context.Context, name string, attrs []SpanAttr) (context.Context, func(err error))
+}
+
+const (
+	SpanReceive = "tcp.receive"
+	SpanSend    = "tcp.send"
+	SpanCall    = "tcp.call"
+)
+
+// WithServerTraceHook 每条消息的回调包在一个 SpanReceive 里，没有设置时只多一次nil判断
+func WithServerTraceHook(h TraceHook) ServerOption {
+	return func(l *tcpServer) {
+		l.traceHook = h
+	}
+}
+
+// WithTraceHook SendMsg和Call分别包在 SpanSend 和 SpanCall 里，没有设置时只多一次nil判断
+func WithTraceHook(h TraceHook) ClientOption {
+	return func(l *tcpClient) {
+		l.traceHook = h
+	}
+}
+
+func msgAttrs(msg btmsg.IMsg) []SpanAttr {
+	return []SpanAttr{
+		{Key: "tcp.act", Value: msg.GetAct()},
+		{Key: "tcp.act_name", Value: btmsg.ActName(msg.GetAct())},
+		{Key: "tcp.seq", Value: msg.GetSeq()},
+	}
+}
+
+// receiveWithCtx 设置了OnReceiveCtx或者trace hook时调用回调，回调panic时span记录为错误之后继续panic
+func (l *tcpServer) receiveWithCtx(conn *contracts.TcpConn, msg btmsg.IMsg) {
+	ctx := MsgContext(l.ctx, msg)
+	if l.traceHook != nil {
+		var end func(err error)
+		ctx, end = l.traceHook.StartSpan(ctx, SpanReceive, append(msgAttrs(msg), SpanAttr{Key: "tcp.conn", Value: conn.Id}))
+		defer func() {
+			if v := recover(); v != nil {
+				end(errors.Errorf("panic: %v", v))
+				panic(v)
+			}
+		}()
+		l.callReceive(ctx, conn, msg)
+		end(nil)
+		return
+	}
+
+	l.callReceive(ctx, conn, msg)
+}
+
+func (l *tcpServer) callReceive(ctx context.Context, conn *contracts.TcpConn, msg btmsg.IMsg) {
+	cb := l.loadCallbacks()
+	if cb.receiveCtx != nil {
+		cb.receiveCtx(ctx, l, conn, msg)
+	} else if cb.receive != nil {
+		cb.receive(l, conn, msg)
+	}
+}
+
+// startSpan 开始client的span，msg的trace id换成span的，服务端的span和它属于同一个trace
+// msg已经有trace id并且ctx里没有时，span沿用msg的trace id
+func (l *tcpClient) startSpan(ctx context.Context, name string, msg btmsg.IMsg) (context.Context, func(err error)) {
+	if _, ok := btmsg.TraceIDFromContext(ctx); !ok {
+		ctx = MsgContext(ctx, msg)
+	}
+
+	ctx, end := l.traceHook.StartSpan(ctx, name, msgAttrs(msg))
+	if id, ok := btmsg.TraceIDFromContext(ctx); ok {
+		msg.SetTraceID(id)
+	}
+	return ctx, end
+}
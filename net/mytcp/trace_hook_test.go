@@ -0,0 +1,177 @@
+package mytcp
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+type recordedSpan struct {
+	name   string
+	parent string
+	trace  btmsg.TraceID
+	attrs  map[string]any
+	err    error
+}
+
+type spanKey struct{}
+
+// recordHook 记录结束的span，父span按ctx里的span name找
+type recordHook struct {
+	lock  sync.Mutex
+	spans []recordedSpan
+}
+
+func (l *recordHook) StartSpan(ctx context.Context, name string, attrs []SpanAttr) (context.Context, func(err error)) {
+	span := recordedSpan{name: name, attrs: map[string]any{}}
+	span.parent, _ = ctx.Value(spanKey{}).(string)
+	var ok bool
+	span.trace, ok = btmsg.TraceIDFromContext(ctx)
+	if !ok {
+		span.trace = btmsg.NewTraceID()
+	}
+	for _, v := range attrs {
+		span.attrs[v.Key] = v.Value
+	}
+
+	ctx = context.WithValue(ctx, spanKey{}, name)
+	ctx = btmsg.ContextWithTraceID(ctx, span.trace)
+	return ctx, func(err error) {
+		span.err = err
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		l.spans = append(l.spans, span)
+	}
+}
+
+func (l *recordHook) find(name string) (recordedSpan, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for _, v := range l.spans {
+		if v.name == name {
+			return v, true
+		}
+	}
+	return recordedSpan{}, false
+}
+
+func (l *recordHook) wait(t *testing.T, name string) recordedSpan {
+	t.Helper()
+	deadline := time.Now().Add(time.Second * 3)
+	for time.Now().Before(deadline) {
+		if v, ok := l.find(name); ok {
+			return v
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	t.Fatalf("span %s not found", name)
+	return recordedSpan{}
+}
+
+func TestTraceHook(t *testing.T) {
+	verifyNoLeaks(t)
+
+	serverHook, clientHook := &recordHook{}, &recordHook{}
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpV2()), WithServerTraceHook(serverHook))
+	var inHandler = make(chan string, 2)
+	ts.OnReceiveCtx(func(ctx context.Context, s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		name, _ := ctx.Value(spanKey{}).(string)
+		inHandler <- name
+		if msg.GetAct() == 1 {
+			_ = conn.ReplyError(msg, 7, "fail")
+		}
+	})
+	wg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		wg.Wait()
+	}()
+
+	cli := newTestClient(ts.listener.Addr().String(), WithHeadFactory(btmsg.FactoryMsgHeadTcpV2()), WithTraceHook(clientHook))
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	ctx, end := clientHook.StartSpan(context.Background(), "root", nil)
+	err = cli.Call(ctx, 1, &callReq{N: 1}, &callRsp{})
+	end(nil)
+	if _, ok := err.(*ReplyError); !ok {
+		t.Fatalf("expect ReplyError, got %v", err)
+	}
+	if v := <-inHandler; v != SpanReceive {
+		t.Fatalf("handler ctx span %q", v)
+	}
+
+	root := clientHook.wait(t, "root")
+	call := clientHook.wait(t, SpanCall)
+	receive := serverHook.wait(t, SpanReceive)
+	if call.parent != "root" || call.trace != root.trace || call.err == nil || call.attrs["tcp.act"] != uint16(1) {
+		t.Fatalf("call span %+v", call)
+	}
+	// 只有trace id跨进程，服务端的span在同一个trace里
+	if receive.trace != root.trace || receive.parent != "" || receive.err != nil {
+		t.Fatalf("receive span %+v", receive)
+	}
+
+	msg := btmsg.NewMsg(btmsg.NewMsgHeadTcpV2(), nil)
+	msg.SetAct(2)
+	err = cli.SendMsg(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-inHandler
+	send := clientHook.wait(t, SpanSend)
+	if id, _ := msg.GetTraceID(); send.parent != "" || send.trace != id || send.trace == root.trace {
+		t.Fatalf("send span %+v", send)
+	}
+}
+
+// TestTraceHookOff 没有设置hook时OnReceiveCtx也能拿到trace id
+func TestTraceHookOff(t *testing.T) {
+	verifyNoLeaks(t)
+
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpV2()))
+	var got = make(chan btmsg.TraceID, 1)
+	ts.OnReceiveCtx(func(ctx context.Context, s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		id, _ := btmsg.TraceIDFromContext(ctx)
+		got <- id
+	})
+	wg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		wg.Wait()
+	}()
+
+	cli := newTestClient(ts.listener.Addr().String(), WithHeadFactory(btmsg.FactoryMsgHeadTcpV2()))
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	msg := btmsg.NewMsg(btmsg.NewMsgHeadTcpV2(), nil)
+	msg.SetAct(1)
+	_ = cli.SendMsg(msg)
+
+	select {
+	case v := <-got:
+		if id, _ := msg.GetTraceID(); v.IsZero() || v != id {
+			t.Fatalf("got %s", v)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout")
+	}
+}
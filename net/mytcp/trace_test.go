@@ -0,0 +1,83 @@
+package mytcp
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// TestTraceIDPropagation client自动生成trace id，server的 MsgContext 和access log里能取到，回复带回同一个
+func TestTraceIDPropagation(t *testing.T) {
+	verifyNoLeaks(t)
+
+	logger := &lineLogger{}
+	var seen = make(chan btmsg.TraceID, 2)
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpV2()))
+	ts.OnReceive(AccessLog(WithAccessLogger(logger))(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		id, _ := btmsg.TraceIDFromContext(MsgContext(context.Background(), msg))
+		seen <- id
+		var req callReq
+		_, _ = msg.ToStruct(&req)
+		_ = conn.ReplyMsg(msg, &callRsp{N: req.N * 2})
+	}))
+	wg, err := ts.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		wg.Wait()
+	}()
+
+	var replies = make(chan btmsg.IMsg, 1)
+	cli := newTestClient(ts.listener.Addr().String(), WithHeadFactory(btmsg.FactoryMsgHeadTcpV2()))
+	cli.OnReceive(func(msg btmsg.IMsg) {
+		replies <- msg.Clone()
+	})
+	_, err = cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	// 没有设置时自动生成
+	var rsp callRsp
+	err = cli.Call(context.Background(), 1, &callReq{N: 2}, &rsp)
+	if err != nil || rsp.N != 4 {
+		t.Fatalf("rsp %d err %v", rsp.N, err)
+	}
+	first := <-seen
+	if first.IsZero() {
+		t.Fatal("expect generated trace id")
+	}
+
+	// 设置了就用调用方的
+	id := btmsg.NewTraceID()
+	hd := btmsg.NewMsgHeadTcpV2()
+	hd.SetAct(1)
+	msg := btmsg.NewMsg(hd, nil)
+	_ = msg.FromStruct(&callReq{N: 3})
+	msg.SetTraceID(id)
+	_ = cli.SendMsg(msg)
+
+	select {
+	case got := <-replies:
+		if v, ok := got.GetTraceID(); !ok || v != id {
+			t.Fatalf("reply trace %s %v", v, ok)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout")
+	}
+	if v := <-seen; v != id || v == first {
+		t.Fatalf("server trace %s", v)
+	}
+
+	lines := logger.take()
+	if len(lines) != 2 || !strings.Contains(lines[0], "trace="+first.String()) || !strings.Contains(lines[1], "trace="+id.String()) {
+		t.Fatalf("access log %v", lines)
+	}
+}
@@ -0,0 +1,38 @@
+package mytcp
+
+import (
+	"context"
+	"net"
+)
+
+// Transport 建立连接的方式，连接建立之后的帧格式、router和回调都一样
+// server用 WithServerTransport，client用 WithTransport，默认 TCPTransport，kcp见kcptransport子包
+type Transport interface {
+	Listen(addr string) (net.Listener, error)
+	// Dial 和 DialFunc 的签名一样，network由client传入，不用tcp的实现可以忽略
+	Dial(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+var _ Transport = TCPTransport{}
+
+// TCPTransport 默认的传输方式
+type TCPTransport struct{}
+
+func (TCPTransport) Listen(addr string) (net.Listener, error) {
+	return net.Listen("tcp", addr)
+}
+
+// ListenNetwork network是tcp、tcp4或者tcp6，见 WithServerNetwork
+func (TCPTransport) ListenNetwork(network, addr string) (net.Listener, error) {
+	return net.Listen(network, addr)
+}
+
+// networkListener 可以选择network的Transport，没有实现时 WithServerNetwork 没有效果
+type networkListener interface {
+	ListenNetwork(network, addr string) (net.Listener, error)
+}
+
+func (TCPTransport) Dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, network, addr)
+}
@@ -0,0 +1,31 @@
+package mytcp
+
+import "io"
+
+// writeFull 写完b或者出错才返回，有的net.Conn包装(tls、pipe等)一次可能只写一部分，err还是nil
+// 写超时是绝对时间，重试时不用重新设置
+func writeFull(w io.Writer, b []byte) error {
+	for len(b) > 0 {
+		n, err := w.Write(b)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return io.ErrShortWrite
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// fullWriter bufio.Writer 遇到部分写入会返回 io.ErrShortWrite，用它包一层
+type fullWriter struct {
+	w io.Writer
+}
+
+func (l fullWriter) Write(b []byte) (int, error) {
+	if err := writeFull(l.w, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
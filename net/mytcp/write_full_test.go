@@ -0,0 +1,129 @@
+package mytcp
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// shortConn 每次最多写7个字节，err是nil
+type shortConn struct {
+	net.Conn
+}
+
+func (l shortConn) Write(b []byte) (int, error) {
+	if len(b) > 7 {
+		b = b[:7]
+	}
+	return l.Conn.Write(b)
+}
+
+type shortListener struct {
+	net.Listener
+}
+
+func (l shortListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return shortConn{Conn: conn}, nil
+}
+
+func TestWriteFull(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeFull(shortWriter{&buf}, []byte("0123456789abcdefghij")); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "0123456789abcdefghij" {
+		t.Fatalf("got %q", buf.String())
+	}
+	if err := writeFull(zeroWriter{}, []byte("x")); err == nil {
+		t.Fatal("expect short write")
+	}
+}
+
+type shortWriter struct {
+	buf *bytes.Buffer
+}
+
+func (l shortWriter) Write(b []byte) (int, error) {
+	if len(b) > 7 {
+		b = b[:7]
+	}
+	return l.buf.Write(b)
+}
+
+type zeroWriter struct{}
+
+func (zeroWriter) Write(b []byte) (int, error) {
+	return 0, nil
+}
+
+// TestShortWriteConn 两端的连接每次都只写一部分，收到的帧还是完整的
+func TestShortWriteConn(t *testing.T) {
+	verifyNoLeaks(t)
+
+	ts := NewTcpServer("0", btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq()))
+	ts.OnReceive(func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		s.Send(conn, msg)
+	})
+	ln := NewPipeListener()
+	wg, err := ts.Serve(shortListener{Listener: ln})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ts.Shutdown()
+		wg.Wait()
+	}()
+
+	for _, buffered := range []bool{false, true} {
+		var received = make(chan string, 64)
+		opts := []ClientOption{WithDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := ln.Dial(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return shortConn{Conn: conn}, nil
+		})}
+		if buffered {
+			opts = append(opts, WithWriteBuffer(4096, time.Millisecond))
+		}
+		cli := newTestClient("pipe", opts...)
+		cli.OnReceive(func(msg btmsg.IMsg) {
+			received <- string(msg.BodyByte())
+		})
+		if _, err = cli.Start(); err != nil {
+			t.Fatal(err)
+		}
+
+		const n = 20
+		for i := 0; i < n; i++ {
+			hd := btmsg.NewMsgHeadTcpSeq()
+			hd.SetAct(2)
+			body := bytes.Repeat([]byte(strconv.Itoa(i)), i*5+1)
+			if err = cli.SendMsg(btmsg.NewMsg(hd, body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := 0; i < n; i++ {
+			select {
+			case v := <-received:
+				if expect := string(bytes.Repeat([]byte(strconv.Itoa(i)), i*5+1)); v != expect {
+					t.Fatalf("msg %d: expect %q, got %q", i, expect, v)
+				}
+			case <-time.After(time.Second * 3):
+				t.Fatalf("timeout waiting %d", i)
+			}
+		}
+		_ = cli.Close()
+		<-cli.Done()
+	}
+}
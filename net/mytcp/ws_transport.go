@@ -0,0 +1,132 @@
+package mytcp
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+var wsUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+var _ net.Conn = (*wsConn)(nil)
+
+// wsConn 把websocket连接当成字节流，帧的格式和tcp一样
+// 读的时候多个binary message首尾相接交给reader，一个message可以有多个帧，一个帧也可以分成多个message
+// 每次Write发送一个binary message
+type wsConn struct {
+	*websocket.Conn
+	r     io.Reader
+	wlock sync.Mutex
+}
+
+func newWsConn(conn *websocket.Conn) *wsConn {
+	return &wsConn{Conn: conn}
+}
+
+func (l *wsConn) Read(b []byte) (n int, err error) {
+	for {
+		if l.r == nil {
+			var mt int
+			mt, l.r, err = l.Conn.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			// text message不是帧的数据，跳过
+			if mt != websocket.BinaryMessage {
+				l.r = nil
+				continue
+			}
+		}
+
+		n, err = l.r.Read(b)
+		if err == io.EOF {
+			l.r = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return
+	}
+}
+
+func (l *wsConn) Write(b []byte) (n int, err error) {
+	l.wlock.Lock()
+	defer l.wlock.Unlock()
+
+	err = l.Conn.WriteMessage(websocket.BinaryMessage, b)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (l *wsConn) SetDeadline(t time.Time) error {
+	if err := l.Conn.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return l.Conn.SetWriteDeadline(t)
+}
+
+// WsHandler 升级成websocket之后和tcp连接一样处理，共用conns、Broadcast和回调
+// 要在Start或者Serve之后使用，挂在任意http.Server的路由上
+func (l *tcpServer) WsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.lock.RLock()
+		ready := l.stop == 0 && l.wg != nil
+		l.lock.RUnlock()
+		if !ready {
+			http.Error(w, "server is stop", http.StatusServiceUnavailable)
+			return
+		}
+
+		ws, err := wsUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// Upgrade已经回复了错误
+			log.Err(errors.Wrap(err, "ws upgrade"))
+			return
+		}
+
+		l.lock.RLock()
+		defer l.lock.RUnlock()
+		if l.stop != 0 {
+			_ = ws.Close()
+			return
+		}
+
+		l.serveConn(l.ctx, l.wg, newWsConn(ws))
+	})
+}
+
+// wsDial 用dial建立底层连接，再握手升级成websocket，设置了tls时使用wss
+func (l *tcpClient) wsDial(dial DialFunc) DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		d := websocket.Dialer{
+			NetDialContext: dial,
+		}
+
+		u := url.URL{Scheme: "ws", Host: addr, Path: l.wsPath}
+		if l.tlsConfig != nil {
+			u.Scheme = "wss"
+			d.TLSClientConfig = l.clientTLSConfig(addr)
+		}
+
+		ws, _, err := d.DialContext(ctx, u.String(), nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "ws dial")
+		}
+		return newWsConn(ws), nil
+	}
+}
@@ -0,0 +1,176 @@
+package mytcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/winkb/tcp1/btmsg"
+	"github.com/winkb/tcp1/contracts"
+)
+
+// startWsServer tcp和websocket接在同一个server上，act 1回复N*2，act 2广播
+func startWsServer(t *testing.T) (*tcpServer, *httptest.Server, func()) {
+	ts, stop := startEchoServer(t, func(s contracts.ITcpServer, conn *contracts.TcpConn, msg btmsg.IMsg) {
+		switch msg.GetAct() {
+		case 1:
+			var req callReq
+			_, _ = msg.ToStruct(&req)
+			_ = conn.ReplyMsg(msg, &callRsp{N: req.N * 2})
+		case 2:
+			s.Broadcast(msg)
+		}
+	})
+	hs := httptest.NewServer(ts.WsHandler())
+
+	return ts, hs, func() {
+		stop()
+		hs.Close()
+	}
+}
+
+func TestWsTransport(t *testing.T) {
+	ts, hs, stop := startWsServer(t)
+	defer stop()
+
+	var got = make(chan string, 2)
+	onReceive := func(name string) clientReceiveCallback {
+		return func(msg btmsg.IMsg) {
+			if msg.GetAct() == 2 {
+				got <- name
+			}
+		}
+	}
+
+	tcpCli := newTestClient(ts.listener.Addr().String())
+	tcpCli.OnReceive(onReceive("tcp"))
+	wsCli := newTestClient(strings.TrimPrefix(hs.URL, "http://"), WithWebSocket("/ws"))
+	wsCli.OnReceive(onReceive("ws"))
+	for _, cli := range []*tcpClient{tcpCli, wsCli} {
+		_, err := cli.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cli.Close()
+	}
+
+	for i := 0; i < 10; i++ {
+		var rsp callRsp
+		err := wsCli.Call(context.Background(), 1, &callReq{N: i}, &rsp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rsp.N != i*2 {
+			t.Fatalf("expect %d, got %d", i*2, rsp.N)
+		}
+	}
+
+	if connCount(ts) != 2 {
+		t.Fatalf("expect 2 conns, got %d", connCount(ts))
+	}
+
+	// ws发的广播tcp也能收到
+	_ = wsCli.SendStruct(2, echoReq{Msg: "all"})
+	var names = map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case v := <-got:
+			names[v] = true
+		case <-time.After(time.Second * 3):
+			t.Fatal("timeout")
+		}
+	}
+	if !names["tcp"] || !names["ws"] {
+		t.Fatalf("got %v", names)
+	}
+}
+
+// TestWsTransportStream 一个message里有多个帧，一个帧分成多个message
+func TestWsTransportStream(t *testing.T) {
+	_, hs, stop := startWsServer(t)
+	defer stop()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(hs.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	frame := func(n int) []byte {
+		msg := btmsg.NewMsg(btmsg.NewMsgHeadTcpSeq(), nil)
+		msg.SetAct(1)
+		_ = msg.FromStruct(&callReq{N: n})
+		return msg.ToSendByte()
+	}
+
+	third := frame(3)
+	parts := [][]byte{
+		append(frame(1), frame(2)...),
+		third[:5],
+		third[5:],
+	}
+	for _, v := range parts {
+		err = ws.WriteMessage(websocket.BinaryMessage, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// text message不是帧的数据，服务端忽略
+	_ = ws.WriteMessage(websocket.TextMessage, []byte("hello"))
+
+	r := btmsg.NewReader(btmsg.FactoryMsgHeadTcpSeq())
+	in := &wrapConn{Conn: newWsConn(ws)}
+	_ = ws.SetReadDeadline(time.Now().Add(time.Second * 3))
+	for i := 1; i <= 3; i++ {
+		res := r.ReadMsg(in)
+		if res.GetErr() != nil {
+			t.Fatal(res.GetErr())
+		}
+		var rsp callRsp
+		_, _ = res.GetMsg().ToStruct(&rsp)
+		if rsp.N != i*2 {
+			t.Fatalf("expect %d, got %d", i*2, rsp.N)
+		}
+	}
+}
+
+func TestWsTransportShutdown(t *testing.T) {
+	ts, hs, stop := startWsServer(t)
+	defer stop()
+
+	var closed = make(chan struct{}, 1)
+	cli := newTestClient(strings.TrimPrefix(hs.URL, "http://"), WithWebSocket(""))
+	cli.OnClose(func(isServer bool, isClient bool) {
+		closed <- struct{}{}
+	})
+	_, err := cli.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	err = cli.Call(context.Background(), 1, &callReq{N: 1}, &callRsp{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts.Shutdown()
+	select {
+	case <-closed:
+	case <-time.After(time.Second * 3):
+		t.Fatal("client not closed")
+	}
+
+	rsp, err := http.Get(hs.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = rsp.Body.Close()
+	if rsp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expect 503, got %d", rsp.StatusCode)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/winkb/tcp1/contracts"
 )
 
 type wrapConn struct {
@@ -29,7 +30,7 @@ func (l *wrapConn) SetDeadline(t time.Time) error {
 }
 
 func (l *wrapConn) GetRemoteIp() string {
-	return l.Conn.RemoteAddr().String()
+	return contracts.RemoteIp(l.Conn.RemoteAddr())
 }
 
 // Write writes data to the connection.
@@ -26,25 +26,27 @@ var upgrader = websocket.Upgrader{
 var _ ITcpServer = (*Ws)(nil)
 
 func NewWs(addr string, wsPath string, r btmsg.IMsgReader) *Ws {
-	return &Ws{
-		wsPath:          wsPath,
-		reader:          r,
-		closeCallback:   func(s ITcpServer, conn *TcpConn, isServer, isClient bool) {},
-		receiveCallback: func(s ITcpServer, conn *TcpConn, msg btmsg.IMsg) {},
-		conns:           sync.Map{},
-		lastId:          0,
-		stop:            0,
-		lock:            sync.RWMutex{},
-		timeout:         time.Second * 3,
+	l := &Ws{
+		wsPath:  wsPath,
+		reader:  r,
+		conns:   sync.Map{},
+		lastId:  0,
+		stop:    0,
+		lock:    sync.RWMutex{},
+		timeout: time.Second * 3,
 	}
+	l.OnClose(func(s ITcpServer, conn *TcpConn, isServer, isClient bool) {})
+	l.OnReceive(func(s ITcpServer, conn *TcpConn, msg btmsg.IMsg) {})
+	return l
 }
 
 type Ws struct {
-	wg              *sync.WaitGroup
-	wsPath          string
-	listener        *http.Server
-	closeCallback   ServerCloseCallback
-	receiveCallback ServerReceiveCallback
+	wg       *sync.WaitGroup
+	wsPath   string
+	listener *http.Server
+	// closeCallback receiveCallback Start之后也可以设置，读的时候不用加锁
+	closeCallback   atomic.Pointer[ServerCloseCallback]
+	receiveCallback atomic.Pointer[ServerReceiveCallback]
 	conns           sync.Map
 	lastId          uint64
 	stop            int
@@ -71,6 +73,11 @@ func (l *Ws) Shutdown() {
 		return true
 	})
 
+	// http.Server由调用方创建时listener是nil
+	if l.listener == nil {
+		return
+	}
+
 	var ctx = context.Background()
 
 	err := l.listener.Shutdown(ctx)
@@ -79,6 +86,12 @@ func (l *Ws) Shutdown() {
 	}
 }
 
+// Close 实现 io.Closer，和Shutdown一样，可以重复调用，总是返回nil
+func (l *Ws) Close() error {
+	l.Shutdown()
+	return nil
+}
+
 func (l *Ws) Send(conn *TcpConn, v btmsg.IMsg) {
 	l.lock.RLock()
 	if l.stop != 0 {
@@ -119,11 +132,11 @@ func (l *Ws) SendById(id uint64, v btmsg.IMsg) {
 }
 
 func (l *Ws) OnReceive(f ServerReceiveCallback) {
-	l.receiveCallback = f
+	l.receiveCallback.Store(&f)
 }
 
 func (l *Ws) OnClose(f ServerCloseCallback) {
-	l.closeCallback = f
+	l.closeCallback.Store(&f)
 }
 
 func (l *Ws) listen() (err error) {
@@ -210,8 +223,8 @@ func (l *Ws) ConsumeInput(conn *TcpConn, wsConn *websocket.Conn) {
 }
 
 func (l *Ws) handelReceive(conn *TcpConn, bt btmsg.IMsg) {
-	if l.receiveCallback != nil {
-		l.receiveCallback(l, conn, bt)
+	if f := *l.receiveCallback.Load(); f != nil {
+		f(l, conn, bt)
 	}
 }
 
@@ -270,7 +283,11 @@ func (l *Ws) LoopRead(conn *TcpConn) {
 	}
 }
 
+// Broadcast 和tcp一样，发送的是调用时bt的拷贝
 func (l *Ws) Broadcast(bt btmsg.IMsg) {
+	bt = bt.Clone()
+	bt.ToSendByte()
+
 	l.conns.Range(func(key, value any) bool {
 		v, ok := value.(*TcpConn)
 		if !ok {
@@ -287,8 +304,8 @@ func (l *Ws) removeConn(id uint64) {
 
 func (l *Ws) handelReadClose(conn *TcpConn, isServer bool, isClient bool) {
 	close(conn.WaitConn)
-	if l.closeCallback != nil {
-		l.closeCallback(l, conn, isServer, isClient)
+	if f := *l.closeCallback.Load(); f != nil {
+		f(l, conn, isServer, isClient)
 	}
 }
 
@@ -318,10 +335,10 @@ func (l *Ws) writeSend(conn *TcpConn, msg btmsg.IMsg, wsConn *websocket.Conn) {
 		return
 	}
 
-	log.Print("input id", id, "msg", msg.GetAct(), string(msg.BodyByte()))
+	log.Print("input id", id, "msg", btmsg.ActName(msg.GetAct()), string(msg.BodyByte()))
 }
 
-func (l *Ws) Close(conn *TcpConn) {
+func (l *Ws) CloseConn(conn *TcpConn) {
 	l.lock.RLock()
 	defer l.lock.RUnlock()
 
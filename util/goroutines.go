@@ -0,0 +1,55 @@
+package util
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NamedGoroutine MyGoWg启动并且还没有结束的goroutine
+type NamedGoroutine struct {
+	// ID 启动的顺序，同名的goroutine用它区分
+	ID        uint64
+	Name      string
+	StartedAt time.Time
+}
+
+var goroutines = struct {
+	lastId uint64
+	lock   sync.Mutex
+	items  map[uint64]NamedGoroutine
+}{
+	items: map[uint64]NamedGoroutine{},
+}
+
+// trackGoroutine 登记一个goroutine，返回的函数在goroutine结束时调用
+func trackGoroutine(name string) (done func()) {
+	id := atomic.AddUint64(&goroutines.lastId, 1)
+	info := NamedGoroutine{ID: id, Name: name, StartedAt: time.Now()}
+
+	goroutines.lock.Lock()
+	goroutines.items[id] = info
+	goroutines.lock.Unlock()
+
+	return func() {
+		goroutines.lock.Lock()
+		delete(goroutines.items, id)
+		goroutines.lock.Unlock()
+	}
+}
+
+// GoroutineSnapshot 所有还在运行的MyGoWg goroutine，按启动顺序排列
+func GoroutineSnapshot() []NamedGoroutine {
+	goroutines.lock.Lock()
+	var res = make([]NamedGoroutine, 0, len(goroutines.items))
+	for _, v := range goroutines.items {
+		res = append(res, v)
+	}
+	goroutines.lock.Unlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
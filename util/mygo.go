@@ -1,34 +1,69 @@
 package util
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 )
 
+// PanicHandler name是MyGoWg的name，stack是panic时的调用栈
+type PanicHandler func(name string, recovered any, stack []byte)
+
+var panicHook atomic.Value
+
+// SetPanicHook MyGoWg启动的goroutine panic时调用，nil表示只打印日志
+func SetPanicHook(f PanicHandler) {
+	panicHook.Store(f)
+}
+
+// MyGoWg 运行期间可以在 GoroutineSnapshot 里看到，panic会被recover并交给 SetPanicHook 设置的hook，goroutine结束，wg只Done一次
 func MyGoWg(wg *sync.WaitGroup, name string, f func()) {
+	MyGoWgRecover(wg, name, f, nil)
+}
+
+// MyGoWgRecover 和MyGoWg一样，panic时调用onPanic，onPanic为nil时用全局的hook
+func MyGoWgRecover(wg *sync.WaitGroup, name string, f func(), onPanic PanicHandler) {
 	wg.Add(1)
+	untrack := trackGoroutine(name)
 
 	go func() {
+		defer wg.Done()
+		defer untrack()
 		defer func() {
 			if err := recover(); err != nil {
-				log.Print(fmt.Sprintf("goroutine %s %s", name, err))
-
-				MyGoWg(wg, name, f)
-
-				wg.Done()
+				handlePanic(name, err, debug.Stack(), onPanic)
 				return
 			}
 
 			fmt.Printf("goroutine %s defer\n", name)
-
-			wg.Done()
 		}()
 
 		f()
 	}()
 }
 
+// MyGoWgCtx f通过ctx知道什么时候退出，其他和MyGoWg一样
+func MyGoWgCtx(ctx context.Context, wg *sync.WaitGroup, name string, f func(ctx context.Context)) {
+	MyGoWg(wg, name, func() {
+		f(ctx)
+	})
+}
+
+func handlePanic(name string, v any, stack []byte, onPanic PanicHandler) {
+	if onPanic == nil {
+		onPanic, _ = panicHook.Load().(PanicHandler)
+	}
+	if onPanic == nil {
+		log.Print(fmt.Sprintf("goroutine %s %s\n%s", name, v, stack))
+		return
+	}
+
+	onPanic(name, v, stack)
+}
+
 func myGo(name string, f func()) {
 	go func() {
 		defer func() {
@@ -0,0 +1,65 @@
+package util
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func waitTimeout(t *testing.T, wg *sync.WaitGroup) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("wait timeout")
+	}
+}
+
+func TestMyGoWgPanic(t *testing.T) {
+	var got = make(chan string, 4)
+	SetPanicHook(func(name string, recovered any, stack []byte) {
+		if len(stack) == 0 {
+			t.Error("expect stack")
+		}
+		got <- name + ":" + recovered.(string)
+	})
+	defer SetPanicHook(nil)
+
+	var wg sync.WaitGroup
+	var runs int
+	MyGoWg(&wg, "global", func() {
+		runs++
+		panic("boom")
+	})
+	MyGoWgRecover(&wg, "local", func() {
+		panic("bang")
+	}, func(name string, recovered any, stack []byte) {
+		got <- "own " + name
+	})
+	MyGoWg(&wg, "ok", func() {})
+
+	// panic之后不重启，Done只调用一次，Wait能返回
+	waitTimeout(t, &wg)
+	close(got)
+
+	var seen = map[string]bool{}
+	for v := range got {
+		seen[v] = true
+	}
+	if len(seen) != 2 || !seen["global:boom"] || !seen["own local"] || runs != 1 {
+		t.Fatalf("seen %v runs %d", seen, runs)
+	}
+}
+
+func TestMyGoWgNoHook(t *testing.T) {
+	var wg sync.WaitGroup
+	MyGoWg(&wg, "log only", func() {
+		panic("boom")
+	})
+	waitTimeout(t, &wg)
+}
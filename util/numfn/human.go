@@ -0,0 +1,77 @@
+package numfn
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var byteUnits = []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// HumanDuration 给日志看的时长，保留3位有效数字，比如 1.23ms，1分钟以上按 time.Duration 的格式，秒以下截掉
+func HumanDuration(d time.Duration) string {
+	if d < 0 {
+		// 取反可能溢出，转成uint64
+		return "-" + humanDuration(uint64(-(d+1))+1)
+	}
+	return humanDuration(uint64(d))
+}
+
+func humanDuration(n uint64) string {
+	switch {
+	case n == 0:
+		return "0s"
+	case n < uint64(time.Microsecond):
+		return strconv.FormatUint(n, 10) + "ns"
+	case n < uint64(time.Millisecond):
+		return humanFloat(float64(n)/float64(time.Microsecond)) + "µs"
+	case n < uint64(time.Second):
+		return humanFloat(float64(n)/float64(time.Millisecond)) + "ms"
+	case n < uint64(time.Minute):
+		return humanFloat(float64(n)/float64(time.Second)) + "s"
+	}
+	// MinInt64取反之后超出Duration的范围，只差1ns，截断到秒之后一样
+	if n > math.MaxInt64 {
+		n = math.MaxInt64
+	}
+	return time.Duration(n).Truncate(time.Second).String()
+}
+
+// HumanBytes 给日志看的字节数，1024进制，保留3位有效数字，比如 1.5KiB
+func HumanBytes(n int64) string {
+	if n < 0 {
+		return "-" + humanBytes(uint64(-(n+1))+1)
+	}
+	return humanBytes(uint64(n))
+}
+
+func humanBytes(n uint64) string {
+	if n < 1024 {
+		return strconv.FormatUint(n, 10) + "B"
+	}
+
+	v := float64(n) / 1024
+	unit := 0
+	for v >= 1024 && unit < len(byteUnits)-1 {
+		v /= 1024
+		unit++
+	}
+	return humanFloat(v) + byteUnits[unit]
+}
+
+// humanFloat 保留3位有效数字，去掉末尾的0
+func humanFloat(v float64) string {
+	prec := 0
+	if v < 10 {
+		prec = 2
+	} else if v < 100 {
+		prec = 1
+	}
+
+	s := strconv.FormatFloat(v, 'f', prec, 64)
+	if prec > 0 {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
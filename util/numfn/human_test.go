@@ -0,0 +1,57 @@
+package numfn
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHumanDuration(t *testing.T) {
+	var cases = []struct {
+		d      time.Duration
+		expect string
+	}{
+		{0, "0s"},
+		{999, "999ns"},
+		{time.Microsecond, "1µs"},
+		{1234, "1.23µs"},
+		{time.Millisecond * 12345 / 1000, "12.3ms"},
+		{time.Millisecond * 999, "999ms"},
+		{time.Millisecond * 1500, "1.5s"},
+		{time.Second * 59, "59s"},
+		{time.Minute + time.Millisecond*1500, "1m1s"},
+		{-time.Millisecond * 3, "-3ms"},
+		{math.MaxInt64, "2562047h47m16s"},
+		{math.MinInt64, "-2562047h47m16s"},
+	}
+
+	for _, c := range cases {
+		if got := HumanDuration(c.d); got != c.expect {
+			t.Errorf("%d: got %s, expect %s", int64(c.d), got, c.expect)
+		}
+	}
+}
+
+func TestHumanBytes(t *testing.T) {
+	var cases = []struct {
+		n      int64
+		expect string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1024, "1KiB"},
+		{1536, "1.5KiB"},
+		{1024*1024 - 1, "1024KiB"},
+		{100 << 20, "100MiB"},
+		{5 << 30, "5GiB"},
+		{-2048, "-2KiB"},
+		{math.MaxInt64, "8EiB"},
+		{math.MinInt64, "-8EiB"},
+	}
+
+	for _, c := range cases {
+		if got := HumanBytes(c.n); got != c.expect {
+			t.Errorf("%d: got %s, expect %s", c.n, got, c.expect)
+		}
+	}
+}
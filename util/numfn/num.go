@@ -1,15 +1,113 @@
 package numfn
 
 import (
-	"fmt"
-	"github.com/winkb/tcp1/util/types"
+	"math"
 	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"github.com/winkb/tcp1/util/types"
+)
+
+var (
+	// ErrSyntax 字符串不是T能表示的数字，比如 Parse[uint8]("-1")
+	ErrSyntax = errors.New("invalid number syntax")
+	// ErrOverflow 是数字但超出了T的范围
+	ErrOverflow = errors.New("number out of range")
 )
 
+// ToStr 整数按10进制，浮点数用能还原成原值的最短写法，很大或者很小时用科学计数法
 func ToStr[T types.Number](v T) string {
-	if float64(int(v)) != float64(v) {
-		return fmt.Sprintf("%v", v)
+	if isFloat[T]() {
+		f := float64(v)
+		if abs := math.Abs(f); abs == 0 || (abs >= 1e-6 && abs < 1e21) {
+			return strconv.FormatFloat(f, 'f', -1, bitSize[T]())
+		}
+		return strconv.FormatFloat(f, 'g', -1, bitSize[T]())
+	}
+
+	if v < 0 {
+		return strconv.FormatInt(int64(v), 10)
+	}
+	return strconv.FormatUint(uint64(v), 10)
+}
+
+// FormatInt 按base输出，base在2到36之间
+func FormatInt[T types.NumInt](v T, base int) string {
+	if v < 0 {
+		return strconv.FormatInt(int64(v), base)
+	}
+	return strconv.FormatUint(uint64(v), base)
+}
+
+// ZeroPad 10进制，不足width位时前面补0，负号不算在位数里
+func ZeroPad[T types.NumInt](v T, width int) string {
+	s := FormatInt(v, 10)
+	sign := ""
+	if v < 0 {
+		sign, s = "-", s[1:]
+	}
+
+	if len(s) < width {
+		s = strings.Repeat("0", width-len(s)) + s
+	}
+	return sign + s
+}
+
+// Parse 把s解析成T，整数只接受10进制，格式不对返回 ErrSyntax，超出范围返回 ErrOverflow
+func Parse[T types.Number](s string) (T, error) {
+	if isFloat[T]() {
+		f, err := strconv.ParseFloat(s, bitSize[T]())
+		if err != nil {
+			return 0, parseErr[T](s, err)
+		}
+		return T(f), nil
+	}
+
+	return parseInt[T](s, 10)
+}
+
+// ParseBase 按base解析整数，base为0时按前缀判断，比如0x
+func ParseBase[T types.NumInt](s string, base int) (T, error) {
+	return parseInt[T](s, base)
+}
+
+func parseInt[T types.Number](s string, base int) (T, error) {
+	if isSigned[T]() {
+		i, err := strconv.ParseInt(s, base, bitSize[T]())
+		if err != nil {
+			return 0, parseErr[T](s, err)
+		}
+		return T(i), nil
+	}
+
+	u, err := strconv.ParseUint(s, base, bitSize[T]())
+	if err != nil {
+		return 0, parseErr[T](s, err)
 	}
+	return T(u), nil
+}
+
+func parseErr[T types.Number](s string, err error) error {
+	var zero T
+	if errors.Is(err, strconv.ErrRange) {
+		return errors.Wrapf(ErrOverflow, "parse %q as %T", s, zero)
+	}
+	return errors.Wrapf(ErrSyntax, "parse %q as %T", s, zero)
+}
+
+func isFloat[T types.Number]() bool {
+	var one T = 1
+	return one/2 != 0
+}
+
+func isSigned[T types.Number]() bool {
+	var zero T
+	return zero-1 < zero
+}
 
-	return strconv.Itoa(int(v))
+func bitSize[T types.Number]() int {
+	var zero T
+	return int(unsafe.Sizeof(zero)) * 8
 }
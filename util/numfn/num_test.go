@@ -1,12 +1,107 @@
 package numfn
 
 import (
+	"errors"
+	"math"
 	"testing"
 )
 
 func TestToStr(t *testing.T) {
-	var s = ToStr(1)
-	t.Logf("%T", s)
-	t.Log(s)
-	t.Log(ToStr(1.1))
+	var cases = []struct {
+		got    string
+		expect string
+	}{
+		{ToStr(1), "1"},
+		{ToStr(int8(math.MinInt8)), "-128"},
+		{ToStr(uint8(math.MaxUint8)), "255"},
+		{ToStr(int64(math.MaxInt64)), "9223372036854775807"},
+		{ToStr(int64(math.MinInt64)), "-9223372036854775808"},
+		{ToStr(uint64(math.MaxUint64)), "18446744073709551615"},
+		{ToStr(uint(7)), "7"},
+		{ToStr(1.1), "1.1"},
+		{ToStr(float32(0.1)), "0.1"},
+		{ToStr(1e6), "1000000"},
+		{ToStr(1e21), "1e+21"},
+		{ToStr(1e-7), "1e-07"},
+		{ToStr(math.Copysign(0, -1)), "-0"},
+		{ToStr(math.Inf(-1)), "-Inf"},
+		{ToStr(math.NaN()), "NaN"},
+	}
+
+	for i, c := range cases {
+		if c.got != c.expect {
+			t.Errorf("case %d: got %s, expect %s", i, c.got, c.expect)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	if s := FormatInt(255, 16); s != "ff" {
+		t.Fatal(s)
+	}
+	if s := FormatInt(int8(-8), 2); s != "-1000" {
+		t.Fatal(s)
+	}
+	if s := FormatInt(uint64(math.MaxUint64), 36); s != "3w5e11264sgsf" {
+		t.Fatal(s)
+	}
+	if s := ZeroPad(7, 3); s != "007" {
+		t.Fatal(s)
+	}
+	if s := ZeroPad(-7, 3); s != "-007" {
+		t.Fatal(s)
+	}
+	if s := ZeroPad(12345, 3); s != "12345" {
+		t.Fatal(s)
+	}
+}
+
+func TestParse(t *testing.T) {
+	if v, err := Parse[int64]("9223372036854775807"); err != nil || v != math.MaxInt64 {
+		t.Fatalf("%d %v", v, err)
+	}
+	if v, err := Parse[uint64]("18446744073709551615"); err != nil || v != math.MaxUint64 {
+		t.Fatalf("%d %v", v, err)
+	}
+	if v, err := Parse[int8]("-128"); err != nil || v != math.MinInt8 {
+		t.Fatalf("%d %v", v, err)
+	}
+	if v, err := Parse[float64]("-0"); err != nil || v != 0 || !math.Signbit(v) {
+		t.Fatalf("%v %v", v, err)
+	}
+	if v, err := Parse[float32]("0.1"); err != nil || v != float32(0.1) {
+		t.Fatalf("%v %v", v, err)
+	}
+	if v, err := ParseBase[uint16]("0xffff", 0); err != nil || v != math.MaxUint16 {
+		t.Fatalf("%d %v", v, err)
+	}
+
+	var overflow = []func() error{
+		func() error { _, err := Parse[int8]("128"); return err },
+		func() error { _, err := Parse[uint8]("256"); return err },
+		func() error { _, err := Parse[int64]("9223372036854775808"); return err },
+		func() error { _, err := Parse[float32]("1e39"); return err },
+	}
+	for i, f := range overflow {
+		if err := f(); !errors.Is(err, ErrOverflow) {
+			t.Errorf("overflow %d: %v", i, err)
+		}
+	}
+
+	var syntax = []func() error{
+		func() error { _, err := Parse[int]("abc"); return err },
+		func() error { _, err := Parse[int]("1.5"); return err },
+		func() error { _, err := Parse[uint8]("-1"); return err },
+		func() error { _, err := Parse[float64](""); return err },
+	}
+	for i, f := range syntax {
+		if err := f(); !errors.Is(err, ErrSyntax) {
+			t.Errorf("syntax %d: %v", i, err)
+		}
+	}
+
+	// 出错时返回0
+	if v, _ := Parse[int8]("128"); v != 0 {
+		t.Fatal(v)
+	}
 }
@@ -1,11 +1,12 @@
 package strfn
 
 import (
+	"github.com/winkb/tcp1/util/numfn"
 	"github.com/winkb/tcp1/util/types"
-	"strconv"
 )
 
+// ToInt 解析失败时返回0，需要区分错误用 numfn.Parse
 func ToInt[T types.Number](v string) T {
-	i, _ := strconv.Atoi(v)
-	return T(i)
+	i, _ := numfn.Parse[T](v)
+	return i
 }
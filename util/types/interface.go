@@ -1,7 +1,7 @@
 package types
 
 type NumInt interface {
-	int | int8 | uint8 | int16 | uint16 | int32 | uint32 | int64 | uint64
+	int | uint | int8 | uint8 | int16 | uint16 | int32 | uint32 | int64 | uint64
 }
 
 type NumFloat interface {